@@ -0,0 +1,71 @@
+// Package callsummary exports summaries of the calls made by each
+// package's functions as facts, so that call graphs spanning a
+// package and its dependencies can be built incrementally, without
+// having the IR of all packages at hand.
+package callsummary
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"honnef.co/go/tools/go/ir/irutil/callgraph"
+	"honnef.co/go/tools/internal/passes/buildir"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+type summaryFact struct {
+	Summary *callgraph.Summary
+}
+
+func (*summaryFact) AFact() {}
+func (fact *summaryFact) String() string {
+	calls := 0
+	for _, fn := range fact.Summary.Funcs {
+		calls += len(fn.Calls)
+	}
+	return fmt.Sprintf("%d functions, %d calls, %d runtime types", len(fact.Summary.Funcs), calls, len(fact.Summary.Types))
+}
+
+// Result holds the summaries of a package and of all of its
+// dependencies.
+type Result struct {
+	// The summary of the package itself is first, followed by
+	// those of its dependencies, sorted by package path.
+	Summaries []*callgraph.Summary
+}
+
+// Graph links the summaries into a call graph. See callgraph.Link.
+func (r *Result) Graph(roots []string) *callgraph.SummaryGraph {
+	return callgraph.Link(r.Summaries, roots)
+}
+
+var Analysis = &analysis.Analyzer{
+	Name:       "callsummary",
+	Doc:        "Summarizes the calls made by functions, for building call graphs",
+	Run:        run,
+	Requires:   []*analysis.Analyzer{buildir.Analyzer},
+	FactTypes:  []analysis.Fact{(*summaryFact)(nil)},
+	ResultType: reflect.TypeOf((*Result)(nil)),
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	s := callgraph.Summarize(pass.ResultOf[buildir.Analyzer].(*buildir.IR).Pkg)
+	pass.ExportPackageFact(&summaryFact{s})
+
+	facts := pass.AllPackageFacts()
+	sort.Slice(facts, func(i, j int) bool {
+		return facts[i].Package.Path() < facts[j].Package.Path()
+	})
+	res := &Result{Summaries: []*callgraph.Summary{s}}
+	for _, fact := range facts {
+		if fact.Package == pass.Pkg {
+			continue
+		}
+		if fact, ok := fact.Fact.(*summaryFact); ok {
+			res.Summaries = append(res.Summaries, fact.Summary)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,11 @@
+package callsummary
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestCallSummary(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analysis, "CallSummary")
+}
@@ -0,0 +1,17 @@
+package pkg // want package:"6 functions, 2 calls, 1 runtime types"
+
+type T struct{}
+
+func (T) String() string { return "" }
+
+func fn1(f func()) {
+	f()
+}
+
+func fn2() {
+	fn1(func() {})
+}
+
+func fn3() interface{} {
+	return T{}
+}
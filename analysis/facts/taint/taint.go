@@ -0,0 +1,721 @@
+// Package taint tracks the flow of untrusted data from sources, such
+// as HTTP request parameters, to sinks, such as SQL queries, through
+// the functions of a package. Sources, sinks and sanitizers are
+// specified by the taint table of the configuration.
+//
+// Functions are summarized by which of their parameters flow into
+// their results, which of their results carry data from sources, and
+// which of their parameters flow into sinks. Summaries are exported as
+// facts, so that flows can be followed across package boundaries.
+//
+// The free variables of closures are treated like additional
+// parameters that follow the closure's parameters, so that data
+// captured by a closure can be followed into the closure.
+//
+// Calls of functions without summaries, such as dynamic calls and
+// calls of interface methods, are assumed to pass all of their
+// arguments to all of their results and to the memory that their
+// arguments point to. Data stored in global variables isn't tracked.
+package taint
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+
+	"honnef.co/go/tools/config"
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/types/typeutil"
+	"honnef.co/go/tools/internal/passes/buildir"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// maxParams is the number of parameters that we track per function.
+const maxParams = 64
+
+type summaryFact struct {
+	// Results holds, for each result, the set of parameters that
+	// flow into it.
+	Results []uint64
+	// Sources holds, for each result, the source that it returns data
+	// from, if any.
+	Sources []string
+	// Params holds, for each parameter and free variable, the set of
+	// other parameters that flow into the memory that it points to.
+	Params []uint64
+	// ParamSources holds, for each parameter and free variable, the
+	// source that data stored in the memory that it points to comes
+	// from, if any.
+	ParamSources []string
+	// Sinks holds, for each parameter and free variable, the sink
+	// that it flows into, if any.
+	Sinks []string
+}
+
+func (*summaryFact) AFact() {}
+func (fact *summaryFact) String() string {
+	var parts []string
+	for i, params := range fact.Results {
+		if params != 0 {
+			parts = append(parts, fmt.Sprintf("r%d <- %s", i, paramList(params)))
+		}
+		if fact.Sources[i] != "" {
+			parts = append(parts, fmt.Sprintf("r%d <- %s", i, fact.Sources[i]))
+		}
+	}
+	for i, params := range fact.Params {
+		if params != 0 {
+			parts = append(parts, fmt.Sprintf("*p%d <- %s", i, paramList(params)))
+		}
+		if fact.ParamSources[i] != "" {
+			parts = append(parts, fmt.Sprintf("*p%d <- %s", i, fact.ParamSources[i]))
+		}
+	}
+	for i, sink := range fact.Sinks {
+		if sink != "" {
+			parts = append(parts, fmt.Sprintf("p%d -> %s", i, sink))
+		}
+	}
+	if len(parts) == 0 {
+		return "taint: clean"
+	}
+	return "taint: " + strings.Join(parts, "; ")
+}
+
+func paramList(params uint64) string {
+	var ps []string
+	for i := 0; i < maxParams; i++ {
+		if params&(1<<i) != 0 {
+			ps = append(ps, fmt.Sprintf("p%d", i))
+		}
+	}
+	return strings.Join(ps, ", ")
+}
+
+// A Step is a step in the flow of untrusted data.
+type Step struct {
+	Instr   ir.Instruction
+	Message string
+}
+
+// A Flow describes untrusted data flowing into a sink.
+type Flow struct {
+	// The call that passes untrusted data to a sink, either directly
+	// or via a function that passes it on.
+	Call ir.CallInstruction
+	// The index of the argument in the call's arguments. For calls of
+	// methods, the receiver is not counted. It is -1 if the data
+	// reaches the sink via a variable captured by a closure.
+	Arg    int
+	Source string
+	Sink   string
+	// The steps the data took from the source to the call.
+	Path []Step
+}
+
+type Result struct {
+	Flows []Flow
+}
+
+var Analysis = &analysis.Analyzer{
+	Name:       "taint",
+	Doc:        "Tracks the flow of untrusted data",
+	Run:        run,
+	Requires:   []*analysis.Analyzer{buildir.Analyzer, config.Analyzer},
+	FactTypes:  []analysis.Fact{(*summaryFact)(nil)},
+	ResultType: reflect.TypeOf((*Result)(nil)),
+}
+
+// A sink is a parameter of a function.
+type sink struct {
+	fn    string
+	param string
+}
+
+func (s sink) String() string {
+	return s.fn + "." + s.param
+}
+
+type analyzer struct {
+	pass       *analysis.Pass
+	pkg        *ir.Package
+	sources    map[string]bool
+	sanitizers map[string]bool
+	sinks      map[string][]string
+
+	summaries  map[*ir.Function]*summaryFact
+	inProgress map[*ir.Function]bool
+	flows      []Flow
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	cfg := config.For(pass).Taint
+	a := &analyzer{
+		pass:       pass,
+		pkg:        pass.ResultOf[buildir.Analyzer].(*buildir.IR).Pkg,
+		sources:    map[string]bool{},
+		sanitizers: map[string]bool{},
+		sinks:      map[string][]string{},
+		summaries:  map[*ir.Function]*summaryFact{},
+		inProgress: map[*ir.Function]bool{},
+	}
+	for _, name := range cfg.Sources {
+		a.sources[name] = true
+	}
+	for _, name := range cfg.Sanitizers {
+		a.sanitizers[name] = true
+	}
+	for _, name := range cfg.Sinks {
+		idx := strings.LastIndex(name, ".")
+		if idx == -1 {
+			continue
+		}
+		a.sinks[name[:idx]] = append(a.sinks[name[:idx]], name[idx+1:])
+	}
+
+	for _, fn := range pass.ResultOf[buildir.Analyzer].(*buildir.IR).SrcFuncs {
+		a.summary(fn)
+	}
+	sort.SliceStable(a.flows, func(i, j int) bool {
+		return a.flows[i].Call.Pos() < a.flows[j].Call.Pos()
+	})
+	return &Result{Flows: a.flows}, nil
+}
+
+// summary returns the summary of fn, or nil if fn's effects are
+// unknown.
+func (a *analyzer) summary(fn *ir.Function) *summaryFact {
+	if s, ok := a.summaries[fn]; ok {
+		return s
+	}
+	if fn.Pkg != a.pkg || fn.Blocks == nil {
+		if obj, ok := fn.Object().(*types.Func); ok {
+			s := new(summaryFact)
+			if a.pass.ImportObjectFact(obj, s) {
+				return s
+			}
+		}
+		return nil
+	}
+	if a.inProgress[fn] {
+		// Break recursion
+		return nil
+	}
+	a.inProgress[fn] = true
+	s := a.analyze(fn)
+	delete(a.inProgress, fn)
+	a.summaries[fn] = s
+	if obj, ok := fn.Object().(*types.Func); ok && fn.Synthetic == 0 && obj.Pkg() == a.pass.Pkg {
+		a.pass.ExportObjectFact(obj, s)
+	}
+	return s
+}
+
+// A step is a node in a linked list of steps that data took, with the
+// most recent step first.
+type step struct {
+	instr ir.Instruction
+	msg   string
+	// source is the name of the source, if this is the first step.
+	source string
+	prev   *step
+}
+
+func (s *step) origin() string {
+	for s.prev != nil {
+		s = s.prev
+	}
+	return s.source
+}
+
+func (s *step) path() []Step {
+	var out []Step
+	for ; s != nil; s = s.prev {
+		out = append(out, Step{Instr: s.instr, Message: s.msg})
+	}
+	for i := 0; i < len(out)/2; i++ {
+		out[i], out[len(out)-1-i] = out[len(out)-1-i], out[i]
+	}
+	return out
+}
+
+// taint describes where a value may have gotten its data from.
+type taint struct {
+	// params is the set of parameters of the current function.
+	params uint64
+	// src is the most recent step of data from a source.
+	src *step
+}
+
+func (t taint) union(o taint) taint {
+	t.params |= o.params
+	if t.src == nil {
+		t.src = o.src
+	}
+	return t
+}
+
+func (t taint) empty() bool {
+	return t.params == 0 && t.src == nil
+}
+
+// via returns t with an additional step.
+func (t taint) via(instr ir.Instruction, msg string) taint {
+	if t.src != nil {
+		t.src = &step{instr: instr, msg: msg, prev: t.src}
+	}
+	return t
+}
+
+// function holds the state of the analysis of a single function.
+type function struct {
+	*analyzer
+	fn      *ir.Function
+	values  map[ir.Value]taint
+	memory  map[ir.Value]taint
+	results []taint
+	// tuples holds the taints of the individual results of calls.
+	tuples     map[ir.Value][]taint
+	paramSinks []string
+	rootCache  map[ir.Value][]ir.Value
+	reported   map[ir.CallInstruction]map[int]bool
+	changed    bool
+}
+
+func (a *analyzer) analyze(fn *ir.Function) *summaryFact {
+	params := make([]ir.Value, 0, len(fn.Params)+len(fn.FreeVars))
+	for _, p := range fn.Params {
+		params = append(params, p)
+	}
+	for _, fv := range fn.FreeVars {
+		params = append(params, fv)
+	}
+	f := &function{
+		analyzer:   a,
+		fn:         fn,
+		values:     map[ir.Value]taint{},
+		memory:     map[ir.Value]taint{},
+		results:    make([]taint, fn.Signature.Results().Len()),
+		tuples:     map[ir.Value][]taint{},
+		paramSinks: make([]string, len(params)),
+		rootCache:  map[ir.Value][]ir.Value{},
+		reported:   map[ir.CallInstruction]map[int]bool{},
+	}
+	for i, p := range params {
+		if i < maxParams {
+			f.values[p] = taint{params: 1 << i}
+		}
+	}
+
+	// All transfer functions are monotone and the lattice is finite,
+	// so this terminates.
+	for f.changed = true; f.changed; {
+		f.changed = false
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				f.transfer(instr)
+			}
+		}
+	}
+
+	s := &summaryFact{
+		Results:      make([]uint64, len(f.results)),
+		Sources:      make([]string, len(f.results)),
+		Params:       make([]uint64, len(params)),
+		ParamSources: make([]string, len(params)),
+		Sinks:        f.paramSinks,
+	}
+	for i, r := range f.results {
+		s.Results[i] = r.params
+		if r.src != nil {
+			s.Sources[i] = r.src.origin()
+		}
+	}
+	for i, p := range params {
+		m := f.memory[p]
+		s.Params[i] = m.params &^ (1 << i)
+		if m.src != nil {
+			s.ParamSources[i] = m.src.origin()
+		}
+	}
+	return s
+}
+
+func (f *function) set(v ir.Value, t taint) {
+	old := f.values[v]
+	n := old.union(t)
+	if n.params != old.params || n.src != old.src {
+		f.values[v] = n
+		f.changed = true
+	}
+}
+
+func (f *function) setMemory(ptr ir.Value, t taint) {
+	if t.empty() {
+		return
+	}
+	for _, root := range f.roots(ptr) {
+		old := f.memory[root]
+		n := old.union(t)
+		if n.params != old.params || n.src != old.src {
+			f.memory[root] = n
+			f.changed = true
+		}
+	}
+}
+
+func (f *function) setResult(i int, t taint) {
+	old := f.results[i]
+	n := old.union(t)
+	if n.params != old.params || n.src != old.src {
+		f.results[i] = n
+		f.changed = true
+	}
+}
+
+// roots returns the values that v, a pointer or a value containing
+// pointers, may have been derived from. We don't distinguish between
+// the memory that a pointer points to directly and the memory
+// reachable through it.
+func (f *function) roots(v ir.Value) []ir.Value {
+	if rs, ok := f.rootCache[v]; ok {
+		return rs
+	}
+	var rs []ir.Value
+	seen := map[ir.Value]bool{}
+	var walk func(v ir.Value)
+	walk = func(v ir.Value) {
+		if seen[v] {
+			return
+		}
+		seen[v] = true
+		switch x := v.(type) {
+		case *ir.Load:
+			walk(x.X)
+		case *ir.FieldAddr:
+			walk(x.X)
+		case *ir.IndexAddr:
+			walk(x.X)
+		case *ir.Slice:
+			walk(x.X)
+		case *ir.ChangeType:
+			walk(x.X)
+		case *ir.MakeInterface:
+			walk(x.X)
+		case *ir.Copy:
+			walk(x.X)
+		case *ir.Sigma:
+			walk(x.X)
+		case *ir.Phi:
+			for _, edge := range x.Edges {
+				walk(edge)
+			}
+		default:
+			rs = append(rs, v)
+		}
+	}
+	walk(v)
+	f.rootCache[v] = rs
+	return rs
+}
+
+// get returns the taint of v, including the taint of the memory it
+// refers to.
+func (f *function) get(v ir.Value) taint {
+	t := f.values[v]
+	for _, root := range f.roots(v) {
+		t = t.union(f.memory[root])
+	}
+	return t
+}
+
+func (f *function) transfer(instr ir.Instruction) {
+	switch instr := instr.(type) {
+	case *ir.Store:
+		f.setMemory(instr.Addr, f.get(instr.Val))
+	case *ir.MapUpdate:
+		f.setMemory(instr.Map, f.get(instr.Key).union(f.get(instr.Value)))
+	case *ir.Send:
+		f.setMemory(instr.Chan, f.get(instr.X))
+	case *ir.Return:
+		for i, r := range instr.Results {
+			f.setResult(i, f.get(r))
+		}
+	case ir.CallInstruction:
+		f.call(instr)
+	case *ir.BinOp:
+		switch instr.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			// Comparisons don't carry data
+		default:
+			t := f.get(instr.X).union(f.get(instr.Y))
+			if basic, ok := instr.Type().Underlying().(*types.Basic); ok && basic.Info()&types.IsString != 0 {
+				// Chains of concatenations, such as a + b + c, are
+				// a single step.
+				if t.src == nil || t.src.msg != msgConcat {
+					t = t.via(instr, msgConcat)
+				}
+			}
+			f.set(instr, t)
+		}
+	case *ir.Extract:
+		if ts, ok := f.tuples[instr.Tuple]; ok {
+			f.set(instr, ts[instr.Index])
+		} else {
+			f.set(instr, f.get(instr.Tuple))
+		}
+	case *ir.Alloc, *ir.Const, *ir.Parameter, *ir.DebugRef:
+	case ir.Value:
+		// All other values get their data from their operands
+		var t taint
+		for _, op := range instr.Operands(nil) {
+			if *op != nil {
+				t = t.union(f.get(*op))
+			}
+		}
+		f.set(instr, t)
+	}
+}
+
+const msgConcat = "string concatenation"
+
+// funcName returns the name of the function called by common, or the
+// empty string.
+func funcName(common *ir.CallCommon) (string, *types.Signature) {
+	if common.IsInvoke() {
+		return typeutil.FuncName(common.Method), common.Method.Type().(*types.Signature)
+	}
+	if callee := common.StaticCallee(); callee != nil {
+		if obj, ok := callee.Object().(*types.Func); ok {
+			return typeutil.FuncName(obj), obj.Type().(*types.Signature)
+		}
+	}
+	return "", nil
+}
+
+func (f *function) call(instr ir.CallInstruction) {
+	common := instr.Common()
+	name, sig := funcName(common)
+
+	// The arguments, including the receiver of invoked methods
+	args := common.Args
+	// The offset of the first parameter in args
+	off := 0
+	if common.IsInvoke() {
+		args = append([]ir.Value{common.Value}, args...)
+		off = 1
+	} else if sig != nil && sig.Recv() != nil {
+		off = 1
+	}
+	// The number of arguments that correspond to parameters. Calls of
+	// closures additionally pass the closure's bindings, for its free
+	// variables.
+	nparams := len(args)
+	if mc, ok := common.Value.(*ir.MakeClosure); ok {
+		args = append(args[:len(args):len(args)], mc.Bindings...)
+	}
+	argTaints := make([]taint, len(args))
+	for i, arg := range args {
+		argTaints[i] = f.get(arg)
+	}
+
+	// Check the sinks that we call directly
+	isSink := false
+	for _, param := range f.sinks[name] {
+		for i := 0; i < sig.Params().Len(); i++ {
+			if sig.Params().At(i).Name() == param && off+i < len(args) {
+				isSink = true
+				f.sink(instr, i, argTaints[off+i], sink{name, param}.String(), "")
+			}
+		}
+	}
+
+	var callee *ir.Function
+	if !common.IsInvoke() {
+		callee = common.StaticCallee()
+	}
+	var sum *summaryFact
+	if callee != nil {
+		sum = f.summary(callee)
+	}
+	// Check the sinks that we call indirectly
+	if sum != nil && !isSink {
+		for i, sink := range sum.Sinks {
+			if sink != "" && i < len(args) {
+				param := i - off
+				if i >= nparams {
+					param = -1
+				}
+				f.sink(instr, param, argTaints[i], sink, name)
+			}
+		}
+	}
+
+	v := instr.Value()
+	if v == nil {
+		// go and defer
+		if sum == nil {
+			f.conservativeCall(instr, args, argTaints, name)
+		} else {
+			f.applyParams(instr, args, argTaints, sum, name)
+		}
+		return
+	}
+	nresults := 1
+	if tuple, ok := v.Type().(*types.Tuple); ok {
+		nresults = tuple.Len()
+	}
+	results := make([]taint, nresults)
+
+	switch {
+	case f.sanitizers[name]:
+		// Sanitizers return trusted data
+	case f.sources[name]:
+		for i := range results {
+			results[i].src = &step{instr: instr, msg: "source: " + name, source: name}
+		}
+	case isBuiltin(common, "append"):
+		for _, t := range argTaints {
+			results[0] = results[0].union(t)
+		}
+	case isBuiltin(common, "copy"):
+		f.setMemory(args[0], argTaints[1])
+	case isBuiltinValue(common):
+		// Other builtins, such as len, don't return data
+	case sum == nil:
+		t := f.conservativeCall(instr, args, argTaints, name)
+		for i := range results {
+			results[i] = t
+		}
+	default:
+		f.applyParams(instr, args, argTaints, sum, name)
+		for i := range results {
+			for j, t := range argTaints {
+				if j < maxParams && sum.Results[i]&(1<<j) != 0 {
+					results[i] = results[i].union(t.via(instr, "flows through "+displayName(name)))
+				}
+			}
+		}
+		addSources(instr, results, sum)
+	}
+
+	if nresults > 1 {
+		old := f.tuples[v]
+		if old == nil {
+			old = make([]taint, nresults)
+			f.tuples[v] = old
+		}
+		for i, t := range results {
+			n := old[i].union(t)
+			if n.params != old[i].params || n.src != old[i].src {
+				old[i] = n
+				f.changed = true
+			}
+		}
+	}
+	var all taint
+	for _, t := range results {
+		all = all.union(t)
+	}
+	f.set(v, all)
+}
+
+// conservativeCall handles a call to a function with unknown effects.
+// All arguments flow into the results and into the memory that
+// arguments point to. It returns the taint of the results.
+func (f *function) conservativeCall(instr ir.CallInstruction, args []ir.Value, argTaints []taint, name string) taint {
+	var t taint
+	for _, at := range argTaints {
+		t = t.union(at)
+	}
+	t = t.via(instr, "flows through "+displayName(name))
+	for _, arg := range args {
+		if typeutil.IsPointerLike(arg.Type()) {
+			f.setMemory(arg, t)
+		}
+	}
+	return t
+}
+
+// applyParams applies the effects that a call has on the memory that
+// its arguments point to.
+func (f *function) applyParams(instr ir.CallInstruction, args []ir.Value, argTaints []taint, sum *summaryFact, name string) {
+	for i, params := range sum.Params {
+		if i >= len(args) {
+			break
+		}
+		var t taint
+		for j, at := range argTaints {
+			if j < maxParams && params&(1<<j) != 0 {
+				t = t.union(at)
+			}
+		}
+		t = t.via(instr, "flows through "+displayName(name))
+		if sum.ParamSources[i] != "" && t.src == nil {
+			t.src = &step{instr: instr, msg: "stores data from " + sum.ParamSources[i], source: sum.ParamSources[i]}
+		}
+		f.setMemory(args[i], t)
+	}
+}
+
+func addSources(instr ir.CallInstruction, results []taint, sum *summaryFact) {
+	for i := range results {
+		if i < len(sum.Sources) && sum.Sources[i] != "" && results[i].src == nil {
+			results[i].src = &step{instr: instr, msg: "returns data from " + sum.Sources[i], source: sum.Sources[i]}
+		}
+	}
+}
+
+func displayName(name string) string {
+	if name == "" {
+		return "function call"
+	}
+	return name
+}
+
+func isBuiltin(common *ir.CallCommon, name string) bool {
+	b, ok := common.Value.(*ir.Builtin)
+	return ok && b.Name() == name
+}
+
+func isBuiltinValue(common *ir.CallCommon) bool {
+	_, ok := common.Value.(*ir.Builtin)
+	return ok
+}
+
+// sink handles data with taint t flowing into a sink. param is the
+// index of the parameter, not counting the receiver. If via isn't
+// empty, the data reaches the sink via the function of that name.
+func (f *function) sink(instr ir.CallInstruction, param int, t taint, sinkName string, via string) {
+	for j := 0; j < maxParams && j < len(f.paramSinks); j++ {
+		if t.params&(1<<j) != 0 && f.paramSinks[j] == "" {
+			f.paramSinks[j] = sinkName
+			f.changed = true
+		}
+	}
+	if t.src == nil {
+		return
+	}
+	if f.reported[instr] == nil {
+		f.reported[instr] = map[int]bool{}
+	}
+	if f.reported[instr][param] {
+		return
+	}
+	f.reported[instr][param] = true
+	path := t.src.path()
+	if via != "" {
+		path = append(path, Step{Instr: instr, Message: fmt.Sprintf("passed to %s, which passes it to %s", via, sinkName)})
+	}
+	f.flows = append(f.flows, Flow{
+		Call:   instr,
+		Arg:    param,
+		Source: t.src.origin(),
+		Sink:   sinkName,
+		Path:   path,
+	})
+}
@@ -0,0 +1,32 @@
+package taint
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestTaint(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analysis, "Taint")
+}
+
+func TestPath(t *testing.T) {
+	results := analysistest.Run(t, analysistest.TestData(), Analysis, "TaintPath")
+	flows := results[0].Result.(*Result).Flows
+	if len(flows) != 1 {
+		t.Fatalf("got %d flows, want 1", len(flows))
+	}
+	var msgs []string
+	for _, step := range flows[0].Path {
+		msgs = append(msgs, step.Message)
+	}
+	want := []string{"source: (net/url.Values).Get", "string concatenation"}
+	if len(msgs) != len(want) {
+		t.Fatalf("got path %q, want %q", msgs, want)
+	}
+	for i := range want {
+		if msgs[i] != want[i] {
+			t.Fatalf("got path %q, want %q", msgs, want)
+		}
+	}
+}
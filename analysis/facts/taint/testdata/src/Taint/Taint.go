@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+func fn1(x string) string { // want fn1:`taint: r0 <- p0`
+	return "prefix" + x
+}
+
+func fn2(x, y string) string { // want fn2:`taint: r0 <- p1`
+	return fmt.Sprint(len(x)) + y
+}
+
+func fn3(r *http.Request) string { // want fn3:`taint: r0 <- \(\*net/http.Request\).FormValue`
+	return r.FormValue("name")
+}
+
+func fn4(name string) { // want fn4:`taint: p0 -> os.Open.name`
+	os.Open(name)
+}
+
+func fn5(name string) { // want fn5:`taint: p0 -> os.Open.name`
+	fn4(fn1(name))
+}
+
+func fn6(s string) int { // want fn6:`taint: clean`
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func fn7(s string) (string, error) { // want fn7:`taint: r0 <- p0`
+	return s, nil
+}
+
+func fn8(s string) []string { // want fn8:`taint: r0 <- p0`
+	var out []string
+	out = append(out, s)
+	return out
+}
+
+type T struct{ s string }
+
+func fn9(s string) string { // want fn9:`taint: r0 <- p0`
+	t := T{s: s}
+	return t.s
+}
+
+func fn10(t *T, s string) { // want fn10:`taint: \*p0 <- p1`
+	t.s = s
+}
+
+func fn11(n int) int { // want fn11:`taint: r0 <- p0`
+	if n == 0 {
+		return 0
+	}
+	return fn11(n-1) + n
+}
+
+func fn12(r *http.Request, t *T) { // want fn12:`taint: \*p1 <- \(\*net/http.Request\).FormValue`
+	t.s = r.FormValue("name")
+}
+
+func fn13(r *http.Request) string { // want fn13:`taint: r0 <- \(\*net/http.Request\).FormValue`
+	var t T
+	fn12(r, &t)
+	return t.s
+}
+
+func fn14(t *T) string { // want fn14:`taint: r0 <- p0`
+	return t.s
+}
+
+func fn15(s string) string { // want fn15:`taint: r0 <- p0`
+	return fmt.Sprintf("%s", s)
+}
+
+func fn16(name string) { // want fn16:`taint: p0 -> os.Open.name`
+	func() {
+		os.Open(name)
+	}()
+}
+
+func fn17(r *http.Request) string { // want fn17:`taint: r0 <- \(\*net/http.Request\).FormValue`
+	var s string
+	func() {
+		s = r.FormValue("name")
+	}()
+	return s
+}
@@ -0,0 +1,10 @@
+package pkg
+
+import (
+	"net/http"
+	"os"
+)
+
+func fn(r *http.Request) { // want fn:`taint: clean`
+	os.Open("/var/www/" + r.URL.Query().Get("file") + ".html")
+}
@@ -1,6 +1,7 @@
 package testutil
 
 import (
+	"context"
 	"crypto/sha256"
 	"go/build"
 	"io"
@@ -123,7 +124,7 @@ func Run(t *testing.T, analyzers []*lint.Analyzer, tests map[string][]Test) {
 		if len(dirs) == 0 {
 			t.Fatal("no directories for version", v)
 		}
-		res, err := r.Run(cfg, as, dirs)
+		res, err := r.Run(context.Background(), cfg, as, dirs)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -128,6 +128,15 @@ func (cfg Config) Merge(ocfg Config) Config {
 	if ocfg.HTTPStatusCodeWhitelist != nil {
 		cfg.HTTPStatusCodeWhitelist = mergeLists(cfg.HTTPStatusCodeWhitelist, ocfg.HTTPStatusCodeWhitelist)
 	}
+	if ocfg.Taint.Sources != nil {
+		cfg.Taint.Sources = mergeLists(cfg.Taint.Sources, ocfg.Taint.Sources)
+	}
+	if ocfg.Taint.Sinks != nil {
+		cfg.Taint.Sinks = mergeLists(cfg.Taint.Sinks, ocfg.Taint.Sinks)
+	}
+	if ocfg.Taint.Sanitizers != nil {
+		cfg.Taint.Sanitizers = mergeLists(cfg.Taint.Sanitizers, ocfg.Taint.Sanitizers)
+	}
 	return cfg
 }
 
@@ -143,6 +152,21 @@ type Config struct {
 	Initialisms             []string `toml:"initialisms"`
 	DotImportWhitelist      []string `toml:"dot_import_whitelist"`
 	HTTPStatusCodeWhitelist []string `toml:"http_status_code_whitelist"`
+	Taint                   Taint    `toml:"taint"`
+}
+
+// Taint configures the taint analysis. Functions are named the same
+// way as in the knowledge package: "fmt.Println" for functions,
+// "(*net/http.Request).FormValue" for methods, and
+// "os/exec.Command.name" for the parameter name of os/exec.Command.
+type Taint struct {
+	// Sources are functions whose results are untrusted.
+	Sources []string `toml:"sources"`
+	// Sinks are parameters that mustn't receive untrusted data.
+	Sinks []string `toml:"sinks"`
+	// Sanitizers are functions whose results are trusted, even if
+	// their arguments aren't.
+	Sanitizers []string `toml:"sanitizers"`
 }
 
 func (c Config) String() string {
@@ -151,7 +175,10 @@ func (c Config) String() string {
 	fmt.Fprintf(buf, "Checks: %#v\n", c.Checks)
 	fmt.Fprintf(buf, "Initialisms: %#v\n", c.Initialisms)
 	fmt.Fprintf(buf, "DotImportWhitelist: %#v\n", c.DotImportWhitelist)
-	fmt.Fprintf(buf, "HTTPStatusCodeWhitelist: %#v", c.HTTPStatusCodeWhitelist)
+	fmt.Fprintf(buf, "HTTPStatusCodeWhitelist: %#v\n", c.HTTPStatusCodeWhitelist)
+	fmt.Fprintf(buf, "Taint.Sources: %#v\n", c.Taint.Sources)
+	fmt.Fprintf(buf, "Taint.Sinks: %#v\n", c.Taint.Sinks)
+	fmt.Fprintf(buf, "Taint.Sanitizers: %#v", c.Taint.Sanitizers)
 
 	return buf.String()
 }
@@ -179,6 +206,56 @@ var DefaultConfig = Config{
 		"github.com/mmcloughlin/avo/reg",
 	},
 	HTTPStatusCodeWhitelist: []string{"200", "400", "404", "500"},
+	Taint: Taint{
+		Sources: []string{
+			"(*net/http.Request).FormValue",
+			"(*net/http.Request).PostFormValue",
+			"(*net/http.Request).Referer",
+			"(*net/http.Request).UserAgent",
+			"(net/http.Header).Get",
+			"(net/url.Values).Get",
+		},
+		Sinks: []string{
+			"(*database/sql.DB).Exec.query",
+			"(*database/sql.DB).ExecContext.query",
+			"(*database/sql.DB).Prepare.query",
+			"(*database/sql.DB).PrepareContext.query",
+			"(*database/sql.DB).Query.query",
+			"(*database/sql.DB).QueryContext.query",
+			"(*database/sql.DB).QueryRow.query",
+			"(*database/sql.DB).QueryRowContext.query",
+			"(*database/sql.Tx).Exec.query",
+			"(*database/sql.Tx).ExecContext.query",
+			"(*database/sql.Tx).Prepare.query",
+			"(*database/sql.Tx).PrepareContext.query",
+			"(*database/sql.Tx).Query.query",
+			"(*database/sql.Tx).QueryContext.query",
+			"(*database/sql.Tx).QueryRow.query",
+			"(*database/sql.Tx).QueryRowContext.query",
+			"os.Create.name",
+			"os.Open.name",
+			"os.OpenFile.name",
+			"os.ReadFile.name",
+			"os.Remove.name",
+			"os.RemoveAll.path",
+			"os.WriteFile.name",
+			"os/exec.Command.arg",
+			"os/exec.Command.name",
+			"os/exec.CommandContext.arg",
+			"os/exec.CommandContext.name",
+		},
+		Sanitizers: []string{
+			"net/url.PathEscape",
+			"net/url.QueryEscape",
+			"path.Base",
+			"path/filepath.Base",
+			"strconv.Atoi",
+			"strconv.ParseBool",
+			"strconv.ParseFloat",
+			"strconv.ParseInt",
+			"strconv.ParseUint",
+		},
+	},
 }
 
 const ConfigName = "staticcheck.conf"
@@ -188,18 +265,30 @@ type ParseError struct {
 	toml.ParseError
 }
 
-func parseConfigs(dir string) ([]Config, error) {
+func parseConfigs(dir string, stopAtModule bool) ([]Config, error) {
 	var out []Config
 
-	// TODO(dh): consider stopping at the GOPATH/module boundary
+	// next returns the directory to look in after dir, or the empty
+	// string once we've reached the root of the file system, or of a
+	// module if stopAtModule is set.
+	//
+	// TODO(dh): consider stopping at the GOPATH boundary
+	next := func(dir string) string {
+		if stopAtModule {
+			if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+				return ""
+			}
+		}
+		ndir := filepath.Dir(dir)
+		if ndir == dir {
+			return ""
+		}
+		return ndir
+	}
 	for dir != "" {
 		f, err := os.Open(filepath.Join(dir, ConfigName))
 		if os.IsNotExist(err) {
-			ndir := filepath.Dir(dir)
-			if ndir == dir {
-				break
-			}
-			dir = ndir
+			dir = next(dir)
 			continue
 		}
 		if err != nil {
@@ -218,11 +307,7 @@ func parseConfigs(dir string) ([]Config, error) {
 			return nil, err
 		}
 		out = append(out, cfg)
-		ndir := filepath.Dir(dir)
-		if ndir == dir {
-			break
-		}
-		dir = ndir
+		dir = next(dir)
 	}
 	out = append(out, DefaultConfig)
 	if len(out) < 2 {
@@ -250,8 +335,23 @@ func mergeConfigs(confs []Config) Config {
 	return conf
 }
 
+// Load loads the configuration that applies to the package in dir,
+// merging the configuration files in dir and all of its parent
+// directories.
 func Load(dir string) (Config, error) {
-	confs, err := parseConfigs(dir)
+	return load(dir, false)
+}
+
+// LoadModule is like Load, but ignores configuration files outside of
+// the module containing dir. It is used when checking several modules
+// at once, which are configured independently of the directories
+// containing them.
+func LoadModule(dir string) (Config, error) {
+	return load(dir, true)
+}
+
+func load(dir string, stopAtModule bool) (Config, error) {
+	confs, err := parseConfigs(dir, stopAtModule)
 	if err != nil {
 		return Config{}, err
 	}
@@ -261,6 +361,9 @@ func Load(dir string) (Config, error) {
 	conf.Initialisms = normalizeList(conf.Initialisms)
 	conf.DotImportWhitelist = normalizeList(conf.DotImportWhitelist)
 	conf.HTTPStatusCodeWhitelist = normalizeList(conf.HTTPStatusCodeWhitelist)
+	conf.Taint.Sources = normalizeList(conf.Taint.Sources)
+	conf.Taint.Sinks = normalizeList(conf.Taint.Sinks)
+	conf.Taint.Sanitizers = normalizeList(conf.Taint.Sanitizers)
 
 	return conf, nil
 }
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadModuleBoundary(t *testing.T) {
+	root := t.TempDir()
+	mod := filepath.Join(root, "mod")
+	pkg := filepath.Join(mod, "pkg")
+	if err := os.MkdirAll(pkg, 0777); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(root, ConfigName): `checks = ["SA1000"]`,
+		filepath.Join(mod, "go.mod"):    "module example.com/mod\n",
+		filepath.Join(pkg, ConfigName):  `initialisms = ["FOO"]`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := Load(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"SA1000"}; !reflect.DeepEqual(cfg.Checks, want) {
+		t.Errorf("Load: got checks %v, want %v", cfg.Checks, want)
+	}
+
+	cfg, err = LoadModule(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := DefaultConfig.Checks; !reflect.DeepEqual(cfg.Checks, want) {
+		t.Errorf("LoadModule: got checks %v, want %v", cfg.Checks, want)
+	}
+	if want := []string{"FOO"}; !reflect.DeepEqual(cfg.Initialisms, want) {
+		t.Errorf("LoadModule: got initialisms %v, want %v", cfg.Initialisms, want)
+	}
+}
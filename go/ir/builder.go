@@ -31,6 +31,7 @@ import (
 	"go/token"
 	"go/types"
 	"os"
+	"sort"
 
 	"honnef.co/go/tools/analysis/lint"
 	"honnef.co/go/tools/go/types/typeutil"
@@ -110,7 +111,7 @@ func (b *builder) logicalBinop(fn *Function, e *ast.BinaryExpr) Value {
 	// T(e) = T(e.X) = T(e.Y) after untyped constants have been
 	// eliminated.
 	// TODO(adonovan): not true; MyBool==MyBool yields UntypedBool.
-	t := fn.Pkg.typeOf(e)
+	t := fn.typeOf(e)
 
 	var short Value // value of the short-circuit path
 	switch e.Op {
@@ -163,7 +164,7 @@ func (b *builder) logicalBinop(fn *Function, e *ast.BinaryExpr) Value {
 // TypeAssertExpr, IndexExpr (when X is a map), and Recv.
 //
 func (b *builder) exprN(fn *Function, e ast.Expr) Value {
-	typ := fn.Pkg.typeOf(e).(*types.Tuple)
+	typ := fn.typeOf(e).(*types.Tuple)
 	switch e := e.(type) {
 	case *ast.ParenExpr:
 		return b.exprN(fn, e.X)
@@ -178,7 +179,7 @@ func (b *builder) exprN(fn *Function, e ast.Expr) Value {
 		return fn.emit(&c, e)
 
 	case *ast.IndexExpr:
-		mapt := typeutil.CoreType(fn.Pkg.typeOf(e.X)).Underlying().(*types.Map)
+		mapt := typeutil.CoreType(fn.typeOf(e.X)).Underlying().(*types.Map)
 		lookup := &MapLookup{
 			X:       b.expr(fn, e.X),
 			Index:   emitConv(fn, b.expr(fn, e.Index), mapt.Key(), e),
@@ -277,7 +278,7 @@ func (b *builder) builtin(fn *Function, obj *types.Builtin, args []ast.Expr, typ
 		//
 		// This never applies to type parameters. Even if the constraint has a structural type, len/cap on a type
 		// parameter aren't constant.
-		t := deref(fn.Pkg.typeOf(args[0])).Underlying()
+		t := deref(fn.typeOf(args[0])).Underlying()
 		if at, ok := t.(*types.Array); ok {
 			b.expr(fn, args[0]) // for effects only
 			return emitConst(fn, intConst(at.Len()))
@@ -332,7 +333,7 @@ func (b *builder) addr(fn *Function, e ast.Expr, escaping bool) (RET lvalue) {
 		return &address{addr: v, expr: e}
 
 	case *ast.CompositeLit:
-		t := deref(fn.Pkg.typeOf(e))
+		t := deref(fn.typeOf(e))
 		var v *Alloc
 		if escaping {
 			v = emitNew(fn, t, e)
@@ -357,7 +358,7 @@ func (b *builder) addr(fn *Function, e ast.Expr, escaping bool) (RET lvalue) {
 			panic(sel)
 		}
 		wantAddr := true
-		v := b.receiver(fn, e.X, wantAddr, escaping, sel, e)
+		v := b.receiver(fn, e.X, wantAddr, escaping, selection{sel.Index(), sel.Indirect()}, e)
 		last := len(sel.Index()) - 1
 		return &address{
 			addr: emitFieldSelection(fn, v, sel.Index()[last], true, e.Sel),
@@ -367,7 +368,7 @@ func (b *builder) addr(fn *Function, e ast.Expr, escaping bool) (RET lvalue) {
 	case *ast.IndexExpr:
 		var x Value
 		var et types.Type
-		xt := fn.Pkg.typeOf(e.X)
+		xt := fn.typeOf(e.X)
 
 		// Indexing doesn't need a core type, it only requires all types to be similar enough. For example, []int64 |
 		// [5]int64 can be indexed. The element types do have to match though.
@@ -550,6 +551,7 @@ func (b *builder) expr(fn *Function, e ast.Expr) Value {
 	e = unparen(e)
 
 	tv := fn.Pkg.info.Types[e]
+	tv.Type = fn.typ(tv.Type)
 
 	// Is expression a constant?
 	if tv.Value != nil {
@@ -579,11 +581,11 @@ func (b *builder) expr0(fn *Function, e ast.Expr, tv types.TypeAndValue) Value {
 	case *ast.FuncLit:
 		fn2 := &Function{
 			name:         fmt.Sprintf("%s$%d", fn.Name(), 1+len(fn.AnonFuncs)),
-			Signature:    fn.Pkg.typeOf(e.Type).Underlying().(*types.Signature),
+			Signature:    fn.typeOf(e.Type).Underlying().(*types.Signature),
 			parent:       fn,
 			Pkg:          fn.Pkg,
 			Prog:         fn.Prog,
-			functionBody: new(functionBody),
+			functionBody: &functionBody{subst: fn.subst},
 		}
 		fn2.source = e
 		fn.AnonFuncs = append(fn.AnonFuncs, fn2)
@@ -671,7 +673,7 @@ func (b *builder) expr0(fn *Function, e ast.Expr, tv types.TypeAndValue) Value {
 	case *ast.SliceExpr:
 		var low, high, max Value
 		var x Value
-		switch typeutil.CoreType(fn.Pkg.typeOf(e.X)).Underlying().(type) {
+		switch typeutil.CoreType(fn.typeOf(e.X)).Underlying().(type) {
 		case *types.Array:
 			// Potentially escaping.
 			x = b.addr(fn, e.X, true).address(fn)
@@ -715,7 +717,12 @@ func (b *builder) expr0(fn *Function, e ast.Expr, tv types.TypeAndValue) Value {
 			instances := typeparams.GetInstances(fn.Pkg.info)
 			if instance, ok := instances[e]; ok {
 				// Instantiated generic function
-				return makeInstance(fn.Prog, v.(*Function), instance.Type.(*types.Signature), instance.TypeArgs)
+				sig := fn.typ(instance.Type).(*types.Signature)
+				targs := typeList(instance.TypeArgs)
+				for i, targ := range targs {
+					targs[i] = fn.typ(targ)
+				}
+				return makeInstance(fn.Prog, v.(*Function), sig, targs)
 			}
 			return v // (func)
 		}
@@ -741,11 +748,11 @@ func (b *builder) expr0(fn *Function, e ast.Expr, tv types.TypeAndValue) Value {
 		case types.MethodVal:
 			// e.f where e is an expression and f is a method.
 			// The result is a "bound".
-			obj := sel.Obj().(*types.Func)
+			obj, msel := fn.selectMethod(e, sel)
 			rt := recvType(obj)
 			wantAddr := isPointer(rt)
 			escaping := true
-			v := b.receiver(fn, e.X, wantAddr, escaping, sel, e)
+			v := b.receiver(fn, e.X, wantAddr, escaping, msel, e)
 			if isInterface(rt) {
 				// If v has interface type I,
 				// we must emit a check that v is non-nil.
@@ -773,7 +780,7 @@ func (b *builder) expr0(fn *Function, e ast.Expr, tv types.TypeAndValue) Value {
 
 	case *ast.IndexExpr:
 		// IndexExpr might either be an actual indexing operation, or an instantiation
-		xt := fn.Pkg.typeOf(e.X)
+		xt := fn.typeOf(e.X)
 
 		terms, err := typeparams.NormalTerms(xt)
 		if err != nil {
@@ -849,6 +856,30 @@ func (b *builder) stmtList(fn *Function, list []ast.Stmt) {
 	}
 }
 
+// selection describes the implicit field selections and indirection
+// of a selector expression.
+type selection struct {
+	index    []int
+	indirect bool
+}
+
+// selectMethod returns the method selected by e, whose selection is sel. In
+// instantiations of generic functions, the receiver's type may have
+// changed, for example from a type parameter to a concrete type, and
+// we look up the method again.
+func (fn *Function) selectMethod(e *ast.SelectorExpr, sel *types.Selection) (*types.Func, selection) {
+	obj := sel.Obj().(*types.Func)
+	if fn.subst == nil {
+		return obj, selection{sel.Index(), sel.Indirect()}
+	}
+	recv := fn.typeOf(e.X)
+	if types.Identical(recv, sel.Recv()) {
+		return obj, selection{sel.Index(), sel.Indirect()}
+	}
+	m, index, indirect := types.LookupFieldOrMethod(recv, true, obj.Pkg(), obj.Name())
+	return m.(*types.Func), selection{index, indirect}
+}
+
 // receiver emits to fn code for expression e in the "receiver"
 // position of selection e.f (where f may be a field or a method) and
 // returns the effective receiver after applying the implicit field
@@ -860,16 +891,16 @@ func (b *builder) stmtList(fn *Function, list []ast.Stmt) {
 //
 // escaping is defined as per builder.addr().
 //
-func (b *builder) receiver(fn *Function, e ast.Expr, wantAddr, escaping bool, sel *types.Selection, source ast.Node) Value {
+func (b *builder) receiver(fn *Function, e ast.Expr, wantAddr, escaping bool, sel selection, source ast.Node) Value {
 	var v Value
-	if wantAddr && !sel.Indirect() && !isPointer(fn.Pkg.typeOf(e)) {
+	if wantAddr && !sel.indirect && !isPointer(fn.typeOf(e)) {
 		v = b.addr(fn, e, escaping).address(fn)
 	} else {
 		v = b.expr(fn, e)
 	}
 
-	last := len(sel.Index()) - 1
-	v = emitImplicitSelections(fn, v, sel.Index()[:last], source)
+	last := len(sel.index) - 1
+	v = emitImplicitSelections(fn, v, sel.index[:last], source)
 	if !wantAddr && isPointer(v.Type()) {
 		v = emitLoad(fn, v, e)
 	}
@@ -885,11 +916,11 @@ func (b *builder) setCallFunc(fn *Function, e *ast.CallExpr, c *CallCommon) {
 	if selector, ok := unparen(e.Fun).(*ast.SelectorExpr); ok {
 		sel, ok := fn.Pkg.info.Selections[selector]
 		if ok && sel.Kind() == types.MethodVal {
-			obj := sel.Obj().(*types.Func)
+			obj, msel := fn.selectMethod(selector, sel)
 			recv := recvType(obj)
 			wantAddr := isPointer(recv)
 			escaping := true
-			v := b.receiver(fn, selector.X, wantAddr, escaping, sel, selector)
+			v := b.receiver(fn, selector.X, wantAddr, escaping, msel, selector)
 			if isInterface(recv) {
 				// Invoke-mode call.
 
@@ -1023,7 +1054,7 @@ func (b *builder) setCall(fn *Function, e *ast.CallExpr, c *CallCommon) {
 	b.setCallFunc(fn, e, c)
 
 	// Then append the other actual parameters.
-	sig, _ := typeutil.CoreType(fn.Pkg.typeOf(e.Fun)).(*types.Signature)
+	sig, _ := typeutil.CoreType(fn.typeOf(e.Fun)).(*types.Signature)
 	if sig == nil {
 		panic(fmt.Sprintf("no signature for call of %s", e.Fun))
 	}
@@ -1158,7 +1189,7 @@ func (b *builder) arrayLen(fn *Function, elts []ast.Expr) int64 {
 // In that case, addr must hold a T, not a *T.
 //
 func (b *builder) compLit(fn *Function, addr Value, e *ast.CompositeLit, isZero bool, sb *storebuf) {
-	typ := deref(fn.Pkg.typeOf(e))
+	typ := deref(fn.typeOf(e))
 	switch t := typeutil.CoreType(typ).(type) {
 	case *types.Struct:
 		if !isZero && len(e.Elts) != t.NumFields() {
@@ -1543,12 +1574,12 @@ func (b *builder) typeSwitchStmt(fn *Function, s *ast.TypeSwitchStmt, label *lbl
 			default_ = cc
 		} else {
 			for _, expr := range cc.List {
-				tswtch.Conds = append(tswtch.Conds, fn.Pkg.typeOf(expr))
+				tswtch.Conds = append(tswtch.Conds, fn.typeOf(expr))
 				cswtch.Conds = append(cswtch.Conds, emitConst(fn, intConst(int64(index))))
 				index++
 			}
 			if len(cc.List) == 1 {
-				rets = append(rets, fn.Pkg.typeOf(cc.List[0]))
+				rets = append(rets, fn.typeOf(cc.List[0]))
 			} else {
 				for range cc.List {
 					rets = append(rets, tag.Type())
@@ -2121,10 +2152,10 @@ func (v *variable) load() Value {
 func (b *builder) rangeStmt(fn *Function, s *ast.RangeStmt, label *lblock, source ast.Node) {
 	var tk, tv types.Type
 	if s.Key != nil && !isBlankIdent(s.Key) {
-		tk = fn.Pkg.typeOf(s.Key)
+		tk = fn.typeOf(s.Key)
 	}
 	if s.Value != nil && !isBlankIdent(s.Value) {
-		tv = fn.Pkg.typeOf(s.Value)
+		tv = fn.typeOf(s.Value)
 	}
 
 	// If iteration variables are defined (:=), this
@@ -2227,7 +2258,7 @@ start:
 		instr := &Send{
 			Chan: b.expr(fn, s.Chan),
 			X: emitConv(fn, b.expr(fn, s.Value),
-				typeutil.CoreType(fn.Pkg.typeOf(s.Chan)).Underlying().(*types.Chan).Elem(), s),
+				typeutil.CoreType(fn.typeOf(s.Chan)).Underlying().(*types.Chan).Elem(), s),
 		}
 		fn.emit(instr, s)
 
@@ -2504,6 +2535,77 @@ func (prog *Program) Build() {
 //
 func (p *Package) Build() { p.buildOnce.Do(p.build) }
 
+// BuildInstances is a cheaper alternative to Build for clients that
+// are only interested in the instantiations of p's generic functions
+// and methods. It builds the instantiations that p refers to with
+// concrete type arguments, as well as the instantiations those refer
+// to in turn, but none of p's other functions. It is only useful in
+// InstantiateGenerics mode.
+//
+// Only the first call to either Build or BuildInstances has an
+// effect.
+func (p *Package) BuildInstances() { p.buildOnce.Do(p.buildInstances) }
+
+func (p *Package) buildInstances() {
+	if p.info == nil {
+		return
+	}
+	if p.Prog.mode&LogSource != 0 {
+		defer logStack("build instances of %s", p)()
+	}
+
+	concrete := func(targs []types.Type) bool {
+		for _, targ := range targs {
+			if hasTypeParams(targ) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// Collect the references to instantiations in source order, so
+	// that instantiations are built in a deterministic order.
+	type ref struct {
+		pos   token.Pos
+		build func()
+	}
+	var refs []ref
+	for id, inst := range typeparams.GetInstances(p.info) {
+		obj, ok := p.info.Uses[id].(*types.Func)
+		if !ok || obj.Pkg() != p.Pkg {
+			continue
+		}
+		fn, ok := p.values[obj].(*Function)
+		if !ok {
+			continue
+		}
+		targs := typeList(inst.TypeArgs)
+		if !concrete(targs) {
+			continue
+		}
+		sig := inst.Type.(*types.Signature)
+		refs = append(refs, ref{id.Pos(), func() { makeInstance(p.Prog, fn, sig, targs) }})
+	}
+	for e, sel := range p.info.Selections {
+		obj, ok := sel.Obj().(*types.Func)
+		if !ok || obj.Pkg() != p.Pkg || typeparams.OriginMethod(obj) == obj {
+			continue
+		}
+		recv, ok := deref(obj.Type().(*types.Signature).Recv().Type()).(*types.Named)
+		if !ok || types.IsInterface(recv) || !concrete(typeList(typeparams.NamedTypeArgs(recv))) {
+			// Abstract methods don't have instantiations.
+			continue
+		}
+		refs = append(refs, ref{e.Pos(), func() { p.Prog.declaredFunc(obj) }})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].pos < refs[j].pos })
+	for _, r := range refs {
+		r.build()
+	}
+
+	p.info = nil // We no longer need ASTs or go/types deductions.
+}
+
 func (p *Package) build() {
 	if p.info == nil {
 		return // synthetic package, e.g. "testmain"
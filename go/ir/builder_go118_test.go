@@ -0,0 +1,262 @@
+//go:build go1.18
+// +build go1.18
+
+package ir_test
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"testing"
+
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/ir/irutil"
+)
+
+func TestInstantiateGenerics(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		fn        string
+		instances []string
+	}{
+		{
+			"function",
+			`package p
+func F[T any](x T) T { return x }
+func G() { F(1); F("") ; F[int](2) }`,
+			"F",
+			[]string{"F[int]", "F[string]"},
+		},
+		{
+			"multiple type parameters",
+			`package p
+func F[K comparable, V any](m map[K]V, k K) V { return m[k] }
+func G() { F(map[string][]int{}, "") }`,
+			"F",
+			[]string{"F[string, []int]"},
+		},
+		{
+			"method",
+			`package p
+type S[T any] struct{ x T }
+func (s *S[T]) Get() T { return s.x }
+func G() { var s S[bool]; s.Get() }`,
+			"Get",
+			[]string{"Get"},
+		},
+		{
+			"method call on type parameter",
+			`package p
+import "fmt"
+type T int
+func (T) String() string { return "" }
+func F[X fmt.Stringer](x X) string { return x.String() }
+func G() { F(T(0)) }`,
+			"F",
+			[]string{"F[T]"},
+		},
+		{
+			"closure",
+			`package p
+func F[T any](x T) func() T { return func() T { return x } }
+func G() { F(1.0) }`,
+			"F",
+			[]string{"F[float64]"},
+		},
+		{
+			"recursion",
+			`package p
+func F[T any](x T, n int) T { if n == 0 { return x }; return F(x, n-1) }
+func G() { F(struct{}{}, 3) }`,
+			"F",
+			[]string{"F[struct{}]"},
+		},
+		{
+			"generic call in generic function",
+			`package p
+func F[T any](x T) []T { return []T{x} }
+func G[T any](x T) []T { return F(x) }
+func H() { G(uint8(0)) }`,
+			"F",
+			[]string{"F[uint8]"},
+		},
+		{
+			// We can't substitute type arguments in local types and
+			// fall back to calling the generic function.
+			"local type",
+			`package p
+func F[T any](x T) any { type L struct{ x T }; return L{x} }
+func G() { F(1) }`,
+			"F",
+			nil,
+		},
+		{
+			"local type after recursion",
+			`package p
+func F[T any](x T, n int) any { if n > 0 { F(x, n-1) }; type L struct{ x T }; return L{x} }
+func G() { F(1, 1) }`,
+			"F",
+			nil,
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			fset := token.NewFileSet()
+			f, err := parser.ParseFile(fset, "p.go", tc.src, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pkg := types.NewPackage("p", "")
+			conf := &types.Config{Importer: importer.Default()}
+			irpkg, _, err := irutil.BuildPackage(conf, fset, pkg, []*ast.File{f}, ir.SanityCheckFunctions|ir.InstantiateGenerics)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var generic *ir.Function
+			for _, fn := range irpkg.Functions {
+				if fn.Name() == tc.fn {
+					generic = fn
+				}
+			}
+			if generic == nil {
+				t.Fatalf("couldn't find function %s", tc.fn)
+			}
+			var names []string
+			for _, inst := range generic.Instances() {
+				names = append(names, inst.Name())
+				if inst.Origin() != generic {
+					t.Errorf("%s: got origin %v, want %v", inst, inst.Origin(), generic)
+				}
+				if inst.Source() != generic.Source() {
+					t.Errorf("%s: instantiation doesn't share the syntax of its origin", inst)
+				}
+				checkNoTypeParams(t, inst)
+			}
+			sort.Strings(names)
+			if len(names) != len(tc.instances) {
+				t.Fatalf("got instances %v, want %v", names, tc.instances)
+			}
+			for i := range names {
+				if names[i] != tc.instances[i] {
+					t.Fatalf("got instances %v, want %v", names, tc.instances)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildInstances(t *testing.T) {
+	const src = `package p
+type box[T any] struct{ v T }
+func (b box[T]) get() T { return b.v }
+func mk[T any](x T) box[T] { return box[T]{x} }
+func F[T any](x T) T { return G(x) }
+func G[T any](x T) T { return x }
+func H[T any](x T) T { return x }
+func I() (int, string) { F(1); return mk(1).get(), box[string]{}.get() }
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{
+		Types:      map[ast.Expr]types.TypeAndValue{},
+		Defs:       map[*ast.Ident]types.Object{},
+		Uses:       map[*ast.Ident]types.Object{},
+		Implicits:  map[ast.Node]types.Object{},
+		Scopes:     map[ast.Node]*types.Scope{},
+		Selections: map[*ast.SelectorExpr]*types.Selection{},
+		Instances:  map[*ast.Ident]types.Instance{},
+	}
+	pkg, err := new(types.Config).Check("p", fset, []*ast.File{f}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog := ir.NewProgram(fset, ir.SanityCheckFunctions|ir.InstantiateGenerics)
+	irpkg := prog.CreatePackage(pkg, []*ast.File{f}, info, false)
+	irpkg.BuildInstances()
+
+	var got []string
+	for _, fn := range irpkg.Functions {
+		for _, inst := range fn.Instances() {
+			got = append(got, inst.String())
+			checkNoTypeParams(t, inst)
+		}
+	}
+	sort.Strings(got)
+	// G[int] is only referred to by an instantiation, and H isn't
+	// instantiated at all.
+	want := []string{"(p.box[int]).get", "(p.box[string]).get", "p.F[int]", "p.G[int]", "p.mk[int]"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got instances %v, want %v", got, want)
+	}
+	if fn := irpkg.Func("I"); fn.Blocks != nil {
+		t.Errorf("BuildInstances built %s", fn)
+	}
+}
+
+// checkNoTypeParams verifies that none of the values in fn and its
+// function literals have types that refer to type parameters.
+func checkNoTypeParams(t *testing.T, fn *ir.Function) {
+	t.Helper()
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			v, ok := instr.(ir.Value)
+			if !ok {
+				continue
+			}
+			if hasTypeParam(v.Type()) {
+				t.Errorf("%s: %s has type %s", fn, v.Name(), v.Type())
+			}
+		}
+	}
+	for _, anon := range fn.AnonFuncs {
+		checkNoTypeParams(t, anon)
+	}
+}
+
+func hasTypeParam(typ types.Type) bool {
+	switch typ := typ.(type) {
+	case *types.TypeParam:
+		return true
+	case *types.Pointer:
+		return hasTypeParam(typ.Elem())
+	case *types.Slice:
+		return hasTypeParam(typ.Elem())
+	case *types.Array:
+		return hasTypeParam(typ.Elem())
+	case *types.Map:
+		return hasTypeParam(typ.Key()) || hasTypeParam(typ.Elem())
+	case *types.Chan:
+		return hasTypeParam(typ.Elem())
+	case *types.Tuple:
+		for i := 0; i < typ.Len(); i++ {
+			if hasTypeParam(typ.At(i).Type()) {
+				return true
+			}
+		}
+		return false
+	case *types.Signature:
+		return hasTypeParam(typ.Params()) || hasTypeParam(typ.Results())
+	case *types.Named:
+		targs := typ.TypeArgs()
+		for i := 0; i < targs.Len(); i++ {
+			if hasTypeParam(targs.At(i)) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
@@ -487,3 +487,45 @@ func h(error)
 		t.Errorf("expected %d Phi nodes (for the range index, slice length and slice), got %d", expected, phis)
 	}
 }
+
+// TestSplitAfterNewInformation ensures that splitting live ranges
+// produces IR that passes the sanity checker. Earlier versions
+// didn't know about Copy instructions in the sanity checker, and
+// didn't update referrers when replacing operands with copies.
+func TestSplitAfterNewInformation(t *testing.T) {
+	const input = `
+package p
+
+func f(x *int, s []int, i int) int {
+	a := *x
+	b := *x
+	c := s[i] + s[i]
+	return a + b + c + *x
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "<input>", input, 0)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	// The sanity checker panics if it finds a problem.
+	irpkg, _, err := irutil.BuildPackage(&types.Config{Importer: importer.Default()}, fset,
+		types.NewPackage("p", ""), []*ast.File{f}, ir.SanityCheckFunctions|ir.SplitAfterNewInformation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fn := irpkg.Func("f")
+	copies := 0
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			if _, ok := instr.(*ir.Copy); ok {
+				copies++
+			}
+		}
+	}
+	if copies == 0 {
+		fn.WriteTo(os.Stderr)
+		t.Errorf("expected Copy instructions")
+	}
+}
@@ -0,0 +1,1301 @@
+package ir
+
+// This file implements decoding of the binary encoding of IR produced
+// by EncodePackage and EncodeFunction. See encode.go for a
+// description of the encoding.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"strings"
+
+	"honnef.co/go/tools/go/types/typeutil"
+
+	"golang.org/x/exp/typeparams"
+)
+
+var errBadEncoding = errors.New("malformed IR encoding")
+
+// decodedSource stands in for the syntax of decoded IR, providing
+// positions only.
+type decodedSource struct {
+	pos, end token.Pos
+}
+
+func (src *decodedSource) Pos() token.Pos { return src.pos }
+func (src *decodedSource) End() token.Pos { return src.end }
+
+// decBuf is a buffer with methods for reading the primitives of the
+// encoding. Reading past the end of the buffer aborts decoding.
+type decBuf struct {
+	data []byte
+}
+
+func (b *decBuf) uint() uint64 {
+	x, n := binary.Uvarint(b.data)
+	if n <= 0 {
+		panic(decodingError{errBadEncoding})
+	}
+	b.data = b.data[n:]
+	return x
+}
+
+func (b *decBuf) int() int64 {
+	x, n := binary.Varint(b.data)
+	if n <= 0 {
+		panic(decodingError{errBadEncoding})
+	}
+	b.data = b.data[n:]
+	return x
+}
+
+func (b *decBuf) len() int {
+	n := b.uint()
+	if n > uint64(len(b.data)) {
+		// Every element occupies at least one byte.
+		panic(decodingError{errBadEncoding})
+	}
+	return int(n)
+}
+
+func (b *decBuf) bool() bool {
+	return b.uint() != 0
+}
+
+func (b *decBuf) bytes() []byte {
+	n := b.len()
+	out := b.data[:n]
+	b.data = b.data[n:]
+	return out
+}
+
+// A decodingError is used to abort decoding.
+type decodingError struct{ err error }
+
+type decoder struct {
+	prog *Program
+	pkg  *types.Package
+	ctxt *typeparams.Context
+
+	// packages maps import paths to the packages transitively
+	// imported by pkg.
+	packages map[string]*types.Package
+
+	strings  []string
+	files    []*token.File
+	objects  []decBuf
+	objCache []types.Object
+	types    []decBuf
+	typCache []types.Type
+	headers  []decBuf
+	bodies   []decBuf
+	funcs    []*Function
+
+	// target is the package being decoded, if any.
+	target *Package
+}
+
+func (d *decoder) errorf(format string, args ...interface{}) {
+	panic(decodingError{fmt.Errorf(format, args...)})
+}
+
+func (d *decoder) recover(err *error) {
+	if r := recover(); r != nil {
+		if derr, ok := r.(decodingError); ok {
+			*err = derr.err
+			return
+		}
+		panic(r)
+	}
+}
+
+// DecodePackage decodes the IR of the package pkg, as encoded by
+// EncodePackage. The package must not yet exist in prog. Packages
+// that pkg depends on are created from their type information if
+// they don't exist yet.
+//
+// The decoded IR has positions, but no syntax: the Source methods of
+// its functions and instructions return nil, and the expressions of
+// DebugRef instructions are placeholders. See EncodePackage.
+func (prog *Program) DecodePackage(pkg *types.Package, r io.Reader) (_ *Package, err error) {
+	if prog.packages[pkg] != nil {
+		return nil, fmt.Errorf("package %s already exists", pkg.Path())
+	}
+	d, err := prog.newDecoder(pkg, r)
+	if err != nil {
+		return nil, err
+	}
+	defer d.recover(&err)
+
+	irpkg := d.irPackage(pkg)
+	d.target = irpkg
+	d.decode()
+
+	// Use the encoded package's functions, in its order. Creating
+	// the package from type information may have added functions
+	// that weren't part of it, such as the methods of aliased types.
+	seen := map[*Function]bool{}
+	var fns []*Function
+	for _, fn := range d.funcs {
+		if fn.Pkg == irpkg && fn.parent == nil && fn.origin == nil && !seen[fn] {
+			if v, ok := irpkg.values[fn.object]; (ok && v == fn) || irpkg.Members[fn.name] == fn {
+				seen[fn] = true
+				fns = append(fns, fn)
+			}
+		}
+	}
+	irpkg.Functions = fns
+	return irpkg, nil
+}
+
+// DecodeFunction decodes a function encoded by EncodeFunction. pkg is
+// the package the function belongs to, which is used for resolving
+// references to other packages.
+//
+// The returned function is a new function, even if it is a member of
+// an existing package.
+func (prog *Program) DecodeFunction(pkg *types.Package, r io.Reader) (_ *Function, err error) {
+	d, err := prog.newDecoder(pkg, r)
+	if err != nil {
+		return nil, err
+	}
+	defer d.recover(&err)
+	d.decode()
+	if len(d.funcs) == 0 {
+		return nil, errBadEncoding
+	}
+	return d.funcs[0], nil
+}
+
+func (prog *Program) newDecoder(pkg *types.Package, r io.Reader) (d *decoder, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(string(data), encodingMagic) {
+		return nil, errBadEncoding
+	}
+
+	d = &decoder{
+		prog:     prog,
+		pkg:      pkg,
+		ctxt:     typeparams.NewContext(),
+		packages: map[string]*types.Package{"unsafe": types.Unsafe},
+	}
+	defer d.recover(&err)
+
+	var addPackage func(pkg *types.Package)
+	addPackage = func(pkg *types.Package) {
+		if _, ok := d.packages[pkg.Path()]; ok {
+			return
+		}
+		d.packages[pkg.Path()] = pkg
+		for _, imp := range pkg.Imports() {
+			addPackage(imp)
+		}
+	}
+	addPackage(pkg)
+
+	b := &decBuf{data: data[len(encodingMagic):]}
+	if v := b.uint(); v != encodingVersion {
+		return nil, fmt.Errorf("unsupported IR encoding version %d", v)
+	}
+	if path := string(b.bytes()); path != pkg.Path() {
+		return nil, fmt.Errorf("IR encoding is for package %s, not %s", path, pkg.Path())
+	}
+
+	d.strings = make([]string, b.len())
+	for i := range d.strings {
+		d.strings[i] = string(b.bytes())
+	}
+
+	d.files = make([]*token.File, b.len())
+	for i := range d.files {
+		name := string(b.bytes())
+		size := int(b.uint())
+		lines := make([]int, b.len())
+		off := 0
+		for j := range lines {
+			off += int(b.uint())
+			lines[j] = off
+		}
+		d.files[i] = d.file(name, size, lines)
+	}
+
+	records := func() []decBuf {
+		out := make([]decBuf, b.len())
+		for i := range out {
+			out[i] = decBuf{b.bytes()}
+		}
+		return out
+	}
+	d.objects = records()
+	d.objCache = make([]types.Object, len(d.objects))
+	d.types = records()
+	d.typCache = make([]types.Type, len(d.types))
+	d.headers = records()
+	d.bodies = records()
+	if len(d.bodies) != len(d.headers) {
+		return nil, errBadEncoding
+	}
+	return d, nil
+}
+
+// file returns the file in the program's file set that has the given
+// name and size, adding it if necessary.
+func (d *decoder) file(name string, size int, lines []int) *token.File {
+	var found *token.File
+	d.prog.Fset.Iterate(func(f *token.File) bool {
+		if f.Name() == name && f.Size() == size {
+			found = f
+			return false
+		}
+		return true
+	})
+	if found != nil {
+		return found
+	}
+	f := d.prog.Fset.AddFile(name, -1, size)
+	if !f.SetLines(lines) {
+		d.errorf("invalid line table for %s", name)
+	}
+	return f
+}
+
+func (d *decoder) string(b *decBuf) string {
+	idx := b.uint()
+	if idx >= uint64(len(d.strings)) {
+		panic(decodingError{errBadEncoding})
+	}
+	return d.strings[idx]
+}
+
+func (d *decoder) pos(b *decBuf) token.Pos {
+	idx := b.uint()
+	if idx == 0 {
+		return token.NoPos
+	}
+	if idx > uint64(len(d.files)) {
+		panic(decodingError{errBadEncoding})
+	}
+	f := d.files[idx-1]
+	off := b.uint()
+	if off > uint64(f.Size()) {
+		panic(decodingError{errBadEncoding})
+	}
+	return f.Pos(int(off))
+}
+
+func (d *decoder) source(b *decBuf) ast.Node {
+	if !b.bool() {
+		return nil
+	}
+	pos := d.pos(b)
+	end := d.pos(b)
+	return &decodedSource{pos, end}
+}
+
+func (d *decoder) pkgPath(b *decBuf) *types.Package {
+	if !b.bool() {
+		return nil
+	}
+	path := d.string(b)
+	if pkg, ok := d.packages[path]; ok {
+		return pkg
+	}
+	if pkg := d.prog.ImportedPackage(path); pkg != nil {
+		return pkg.Pkg
+	}
+	d.errorf("unknown package %s", path)
+	return nil
+}
+
+// irPackage returns the IR package for pkg, creating it from its
+// type information if necessary.
+func (d *decoder) irPackage(pkg *types.Package) *Package {
+	if irpkg, ok := d.prog.packages[pkg]; ok {
+		return irpkg
+	}
+	return d.prog.CreatePackage(pkg, nil, nil, true)
+}
+
+func (d *decoder) object(idx uint64) types.Object {
+	if idx == 0 {
+		return nil
+	}
+	if idx > uint64(len(d.objects)) {
+		panic(decodingError{errBadEncoding})
+	}
+	if obj := d.objCache[idx-1]; obj != nil {
+		return obj
+	}
+	b := d.objects[idx-1]
+	obj := d.objectRecord(&b)
+	d.objCache[idx-1] = obj
+	return obj
+}
+
+func (d *decoder) objectRecord(b *decBuf) types.Object {
+	switch kind := b.uint(); kind {
+	case objPackageLevel:
+		pkg := d.pkgPath(b)
+		name := d.string(b)
+		scope := types.Universe
+		if pkg != nil {
+			scope = pkg.Scope()
+		}
+		obj := scope.Lookup(name)
+		if obj == nil {
+			d.errorf("couldn't find object %s in package %s", name, pkg)
+		}
+		return obj
+	case objMethod:
+		tname, ok := d.object(b.uint()).(*types.TypeName)
+		name := d.string(b)
+		if !ok {
+			d.errorf("method %s of a non-type", name)
+		}
+		if named, ok := tname.Type().(*types.Named); ok {
+			for i := 0; i < named.NumMethods(); i++ {
+				if m := named.Method(i); m.Name() == name {
+					return m
+				}
+			}
+		}
+		if iface, ok := tname.Type().Underlying().(*types.Interface); ok {
+			for i := 0; i < iface.NumMethods(); i++ {
+				if m := iface.Method(i); m.Name() == name {
+					return m
+				}
+			}
+		}
+		d.errorf("couldn't find method %s of %s", name, tname)
+	case objVar:
+		pkg := d.pkgPath(b)
+		name := d.string(b)
+		pos := d.pos(b)
+		typ := d.typ(b)
+		if field, embedded := b.bool(), b.bool(); field {
+			return types.NewField(pos, pkg, name, typ, embedded)
+		}
+		return types.NewVar(pos, pkg, name, typ)
+	case objFuncTypeParam, objRecvTypeParam, objNamedTypeParam, objParam:
+		owner := d.object(b.uint())
+		idx := int(b.uint())
+		var tparams *typeparams.TypeParamList
+		switch kind {
+		case objFuncTypeParam:
+			tparams = typeparams.ForSignature(owner.Type().(*types.Signature))
+		case objRecvTypeParam:
+			tparams = typeparams.RecvTypeParams(owner.Type().(*types.Signature))
+		case objNamedTypeParam:
+			tparams = typeparams.ForNamed(owner.Type().(*types.Named))
+		case objParam:
+			if v := signatureVar(owner.Type().(*types.Signature), idx); v != nil {
+				return v
+			}
+			d.errorf("couldn't find parameter %d of %s", idx, owner)
+		}
+		if idx >= tparams.Len() {
+			d.errorf("couldn't find type parameter %d of %s", idx, owner)
+		}
+		return tparams.At(idx).Obj()
+	}
+	panic(decodingError{errBadEncoding})
+}
+
+// signatureVar returns the idx'th variable in the concatenation of
+// sig's receiver, parameters and results.
+func signatureVar(sig *types.Signature, idx int) *types.Var {
+	if recv := sig.Recv(); recv != nil {
+		if idx == 0 {
+			return recv
+		}
+		idx--
+	}
+	for _, tuple := range []*types.Tuple{sig.Params(), sig.Results()} {
+		if idx < tuple.Len() {
+			return tuple.At(idx)
+		}
+		idx -= tuple.Len()
+	}
+	return nil
+}
+
+func (d *decoder) typ(b *decBuf) types.Type {
+	idx := b.uint()
+	if idx >= uint64(len(d.types)) {
+		panic(decodingError{errBadEncoding})
+	}
+	if t := d.typCache[idx]; t != nil {
+		return t
+	}
+	rec := d.types[idx]
+	t := d.typeRecord(&rec, idx)
+	d.typCache[idx] = t
+	return t
+}
+
+func (d *decoder) vars(b *decBuf) []*types.Var {
+	vars := make([]*types.Var, b.len())
+	for i := range vars {
+		name := d.string(b)
+		pkg := d.pkgPath(b)
+		vars[i] = types.NewVar(token.NoPos, pkg, name, d.typ(b))
+	}
+	return vars
+}
+
+func (d *decoder) typeRecord(b *decBuf, idx uint64) types.Type {
+	switch b.uint() {
+	case typBasic:
+		kind := b.uint()
+		if kind >= uint64(len(types.Typ)) {
+			panic(decodingError{errBadEncoding})
+		}
+		return types.Typ[kind]
+	case typUniverse:
+		name := d.string(b)
+		obj, ok := types.Universe.Lookup(name).(*types.TypeName)
+		if !ok {
+			d.errorf("unknown type %s", name)
+		}
+		return obj.Type()
+	case typIterator:
+		return typeutil.NewIterator(d.typ(b))
+	case typPointer:
+		return types.NewPointer(d.typ(b))
+	case typSlice:
+		return types.NewSlice(d.typ(b))
+	case typArray:
+		elem := d.typ(b)
+		return types.NewArray(elem, b.int())
+	case typMap:
+		key := d.typ(b)
+		return types.NewMap(key, d.typ(b))
+	case typChan:
+		dir := types.ChanDir(b.uint())
+		return types.NewChan(dir, d.typ(b))
+	case typTuple:
+		return types.NewTuple(d.vars(b)...)
+	case typStruct:
+		fields := make([]*types.Var, b.len())
+		tags := make([]string, len(fields))
+		for i := range fields {
+			name := d.string(b)
+			pkg := d.pkgPath(b)
+			typ := d.typ(b)
+			embedded := b.bool()
+			tags[i] = d.string(b)
+			fields[i] = types.NewField(token.NoPos, pkg, name, typ, embedded)
+		}
+		return types.NewStruct(fields, tags)
+	case typSignature:
+		var recv *types.Var
+		if b.bool() {
+			name := d.string(b)
+			pkg := d.pkgPath(b)
+			recv = types.NewVar(token.NoPos, pkg, name, d.typ(b))
+		}
+		params := d.vars(b)
+		results := d.vars(b)
+		variadic := b.bool()
+		return types.NewSignature(recv, types.NewTuple(params...), types.NewTuple(results...), variadic)
+	case typInterface:
+		methods := make([]*types.Func, b.len())
+		for i := range methods {
+			name := d.string(b)
+			pkg := d.pkgPath(b)
+			params := d.vars(b)
+			results := d.vars(b)
+			variadic := b.bool()
+			sig := types.NewSignature(nil, types.NewTuple(params...), types.NewTuple(results...), variadic)
+			methods[i] = types.NewFunc(token.NoPos, pkg, name, sig)
+		}
+		embeddeds := make([]types.Type, b.len())
+		for i := range embeddeds {
+			embeddeds[i] = d.typ(b)
+		}
+		return types.NewInterfaceType(methods, embeddeds).Complete()
+	case typUnion:
+		terms := make([]*typeparams.Term, b.len())
+		for i := range terms {
+			tilde := b.bool()
+			terms[i] = typeparams.NewTerm(tilde, d.typ(b))
+		}
+		return typeparams.NewUnion(terms)
+	case typNamed:
+		tname, ok := d.object(b.uint()).(*types.TypeName)
+		if !ok {
+			d.errorf("named type refers to a non-type")
+		}
+		targs := make([]types.Type, b.len())
+		for i := range targs {
+			targs[i] = d.typ(b)
+		}
+		if len(targs) == 0 {
+			return tname.Type()
+		}
+		t, err := typeparams.Instantiate(d.ctxt, tname.Type(), targs, false)
+		if err != nil {
+			d.errorf("couldn't instantiate %s: %s", tname, err)
+		}
+		return t
+	case typLocalNamed:
+		name := d.string(b)
+		pkg := d.pkgPath(b)
+		pos := d.pos(b)
+		named := types.NewNamed(types.NewTypeName(pos, pkg, name, nil), nil, nil)
+		// Record the type before decoding its underlying type,
+		// which may refer to it.
+		d.typCache[idx] = named
+		named.SetUnderlying(d.typ(b).Underlying())
+		return named
+	case typTypeParam:
+		tname, ok := d.object(b.uint()).(*types.TypeName)
+		if !ok {
+			d.errorf("type parameter refers to a non-type")
+		}
+		return tname.Type()
+	}
+	panic(decodingError{errBadEncoding})
+}
+
+// function decodes an entry of the function table. Bodies are decoded
+// separately, once all functions are known.
+//
+// Functions of other packages keep their properties, except for
+// NoReturn.
+func (d *decoder) function(b *decBuf) *Function {
+	var fn *Function
+	// existing is set for functions that exist in the program
+	// independently of the encoding.
+	existing := false
+	switch b.uint() {
+	case fnObject:
+		obj, ok := d.object(b.uint()).(*types.Func)
+		if !ok {
+			d.errorf("function refers to a non-function")
+		}
+		d.irPackage(obj.Pkg())
+		fn = d.prog.FuncValue(obj)
+		if fn == nil {
+			d.errorf("couldn't find function %s", obj)
+		}
+		existing = true
+	case fnMember:
+		pkg := d.irPackage(d.pkgPath(b))
+		name := d.string(b)
+		sig, _ := d.typ(b).(*types.Signature)
+		fn, _ = pkg.Members[name].(*Function)
+		existing = fn != nil
+		if fn == nil {
+			if !strings.HasPrefix(name, "init#") || sig == nil {
+				d.errorf("couldn't find function %s in package %s", name, pkg.Pkg.Path())
+			}
+			// Declared init functions aren't part of the package's
+			// type information.
+			fn = &Function{
+				name:      name,
+				Signature: sig,
+				Pkg:       pkg,
+				Prog:      d.prog,
+			}
+			pkg.Members[name] = fn
+			pkg.Functions = append(pkg.Functions, fn)
+		}
+	case fnAnonymous:
+		parent := d.funcRef(b.uint())
+		name := d.string(b)
+		sig, ok := d.typ(b).(*types.Signature)
+		if !ok {
+			panic(decodingError{errBadEncoding})
+		}
+		fn = &Function{
+			name:      name,
+			Signature: sig,
+			parent:    parent,
+			Pkg:       parent.Pkg,
+			Prog:      d.prog,
+		}
+		parent.AnonFuncs = append(parent.AnonFuncs, fn)
+	case fnInstance:
+		origin := d.funcRef(b.uint())
+		name := d.string(b)
+		sig, ok := d.typ(b).(*types.Signature)
+		if !ok {
+			panic(decodingError{errBadEncoding})
+		}
+		targs := make([]types.Type, b.len())
+		for i := range targs {
+			targs[i] = d.typ(b)
+		}
+		fn = &Function{
+			name:      name,
+			object:    origin.object,
+			Signature: sig,
+			Pkg:       origin.Pkg,
+			Prog:      d.prog,
+			origin:    origin,
+			typeArgs:  targs,
+		}
+		origin.generics.Set(targs, fn)
+		origin.instances = append(origin.instances, fn)
+	case fnSynthetic:
+		name := d.string(b)
+		obj := d.object(b.uint())
+		var sig *types.Signature
+		if b.bool() {
+			if obj == nil {
+				panic(decodingError{errBadEncoding})
+			}
+			sig, _ = obj.Type().(*types.Signature)
+		} else {
+			sig, _ = d.typ(b).(*types.Signature)
+		}
+		if sig == nil {
+			panic(decodingError{errBadEncoding})
+		}
+		fn = &Function{
+			name:      name,
+			object:    obj,
+			Signature: sig,
+			Prog:      d.prog,
+		}
+		if pkg := d.pkgPath(b); pkg != nil {
+			fn.Pkg = d.irPackage(pkg)
+		}
+		if b.bool() {
+			recv := d.typ(b)
+			if obj != nil {
+				fn.method = d.prog.MethodSets.MethodSet(recv).Lookup(obj.Pkg(), obj.Name())
+				if fn.method == nil {
+					fn.method = d.prog.MethodSets.MethodSet(types.NewPointer(recv)).Lookup(obj.Pkg(), obj.Name())
+				}
+			}
+		}
+	default:
+		panic(decodingError{errBadEncoding})
+	}
+
+	synthetic := Synthetic(b.uint())
+	noReturn := NoReturn(b.uint())
+	source := d.source(b)
+	b.bool() // has body
+	if !existing || fn.Pkg == d.target {
+		fn.Synthetic = synthetic
+		fn.source = source
+	}
+	fn.NoReturn = noReturn
+	return fn
+}
+
+func (d *decoder) funcRef(idx uint64) *Function {
+	if idx >= uint64(len(d.funcs)) || d.funcs[idx] == nil {
+		panic(decodingError{errBadEncoding})
+	}
+	return d.funcs[idx]
+}
+
+// decode decodes all functions.
+func (d *decoder) decode() {
+	d.funcs = make([]*Function, len(d.headers))
+	for i := range d.headers {
+		d.funcs[i] = d.function(&d.headers[i])
+	}
+
+	var fns []*Function
+	for i, fn := range d.funcs {
+		if len(d.bodies[i].data) == 0 {
+			continue
+		}
+		fd := &funcDecoder{decoder: d, fn: fn}
+		fd.body(&d.bodies[i])
+		fns = append(fns, fn)
+	}
+	for _, fn := range fns {
+		fn.functionBody = new(functionBody)
+		buildFakeExits(fn)
+		buildReferrers(fn)
+		buildDomTree(fn)
+		buildPostDomTree(fn)
+		fn.functionBody = nil
+	}
+	if d.prog.mode&SanityCheckFunctions != 0 {
+		// Only check functions once all of them have been decoded, as
+		// the checks look at the free variables of closures.
+		for _, fn := range fns {
+			mustSanityCheck(fn, nil)
+		}
+	}
+}
+
+// funcDecoder decodes the body of a single function.
+type funcDecoder struct {
+	*decoder
+	fn     *Function
+	instrs []Instruction
+}
+
+func (fd *funcDecoder) body(b *decBuf) {
+	fn := fd.fn
+	fn.Blocks = make([]*BasicBlock, b.len())
+	for i := range fn.Blocks {
+		fn.Blocks[i] = &BasicBlock{Index: i, parent: fn}
+	}
+	block := func(idx uint64) *BasicBlock {
+		if idx >= uint64(len(fn.Blocks)) {
+			panic(decodingError{errBadEncoding})
+		}
+		return fn.Blocks[idx]
+	}
+	for _, blk := range fn.Blocks {
+		blk.Comment = fd.string(b)
+		blk.Preds = make([]*BasicBlock, b.len())
+		for i := range blk.Preds {
+			blk.Preds[i] = block(b.uint())
+		}
+		blk.Succs = blk.succs2[:0]
+		for n := b.len(); n > 0; n-- {
+			blk.Succs = append(blk.Succs, block(b.uint()))
+		}
+		blk.Instrs = make([]Instruction, b.len())
+		for i := range blk.Instrs {
+			instr := newInstruction(b.uint())
+			instr.setBlock(blk)
+			blk.Instrs[i] = instr
+			fd.instrs = append(fd.instrs, instr)
+		}
+	}
+	if idx := b.uint(); idx != 0 {
+		fn.Exit = block(idx - 1)
+	}
+
+	if n := b.len(); n > 0 {
+		fn.FreeVars = make([]*FreeVar, n)
+	}
+	for i := range fn.FreeVars {
+		fv := &FreeVar{parent: fn}
+		fv.id = ID(b.int())
+		fv.name = fd.string(b)
+		fv.typ = fd.typ(b)
+		fv.source = fd.source(b)
+		fn.FreeVars[i] = fv
+	}
+	if n := b.len(); n > 0 {
+		fn.Params = make([]*Parameter, n)
+	}
+	for i := range fn.Params {
+		p, ok := fd.instr(b.uint()).(*Parameter)
+		if !ok {
+			panic(decodingError{errBadEncoding})
+		}
+		fn.Params[i] = p
+	}
+	if n := b.len(); n > 0 {
+		fn.Locals = make([]*Alloc, n)
+	}
+	for i := range fn.Locals {
+		l, ok := fd.instr(b.uint()).(*Alloc)
+		if !ok {
+			panic(decodingError{errBadEncoding})
+		}
+		fn.Locals[i] = l
+	}
+
+	for _, instr := range fd.instrs {
+		fd.instruction(b, instr)
+	}
+}
+
+func newInstruction(op uint64) Instruction {
+	switch op {
+	case opParameter:
+		return new(Parameter)
+	case opConst:
+		return new(Const)
+	case opAggregateConst:
+		return new(AggregateConst)
+	case opArrayConst:
+		return new(ArrayConst)
+	case opGenericConst:
+		return new(GenericConst)
+	case opAlloc:
+		return new(Alloc)
+	case opSigma:
+		return new(Sigma)
+	case opCopy:
+		return new(Copy)
+	case opPhi:
+		return new(Phi)
+	case opCall:
+		return new(Call)
+	case opBinOp:
+		return new(BinOp)
+	case opUnOp:
+		return new(UnOp)
+	case opLoad:
+		return new(Load)
+	case opChangeType:
+		return new(ChangeType)
+	case opConvert:
+		return new(Convert)
+	case opChangeInterface:
+		return new(ChangeInterface)
+	case opSliceToArrayPointer:
+		return new(SliceToArrayPointer)
+	case opMakeInterface:
+		return new(MakeInterface)
+	case opMakeClosure:
+		return new(MakeClosure)
+	case opMakeMap:
+		return new(MakeMap)
+	case opMakeChan:
+		return new(MakeChan)
+	case opMakeSlice:
+		return new(MakeSlice)
+	case opSlice:
+		return new(Slice)
+	case opFieldAddr:
+		return new(FieldAddr)
+	case opField:
+		return new(Field)
+	case opIndexAddr:
+		return new(IndexAddr)
+	case opIndex:
+		return new(Index)
+	case opMapLookup:
+		return new(MapLookup)
+	case opStringLookup:
+		return new(StringLookup)
+	case opSelect:
+		return new(Select)
+	case opRange:
+		return new(Range)
+	case opNext:
+		return new(Next)
+	case opTypeAssert:
+		return new(TypeAssert)
+	case opExtract:
+		return new(Extract)
+	case opJump:
+		return new(Jump)
+	case opUnreachable:
+		return new(Unreachable)
+	case opIf:
+		return new(If)
+	case opConstantSwitch:
+		return new(ConstantSwitch)
+	case opTypeSwitch:
+		return new(TypeSwitch)
+	case opReturn:
+		return new(Return)
+	case opRunDefers:
+		return new(RunDefers)
+	case opPanic:
+		return new(Panic)
+	case opGo:
+		return new(Go)
+	case opDefer:
+		return new(Defer)
+	case opSend:
+		return new(Send)
+	case opRecv:
+		return new(Recv)
+	case opStore:
+		return new(Store)
+	case opBlankStore:
+		return new(BlankStore)
+	case opMapUpdate:
+		return new(MapUpdate)
+	case opDebugRef:
+		return new(DebugRef)
+	default:
+		panic(decodingError{errBadEncoding})
+	}
+}
+
+func (fd *funcDecoder) instr(idx uint64) Instruction {
+	if idx >= uint64(len(fd.instrs)) {
+		panic(decodingError{errBadEncoding})
+	}
+	return fd.instrs[idx]
+}
+
+func (fd *funcDecoder) value(b *decBuf) Value {
+	switch b.uint() {
+	case 0:
+		return nil
+	case valInstruction:
+		v, ok := fd.instr(b.uint()).(Value)
+		if !ok {
+			panic(decodingError{errBadEncoding})
+		}
+		return v
+	case valFreeVar:
+		idx := b.uint()
+		if idx >= uint64(len(fd.fn.FreeVars)) {
+			panic(decodingError{errBadEncoding})
+		}
+		return fd.fn.FreeVars[idx]
+	case valFunction:
+		return fd.funcRef(b.uint())
+	case valGlobal:
+		obj := fd.object(b.uint())
+		if obj == nil {
+			panic(decodingError{errBadEncoding})
+		}
+		fd.irPackage(obj.Pkg())
+		g, ok := fd.prog.packageLevelValue(obj).(*Global)
+		if !ok {
+			fd.errorf("couldn't find global %s", obj)
+		}
+		return g
+	case valMemberGlobal:
+		pkg := fd.pkgPath(b)
+		name := fd.string(b)
+		if pkg == nil {
+			panic(decodingError{errBadEncoding})
+		}
+		g, ok := fd.irPackage(pkg).Members[name].(*Global)
+		if !ok {
+			fd.errorf("couldn't find global %s in package %s", name, pkg.Path())
+		}
+		return g
+	case valBuiltin:
+		name := fd.string(b)
+		sig, ok := fd.typ(b).(*types.Signature)
+		if !ok {
+			panic(decodingError{errBadEncoding})
+		}
+		return &Builtin{name: name, sig: sig}
+	default:
+		panic(decodingError{errBadEncoding})
+	}
+}
+
+func (fd *funcDecoder) values(b *decBuf) []Value {
+	n := b.len()
+	if n == 0 {
+		return nil
+	}
+	vs := make([]Value, n)
+	for i := range vs {
+		vs[i] = fd.value(b)
+	}
+	return vs
+}
+
+func (fd *funcDecoder) constant(b *decBuf) constant.Value {
+	switch b.uint() {
+	case constNil:
+		return nil
+	case constBool:
+		return constant.MakeBool(b.bool())
+	case constString:
+		return constant.MakeString(string(b.bytes()))
+	case constInt:
+		return constant.ToInt(fd.number(b))
+	case constFloat:
+		return constant.ToFloat(fd.number(b))
+	case constComplex:
+		re := fd.number(b)
+		im := fd.number(b)
+		return constant.BinaryOp(re, token.ADD, constant.MakeImag(im))
+	case constUnknown:
+		return constant.MakeUnknown()
+	default:
+		panic(decodingError{errBadEncoding})
+	}
+}
+
+func (fd *funcDecoder) number(b *decBuf) constant.Value {
+	var r big.Rat
+	if err := r.UnmarshalText(b.bytes()); err != nil {
+		panic(decodingError{errBadEncoding})
+	}
+	if r.IsInt() {
+		return constant.Make(new(big.Int).Set(r.Num()))
+	}
+	return constant.Make(&r)
+}
+
+func (fd *funcDecoder) aggregate(b *decBuf, c *AggregateConst) {
+	c.Values = make([]Constant, b.len())
+	for i := range c.Values {
+		v, ok := newInstruction(b.uint()).(Constant)
+		if !ok {
+			panic(decodingError{errBadEncoding})
+		}
+		v.setType(fd.typ(b))
+		switch v := v.(type) {
+		case *Const:
+			v.Value = fd.constant(b)
+		case *AggregateConst:
+			fd.aggregate(b, v)
+		}
+		c.Values[i] = v
+	}
+}
+
+func (fd *funcDecoder) call(b *decBuf, c *CallCommon) {
+	c.Value = fd.value(b)
+	if b.bool() {
+		recv := fd.typ(b)
+		pkg := fd.pkgPath(b)
+		name := fd.string(b)
+		obj, _, _ := types.LookupFieldOrMethod(recv, false, pkg, name)
+		m, ok := obj.(*types.Func)
+		if !ok {
+			fd.errorf("couldn't find method %s of %s", name, recv)
+		}
+		c.Method = m
+	}
+	c.Args = fd.values(b)
+	if n := b.len(); n > 0 {
+		c.TypeArgs = make([]types.Type, n)
+		for i := range c.TypeArgs {
+			c.TypeArgs[i] = fd.typ(b)
+		}
+	}
+	c.Results = fd.value(b)
+}
+
+func (fd *funcDecoder) instruction(b *decBuf, instr Instruction) {
+	instr.setID(ID(b.int()))
+	if source := fd.source(b); source != nil {
+		instr.setSource(source)
+	}
+	if v, ok := instr.(interface{ setType(types.Type) }); ok {
+		v.setType(fd.typ(b))
+	}
+
+	switch instr := instr.(type) {
+	case *Parameter:
+		instr.name = fd.string(b)
+		instr.object = fd.paramObject(b)
+	case *Const:
+		instr.Value = fd.constant(b)
+	case *AggregateConst:
+		fd.aggregate(b, instr)
+	case *ArrayConst, *GenericConst:
+	case *Alloc:
+		instr.Heap = b.bool()
+	case *Sigma:
+		idx := b.uint()
+		if idx >= uint64(len(fd.fn.Blocks)) {
+			panic(decodingError{errBadEncoding})
+		}
+		instr.From = fd.fn.Blocks[idx]
+		instr.X = fd.value(b)
+	case *Copy:
+		instr.X = fd.value(b)
+		if idx := b.uint(); idx != 0 {
+			instr.Why = fd.instr(idx - 1)
+		}
+		instr.Info = CopyInfo(b.uint())
+	case *Phi:
+		instr.Edges = fd.values(b)
+	case *Call:
+		fd.call(b, &instr.Call)
+	case *BinOp:
+		instr.Op = token.Token(b.uint())
+		instr.X = fd.value(b)
+		instr.Y = fd.value(b)
+	case *UnOp:
+		instr.Op = token.Token(b.uint())
+		instr.X = fd.value(b)
+	case *Load:
+		instr.X = fd.value(b)
+	case *ChangeType:
+		instr.X = fd.value(b)
+	case *Convert:
+		instr.X = fd.value(b)
+	case *ChangeInterface:
+		instr.X = fd.value(b)
+	case *SliceToArrayPointer:
+		instr.X = fd.value(b)
+	case *MakeInterface:
+		instr.X = fd.value(b)
+	case *MakeClosure:
+		instr.Fn = fd.value(b)
+		instr.Bindings = fd.values(b)
+	case *MakeMap:
+		instr.Reserve = fd.value(b)
+	case *MakeChan:
+		instr.Size = fd.value(b)
+	case *MakeSlice:
+		instr.Len = fd.value(b)
+		instr.Cap = fd.value(b)
+	case *Slice:
+		instr.X = fd.value(b)
+		instr.Low = fd.value(b)
+		instr.High = fd.value(b)
+		instr.Max = fd.value(b)
+	case *FieldAddr:
+		instr.X = fd.value(b)
+		instr.Field = int(b.uint())
+	case *Field:
+		instr.X = fd.value(b)
+		instr.Field = int(b.uint())
+	case *IndexAddr:
+		instr.X = fd.value(b)
+		instr.Index = fd.value(b)
+	case *Index:
+		instr.X = fd.value(b)
+		instr.Index = fd.value(b)
+	case *MapLookup:
+		instr.X = fd.value(b)
+		instr.Index = fd.value(b)
+		instr.CommaOk = b.bool()
+	case *StringLookup:
+		instr.X = fd.value(b)
+		instr.Index = fd.value(b)
+	case *Select:
+		instr.States = make([]*SelectState, b.len())
+		for i := range instr.States {
+			st := &SelectState{}
+			st.Dir = types.ChanDir(b.uint())
+			st.Chan = fd.value(b)
+			st.Send = fd.value(b)
+			st.Pos = fd.pos(b)
+			instr.States[i] = st
+		}
+		instr.Blocking = b.bool()
+	case *Range:
+		instr.X = fd.value(b)
+	case *Next:
+		instr.Iter = fd.value(b)
+		instr.IsString = b.bool()
+	case *TypeAssert:
+		instr.X = fd.value(b)
+		instr.AssertedType = fd.typ(b)
+		instr.CommaOk = b.bool()
+	case *Extract:
+		instr.Tuple = fd.value(b)
+		instr.Index = int(b.uint())
+	case *Jump:
+		instr.Comment = fd.string(b)
+	case *Unreachable:
+	case *If:
+		instr.Cond = fd.value(b)
+	case *ConstantSwitch:
+		instr.Tag = fd.value(b)
+		instr.Conds = fd.values(b)
+	case *TypeSwitch:
+		instr.Tag = fd.value(b)
+		instr.Conds = make([]types.Type, b.len())
+		for i := range instr.Conds {
+			instr.Conds[i] = fd.typ(b)
+		}
+	case *Return:
+		instr.Results = fd.values(b)
+	case *RunDefers:
+	case *Panic:
+		instr.X = fd.value(b)
+	case *Go:
+		fd.call(b, &instr.Call)
+	case *Defer:
+		fd.call(b, &instr.Call)
+	case *Send:
+		instr.Chan = fd.value(b)
+		instr.X = fd.value(b)
+	case *Recv:
+		instr.Chan = fd.value(b)
+		instr.CommaOk = b.bool()
+	case *Store:
+		instr.Addr = fd.value(b)
+		instr.Val = fd.value(b)
+	case *BlankStore:
+		instr.Val = fd.value(b)
+	case *MapUpdate:
+		instr.Map = fd.value(b)
+		instr.Key = fd.value(b)
+		instr.Value = fd.value(b)
+	case *DebugRef:
+		instr.Expr = fd.debugExpr(b)
+		instr.object = fd.paramObject(b)
+		instr.IsAddr = b.bool()
+		instr.X = fd.value(b)
+	default:
+		panic(fmt.Sprintf("unhandled instruction %T", instr))
+	}
+}
+
+func (fd *funcDecoder) paramObject(b *decBuf) types.Object {
+	switch b.uint() {
+	case paramNoObject:
+		return nil
+	case paramObject:
+		return fd.object(b.uint())
+	case paramSignature:
+		return signatureVar(fd.fn.Signature, int(b.uint()))
+	default:
+		panic(decodingError{errBadEncoding})
+	}
+}
+
+// debugExpr decodes the expression of a DebugRef. The expression has
+// the same type and extent as the original one, but its operands are
+// *ast.BadExpr.
+func (fd *funcDecoder) debugExpr(b *decBuf) ast.Expr {
+	kind := b.uint()
+	var name string
+	var op token.Token
+	var lit token.Token
+	switch kind {
+	case exprIdent, exprSelector:
+		name = fd.string(b)
+	case exprBasicLit:
+		lit = token.Token(b.uint())
+		name = fd.string(b)
+	case exprUnary, exprBinary:
+		op = token.Token(b.uint())
+	}
+	pos := fd.pos(b)
+	end := fd.pos(b)
+	// Operands that make up the start and the end of the expression.
+	first := &ast.BadExpr{From: pos, To: pos}
+	last := &ast.BadExpr{From: end, To: end}
+
+	switch kind {
+	case exprOther:
+		return &ast.BadExpr{From: pos, To: end}
+	case exprIdent:
+		return &ast.Ident{NamePos: pos, Name: name}
+	case exprBasicLit:
+		return &ast.BasicLit{ValuePos: pos, Kind: lit, Value: name}
+	case exprFuncLit:
+		return &ast.FuncLit{Type: &ast.FuncType{Func: pos}, Body: &ast.BlockStmt{Rbrace: end - 1}}
+	case exprCompositeLit:
+		return &ast.CompositeLit{Lbrace: pos, Rbrace: end - 1}
+	case exprSelector:
+		return &ast.SelectorExpr{X: first, Sel: &ast.Ident{NamePos: end - token.Pos(len(name)), Name: name}}
+	case exprIndex:
+		return &ast.IndexExpr{X: first, Rbrack: end - 1}
+	case exprIndexList:
+		return &typeparams.IndexListExpr{X: first, Rbrack: end - 1}
+	case exprSlice:
+		return &ast.SliceExpr{X: first, Rbrack: end - 1}
+	case exprTypeAssert:
+		return &ast.TypeAssertExpr{X: first, Rparen: end - 1}
+	case exprCall:
+		return &ast.CallExpr{Fun: first, Rparen: end - 1}
+	case exprStar:
+		return &ast.StarExpr{Star: pos, X: last}
+	case exprUnary:
+		return &ast.UnaryExpr{OpPos: pos, Op: op, X: last}
+	case exprBinary:
+		return &ast.BinaryExpr{X: first, Op: op, Y: last}
+	default:
+		panic(decodingError{errBadEncoding})
+	}
+}
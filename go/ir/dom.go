@@ -403,10 +403,9 @@ func printDomTreeText(buf *bytes.Buffer, v *BasicBlock, indent int) {
 	}
 }
 
-// printDomTreeDot prints the dominator tree of f in AT&T GraphViz
+// PrintDomTreeDot prints the dominator tree of f in AT&T GraphViz
 // (.dot) format.
-//lint:ignore U1000 used during debugging
-func printDomTreeDot(buf io.Writer, f *Function) {
+func PrintDomTreeDot(buf io.Writer, f *Function) {
 	fmt.Fprintln(buf, "//", f)
 	fmt.Fprintln(buf, "digraph domtree {")
 	for i, b := range f.Blocks {
@@ -416,7 +415,7 @@ func printDomTreeDot(buf io.Writer, f *Function) {
 		// belonging to both dominator tree and CFG.
 
 		// Dominator tree edge.
-		if i != 0 {
+		if i != 0 && v.idom != nil {
 			fmt.Fprintf(buf, "\tn%d -> n%d [style=\"solid\",weight=100];\n", v.idom.dom.pre, v.pre)
 		}
 		// CFG edges.
@@ -424,7 +423,8 @@ func printDomTreeDot(buf io.Writer, f *Function) {
 			fmt.Fprintf(buf, "\tn%d -> n%d [style=\"dotted\",weight=0];\n", pred.dom.pre, v.pre)
 		}
 
-		if f.fakeExits.Has(b) {
+		// Fake exits are only known while building the function.
+		if f.functionBody != nil && f.fakeExits.Has(b) {
 			fmt.Fprintf(buf, "\tn%d -> n%d [style=\"dotted\",weight=0,color=red];\n", b.dom.pre, f.Exit.dom.pre)
 		}
 	}
@@ -440,10 +440,9 @@ func printPostDomTreeText(buf io.Writer, v *BasicBlock, indent int) {
 	}
 }
 
-// printDomTreeDot prints the dominator tree of f in AT&T GraphViz
-// (.dot) format.
-//lint:ignore U1000 used during debugging
-func printPostDomTreeDot(buf io.Writer, f *Function) {
+// PrintPostDomTreeDot prints the post-dominator tree of f in AT&T
+// GraphViz (.dot) format.
+func PrintPostDomTreeDot(buf io.Writer, f *Function) {
 	fmt.Fprintln(buf, "//", f)
 	fmt.Fprintln(buf, "digraph pdomtree {")
 	for _, b := range f.Blocks {
@@ -453,7 +452,7 @@ func printPostDomTreeDot(buf io.Writer, f *Function) {
 		// belonging to both dominator tree and CFG.
 
 		// Dominator tree edge.
-		if b != f.Exit {
+		if b != f.Exit && v.idom != nil {
 			fmt.Fprintf(buf, "\tn%d -> n%d [style=\"solid\",weight=100];\n", v.idom.pdom.pre, v.pre)
 		}
 		// CFG edges.
@@ -461,8 +460,8 @@ func printPostDomTreeDot(buf io.Writer, f *Function) {
 			fmt.Fprintf(buf, "\tn%d -> n%d [style=\"dotted\",weight=0];\n", pred.pdom.pre, v.pre)
 		}
 
-		if f.fakeExits.Has(b) {
-			fmt.Fprintf(buf, "\tn%d -> n%d [style=\"dotted\",weight=0,color=red];\n", b.dom.pre, f.Exit.dom.pre)
+		if f.functionBody != nil && f.fakeExits.Has(b) {
+			fmt.Fprintf(buf, "\tn%d -> n%d [style=\"dotted\",weight=0,color=red];\n", b.pdom.pre, f.Exit.pdom.pre)
 		}
 	}
 	fmt.Fprintln(buf, "}")
@@ -0,0 +1,1351 @@
+package ir
+
+// This file implements a compact binary encoding of the IR of
+// packages and functions, which allows storing IR on disk and loading
+// it without having to rebuild it from source.
+//
+// The encoding consists of a header, followed by tables of strings,
+// files, objects, types and functions, and finally the bodies of the
+// functions. Objects, types and functions refer to each other by
+// their index in the respective table. Objects and types that belong
+// to other packages are encoded as references that the decoder
+// resolves by looking them up in the packages' type information.
+// Local types and other objects that cannot be referenced by name
+// are encoded structurally.
+//
+// Syntax isn't part of the encoding. Decoded instructions retain
+// their positions, but their Source method returns nil. The
+// expressions of DebugRef instructions are replaced by placeholders
+// of the same type that only have positions, and identifiers.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"io"
+	"math/big"
+
+	"honnef.co/go/tools/go/types/typeutil"
+
+	"golang.org/x/exp/typeparams"
+)
+
+var universeAny = types.Universe.Lookup("any").Type()
+
+const (
+	encodingMagic   = "staticcheck IR"
+	encodingVersion = 2
+)
+
+// Kinds of entries in the object table.
+const (
+	objPackageLevel   = iota + 1 // package path, name
+	objMethod                    // receiver type name, method name
+	objFuncTypeParam             // function, index
+	objRecvTypeParam             // method, index
+	objNamedTypeParam            // type name, index
+	objParam                     // function, index into receiver, params and results
+	objVar                       // package path, name, position, type, field, embedded
+)
+
+// Kinds of entries in the type table.
+const (
+	typBasic = iota + 1
+	typPointer
+	typSlice
+	typArray
+	typMap
+	typChan
+	typTuple
+	typStruct
+	typSignature
+	typInterface
+	typUnion
+	typNamed
+	typLocalNamed
+	typTypeParam
+	typUniverse
+	typIterator
+)
+
+// Kinds of entries in the function table.
+const (
+	fnObject    = iota + 1 // a function or method with an object
+	fnMember               // a package member without an object, such as init#1
+	fnAnonymous            // an anonymous function
+	fnInstance             // an instantiation of a generic function
+	fnSynthetic            // any other function
+)
+
+// Kinds of values.
+const (
+	valInstruction = iota + 1
+	valFreeVar
+	valFunction
+	valGlobal
+	valMemberGlobal
+	valBuiltin
+)
+
+// Kinds of constants.
+const (
+	constNil = iota
+	constBool
+	constString
+	constInt
+	constFloat
+	constComplex
+	constUnknown
+)
+
+// Kinds of parameter objects.
+const (
+	paramNoObject = iota
+	paramObject
+	paramSignature
+)
+
+// Opcodes of instructions.
+const (
+	opParameter = iota + 1
+	opConst
+	opAggregateConst
+	opArrayConst
+	opGenericConst
+	opAlloc
+	opSigma
+	opCopy
+	opPhi
+	opCall
+	opBinOp
+	opUnOp
+	opLoad
+	opChangeType
+	opConvert
+	opChangeInterface
+	opSliceToArrayPointer
+	opMakeInterface
+	opMakeClosure
+	opMakeMap
+	opMakeChan
+	opMakeSlice
+	opSlice
+	opFieldAddr
+	opField
+	opIndexAddr
+	opIndex
+	opMapLookup
+	opStringLookup
+	opSelect
+	opRange
+	opNext
+	opTypeAssert
+	opExtract
+	opJump
+	opUnreachable
+	opIf
+	opConstantSwitch
+	opTypeSwitch
+	opReturn
+	opRunDefers
+	opPanic
+	opGo
+	opDefer
+	opSend
+	opRecv
+	opStore
+	opBlankStore
+	opMapUpdate
+	opDebugRef
+)
+
+// Kinds of expressions of DebugRef instructions.
+const (
+	exprOther = iota
+	exprIdent
+	exprBasicLit
+	exprFuncLit
+	exprCompositeLit
+	exprSelector
+	exprIndex
+	exprIndexList
+	exprSlice
+	exprTypeAssert
+	exprCall
+	exprStar
+	exprUnary
+	exprBinary
+)
+
+// encBuf is a buffer with methods for writing the primitives of the
+// encoding.
+type encBuf struct {
+	bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (b *encBuf) uint(x uint64) {
+	n := binary.PutUvarint(b.scratch[:], x)
+	b.Write(b.scratch[:n])
+}
+
+func (b *encBuf) int(x int64) {
+	n := binary.PutVarint(b.scratch[:], x)
+	b.Write(b.scratch[:n])
+}
+
+func (b *encBuf) bool(x bool) {
+	if x {
+		b.WriteByte(1)
+	} else {
+		b.WriteByte(0)
+	}
+}
+
+func (b *encBuf) bytes(x []byte) {
+	b.uint(uint64(len(x)))
+	b.Write(x)
+}
+
+type encoder struct {
+	prog *Program
+
+	strings    map[string]uint64
+	stringList []string
+	files      map[*token.File]uint64
+	fileList   []*token.File
+	objects    map[types.Object]uint64
+	objectList [][]byte
+	types      map[types.Type]uint64
+	typeList   [][]byte
+	funcs      map[*Function]uint64
+	funcList   []*Function
+	funcHdrs   [][]byte
+
+	// tparams maps type parameters to entries in the object table,
+	// for the packages in tparamPkgs.
+	tparams    map[*typeparams.TypeParam][]byte
+	tparamPkgs map[*types.Package]bool
+
+	err error
+}
+
+// An encodingError is used to abort encoding.
+type encodingError struct{ err error }
+
+func newEncoder(prog *Program) *encoder {
+	return &encoder{
+		prog:       prog,
+		strings:    map[string]uint64{},
+		files:      map[*token.File]uint64{},
+		objects:    map[types.Object]uint64{},
+		types:      map[types.Type]uint64{},
+		funcs:      map[*Function]uint64{},
+		tparams:    map[*typeparams.TypeParam][]byte{},
+		tparamPkgs: map[*types.Package]bool{},
+	}
+}
+
+func (e *encoder) errorf(format string, args ...interface{}) {
+	panic(encodingError{fmt.Errorf(format, args...)})
+}
+
+// EncodePackage writes the binary encoding of the IR of pkg to w. It
+// includes all functions of the package, their anonymous functions
+// and instantiations, as well as the synthetic functions they refer
+// to. Functions of other packages are encoded as references.
+//
+// The encoding can be decoded with Program.DecodePackage.
+func EncodePackage(w io.Writer, pkg *Package) (err error) {
+	e := newEncoder(pkg.Prog)
+	defer e.recover(&err)
+
+	var add func(fn *Function)
+	add = func(fn *Function) {
+		e.function(fn)
+		for _, anon := range fn.AnonFuncs {
+			add(anon)
+		}
+		for _, inst := range fn.instances {
+			add(inst)
+		}
+	}
+	for _, fn := range pkg.Functions {
+		add(fn)
+	}
+	return e.finish(w, pkg.Pkg)
+}
+
+// EncodeFunction writes the binary encoding of the IR of fn and its
+// anonymous functions to w. All other functions, including the
+// other functions of fn's package, are encoded as references.
+//
+// The encoding can be decoded with Program.DecodeFunction.
+func EncodeFunction(w io.Writer, fn *Function) (err error) {
+	e := newEncoder(fn.Prog)
+	defer e.recover(&err)
+
+	e.synthetic(fn)
+	var add func(fn *Function)
+	add = func(fn *Function) {
+		for _, anon := range fn.AnonFuncs {
+			e.function(anon)
+			add(anon)
+		}
+	}
+	add(fn)
+	return e.finish(w, fn.pkg())
+}
+
+func (e *encoder) recover(err *error) {
+	if r := recover(); r != nil {
+		if eerr, ok := r.(encodingError); ok {
+			*err = eerr.err
+			return
+		}
+		panic(r)
+	}
+}
+
+// finish encodes the bodies of all functions in the function table
+// and writes the complete encoding to w.
+func (e *encoder) finish(w io.Writer, pkg *types.Package) error {
+	// Encoding bodies may add more functions to the table.
+	var bodies [][]byte
+	for i := 0; i < len(e.funcList); i++ {
+		bodies = append(bodies, e.body(e.funcList[i]))
+	}
+
+	var out encBuf
+	out.WriteString(encodingMagic)
+	out.uint(encodingVersion)
+	if pkg != nil {
+		out.bytes([]byte(pkg.Path()))
+	} else {
+		out.bytes(nil)
+	}
+
+	out.uint(uint64(len(e.stringList)))
+	for _, s := range e.stringList {
+		out.bytes([]byte(s))
+	}
+
+	out.uint(uint64(len(e.fileList)))
+	for _, f := range e.fileList {
+		out.bytes([]byte(f.Name()))
+		out.uint(uint64(f.Size()))
+		out.uint(uint64(f.LineCount()))
+		prev := 0
+		for line := 1; line <= f.LineCount(); line++ {
+			off := f.Offset(f.LineStart(line))
+			out.uint(uint64(off - prev))
+			prev = off
+		}
+	}
+
+	for _, table := range [][][]byte{e.objectList, e.typeList, e.funcHdrs, bodies} {
+		out.uint(uint64(len(table)))
+		for _, rec := range table {
+			out.bytes(rec)
+		}
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func (e *encoder) string(b *encBuf, s string) {
+	idx, ok := e.strings[s]
+	if !ok {
+		idx = uint64(len(e.stringList))
+		e.strings[s] = idx
+		e.stringList = append(e.stringList, s)
+	}
+	b.uint(idx)
+}
+
+func (e *encoder) pos(b *encBuf, pos token.Pos) {
+	if !pos.IsValid() {
+		b.uint(0)
+		return
+	}
+	f := e.prog.Fset.File(pos)
+	if f == nil {
+		b.uint(0)
+		return
+	}
+	idx, ok := e.files[f]
+	if !ok {
+		idx = uint64(len(e.fileList))
+		e.files[f] = idx
+		e.fileList = append(e.fileList, f)
+	}
+	b.uint(idx + 1)
+	b.uint(uint64(f.Offset(pos)))
+}
+
+func (e *encoder) pkgPath(b *encBuf, pkg *types.Package) {
+	if pkg == nil {
+		b.bool(false)
+		return
+	}
+	b.bool(true)
+	e.string(b, pkg.Path())
+}
+
+// object returns the index+1 of obj in the object table, or 0 if obj
+// cannot be encoded.
+func (e *encoder) object(obj types.Object) uint64 {
+	if obj == nil {
+		return 0
+	}
+	if idx, ok := e.objects[obj]; ok {
+		return idx
+	}
+	var b encBuf
+	if !e.objectRecord(&b, obj) {
+		e.objects[obj] = 0
+		return 0
+	}
+	e.objectList = append(e.objectList, b.Bytes())
+	idx := uint64(len(e.objectList))
+	e.objects[obj] = idx
+	return idx
+}
+
+func (e *encoder) objectRecord(b *encBuf, obj types.Object) bool {
+	pkg := obj.Pkg()
+	scope := types.Universe
+	if pkg != nil {
+		scope = pkg.Scope()
+	}
+	if scope.Lookup(obj.Name()) == obj {
+		b.uint(objPackageLevel)
+		e.pkgPath(b, pkg)
+		e.string(b, obj.Name())
+		return true
+	}
+
+	switch obj := obj.(type) {
+	case *types.Func:
+		sig := obj.Type().(*types.Signature)
+		if sig.Recv() == nil {
+			return false
+		}
+		named, ok := deref(sig.Recv().Type()).(*types.Named)
+		if !ok {
+			return false
+		}
+		// Methods of generic types have receivers that are
+		// instantiated with the methods' type parameters.
+		tname := e.object(typeparams.NamedTypeOrigin(named).(*types.Named).Obj())
+		if tname == 0 {
+			return false
+		}
+		b.uint(objMethod)
+		b.uint(tname)
+		e.string(b, obj.Name())
+		return true
+	case *types.TypeName:
+		tparam, ok := obj.Type().(*typeparams.TypeParam)
+		if !ok || pkg == nil {
+			return false
+		}
+		e.scanTypeParams(pkg)
+		rec, ok := e.tparams[tparam]
+		if !ok {
+			return false
+		}
+		b.Write(rec)
+		return true
+	default:
+		return false
+	}
+}
+
+// scanTypeParams records how to refer to the type parameters of all
+// generic functions, methods and types in pkg.
+func (e *encoder) scanTypeParams(pkg *types.Package) {
+	if e.tparamPkgs[pkg] {
+		return
+	}
+	e.tparamPkgs[pkg] = true
+	add := func(kind int, owner types.Object, tparams *typeparams.TypeParamList) {
+		for i := 0; i < tparams.Len(); i++ {
+			tparam := tparams.At(i)
+			if _, ok := e.tparams[tparam]; ok {
+				continue
+			}
+			ownerIdx := e.object(owner)
+			if ownerIdx == 0 {
+				continue
+			}
+			var b encBuf
+			b.uint(uint64(kind))
+			b.uint(ownerIdx)
+			b.uint(uint64(i))
+			e.tparams[tparam] = b.Bytes()
+		}
+	}
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		switch obj := scope.Lookup(name).(type) {
+		case *types.Func:
+			add(objFuncTypeParam, obj, typeparams.ForSignature(obj.Type().(*types.Signature)))
+		case *types.TypeName:
+			named, ok := obj.Type().(*types.Named)
+			if !ok {
+				continue
+			}
+			add(objNamedTypeParam, obj, typeparams.ForNamed(named))
+			for i := 0; i < named.NumMethods(); i++ {
+				m := named.Method(i)
+				add(objRecvTypeParam, m, typeparams.RecvTypeParams(m.Type().(*types.Signature)))
+			}
+		}
+	}
+}
+
+// typ returns the index of t in the type table.
+func (e *encoder) typ(t types.Type) uint64 {
+	if idx, ok := e.types[t]; ok {
+		return idx
+	}
+	// Reserve the index before encoding the type, to support
+	// recursive local types.
+	idx := uint64(len(e.typeList))
+	e.types[t] = idx
+	e.typeList = append(e.typeList, nil)
+	var b encBuf
+	e.typeRecord(&b, t)
+	e.typeList[idx] = b.Bytes()
+	return idx
+}
+
+func (e *encoder) vars(b *encBuf, vars *types.Tuple) {
+	b.uint(uint64(vars.Len()))
+	for i := 0; i < vars.Len(); i++ {
+		v := vars.At(i)
+		e.string(b, v.Name())
+		e.pkgPath(b, v.Pkg())
+		b.uint(e.typ(v.Type()))
+	}
+}
+
+func (e *encoder) typeRecord(b *encBuf, t types.Type) {
+	switch t := t.(type) {
+	case *types.Basic:
+		if types.Typ[t.Kind()] == t {
+			b.uint(typBasic)
+			b.uint(uint64(t.Kind()))
+		} else {
+			// byte and rune
+			b.uint(typUniverse)
+			e.string(b, t.Name())
+		}
+	case *types.Pointer:
+		b.uint(typPointer)
+		b.uint(e.typ(t.Elem()))
+	case *types.Slice:
+		b.uint(typSlice)
+		b.uint(e.typ(t.Elem()))
+	case *types.Array:
+		b.uint(typArray)
+		b.uint(e.typ(t.Elem()))
+		b.int(t.Len())
+	case *types.Map:
+		b.uint(typMap)
+		b.uint(e.typ(t.Key()))
+		b.uint(e.typ(t.Elem()))
+	case *types.Chan:
+		b.uint(typChan)
+		b.uint(uint64(t.Dir()))
+		b.uint(e.typ(t.Elem()))
+	case *types.Tuple:
+		b.uint(typTuple)
+		e.vars(b, t)
+	case *types.Struct:
+		b.uint(typStruct)
+		b.uint(uint64(t.NumFields()))
+		for i := 0; i < t.NumFields(); i++ {
+			f := t.Field(i)
+			e.string(b, f.Name())
+			e.pkgPath(b, f.Pkg())
+			b.uint(e.typ(f.Type()))
+			b.bool(f.Embedded())
+			e.string(b, t.Tag(i))
+		}
+	case *types.Signature:
+		// Receiver type parameters are dropped; they are only
+		// meaningful for the signatures of declared methods, which
+		// we refer to via their objects.
+		if typeparams.ForSignature(t).Len() != 0 {
+			e.errorf("cannot encode generic signature %s", t)
+		}
+		b.uint(typSignature)
+		if recv := t.Recv(); recv != nil {
+			b.bool(true)
+			e.string(b, recv.Name())
+			e.pkgPath(b, recv.Pkg())
+			b.uint(e.typ(recv.Type()))
+		} else {
+			b.bool(false)
+		}
+		e.vars(b, t.Params())
+		e.vars(b, t.Results())
+		b.bool(t.Variadic())
+	case *types.Interface:
+		if t == universeAny {
+			// any is identical to, but prints differently from,
+			// interface{}.
+			b.uint(typUniverse)
+			e.string(b, "any")
+			return
+		}
+		b.uint(typInterface)
+		b.uint(uint64(t.NumExplicitMethods()))
+		for i := 0; i < t.NumExplicitMethods(); i++ {
+			m := t.ExplicitMethod(i)
+			sig := m.Type().(*types.Signature)
+			e.string(b, m.Name())
+			e.pkgPath(b, m.Pkg())
+			e.vars(b, sig.Params())
+			e.vars(b, sig.Results())
+			b.bool(sig.Variadic())
+		}
+		b.uint(uint64(t.NumEmbeddeds()))
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			b.uint(e.typ(t.EmbeddedType(i)))
+		}
+	case *typeparams.Union:
+		b.uint(typUnion)
+		b.uint(uint64(t.Len()))
+		for i := 0; i < t.Len(); i++ {
+			term := t.Term(i)
+			b.bool(term.Tilde())
+			b.uint(e.typ(term.Type()))
+		}
+	case *types.Named:
+		origin := typeparams.NamedTypeOrigin(t).(*types.Named)
+		if obj := e.object(origin.Obj()); obj != 0 {
+			b.uint(typNamed)
+			b.uint(obj)
+			targs := typeparams.NamedTypeArgs(t)
+			b.uint(uint64(targs.Len()))
+			for i := 0; i < targs.Len(); i++ {
+				b.uint(e.typ(targs.At(i)))
+			}
+			return
+		}
+		// A type declared inside a function. Such types cannot
+		// have type parameters or methods of their own.
+		obj := t.Obj()
+		b.uint(typLocalNamed)
+		e.string(b, obj.Name())
+		e.pkgPath(b, obj.Pkg())
+		e.pos(b, obj.Pos())
+		b.uint(e.typ(t.Underlying()))
+	case *typeutil.Iterator:
+		b.uint(typIterator)
+		b.uint(e.typ(t.Elem()))
+	case *typeparams.TypeParam:
+		obj := e.object(t.Obj())
+		if obj == 0 {
+			e.errorf("cannot encode type parameter %s", t)
+		}
+		b.uint(typTypeParam)
+		b.uint(obj)
+	default:
+		e.errorf("cannot encode type %T", t)
+	}
+}
+
+// function adds fn to the function table and returns its index.
+func (e *encoder) function(fn *Function) uint64 {
+	if idx, ok := e.funcs[fn]; ok {
+		return idx
+	}
+
+	var b encBuf
+	switch {
+	case fn.parent != nil:
+		if _, ok := e.funcs[fn.parent]; !ok {
+			// Anonymous functions can only be referred to by
+			// their parents, which we encode first.
+			e.errorf("anonymous function %s referenced before its parent", fn)
+		}
+		b.uint(fnAnonymous)
+		b.uint(e.funcs[fn.parent])
+		e.string(&b, fn.name)
+		b.uint(e.typ(fn.Signature))
+	case fn.origin != nil && e.hasFunction(fn.origin):
+		b.uint(fnInstance)
+		b.uint(e.funcs[fn.origin])
+		e.string(&b, fn.name)
+		b.uint(e.typ(fn.Signature))
+		b.uint(uint64(len(fn.typeArgs)))
+		for _, targ := range fn.typeArgs {
+			b.uint(e.typ(targ))
+		}
+	case fn.Pkg != nil && fn.origin == nil && fn.object != nil && fn.Prog.packageLevelValue(fn.object) == fn && e.object(fn.object) != 0:
+		b.uint(fnObject)
+		b.uint(e.object(fn.object))
+	case fn.Pkg != nil && fn.Pkg.Members[fn.name] == Member(fn):
+		b.uint(fnMember)
+		e.pkgPath(&b, fn.Pkg.Pkg)
+		e.string(&b, fn.name)
+		b.uint(e.typ(fn.Signature))
+	default:
+		return e.synthetic(fn)
+	}
+	e.addFunction(fn, &b)
+	return e.funcs[fn]
+}
+
+func (e *encoder) hasFunction(fn *Function) bool {
+	_, ok := e.funcs[fn]
+	return ok
+}
+
+// synthetic adds fn to the function table as a self-contained
+// function.
+func (e *encoder) synthetic(fn *Function) uint64 {
+	var b encBuf
+	b.uint(fnSynthetic)
+	e.string(&b, fn.name)
+	obj := e.object(fn.object)
+	b.uint(obj)
+	// Generic signatures can only be referred to via their objects.
+	if obj != 0 && fn.object.Type() == fn.Signature {
+		b.bool(true)
+	} else {
+		b.bool(false)
+		b.uint(e.typ(fn.Signature))
+	}
+	e.pkgPath(&b, fn.pkg())
+	if fn.method != nil {
+		// Thunks use the selection for their names.
+		b.bool(true)
+		b.uint(e.typ(fn.method.Recv()))
+	} else {
+		b.bool(false)
+	}
+	e.addFunction(fn, &b)
+	return e.funcs[fn]
+}
+
+func (e *encoder) addFunction(fn *Function, b *encBuf) {
+	b.uint(uint64(fn.Synthetic))
+	b.uint(uint64(fn.NoReturn))
+	e.source(b, fn.syntax())
+	b.bool(fn.Blocks != nil)
+	e.funcs[fn] = uint64(len(e.funcList))
+	e.funcList = append(e.funcList, fn)
+	e.funcHdrs = append(e.funcHdrs, b.Bytes())
+}
+
+func (e *encoder) source(b *encBuf, source ast.Node) {
+	if source == nil {
+		b.bool(false)
+		return
+	}
+	b.bool(true)
+	e.pos(b, source.Pos())
+	e.pos(b, source.End())
+}
+
+// funcEncoder encodes the body of a single function.
+type funcEncoder struct {
+	*encoder
+	fn       *Function
+	instrs   map[Instruction]uint64
+	freeVars map[*FreeVar]uint64
+}
+
+func (e *encoder) body(fn *Function) []byte {
+	if fn.Blocks == nil {
+		return nil
+	}
+	fe := &funcEncoder{
+		encoder:  e,
+		fn:       fn,
+		instrs:   map[Instruction]uint64{},
+		freeVars: map[*FreeVar]uint64{},
+	}
+	var b encBuf
+
+	// Blocks, and the opcodes of their instructions
+	b.uint(uint64(len(fn.Blocks)))
+	for _, block := range fn.Blocks {
+		e.string(&b, block.Comment)
+		b.uint(uint64(len(block.Preds)))
+		for _, pred := range block.Preds {
+			b.uint(uint64(pred.Index))
+		}
+		b.uint(uint64(len(block.Succs)))
+		for _, succ := range block.Succs {
+			b.uint(uint64(succ.Index))
+		}
+		b.uint(uint64(len(block.Instrs)))
+		for _, instr := range block.Instrs {
+			fe.instrs[instr] = uint64(len(fe.instrs))
+			b.uint(uint64(e.opcode(instr)))
+		}
+	}
+	if fn.Exit != nil {
+		b.uint(uint64(fn.Exit.Index + 1))
+	} else {
+		b.uint(0)
+	}
+
+	b.uint(uint64(len(fn.FreeVars)))
+	for i, fv := range fn.FreeVars {
+		fe.freeVars[fv] = uint64(i)
+		b.int(int64(fv.id))
+		e.string(&b, fv.name)
+		b.uint(e.typ(fv.typ))
+		e.source(&b, fv.syntax())
+	}
+	b.uint(uint64(len(fn.Params)))
+	for _, p := range fn.Params {
+		b.uint(fe.instrs[p])
+	}
+	b.uint(uint64(len(fn.Locals)))
+	for _, l := range fn.Locals {
+		b.uint(fe.instrs[l])
+	}
+
+	for _, block := range fn.Blocks {
+		for _, instr := range block.Instrs {
+			fe.instr(&b, instr)
+		}
+	}
+	return b.Bytes()
+}
+
+// opcode returns the opcode of instr, failing the encoding for
+// instructions that we don't know how to encode.
+func (e *encoder) opcode(instr Instruction) int {
+	switch instr.(type) {
+	case *Parameter:
+		return opParameter
+	case *Const:
+		return opConst
+	case *AggregateConst:
+		return opAggregateConst
+	case *ArrayConst:
+		return opArrayConst
+	case *GenericConst:
+		return opGenericConst
+	case *Alloc:
+		return opAlloc
+	case *Sigma:
+		return opSigma
+	case *Copy:
+		return opCopy
+	case *Phi:
+		return opPhi
+	case *Call:
+		return opCall
+	case *BinOp:
+		return opBinOp
+	case *UnOp:
+		return opUnOp
+	case *Load:
+		return opLoad
+	case *ChangeType:
+		return opChangeType
+	case *Convert:
+		return opConvert
+	case *ChangeInterface:
+		return opChangeInterface
+	case *SliceToArrayPointer:
+		return opSliceToArrayPointer
+	case *MakeInterface:
+		return opMakeInterface
+	case *MakeClosure:
+		return opMakeClosure
+	case *MakeMap:
+		return opMakeMap
+	case *MakeChan:
+		return opMakeChan
+	case *MakeSlice:
+		return opMakeSlice
+	case *Slice:
+		return opSlice
+	case *FieldAddr:
+		return opFieldAddr
+	case *Field:
+		return opField
+	case *IndexAddr:
+		return opIndexAddr
+	case *Index:
+		return opIndex
+	case *MapLookup:
+		return opMapLookup
+	case *StringLookup:
+		return opStringLookup
+	case *Select:
+		return opSelect
+	case *Range:
+		return opRange
+	case *Next:
+		return opNext
+	case *TypeAssert:
+		return opTypeAssert
+	case *Extract:
+		return opExtract
+	case *Jump:
+		return opJump
+	case *Unreachable:
+		return opUnreachable
+	case *If:
+		return opIf
+	case *ConstantSwitch:
+		return opConstantSwitch
+	case *TypeSwitch:
+		return opTypeSwitch
+	case *Return:
+		return opReturn
+	case *RunDefers:
+		return opRunDefers
+	case *Panic:
+		return opPanic
+	case *Go:
+		return opGo
+	case *Defer:
+		return opDefer
+	case *Send:
+		return opSend
+	case *Recv:
+		return opRecv
+	case *Store:
+		return opStore
+	case *BlankStore:
+		return opBlankStore
+	case *MapUpdate:
+		return opMapUpdate
+	case *DebugRef:
+		return opDebugRef
+	default:
+		e.errorf("cannot encode instruction %T", instr)
+		panic("unreachable")
+	}
+}
+
+func (fe *funcEncoder) value(b *encBuf, v Value) {
+	switch v := v.(type) {
+	case nil:
+		b.uint(0)
+	case *Function:
+		b.uint(valFunction)
+		b.uint(fe.function(v))
+	case *FreeVar:
+		idx, ok := fe.freeVars[v]
+		if !ok {
+			fe.errorf("%s: free variable %s of another function", fe.fn, v.Name())
+		}
+		b.uint(valFreeVar)
+		b.uint(idx)
+	case *Global:
+		if obj := fe.object(v.object); obj != 0 {
+			b.uint(valGlobal)
+			b.uint(obj)
+		} else {
+			b.uint(valMemberGlobal)
+			fe.pkgPath(b, v.Pkg.Pkg)
+			fe.string(b, v.name)
+		}
+	case *Builtin:
+		b.uint(valBuiltin)
+		fe.string(b, v.name)
+		b.uint(fe.typ(v.sig))
+	case Instruction:
+		idx, ok := fe.instrs[v]
+		if !ok {
+			fe.errorf("%s: reference to %T that isn't part of the function", fe.fn, v)
+		}
+		b.uint(valInstruction)
+		b.uint(idx)
+	default:
+		fe.errorf("cannot encode value %T", v)
+	}
+}
+
+func (fe *funcEncoder) values(b *encBuf, vs []Value) {
+	b.uint(uint64(len(vs)))
+	for _, v := range vs {
+		fe.value(b, v)
+	}
+}
+
+func (fe *funcEncoder) constant(b *encBuf, v constant.Value) {
+	if v == nil {
+		b.uint(constNil)
+		return
+	}
+	switch v.Kind() {
+	case constant.Bool:
+		b.uint(constBool)
+		b.bool(constant.BoolVal(v))
+	case constant.String:
+		b.uint(constString)
+		b.bytes([]byte(constant.StringVal(v)))
+	case constant.Int:
+		b.uint(constInt)
+		fe.number(b, v)
+	case constant.Float:
+		b.uint(constFloat)
+		fe.number(b, v)
+	case constant.Complex:
+		b.uint(constComplex)
+		fe.number(b, constant.Real(v))
+		fe.number(b, constant.Imag(v))
+	case constant.Unknown:
+		b.uint(constUnknown)
+	default:
+		fe.errorf("unhandled constant kind %s", v.Kind())
+	}
+}
+
+// number encodes an integer or floating-point constant as an exact
+// fraction.
+func (fe *funcEncoder) number(b *encBuf, v constant.Value) {
+	var r big.Rat
+	switch x := constant.Val(v).(type) {
+	case int64:
+		r.SetInt64(x)
+	case *big.Int:
+		r.SetInt(x)
+	case *big.Rat:
+		r.Set(x)
+	case *big.Float:
+		if _, acc := x.Rat(&r); acc != big.Exact {
+			fe.errorf("cannot encode constant %s exactly", v)
+		}
+	case float64:
+		r.SetFloat64(x)
+	default:
+		fe.errorf("unhandled constant representation %T", x)
+	}
+	text, err := r.MarshalText()
+	if err != nil {
+		fe.errorf("cannot encode constant %s: %s", v, err)
+	}
+	b.bytes(text)
+}
+
+// aggregate encodes the values of an aggregate constant. These values
+// aren't instructions of the function and are encoded in full.
+func (fe *funcEncoder) aggregate(b *encBuf, c *AggregateConst) {
+	b.uint(uint64(len(c.Values)))
+	for _, v := range c.Values {
+		b.uint(uint64(fe.opcode(v)))
+		b.uint(fe.typ(v.Type()))
+		switch v := v.(type) {
+		case *Const:
+			fe.constant(b, v.Value)
+		case *AggregateConst:
+			fe.aggregate(b, v)
+		}
+	}
+}
+
+func (fe *funcEncoder) call(b *encBuf, c *CallCommon) {
+	fe.value(b, c.Value)
+	if c.Method != nil {
+		// Methods of interface literals have no identity that we
+		// could refer to; look them up by name instead.
+		b.bool(true)
+		b.uint(fe.typ(recvType(c.Method)))
+		fe.pkgPath(b, c.Method.Pkg())
+		fe.string(b, c.Method.Name())
+	} else {
+		b.bool(false)
+	}
+	fe.values(b, c.Args)
+	b.uint(uint64(len(c.TypeArgs)))
+	for _, targ := range c.TypeArgs {
+		b.uint(fe.typ(targ))
+	}
+	fe.value(b, c.Results)
+}
+
+func (fe *funcEncoder) instr(b *encBuf, instr Instruction) {
+	b.int(int64(instr.ID()))
+	fe.source(b, instr.(interface{ syntax() ast.Node }).syntax())
+	if v, ok := instr.(Value); ok {
+		b.uint(fe.typ(v.Type()))
+	}
+
+	switch instr := instr.(type) {
+	case *Parameter:
+		fe.string(b, instr.name)
+		fe.paramObject(b, instr.object)
+	case *Const:
+		fe.constant(b, instr.Value)
+	case *AggregateConst:
+		fe.aggregate(b, instr)
+	case *ArrayConst, *GenericConst:
+	case *Alloc:
+		b.bool(instr.Heap)
+	case *Sigma:
+		b.uint(uint64(instr.From.Index))
+		fe.value(b, instr.X)
+	case *Copy:
+		fe.value(b, instr.X)
+		if idx, ok := fe.instrs[instr.Why]; ok && instr.Why != nil {
+			b.uint(idx + 1)
+		} else {
+			b.uint(0)
+		}
+		b.uint(uint64(instr.Info))
+	case *Phi:
+		fe.values(b, instr.Edges)
+	case *Call:
+		fe.call(b, &instr.Call)
+	case *BinOp:
+		b.uint(uint64(instr.Op))
+		fe.value(b, instr.X)
+		fe.value(b, instr.Y)
+	case *UnOp:
+		b.uint(uint64(instr.Op))
+		fe.value(b, instr.X)
+	case *Load:
+		fe.value(b, instr.X)
+	case *ChangeType:
+		fe.value(b, instr.X)
+	case *Convert:
+		fe.value(b, instr.X)
+	case *ChangeInterface:
+		fe.value(b, instr.X)
+	case *SliceToArrayPointer:
+		fe.value(b, instr.X)
+	case *MakeInterface:
+		fe.value(b, instr.X)
+	case *MakeClosure:
+		fe.value(b, instr.Fn)
+		fe.values(b, instr.Bindings)
+	case *MakeMap:
+		fe.value(b, instr.Reserve)
+	case *MakeChan:
+		fe.value(b, instr.Size)
+	case *MakeSlice:
+		fe.value(b, instr.Len)
+		fe.value(b, instr.Cap)
+	case *Slice:
+		fe.value(b, instr.X)
+		fe.value(b, instr.Low)
+		fe.value(b, instr.High)
+		fe.value(b, instr.Max)
+	case *FieldAddr:
+		fe.value(b, instr.X)
+		b.uint(uint64(instr.Field))
+	case *Field:
+		fe.value(b, instr.X)
+		b.uint(uint64(instr.Field))
+	case *IndexAddr:
+		fe.value(b, instr.X)
+		fe.value(b, instr.Index)
+	case *Index:
+		fe.value(b, instr.X)
+		fe.value(b, instr.Index)
+	case *MapLookup:
+		fe.value(b, instr.X)
+		fe.value(b, instr.Index)
+		b.bool(instr.CommaOk)
+	case *StringLookup:
+		fe.value(b, instr.X)
+		fe.value(b, instr.Index)
+	case *Select:
+		b.uint(uint64(len(instr.States)))
+		for _, st := range instr.States {
+			b.uint(uint64(st.Dir))
+			fe.value(b, st.Chan)
+			fe.value(b, st.Send)
+			fe.pos(b, st.Pos)
+		}
+		b.bool(instr.Blocking)
+	case *Range:
+		fe.value(b, instr.X)
+	case *Next:
+		fe.value(b, instr.Iter)
+		b.bool(instr.IsString)
+	case *TypeAssert:
+		fe.value(b, instr.X)
+		b.uint(fe.typ(instr.AssertedType))
+		b.bool(instr.CommaOk)
+	case *Extract:
+		fe.value(b, instr.Tuple)
+		b.uint(uint64(instr.Index))
+	case *Jump:
+		fe.string(b, instr.Comment)
+	case *Unreachable:
+	case *If:
+		fe.value(b, instr.Cond)
+	case *ConstantSwitch:
+		fe.value(b, instr.Tag)
+		fe.values(b, instr.Conds)
+	case *TypeSwitch:
+		fe.value(b, instr.Tag)
+		b.uint(uint64(len(instr.Conds)))
+		for _, cond := range instr.Conds {
+			b.uint(fe.typ(cond))
+		}
+	case *Return:
+		fe.values(b, instr.Results)
+	case *RunDefers:
+	case *Panic:
+		fe.value(b, instr.X)
+	case *Go:
+		fe.call(b, &instr.Call)
+	case *Defer:
+		fe.call(b, &instr.Call)
+	case *Send:
+		fe.value(b, instr.Chan)
+		fe.value(b, instr.X)
+	case *Recv:
+		fe.value(b, instr.Chan)
+		b.bool(instr.CommaOk)
+	case *Store:
+		fe.value(b, instr.Addr)
+		fe.value(b, instr.Val)
+	case *BlankStore:
+		fe.value(b, instr.Val)
+	case *MapUpdate:
+		fe.value(b, instr.Map)
+		fe.value(b, instr.Key)
+		fe.value(b, instr.Value)
+	case *DebugRef:
+		fe.debugExpr(b, instr.Expr)
+		fe.paramObject(b, instr.object)
+		b.bool(instr.IsAddr)
+		fe.value(b, instr.X)
+	default:
+		fe.errorf("cannot encode instruction %T", instr)
+	}
+}
+
+// debugExpr encodes the type and extent of the expression of a
+// DebugRef, as well as identifiers, literals and operators.
+func (fe *funcEncoder) debugExpr(b *encBuf, e ast.Expr) {
+	switch e := e.(type) {
+	case *ast.Ident:
+		b.uint(exprIdent)
+		fe.string(b, e.Name)
+	case *ast.BasicLit:
+		b.uint(exprBasicLit)
+		b.uint(uint64(e.Kind))
+		fe.string(b, e.Value)
+	case *ast.FuncLit:
+		b.uint(exprFuncLit)
+	case *ast.CompositeLit:
+		b.uint(exprCompositeLit)
+	case *ast.SelectorExpr:
+		b.uint(exprSelector)
+		fe.string(b, e.Sel.Name)
+	case *ast.IndexExpr:
+		b.uint(exprIndex)
+	case *typeparams.IndexListExpr:
+		b.uint(exprIndexList)
+	case *ast.SliceExpr:
+		b.uint(exprSlice)
+	case *ast.TypeAssertExpr:
+		b.uint(exprTypeAssert)
+	case *ast.CallExpr:
+		b.uint(exprCall)
+	case *ast.StarExpr:
+		b.uint(exprStar)
+	case *ast.UnaryExpr:
+		b.uint(exprUnary)
+		b.uint(uint64(e.Op))
+	case *ast.BinaryExpr:
+		b.uint(exprBinary)
+		b.uint(uint64(e.Op))
+	default:
+		b.uint(exprOther)
+	}
+	fe.pos(b, e.Pos())
+	fe.pos(b, e.End())
+}
+
+// paramObject encodes the object of a parameter or DebugRef.
+// Parameters of functions without objects, such as anonymous
+// functions, refer to the variables of the function's signature.
+// Local variables and fields are encoded structurally.
+func (fe *funcEncoder) paramObject(b *encBuf, obj types.Object) {
+	if obj == nil {
+		b.uint(paramNoObject)
+		return
+	}
+	if idx := fe.object(obj); idx != 0 {
+		b.uint(paramObject)
+		b.uint(idx)
+		return
+	}
+	if idx, ok := signatureVarIndex(fe.fn.Signature, obj); ok {
+		b.uint(paramSignature)
+		b.uint(uint64(idx))
+		return
+	}
+	if fn, ok := fe.fn.object.(*types.Func); ok {
+		if idx, ok := signatureVarIndex(fn.Type().(*types.Signature), obj); ok {
+			if owner := fe.object(fn); owner != 0 {
+				// Encode the parameter as an object of its own,
+				// so that it can be shared by instantiations.
+				var rec encBuf
+				rec.uint(objParam)
+				rec.uint(owner)
+				rec.uint(uint64(idx))
+				fe.objectList = append(fe.objectList, rec.Bytes())
+				fe.objects[obj] = uint64(len(fe.objectList))
+				b.uint(paramObject)
+				b.uint(fe.objects[obj])
+				return
+			}
+		}
+	}
+	if v, ok := obj.(*types.Var); ok {
+		// Encode the variable as an object of its own, so that all
+		// references to it share the decoded variable.
+		var rec encBuf
+		rec.uint(objVar)
+		fe.pkgPath(&rec, v.Pkg())
+		fe.string(&rec, v.Name())
+		fe.pos(&rec, v.Pos())
+		rec.uint(fe.typ(v.Type()))
+		rec.bool(v.IsField())
+		rec.bool(v.Embedded())
+		fe.objectList = append(fe.objectList, rec.Bytes())
+		fe.objects[obj] = uint64(len(fe.objectList))
+		b.uint(paramObject)
+		b.uint(fe.objects[obj])
+		return
+	}
+	b.uint(paramNoObject)
+}
+
+// signatureVarIndex returns the index of v in the concatenation of
+// sig's receiver, parameters and results.
+func signatureVarIndex(sig *types.Signature, v types.Object) (int, bool) {
+	i := 0
+	if recv := sig.Recv(); recv != nil {
+		if recv == v {
+			return 0, true
+		}
+		i++
+	}
+	for _, tuple := range []*types.Tuple{sig.Params(), sig.Results()} {
+		for j := 0; j < tuple.Len(); j++ {
+			if tuple.At(j) == v {
+				return i, true
+			}
+			i++
+		}
+	}
+	return 0, false
+}
@@ -232,7 +232,7 @@ func (f *Function) addParamObj(obj types.Object, source ast.Node) *Parameter {
 	if name == "" {
 		name = fmt.Sprintf("arg%d", len(f.Params))
 	}
-	param := f.addParam(name, obj.Type(), source)
+	param := f.addParam(name, f.typ(obj.Type()), source)
 	param.object = obj
 	return param
 }
@@ -244,7 +244,7 @@ func (f *Function) addParamObj(obj types.Object, source ast.Node) *Parameter {
 func (f *Function) addSpilledParam(obj types.Object, source ast.Node) {
 	param := f.addParamObj(obj, source)
 	spill := &Alloc{}
-	spill.setType(types.NewPointer(obj.Type()))
+	spill.setType(types.NewPointer(f.typ(obj.Type())))
 	spill.source = source
 	f.objects[obj] = spill
 	f.Locals = append(f.Locals, spill)
@@ -679,6 +679,20 @@ func (pkg *Package) SetDebugMode(debug bool) {
 	pkg.debug = debug
 }
 
+// typ returns t with the type arguments of f substituted for its type
+// parameters, if f is an instantiation of a generic function.
+func (f *Function) typ(t types.Type) types.Type {
+	if f.functionBody == nil || f.subst == nil {
+		return t
+	}
+	return f.subst.typ(t)
+}
+
+// typeOf is like Package.typeOf, but substitutes type arguments.
+func (f *Function) typeOf(e ast.Expr) types.Type {
+	return f.typ(f.Pkg.typeOf(e))
+}
+
 // debugInfo reports whether debug info is wanted for this function.
 func (f *Function) debugInfo() bool {
 	return f.Pkg != nil && f.Pkg.debug
@@ -689,7 +703,7 @@ func (f *Function) debugInfo() bool {
 // calls to f.lookup(obj) will return the same local.
 //
 func (f *Function) addNamedLocal(obj types.Object, source ast.Node) *Alloc {
-	l := f.addLocal(obj.Type(), source)
+	l := f.addLocal(f.typ(obj.Type()), source)
 	f.objects[obj] = l
 	return l
 }
@@ -161,6 +161,19 @@ func NewHTMLWriter(path string, funcname, cfgMask string) *HTMLWriter {
 	return &html
 }
 
+// NewHTMLWriterTo returns an HTMLWriter that writes to w, for example
+// to serve the HTML over HTTP. Closing the HTMLWriter doesn't close w.
+func NewHTMLWriterTo(w io.Writer, funcname string) *HTMLWriter {
+	html := HTMLWriter{w: nopWriteCloser{w}}
+	html.dot = newDotWriter()
+	html.start(funcname)
+	return &html
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
 func (w *HTMLWriter) start(name string) {
 	if w == nil {
 		return
@@ -752,7 +765,9 @@ func (w *HTMLWriter) Close() {
 	io.WriteString(w.w, "</body>")
 	io.WriteString(w.w, "</html>")
 	w.w.Close()
-	fmt.Printf("dumped IR to %v\n", w.path)
+	if w.path != "" {
+		fmt.Printf("dumped IR to %v\n", w.path)
+	}
 }
 
 // WriteFunc writes f in a column headed by title.
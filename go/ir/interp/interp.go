@@ -0,0 +1,631 @@
+// Package interp implements an interpreter for the IR of pure
+// functions.
+//
+// The interpreter is meant for evaluating calls to pure functions
+// with constant arguments, such as
+//
+//	func pattern(sep string) string { return "[" + sep + "]" }
+//
+//	regexp.MustCompile(pattern(","))
+//
+// so that checks can validate the results. It supports booleans,
+// integers, floats, strings, pointers, slices, arrays, maps, structs
+// and closures, as well as a number of functions from the standard
+// library. Evaluation fails when it encounters code that has side
+// effects outside of the evaluated call, such as accessing global
+// variables, doing I/O, or calling functions whose bodies aren't
+// available. It also fails when the evaluated code panics or when it
+// exceeds its budget of steps or allocations.
+//
+// Values of platform-dependent size, such as int, are limited to 32
+// bits, so that results are the same on all platforms.
+//
+// THIS INTERFACE IS EXPERIMENTAL AND MAY BE SUBJECT TO INCOMPATIBLE CHANGE.
+package interp
+
+import (
+	"go/constant"
+	"go/token"
+	"go/types"
+	"unicode/utf8"
+
+	"honnef.co/go/tools/go/ir"
+)
+
+const (
+	// maxSteps is the maximum number of instructions that a single
+	// call to Eval may execute.
+	maxSteps = 100_000
+	// maxAlloc is the maximum number of elements, map entries and
+	// string bytes that a single call to Eval may allocate.
+	maxAlloc = 1 << 16
+	// maxDepth is the maximum depth of calls.
+	maxDepth = 100
+)
+
+// Eval calls fn with the arguments args and returns its result. fn
+// must have a single result of basic type. The boolean result reports
+// whether the call could be evaluated.
+func Eval(fn *ir.Function, args []constant.Value) (res constant.Value, ok bool) {
+	if fn.Signature.Results().Len() != 1 || len(args) != len(fn.Params) || len(fn.FreeVars) != 0 {
+		return nil, false
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isBail := r.(bailout); !isBail {
+				panic(r)
+			}
+			res, ok = nil, false
+		}
+	}()
+
+	in := &interpreter{}
+	vargs := make([]value, len(args))
+	for i, arg := range args {
+		if arg == nil {
+			return nil, false
+		}
+		vargs[i] = fromConstant(arg, fn.Params[i].Type())
+	}
+	return toConstant(in.call(fn, vargs, nil))
+}
+
+// bailout is used as a panic value to abort evaluation.
+type bailout struct{}
+
+func bail() {
+	panic(bailout{})
+}
+
+type interpreter struct {
+	steps  int
+	allocs int
+	depth  int
+}
+
+// alloc accounts for the allocation of n elements.
+func (in *interpreter) alloc(n int) {
+	if n < 0 {
+		bail()
+	}
+	in.allocs += n
+	if in.allocs > maxAlloc {
+		bail()
+	}
+}
+
+type frame struct {
+	in     *interpreter
+	fn     *ir.Function
+	env    map[ir.Value]value
+	freeVs []value
+}
+
+// call calls fn, whose free variables are bound to env.
+func (in *interpreter) call(fn *ir.Function, args []value, env []value) value {
+	if fn.Blocks == nil {
+		return in.intrinsic(fn, args)
+	}
+	in.depth++
+	if in.depth > maxDepth {
+		bail()
+	}
+	defer func() { in.depth-- }()
+
+	fr := &frame{
+		in:     in,
+		fn:     fn,
+		env:    map[ir.Value]value{},
+		freeVs: env,
+	}
+	for i, p := range fn.Params {
+		fr.env[p] = args[i]
+	}
+
+	var pred *ir.BasicBlock
+	b := fn.Blocks[0]
+	for {
+		// σ-nodes and φ-nodes are at the start of the block. Only
+		// the σ-nodes of the edge we came from are defined, and
+		// φ-nodes are evaluated in parallel.
+		var phis []*ir.Phi
+		var phiValues []value
+		i := 0
+	header:
+		for ; i < len(b.Instrs); i++ {
+			switch instr := b.Instrs[i].(type) {
+			case *ir.Sigma:
+				if instr.From == pred {
+					fr.env[instr] = fr.get(instr.X)
+				}
+			case *ir.Phi:
+				phis = append(phis, instr)
+				phiValues = append(phiValues, fr.get(instr.Edges[predIndex(b, pred)]))
+			default:
+				break header
+			}
+		}
+		for j, phi := range phis {
+			fr.env[phi] = phiValues[j]
+		}
+
+		var next *ir.BasicBlock
+		for _, instr := range b.Instrs[i:] {
+			in.steps++
+			if in.steps > maxSteps {
+				bail()
+			}
+			switch instr := instr.(type) {
+			case *ir.Jump:
+				next = b.Succs[0]
+			case *ir.If:
+				if fr.get(instr.Cond).(bool) {
+					next = b.Succs[0]
+				} else {
+					next = b.Succs[1]
+				}
+			case *ir.ConstantSwitch:
+				next = fr.constantSwitch(instr)
+			case *ir.Return:
+				switch len(instr.Results) {
+				case 0:
+					return nil
+				case 1:
+					return fr.get(instr.Results[0])
+				default:
+					out := make(tuple, len(instr.Results))
+					for i, r := range instr.Results {
+						out[i] = fr.get(r)
+					}
+					return out
+				}
+			default:
+				fr.exec(instr)
+			}
+		}
+		if next == nil {
+			// The block ended in an instruction that doesn't
+			// transfer control, such as a call to a function that
+			// never returns.
+			bail()
+		}
+		pred, b = b, next
+	}
+}
+
+func predIndex(b, pred *ir.BasicBlock) int {
+	for i, p := range b.Preds {
+		if p == pred {
+			return i
+		}
+	}
+	panic("unreachable")
+}
+
+// get returns the value of v.
+func (fr *frame) get(v ir.Value) value {
+	switch v := v.(type) {
+	case *ir.Const:
+		if v.Value == nil {
+			return fr.in.zero(v.Type())
+		}
+		return fromConstant(v.Value, v.Type())
+	case *ir.AggregateConst, *ir.ArrayConst:
+		return fr.in.zero(v.Type())
+	case *ir.Function:
+		return &closure{fn: v}
+	case *ir.FreeVar:
+		for i, fv := range fr.fn.FreeVars {
+			if fv == v {
+				return fr.freeVs[i]
+			}
+		}
+	case *ir.Global, *ir.Builtin, *ir.GenericConst:
+		// We don't allow access to global state.
+		bail()
+	default:
+		if x, ok := fr.env[v]; ok {
+			return x
+		}
+	}
+	panic("unreachable")
+}
+
+func (fr *frame) constantSwitch(sw *ir.ConstantSwitch) *ir.BasicBlock {
+	tag := fr.get(sw.Tag)
+	var def *ir.BasicBlock
+	for i, cond := range sw.Conds {
+		if cond == nil {
+			def = sw.Block().Succs[i]
+			continue
+		}
+		if equal(tag, fr.get(cond)) {
+			return sw.Block().Succs[i]
+		}
+	}
+	if def == nil {
+		bail()
+	}
+	return def
+}
+
+func (fr *frame) load(ptr value) value {
+	p := ptr.(*value)
+	if p == nil {
+		bail()
+	}
+	return copyValue(*p)
+}
+
+func (fr *frame) store(ptr value, v value) {
+	p := ptr.(*value)
+	if p == nil {
+		bail()
+	}
+	*p = copyValue(v)
+}
+
+// exec executes an instruction that doesn't transfer control.
+func (fr *frame) exec(instr ir.Instruction) {
+	in := fr.in
+	set := func(v value) {
+		fr.env[instr.(ir.Value)] = v
+	}
+	switch instr := instr.(type) {
+	case *ir.DebugRef, *ir.BlankStore, *ir.RunDefers:
+		// Since we don't support defer, RunDefers has nothing to
+		// do.
+	case *ir.Const, *ir.AggregateConst, *ir.ArrayConst:
+		// Constants are computed on use
+	case *ir.Parameter:
+		// Parameters are set by call
+	case *ir.Copy:
+		set(fr.get(instr.X))
+	case *ir.ChangeType:
+		set(fr.get(instr.X))
+	case *ir.ChangeInterface:
+		set(fr.get(instr.X))
+	case *ir.Convert:
+		set(in.convert(fr.get(instr.X), instr.X.Type(), instr.Type()))
+	case *ir.BinOp:
+		x, y := fr.get(instr.X), fr.get(instr.Y)
+		switch instr.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			set(compare(instr.Op, x, y))
+		default:
+			set(in.binop(instr.Op, instr.Type(), x, y))
+		}
+	case *ir.UnOp:
+		x := fr.get(instr.X)
+		switch instr.Op {
+		case token.MUL:
+			set(fr.load(x))
+		case token.ARROW:
+			bail()
+		default:
+			set(unop(instr.Op, instr.Type(), x))
+		}
+	case *ir.Load:
+		set(fr.load(fr.get(instr.X)))
+	case *ir.Store:
+		fr.store(fr.get(instr.Addr), fr.get(instr.Val))
+	case *ir.Alloc:
+		in.alloc(1)
+		p := new(value)
+		*p = in.zero(instr.Type().Underlying().(*types.Pointer).Elem())
+		set(p)
+	case *ir.FieldAddr:
+		p := fr.get(instr.X).(*value)
+		if p == nil {
+			bail()
+		}
+		set(&(*p).(structure)[instr.Field])
+	case *ir.Field:
+		set(fr.get(instr.X).(structure)[instr.Field])
+	case *ir.IndexAddr:
+		idx := toInt(fr.get(instr.Index))
+		switch x := fr.get(instr.X).(type) {
+		case slice:
+			if idx < 0 || idx >= x.len {
+				bail()
+			}
+			set(&x.arr[x.off+idx])
+		case *value:
+			if x == nil {
+				bail()
+			}
+			arr := (*x).(array)
+			if idx < 0 || idx >= len(arr) {
+				bail()
+			}
+			set(&arr[idx])
+		default:
+			bail()
+		}
+	case *ir.Index:
+		set(index(fr.get(instr.X), toInt(fr.get(instr.Index))))
+	case *ir.StringLookup:
+		set(index(fr.get(instr.X), toInt(fr.get(instr.Index))))
+	case *ir.Slice:
+		set(fr.slice(instr))
+	case *ir.MakeSlice:
+		n := toInt(fr.get(instr.Len))
+		c := toInt(fr.get(instr.Cap))
+		if n < 0 || n > c {
+			bail()
+		}
+		in.alloc(c)
+		elem := instr.Type().Underlying().(*types.Slice).Elem()
+		arr := make([]value, c)
+		for i := range arr {
+			arr[i] = in.zero(elem)
+		}
+		set(slice{arr: arr, len: n, cap: c})
+	case *ir.MakeMap:
+		set(&mapValue{entries: map[value]value{}})
+	case *ir.MapUpdate:
+		m := fr.get(instr.Map).(*mapValue)
+		if m == nil {
+			bail()
+		}
+		k := mapKey(fr.get(instr.Key))
+		if _, ok := m.entries[k]; !ok {
+			in.alloc(1)
+		}
+		m.entries[k] = copyValue(fr.get(instr.Value))
+	case *ir.MapLookup:
+		m := fr.get(instr.X).(*mapValue)
+		k := mapKey(fr.get(instr.Index))
+		var v value
+		var ok bool
+		if m != nil {
+			v, ok = m.entries[k]
+		}
+		if !ok {
+			v = in.zero(instr.X.Type().Underlying().(*types.Map).Elem())
+		}
+		if instr.CommaOk {
+			set(tuple{v, ok})
+		} else {
+			set(v)
+		}
+	case *ir.Range:
+		s, ok := fr.get(instr.X).(string)
+		if !ok {
+			// The order of map iteration isn't deterministic
+			bail()
+		}
+		set(&stringIter{s: s})
+	case *ir.Next:
+		it := fr.get(instr.Iter).(*stringIter)
+		if it.i >= len(it.s) {
+			set(tuple{false, int64(0), int64(0)})
+			break
+		}
+		r, n := utf8.DecodeRuneInString(it.s[it.i:])
+		set(tuple{true, int64(it.i), int64(r)})
+		it.i += n
+	case *ir.Extract:
+		set(fr.get(instr.Tuple).(tuple)[instr.Index])
+	case *ir.MakeInterface:
+		set(iface{typ: instr.X.Type(), v: fr.get(instr.X)})
+	case *ir.TypeAssert:
+		x := fr.get(instr.X).(iface)
+		if types.IsInterface(instr.AssertedType) {
+			bail()
+		}
+		ok := x.typ != nil && types.Identical(x.typ, instr.AssertedType)
+		var v value
+		if ok {
+			v = x.v
+		} else {
+			if !instr.CommaOk {
+				bail()
+			}
+			v = in.zero(instr.AssertedType)
+		}
+		if instr.CommaOk {
+			set(tuple{v, ok})
+		} else {
+			set(v)
+		}
+	case *ir.MakeClosure:
+		env := make([]value, len(instr.Bindings))
+		for i, b := range instr.Bindings {
+			env[i] = fr.get(b)
+		}
+		set(&closure{fn: instr.Fn.(*ir.Function), env: env})
+	case *ir.Call:
+		set(fr.callCommon(instr.Common()))
+	default:
+		// Go, Defer, Send, Select, Panic, Unreachable and the like
+		bail()
+	}
+}
+
+func (fr *frame) slice(instr *ir.Slice) value {
+	x := fr.get(instr.X)
+	bound := func(v ir.Value, def int) int {
+		if v == nil {
+			return def
+		}
+		return toInt(fr.get(v))
+	}
+	switch x := x.(type) {
+	case string:
+		lo, hi := bound(instr.Low, 0), bound(instr.High, len(x))
+		if lo < 0 || hi < lo || hi > len(x) {
+			bail()
+		}
+		return x[lo:hi]
+	case slice:
+		lo, hi, max := bound(instr.Low, 0), bound(instr.High, x.len), bound(instr.Max, x.cap)
+		if lo < 0 || hi < lo || max < hi || max > x.cap {
+			bail()
+		}
+		return slice{arr: x.arr, off: x.off + lo, len: hi - lo, cap: max - lo}
+	case *value:
+		if x == nil {
+			bail()
+		}
+		arr := (*x).(array)
+		lo, hi, max := bound(instr.Low, 0), bound(instr.High, len(arr)), bound(instr.Max, len(arr))
+		if lo < 0 || hi < lo || max < hi || max > len(arr) {
+			bail()
+		}
+		return slice{arr: arr, off: lo, len: hi - lo, cap: max - lo}
+	default:
+		bail()
+		panic("unreachable")
+	}
+}
+
+// index indexes arrays and strings.
+func index(x value, idx int) value {
+	switch x := x.(type) {
+	case array:
+		if idx < 0 || idx >= len(x) {
+			bail()
+		}
+		return x[idx]
+	case string:
+		if idx < 0 || idx >= len(x) {
+			bail()
+		}
+		return uint64(x[idx])
+	default:
+		bail()
+		panic("unreachable")
+	}
+}
+
+// mapKey returns the representation of v as a key in a Go map.
+func mapKey(v value) value {
+	switch v := v.(type) {
+	case bool, int64, uint64, string:
+		return v
+	default:
+		// Floats may be NaN, and composite values aren't hashable in
+		// our representation.
+		bail()
+		panic("unreachable")
+	}
+}
+
+func (fr *frame) callCommon(common *ir.CallCommon) value {
+	if common.IsInvoke() {
+		bail()
+	}
+	args := make([]value, len(common.Args))
+	for i, arg := range common.Args {
+		args[i] = fr.get(arg)
+	}
+	if builtin, ok := common.Value.(*ir.Builtin); ok {
+		return fr.builtin(builtin, common.Args, args)
+	}
+	c := fr.get(common.Value).(*closure)
+	if c == nil {
+		bail()
+	}
+	return fr.in.call(c.fn, args, c.env)
+}
+
+func (fr *frame) builtin(fn *ir.Builtin, irargs []ir.Value, args []value) value {
+	in := fr.in
+	switch fn.Name() {
+	case "len", "cap":
+		var n int
+		switch x := args[0].(type) {
+		case string:
+			n = len(x)
+		case slice:
+			n = x.len
+			if fn.Name() == "cap" {
+				n = x.cap
+			}
+		case *mapValue:
+			if x != nil {
+				n = len(x.entries)
+			}
+		case *value:
+			if x == nil {
+				bail()
+			}
+			n = len((*x).(array))
+		case array:
+			n = len(x)
+		default:
+			bail()
+		}
+		return int64(n)
+	case "append":
+		s := args[0].(slice)
+		var elems []value
+		switch y := args[1].(type) {
+		case string:
+			elems = make([]value, len(y))
+			for i := 0; i < len(y); i++ {
+				elems[i] = uint64(y[i])
+			}
+		case slice:
+			elems = y.arr[y.off : y.off+y.len]
+		default:
+			bail()
+		}
+		n := s.len + len(elems)
+		if n <= s.cap {
+			// copy handles overlapping elements correctly
+			copy(s.arr[s.off+s.len:], elems)
+			for i := s.len; i < n; i++ {
+				s.arr[s.off+i] = copyValue(s.arr[s.off+i])
+			}
+			return slice{arr: s.arr, off: s.off, len: n, cap: s.cap}
+		}
+		c := s.cap * 2
+		if c < n {
+			c = n
+		}
+		in.alloc(c)
+		arr := make([]value, c)
+		copy(arr, s.arr[s.off:s.off+s.len])
+		copy(arr[s.len:], elems)
+		elem := irargs[0].Type().Underlying().(*types.Slice).Elem()
+		for i := range arr {
+			if i < n {
+				arr[i] = copyValue(arr[i])
+			} else {
+				arr[i] = in.zero(elem)
+			}
+		}
+		return slice{arr: arr, len: n, cap: c}
+	case "copy":
+		dst := args[0].(slice)
+		var n int
+		switch src := args[1].(type) {
+		case string:
+			n = copy(make([]byte, dst.len), src)
+			for i := 0; i < n; i++ {
+				dst.arr[dst.off+i] = uint64(src[i])
+			}
+		case slice:
+			n = copy(dst.arr[dst.off:dst.off+dst.len], src.arr[src.off:src.off+src.len])
+			for i := 0; i < n; i++ {
+				dst.arr[dst.off+i] = copyValue(dst.arr[dst.off+i])
+			}
+		default:
+			bail()
+		}
+		return int64(n)
+	case "delete":
+		m := args[0].(*mapValue)
+		if m != nil {
+			delete(m.entries, mapKey(args[1]))
+		}
+		return nil
+	default:
+		// print, println, panic, recover, close and the like
+		bail()
+		panic("unreachable")
+	}
+}
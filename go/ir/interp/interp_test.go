@@ -0,0 +1,168 @@
+package interp_test
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"honnef.co/go/tools/go/ir/interp"
+	"honnef.co/go/tools/go/ir/irutil"
+)
+
+const src = `package pkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+func concat(sep string) string { return "[" + sep + "]" }
+
+func loop(n int) string {
+	s := ""
+	for i := 0; i < n; i++ {
+		s += fmt.Sprint(i)
+	}
+	return s
+}
+
+func fib(n int) int {
+	if n < 2 {
+		return n
+	}
+	return fib(n-1) + fib(n-2)
+}
+
+func runes(s string) string {
+	var out []rune
+	for _, r := range s {
+		out = append([]rune{r}, out...)
+	}
+	return string(out)
+}
+
+type pair struct{ k, v string }
+
+func structs(k string) string {
+	ps := []pair{{k, "1"}, {"b", "2"}}
+	ps[1].v = "3"
+	p := ps[0]
+	p.v = "changed"
+	return ps[0].k + "=" + ps[0].v + "," + ps[1].k + "=" + ps[1].v
+}
+
+func maps(k string) int {
+	m := map[string]int{"a": 1}
+	m[k] += 10
+	if _, ok := m["missing"]; ok {
+		return -1
+	}
+	return m["a"] + len(m)
+}
+
+func arrays() int {
+	var a [4]int
+	b := a
+	for i := range a {
+		a[i] = i * i
+	}
+	s := a[1:3]
+	s[0] = 100
+	return a[1] + a[3] + b[3] + len(s) + cap(s)
+}
+
+func closures(s string) string {
+	f := func(t string) string { return s + t }
+	return f("x") + f("y")
+}
+
+func wrap(x int8) int8 { return x + 1 }
+
+func conv(x int) string {
+	return string(rune(x)) + fmt.Sprintf("%d-%x-%s", x, uint8(x), strings.ToUpper("abc"))
+}
+
+func layout(date bool) string {
+	if date {
+		return "2006-01-02"
+	}
+	return "15:04:05"
+}
+
+func infinite() int {
+	for {
+	}
+}
+
+func alloc(n int) int {
+	s := make([]int, 0)
+	for i := 0; i < n; i++ {
+		s = append(s, i)
+	}
+	return len(s)
+}
+
+var global = "x"
+
+func readGlobal() string { return global }
+
+func div(x int) int { return 1 / x }
+
+func big(x int) int { return x * x }
+
+func external(s string) string { return strings.Map(nil, s) }
+`
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		fn   string
+		args []constant.Value
+		want string // empty if evaluation should fail
+	}{
+		{"concat", []constant.Value{constant.MakeString(",")}, `"[,]"`},
+		{"loop", []constant.Value{constant.MakeInt64(12)}, `"01234567891011"`},
+		{"fib", []constant.Value{constant.MakeInt64(15)}, "610"},
+		{"runes", []constant.Value{constant.MakeString("héllo")}, `"olléh"`},
+		{"structs", []constant.Value{constant.MakeString("a")}, `"a=1,b=3"`},
+		{"maps", []constant.Value{constant.MakeString("c")}, "3"},
+		{"arrays", []constant.Value{}, "114"},
+		{"closures", []constant.Value{constant.MakeString("a")}, `"axay"`},
+		{"wrap", []constant.Value{constant.MakeInt64(127)}, "-128"},
+		{"conv", []constant.Value{constant.MakeInt64(65)}, `"A65-41-ABC"`},
+		{"layout", []constant.Value{constant.MakeBool(true)}, `"2006-01-02"`},
+
+		{"infinite", []constant.Value{}, ""},
+		{"alloc", []constant.Value{constant.MakeInt64(1 << 20)}, ""},
+		{"fib", []constant.Value{constant.MakeInt64(40)}, ""},
+		{"readGlobal", []constant.Value{}, ""},
+		{"div", []constant.Value{constant.MakeInt64(0)}, ""},
+		{"big", []constant.Value{constant.MakeInt64(1 << 20)}, ""},
+		{"external", []constant.Value{constant.MakeString("")}, ""},
+		{"concat", []constant.Value{constant.MakeInt64(1)}, ""},
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "pkg.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, _, err := irutil.BuildPackage(&types.Config{Importer: importer.Default()}, fset, types.NewPackage("pkg", ""), []*ast.File{f}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		got, ok := interp.Eval(pkg.Func(tt.fn), tt.args)
+		switch {
+		case tt.want == "" && ok:
+			t.Errorf("%s%v: got %s, want failure", tt.fn, tt.args, got)
+		case tt.want != "" && !ok:
+			t.Errorf("%s%v: evaluation failed, want %s", tt.fn, tt.args, tt.want)
+		case ok && got.ExactString() != tt.want:
+			t.Errorf("%s%v: got %s, want %s", tt.fn, tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package interp
+
+import (
+	"fmt"
+	"go/types"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"honnef.co/go/tools/go/ir"
+)
+
+// intrinsics implements functions whose bodies aren't available,
+// because they're defined in other packages.
+var intrinsics = map[string]func(in *interpreter, args []value) value{
+	"strings.Contains":   func(in *interpreter, args []value) value { return strings.Contains(str(args[0]), str(args[1])) },
+	"strings.HasPrefix":  func(in *interpreter, args []value) value { return strings.HasPrefix(str(args[0]), str(args[1])) },
+	"strings.HasSuffix":  func(in *interpreter, args []value) value { return strings.HasSuffix(str(args[0]), str(args[1])) },
+	"strings.Index":      func(in *interpreter, args []value) value { return int64(strings.Index(str(args[0]), str(args[1]))) },
+	"strings.ToLower":    func(in *interpreter, args []value) value { return in.string(strings.ToLower(str(args[0]))) },
+	"strings.ToUpper":    func(in *interpreter, args []value) value { return in.string(strings.ToUpper(str(args[0]))) },
+	"strings.Trim":       func(in *interpreter, args []value) value { return strings.Trim(str(args[0]), str(args[1])) },
+	"strings.TrimLeft":   func(in *interpreter, args []value) value { return strings.TrimLeft(str(args[0]), str(args[1])) },
+	"strings.TrimRight":  func(in *interpreter, args []value) value { return strings.TrimRight(str(args[0]), str(args[1])) },
+	"strings.TrimPrefix": func(in *interpreter, args []value) value { return strings.TrimPrefix(str(args[0]), str(args[1])) },
+	"strings.TrimSuffix": func(in *interpreter, args []value) value { return strings.TrimSuffix(str(args[0]), str(args[1])) },
+	"strings.TrimSpace":  func(in *interpreter, args []value) value { return strings.TrimSpace(str(args[0])) },
+	"strings.Repeat": func(in *interpreter, args []value) value {
+		s, n := str(args[0]), toInt(args[1])
+		if n < 0 {
+			bail()
+		}
+		in.alloc(len(s) * n)
+		return strings.Repeat(s, n)
+	},
+	"strings.Replace": func(in *interpreter, args []value) value {
+		return in.string(strings.Replace(str(args[0]), str(args[1]), str(args[2]), toInt(args[3])))
+	},
+	"strings.ReplaceAll": func(in *interpreter, args []value) value {
+		return in.string(strings.ReplaceAll(str(args[0]), str(args[1]), str(args[2])))
+	},
+	"strings.Join": func(in *interpreter, args []value) value {
+		s := args[0].(slice)
+		elems := make([]string, s.len)
+		for i := range elems {
+			elems[i] = str(s.arr[s.off+i])
+		}
+		return in.string(strings.Join(elems, str(args[1])))
+	},
+	"strconv.Itoa": func(in *interpreter, args []value) value { return strconv.Itoa(toInt(args[0])) },
+	"strconv.Quote": func(in *interpreter, args []value) value {
+		return in.string(strconv.Quote(str(args[0])))
+	},
+	"regexp.QuoteMeta": func(in *interpreter, args []value) value {
+		return in.string(regexp.QuoteMeta(str(args[0])))
+	},
+	"fmt.Sprint": func(in *interpreter, args []value) value {
+		return in.string(fmt.Sprint(fmtArgs(args[0])...))
+	},
+	"fmt.Sprintf": func(in *interpreter, args []value) value {
+		return in.string(fmt.Sprintf(str(args[0]), fmtArgs(args[1])...))
+	},
+}
+
+func (in *interpreter) intrinsic(fn *ir.Function, args []value) value {
+	obj, ok := fn.Object().(*types.Func)
+	if !ok {
+		bail()
+	}
+	impl, ok := intrinsics[obj.FullName()]
+	if !ok {
+		bail()
+	}
+	return impl(in, args)
+}
+
+func str(v value) string {
+	return v.(string)
+}
+
+// string accounts for the allocation of s.
+func (in *interpreter) string(s string) string {
+	in.alloc(len(s))
+	return s
+}
+
+// fmtArgs converts the variadic arguments of a fmt function to Go
+// values.
+func fmtArgs(v value) []interface{} {
+	s := v.(slice)
+	out := make([]interface{}, s.len)
+	for i := range out {
+		arg := s.arr[s.off+i].(iface)
+		if arg.typ == nil {
+			out[i] = nil
+			continue
+		}
+		// Values of named types may have methods, such as String,
+		// that affect formatting.
+		basic, ok := arg.typ.(*types.Basic)
+		if !ok {
+			bail()
+		}
+		switch basic.Kind() {
+		case types.Bool:
+			out[i] = arg.v.(bool)
+		case types.String:
+			out[i] = arg.v.(string)
+		case types.Int:
+			out[i] = int(arg.v.(int64))
+		case types.Int8:
+			out[i] = int8(arg.v.(int64))
+		case types.Int16:
+			out[i] = int16(arg.v.(int64))
+		case types.Int32:
+			out[i] = int32(arg.v.(int64))
+		case types.Int64:
+			out[i] = arg.v.(int64)
+		case types.Uint:
+			out[i] = uint(arg.v.(uint64))
+		case types.Uint8:
+			out[i] = uint8(arg.v.(uint64))
+		case types.Uint16:
+			out[i] = uint16(arg.v.(uint64))
+		case types.Uint32:
+			out[i] = uint32(arg.v.(uint64))
+		case types.Uint64:
+			out[i] = arg.v.(uint64)
+		case types.Uintptr:
+			out[i] = uintptr(arg.v.(uint64))
+		case types.Float32:
+			out[i] = float32(arg.v.(float64))
+		case types.Float64:
+			out[i] = arg.v.(float64)
+		default:
+			bail()
+		}
+	}
+	return out
+}
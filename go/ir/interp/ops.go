@@ -0,0 +1,406 @@
+package interp
+
+import (
+	"go/token"
+	"go/types"
+	"math"
+	"unicode/utf8"
+)
+
+// normalize truncates v, an integer or float computed with 64 bits of
+// precision, to the size of typ. Values of type int, uint and uintptr
+// have to fit in 32 bits, because we don't know the size of these
+// types on the platform the code will run on.
+func normalize(v value, typ types.Type) value {
+	basic, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		bail()
+	}
+	switch x := v.(type) {
+	case int64:
+		switch basic.Kind() {
+		case types.Int8:
+			return int64(int8(x))
+		case types.Int16:
+			return int64(int16(x))
+		case types.Int32, types.UntypedRune:
+			return int64(int32(x))
+		case types.Int64, types.UntypedInt:
+			return x
+		case types.Int:
+			if x < math.MinInt32 || x > math.MaxInt32 {
+				bail()
+			}
+			return x
+		}
+	case uint64:
+		switch basic.Kind() {
+		case types.Uint8:
+			return uint64(uint8(x))
+		case types.Uint16:
+			return uint64(uint16(x))
+		case types.Uint32:
+			return uint64(uint32(x))
+		case types.Uint64:
+			return x
+		case types.Uint, types.Uintptr:
+			if x > math.MaxUint32 {
+				bail()
+			}
+			return x
+		}
+	case float64:
+		switch basic.Kind() {
+		case types.Float32:
+			return float64(float32(x))
+		case types.Float64, types.UntypedFloat:
+			return x
+		}
+	}
+	bail()
+	panic("unreachable")
+}
+
+// toInt returns the value of an integer as an int, failing if it
+// isn't representable.
+func toInt(v value) int {
+	switch v := v.(type) {
+	case int64:
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			bail()
+		}
+		return int(v)
+	case uint64:
+		if v > math.MaxInt32 {
+			bail()
+		}
+		return int(v)
+	default:
+		bail()
+		panic("unreachable")
+	}
+}
+
+// shiftCount returns the value of a shift count.
+func shiftCount(v value) uint64 {
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			// negative shift counts panic
+			bail()
+		}
+		return uint64(v)
+	case uint64:
+		return v
+	default:
+		bail()
+		panic("unreachable")
+	}
+}
+
+func compare(op token.Token, x, y value) bool {
+	switch op {
+	case token.EQL:
+		return equal(x, y)
+	case token.NEQ:
+		return !equal(x, y)
+	}
+
+	var c int
+	switch x := x.(type) {
+	case int64:
+		y := y.(int64)
+		c = cmp(x < y, x > y)
+	case uint64:
+		y := y.(uint64)
+		c = cmp(x < y, x > y)
+	case float64:
+		y := y.(float64)
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return false
+		}
+		c = cmp(x < y, x > y)
+	case string:
+		y := y.(string)
+		c = cmp(x < y, x > y)
+	default:
+		bail()
+	}
+	switch op {
+	case token.LSS:
+		return c < 0
+	case token.LEQ:
+		return c <= 0
+	case token.GTR:
+		return c > 0
+	case token.GEQ:
+		return c >= 0
+	default:
+		bail()
+		panic("unreachable")
+	}
+}
+
+func cmp(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// binop implements all binary operators except for comparisons.
+func (in *interpreter) binop(op token.Token, typ types.Type, x, y value) value {
+	switch x := x.(type) {
+	case int64:
+		switch op {
+		case token.SHL:
+			n := shiftCount(y)
+			if n >= 64 {
+				return normalize(int64(0), typ)
+			}
+			return normalize(x<<n, typ)
+		case token.SHR:
+			n := shiftCount(y)
+			if n >= 64 {
+				n = 63
+			}
+			return normalize(x>>n, typ)
+		}
+		y := y.(int64)
+		var r int64
+		switch op {
+		case token.ADD:
+			r = x + y
+		case token.SUB:
+			r = x - y
+		case token.MUL:
+			r = x * y
+		case token.QUO:
+			if y == 0 {
+				bail()
+			}
+			r = x / y
+		case token.REM:
+			if y == 0 {
+				bail()
+			}
+			r = x % y
+		case token.AND:
+			r = x & y
+		case token.OR:
+			r = x | y
+		case token.XOR:
+			r = x ^ y
+		case token.AND_NOT:
+			r = x &^ y
+		default:
+			bail()
+		}
+		return normalize(r, typ)
+	case uint64:
+		switch op {
+		case token.SHL:
+			n := shiftCount(y)
+			if n >= 64 {
+				return normalize(uint64(0), typ)
+			}
+			return normalize(x<<n, typ)
+		case token.SHR:
+			n := shiftCount(y)
+			if n >= 64 {
+				return normalize(uint64(0), typ)
+			}
+			return normalize(x>>n, typ)
+		}
+		y := y.(uint64)
+		var r uint64
+		switch op {
+		case token.ADD:
+			r = x + y
+		case token.SUB:
+			r = x - y
+		case token.MUL:
+			r = x * y
+		case token.QUO:
+			if y == 0 {
+				bail()
+			}
+			r = x / y
+		case token.REM:
+			if y == 0 {
+				bail()
+			}
+			r = x % y
+		case token.AND:
+			r = x & y
+		case token.OR:
+			r = x | y
+		case token.XOR:
+			r = x ^ y
+		case token.AND_NOT:
+			r = x &^ y
+		default:
+			bail()
+		}
+		return normalize(r, typ)
+	case float64:
+		y := y.(float64)
+		var r float64
+		switch op {
+		case token.ADD:
+			r = x + y
+		case token.SUB:
+			r = x - y
+		case token.MUL:
+			r = x * y
+		case token.QUO:
+			r = x / y
+		default:
+			bail()
+		}
+		return normalize(r, typ)
+	case string:
+		if op != token.ADD {
+			bail()
+		}
+		y := y.(string)
+		in.alloc(len(x) + len(y))
+		return x + y
+	default:
+		bail()
+		panic("unreachable")
+	}
+}
+
+// unop implements the unary operators that don't involve memory or
+// channels.
+func unop(op token.Token, typ types.Type, x value) value {
+	switch op {
+	case token.NOT:
+		return !x.(bool)
+	case token.SUB:
+		switch x := x.(type) {
+		case int64:
+			return normalize(-x, typ)
+		case uint64:
+			return normalize(-x, typ)
+		case float64:
+			return normalize(-x, typ)
+		}
+	case token.XOR:
+		switch x := x.(type) {
+		case int64:
+			return normalize(^x, typ)
+		case uint64:
+			return normalize(^x, typ)
+		}
+	}
+	bail()
+	panic("unreachable")
+}
+
+// convert implements conversions between basic types and between
+// strings and byte and rune slices.
+func (in *interpreter) convert(x value, from, to types.Type) value {
+	switch to := to.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case to.Info()&types.IsString != 0:
+			switch x := x.(type) {
+			case string:
+				return x
+			case int64:
+				if x < 0 || x > utf8.MaxRune {
+					return string(utf8.RuneError)
+				}
+				return string(rune(x))
+			case uint64:
+				if x > utf8.MaxRune {
+					return string(utf8.RuneError)
+				}
+				return string(rune(x))
+			case slice:
+				elem := from.Underlying().(*types.Slice).Elem().Underlying().(*types.Basic)
+				in.alloc(x.len)
+				if elem.Kind() == types.Int32 {
+					rs := make([]rune, x.len)
+					for i := range rs {
+						rs[i] = rune(x.arr[x.off+i].(int64))
+					}
+					return string(rs)
+				}
+				bs := make([]byte, x.len)
+				for i := range bs {
+					bs[i] = byte(x.arr[x.off+i].(uint64))
+				}
+				return string(bs)
+			}
+		case to.Info()&types.IsUnsigned != 0:
+			switch x := x.(type) {
+			case int64:
+				return normalize(uint64(x), to)
+			case uint64:
+				return normalize(x, to)
+			case float64:
+				if math.IsNaN(x) || x < 0 || x >= math.MaxUint64 {
+					// implementation-specific
+					bail()
+				}
+				return normalize(uint64(x), to)
+			}
+		case to.Info()&types.IsInteger != 0:
+			switch x := x.(type) {
+			case int64:
+				return normalize(x, to)
+			case uint64:
+				return normalize(int64(x), to)
+			case float64:
+				if math.IsNaN(x) || x < math.MinInt64 || x >= math.MaxInt64 {
+					// implementation-specific
+					bail()
+				}
+				return normalize(int64(x), to)
+			}
+		case to.Info()&types.IsFloat != 0:
+			switch x := x.(type) {
+			case int64:
+				return normalize(float64(x), to)
+			case uint64:
+				return normalize(float64(x), to)
+			case float64:
+				return normalize(x, to)
+			}
+		}
+	case *types.Slice:
+		s, ok := x.(string)
+		elem, ok2 := to.Elem().Underlying().(*types.Basic)
+		if !ok || !ok2 {
+			break
+		}
+		var arr []value
+		switch elem.Kind() {
+		case types.Uint8:
+			in.alloc(len(s))
+			arr = make([]value, len(s))
+			for i := 0; i < len(s); i++ {
+				arr[i] = uint64(s[i])
+			}
+		case types.Int32:
+			rs := []rune(s)
+			in.alloc(len(rs))
+			arr = make([]value, len(rs))
+			for i, r := range rs {
+				arr[i] = int64(r)
+			}
+		default:
+			bail()
+		}
+		return slice{arr: arr, len: len(arr), cap: len(arr)}
+	}
+	bail()
+	panic("unreachable")
+}
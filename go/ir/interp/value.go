@@ -0,0 +1,258 @@
+package interp
+
+// This file defines the representation of values during
+// interpretation.
+//
+// Values are represented as follows:
+//
+//	bool                   bool
+//	signed integers        int64
+//	unsigned integers      uint64
+//	floats                 float64
+//	string                 string
+//	pointer                *value
+//	slice                  slice
+//	array                  array
+//	struct                 structure
+//	map                    *mapValue
+//	function               *closure
+//	interface              iface
+//	tuple                  tuple
+//	string iterator        *stringIter
+//
+// Integers and floats hold values that are representable in their
+// type, e.g. the int64 of an int8 is always in the range [-128, 127].
+//
+// Arrays and structs have value semantics. They are copied whenever
+// they are loaded from or stored to memory, so that SSA values never
+// alias memory.
+
+import (
+	"go/constant"
+	"go/types"
+	"math"
+
+	"honnef.co/go/tools/go/ir"
+)
+
+type value interface{}
+
+type slice struct {
+	arr []value
+	off int
+	len int
+	cap int
+}
+
+type array []value
+
+type structure []value
+
+type mapValue struct {
+	entries map[value]value
+}
+
+type closure struct {
+	fn  *ir.Function
+	env []value
+}
+
+type iface struct {
+	typ types.Type // nil for the nil interface
+	v   value
+}
+
+type tuple []value
+
+type stringIter struct {
+	s string
+	i int
+}
+
+// copyValue returns a copy of v that doesn't share memory with v.
+func copyValue(v value) value {
+	switch v := v.(type) {
+	case array:
+		out := make(array, len(v))
+		for i, e := range v {
+			out[i] = copyValue(e)
+		}
+		return out
+	case structure:
+		out := make(structure, len(v))
+		for i, e := range v {
+			out[i] = copyValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// equal implements the == operator.
+func equal(x, y value) bool {
+	switch x := x.(type) {
+	case array:
+		y := y.(array)
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case structure:
+		y := y.(structure)
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case iface:
+		y := y.(iface)
+		if x.typ == nil || y.typ == nil {
+			return x.typ == nil && y.typ == nil
+		}
+		if !types.Identical(x.typ, y.typ) {
+			return false
+		}
+		if !types.Comparable(x.typ) {
+			// comparing uncomparable types panics
+			bail()
+		}
+		return equal(x.v, y.v)
+	case slice:
+		// Slices can only be compared to nil.
+		return x.arr == nil && y.(slice).arr == nil
+	default:
+		return x == y
+	}
+}
+
+// zero returns the zero value of typ.
+func (in *interpreter) zero(typ types.Type) value {
+	switch typ := typ.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case typ.Info()&types.IsBoolean != 0:
+			return false
+		case typ.Info()&types.IsString != 0:
+			return ""
+		case typ.Info()&types.IsUnsigned != 0:
+			return uint64(0)
+		case typ.Info()&types.IsInteger != 0:
+			return int64(0)
+		case typ.Info()&types.IsFloat != 0:
+			return float64(0)
+		}
+	case *types.Pointer:
+		return (*value)(nil)
+	case *types.Slice:
+		return slice{}
+	case *types.Map:
+		return (*mapValue)(nil)
+	case *types.Signature:
+		return (*closure)(nil)
+	case *types.Interface:
+		return iface{}
+	case *types.Array:
+		if typ.Len() > maxAlloc {
+			bail()
+		}
+		in.alloc(int(typ.Len()))
+		out := make(array, typ.Len())
+		for i := range out {
+			out[i] = in.zero(typ.Elem())
+		}
+		return out
+	case *types.Struct:
+		out := make(structure, typ.NumFields())
+		for i := range out {
+			out[i] = in.zero(typ.Field(i).Type())
+		}
+		return out
+	case *types.Tuple:
+		out := make(tuple, typ.Len())
+		for i := range out {
+			out[i] = in.zero(typ.At(i).Type())
+		}
+		return out
+	}
+	// Channels, complex numbers, unsafe pointers and type
+	// parameters aren't supported.
+	bail()
+	panic("unreachable")
+}
+
+// fromConstant converts a constant of type typ to a value.
+func fromConstant(c constant.Value, typ types.Type) value {
+	basic, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		bail()
+	}
+	switch {
+	case basic.Info()&types.IsBoolean != 0:
+		if c.Kind() != constant.Bool {
+			bail()
+		}
+		return constant.BoolVal(c)
+	case basic.Info()&types.IsString != 0:
+		if c.Kind() != constant.String {
+			bail()
+		}
+		return constant.StringVal(c)
+	case basic.Info()&types.IsInteger != 0:
+		c = constant.ToInt(c)
+		if c.Kind() != constant.Int {
+			bail()
+		}
+		var v value
+		if basic.Info()&types.IsUnsigned != 0 {
+			n, ok := constant.Uint64Val(c)
+			if !ok {
+				bail()
+			}
+			v = n
+		} else {
+			n, ok := constant.Int64Val(c)
+			if !ok {
+				bail()
+			}
+			v = n
+		}
+		// Make sure that values of platform-dependent types are
+		// portable.
+		return normalize(v, typ)
+	case basic.Info()&types.IsFloat != 0:
+		c = constant.ToFloat(c)
+		if c.Kind() != constant.Float && c.Kind() != constant.Int {
+			bail()
+		}
+		f, _ := constant.Float64Val(c)
+		return normalize(f, typ)
+	default:
+		bail()
+		panic("unreachable")
+	}
+}
+
+// toConstant converts a value of basic type to a constant.
+func toConstant(v value) (constant.Value, bool) {
+	switch v := v.(type) {
+	case bool:
+		return constant.MakeBool(v), true
+	case int64:
+		return constant.MakeInt64(v), true
+	case uint64:
+		return constant.MakeUint64(v), true
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil, false
+		}
+		return constant.MakeFloat64(v), true
+	case string:
+		return constant.MakeString(v), true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,61 @@
+//go:build go1.18
+// +build go1.18
+
+package callgraph_test
+
+import (
+	"go/importer"
+	"testing"
+
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/ir/irutil/callgraph"
+)
+
+const genericProgram = `package main
+
+type I interface{ M() }
+
+type C struct{}
+
+func (*C) M() {}
+
+func Generic[T I](x T) { x.M() }
+func Apply[T any](x T) {}
+
+func main() {
+	Generic(&C{})
+	apply := Apply[int]
+	apply(0)
+}
+`
+
+func TestStaticGeneric(t *testing.T) {
+	pkg := build(t, "main", genericProgram, importer.Default())
+	checkEdges(t, edges(t, callgraph.Static(pkg.Prog)),
+		[]string{
+			"main.main -> main.Generic",
+		},
+		nil)
+}
+
+func TestCHAGeneric(t *testing.T) {
+	pkg := build(t, "main", genericProgram, importer.Default())
+	checkEdges(t, edges(t, callgraph.CHA(pkg.Prog)),
+		[]string{
+			"main.Generic -> (*main.C).M",
+			"main.main -> main.Apply",
+		},
+		nil)
+}
+
+func TestRTAGeneric(t *testing.T) {
+	pkg := build(t, "main", genericProgram, importer.Default())
+	res := callgraph.RTA([]*ir.Function{pkg.Func("main")}, true)
+	checkEdges(t, edges(t, res.CallGraph),
+		[]string{
+			"main.main -> main.Generic",
+			"main.Generic -> (*main.C).M",
+			"main.main -> main.Apply",
+		},
+		nil)
+}
@@ -0,0 +1,237 @@
+package callgraph_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/ir/irutil"
+	"honnef.co/go/tools/go/ir/irutil/callgraph"
+)
+
+const program = `package main
+
+type I interface{ M() }
+
+type A struct{}
+
+func (A) M() {}
+
+// B is never converted to an interface.
+type B struct{}
+
+func (B) M() {}
+
+type C struct{}
+
+func (*C) M() {}
+
+func f() {}
+
+// g's value is never taken.
+func g() {}
+
+func use(i I)        { i.M() }
+func call(fn func()) { fn() }
+
+func main() {
+	use(A{})
+	call(f)
+	n := 0
+	call(func() { n++ })
+	var c I = &C{}
+	c.M()
+	g()
+}
+`
+
+func build(t *testing.T, path, src string, imp types.Importer) *ir.Package {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path+".go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, _, err := irutil.BuildPackage(&types.Config{Importer: imp}, fset, types.NewPackage(path, ""), []*ast.File{f}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+// edges returns the edges of a call graph as "caller -> callee"
+// strings, omitting edges from the synthetic root.
+func edges(t *testing.T, g *callgraph.Graph) map[string]bool {
+	t.Helper()
+	out := map[string]bool{}
+	for fn := range g.Nodes {
+		if fn != nil && fn.Synthetic == ir.SyntheticGeneric {
+			t.Errorf("call graph contains wrapper %s", fn)
+		}
+	}
+	callgraph.GraphVisitEdges(g, func(e *callgraph.Edge) error {
+		if e.Caller.Func != nil {
+			out[fmt.Sprintf("%s -> %s", e.Caller.Func, e.Callee.Func)] = true
+		}
+		return nil
+	})
+	return out
+}
+
+func checkEdges(t *testing.T, got map[string]bool, want, notWant []string) {
+	t.Helper()
+	for _, e := range want {
+		if !got[e] {
+			t.Errorf("missing edge %s", e)
+		}
+	}
+	for _, e := range notWant {
+		if got[e] {
+			t.Errorf("unexpected edge %s", e)
+		}
+	}
+}
+
+func TestStatic(t *testing.T) {
+	pkg := build(t, "main", program, importer.Default())
+	checkEdges(t, edges(t, callgraph.Static(pkg.Prog)),
+		[]string{
+			"main.main -> main.use",
+			"main.main -> main.call",
+			"main.main -> main.g",
+		},
+		[]string{
+			"main.use -> (main.A).M",
+			"main.call -> main.f",
+		})
+}
+
+func TestCHA(t *testing.T) {
+	pkg := build(t, "main", program, importer.Default())
+	checkEdges(t, edges(t, callgraph.CHA(pkg.Prog)),
+		[]string{
+			"main.main -> main.use",
+			"main.use -> (main.A).M",
+			"main.use -> (main.B).M",
+			"main.use -> (*main.C).M",
+			"main.call -> main.f",
+			"main.call -> main.g",
+			"main.call -> main.main$1",
+			"main.main -> (*main.C).M",
+		},
+		nil)
+}
+
+func TestRTA(t *testing.T) {
+	pkg := build(t, "main", program, importer.Default())
+	res := callgraph.RTA([]*ir.Function{pkg.Func("main")}, true)
+	checkEdges(t, edges(t, res.CallGraph),
+		[]string{
+			"main.main -> main.use",
+			"main.use -> (main.A).M",
+			"main.call -> main.f",
+			"main.call -> main.main$1",
+			"main.main -> (*main.C).M",
+		},
+		[]string{
+			"main.use -> (main.B).M",
+			"main.call -> main.g",
+		})
+
+	B := pkg.Prog.FuncValue(pkg.Type("B").Type().(*types.Named).Method(0))
+	if _, ok := res.Reachable[B]; ok {
+		t.Errorf("%s is reachable", B)
+	}
+	if !res.Reachable[pkg.Func("f")].AddrTaken {
+		t.Errorf("f isn't address-taken")
+	}
+}
+
+const libPackage = `package lib
+
+type Runner interface{ Run() }
+
+func Run(r Runner) { r.Run() }
+
+func Each(fns []func()) {
+	for _, fn := range fns {
+		fn()
+	}
+}
+`
+
+const mainPackage = `package main
+
+import "lib"
+
+type T struct{}
+
+func (T) Run() {}
+
+type U struct{}
+
+func (U) Run() {}
+
+func main() {
+	lib.Run(T{})
+	lib.Each([]func(){func() {}})
+	_ = U{}
+}
+`
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+// TestSummary checks that summaries of separately built packages can
+// be serialized and linked.
+func TestSummary(t *testing.T) {
+	lib := build(t, "lib", libPackage, importer.Default())
+	main := build(t, "main", mainPackage, importerFunc(func(path string) (*types.Package, error) {
+		if path == "lib" {
+			return lib.Pkg, nil
+		}
+		return importer.Default().Import(path)
+	}))
+
+	var summaries []*callgraph.Summary
+	for _, pkg := range []*ir.Package{main, lib} {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(callgraph.Summarize(pkg)); err != nil {
+			t.Fatal(err)
+		}
+		s := new(callgraph.Summary)
+		if err := gob.NewDecoder(&buf).Decode(s); err != nil {
+			t.Fatal(err)
+		}
+		summaries = append(summaries, s)
+	}
+
+	g := callgraph.Link(summaries, []string{"main.main"})
+	got := map[string]bool{}
+	for caller, out := range g.Out {
+		for _, e := range out {
+			got[caller+" -> "+e.Callee] = true
+		}
+	}
+	checkEdges(t, got,
+		[]string{
+			"main.main -> lib.Run",
+			"main.main -> lib.Each",
+			"lib.Run -> (main.T).Run",
+			"lib.Each -> main.main$1",
+		},
+		[]string{
+			"lib.Run -> (main.U).Run",
+		})
+	if g.Reachable["(main.U).Run"] {
+		t.Errorf("(main.U).Run is reachable")
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package callgraph
+
+import (
+	"go/types"
+
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/types/typeutil"
+)
+
+// CHA computes the call graph of a program using the Class Hierarchy
+// Analysis algorithm.
+//
+// A dynamic call of a function value may call any function of the
+// program with an identical signature, and an interface method call
+// may call any method of any type of the program that implements the
+// interface, regardless of whether the function's value is ever
+// taken, or whether the type is ever converted to an interface.
+//
+// The resulting graph has no root node.
+func CHA(prog *ir.Program) *Graph {
+	cg := New(nil)
+
+	allFuncs := allFunctions(prog)
+
+	// funcsBySig contains all functions, keyed by signature. It is
+	// the effective set of address-taken functions used to resolve
+	// a dynamic call of a particular signature.
+	var funcsBySig typeutil.Map // value is []*ir.Function
+
+	// methodsByName contains all methods, grouped by name for
+	// efficient lookup.
+	methodsByName := make(map[string][]*ir.Function)
+
+	// methodsMemo records, for every abstract method call I.m on
+	// interface type I, the set of concrete methods C.m of all
+	// types C that satisfy interface I.
+	methodsMemo := make(map[*types.Func][]*ir.Function)
+	lookupMethods := func(m *types.Func) []*ir.Function {
+		methods, ok := methodsMemo[m]
+		if !ok {
+			I := m.Type().(*types.Signature).Recv().Type().Underlying().(*types.Interface)
+			for _, f := range methodsByName[m.Name()] {
+				C := f.Signature.Recv().Type() // named or *named
+				if types.Implements(C, I) {
+					methods = append(methods, f)
+				}
+			}
+			methodsMemo[m] = methods
+		}
+		return methods
+	}
+
+	for f := range allFuncs {
+		if f.Signature.Recv() == nil {
+			// Package initializers can never be address-taken.
+			if f.Synthetic == ir.SyntheticPackageInitializer {
+				continue
+			}
+			funcs, _ := funcsBySig.At(f.Signature).([]*ir.Function)
+			funcs = append(funcs, f)
+			funcsBySig.Set(f.Signature, funcs)
+		} else if !isGeneric(f) {
+			methodsByName[f.Name()] = append(methodsByName[f.Name()], f)
+		}
+	}
+
+	addEdge := func(fnode *Node, site ir.CallInstruction, g *ir.Function) {
+		AddEdge(fnode, site, cg.CreateNode(unwrap(g)))
+	}
+
+	for f := range allFuncs {
+		if wrappedCall(f) != nil {
+			continue
+		}
+		fnode := cg.CreateNode(f)
+		calls(f, func(site ir.CallInstruction) {
+			call := site.Common()
+			if call.IsInvoke() {
+				for _, g := range lookupMethods(call.Method) {
+					addEdge(fnode, site, g)
+				}
+			} else if g := staticCallee(call); g != nil {
+				addEdge(fnode, site, g)
+			} else if _, ok := call.Value.(*ir.Builtin); !ok {
+				callees, _ := funcsBySig.At(call.Signature()).([]*ir.Function)
+				for _, g := range callees {
+					addEdge(fnode, site, g)
+				}
+			}
+		})
+	}
+
+	return cg
+}
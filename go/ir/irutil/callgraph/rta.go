@@ -0,0 +1,402 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package callgraph
+
+// This file implements Rapid Type Analysis (RTA), a fast and
+// reasonably precise algorithm for constructing call graphs that
+// only considers the functions and types that are reachable from a
+// set of roots.
+//
+// RTA discovers the set of reachable functions iteratively. When a
+// reachable function converts a value of concrete type C to an
+// interface (MakeInterface), C becomes a runtime type, and calls of
+// interface methods may dispatch to C's methods. When a reachable
+// function takes the value of a function (a function used as an
+// operand other than the callee of a call, or a MakeClosure), that
+// function becomes address-taken, and dynamic calls of function values
+// with an identical signature may call it.
+//
+// Unlike CHA, RTA thus ignores types that are never converted to
+// interfaces and functions whose values are never taken, as well as
+// anything that isn't reachable from the roots.
+//
+// Reflection is only approximated: exported methods of runtime types
+// are assumed to be reachable, and so are the types of their
+// parameters and results.
+
+import (
+	"go/types"
+
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/types/typeutil"
+
+	"golang.org/x/exp/typeparams"
+)
+
+// An RTAResult holds the results of Rapid Type Analysis.
+type RTAResult struct {
+	// CallGraph is the discovered call graph. It has a synthetic
+	// root node with edges to the roots of the analysis. It is nil
+	// if not requested.
+	CallGraph *Graph
+
+	// Reachable contains the set of reachable functions, and
+	// whether each was reachable via its address being taken, as
+	// opposed to only by static calls.
+	Reachable map[*ir.Function]struct{ AddrTaken bool }
+
+	// RuntimeTypes contains the set of types that are needed at
+	// runtime, for interfaces or reflection.
+	RuntimeTypes typeutil.Map // value is bool
+}
+
+type rta struct {
+	result *RTAResult
+	prog   *ir.Program
+
+	worklist []*ir.Function
+
+	// addrTakenFuncsBySig contains all address-taken functions,
+	// keyed by signature.
+	addrTakenFuncsBySig typeutil.Map // value is map[*ir.Function]bool
+
+	// dynCallSites contains all dynamic "call"-mode call sites,
+	// keyed by signature.
+	dynCallSites typeutil.Map // value is []ir.CallInstruction
+
+	// invokeSites contains all "invoke"-mode call sites, keyed by
+	// interface type.
+	invokeSites typeutil.Map // value is []ir.CallInstruction
+
+	// concreteTypes maps each concrete runtime type to the set of
+	// interfaces it implements, among those in interfaceTypes.
+	concreteTypes typeutil.Map // value is []*types.Interface
+
+	// interfaceTypes maps each interface type of an invoke site to
+	// the set of concrete runtime types that implement it.
+	interfaceTypes typeutil.Map // value is []types.Type
+}
+
+// RTA performs Rapid Type Analysis, starting at the specified root
+// functions. It returns the set of reachable functions and runtime
+// types, and optionally the call graph.
+//
+// The roots usually are the main and init functions of the main
+// package, and, for tests, the test functions.
+func RTA(roots []*ir.Function, buildCallGraph bool) *RTAResult {
+	if len(roots) == 0 {
+		return nil
+	}
+	r := &rta{
+		result: &RTAResult{Reachable: make(map[*ir.Function]struct{ AddrTaken bool })},
+		prog:   roots[0].Prog,
+	}
+	if buildCallGraph {
+		// The root node is synthetic, with edges to all roots.
+		r.result.CallGraph = New(nil)
+	}
+
+	for _, root := range roots {
+		r.addReachable(root, false)
+		if g := r.result.CallGraph; g != nil {
+			AddEdge(g.Root, nil, g.CreateNode(root))
+		}
+	}
+
+	// Visit functions, processing their instructions, and adding
+	// new ones to the worklist, until a fixed point is reached.
+	var shadow []*ir.Function
+	for len(r.worklist) > 0 {
+		shadow, r.worklist = r.worklist, shadow[:0]
+		for _, f := range shadow {
+			r.visitFunc(f)
+		}
+	}
+	return r.result
+}
+
+// addReachable marks a function as potentially callable at runtime,
+// and if new, queues it for processing.
+func (r *rta) addReachable(f *ir.Function, addrTaken bool) {
+	reachable := r.result.Reachable
+	n := len(reachable)
+	v := reachable[f]
+	if addrTaken {
+		v.AddrTaken = true
+	}
+	reachable[f] = v
+	if len(reachable) > n {
+		// First time seeing f. Add it to the worklist.
+		r.worklist = append(r.worklist, f)
+	}
+}
+
+// addEdge adds the specified call graph edge, and marks the callee
+// as reachable. addrTaken indicates whether to mark the callee as
+// "address-taken".
+func (r *rta) addEdge(site ir.CallInstruction, callee *ir.Function, addrTaken bool) {
+	if inner := wrappedCall(callee); inner != nil {
+		// Dynamic calls may call wrappers for instantiations of
+		// generic functions, which we resolve to the generic
+		// functions.
+		for _, targ := range inner.TypeArgs {
+			r.addRuntimeType(targ)
+		}
+		callee = inner.StaticCallee()
+	}
+	r.addReachable(callee, addrTaken)
+
+	if g := r.result.CallGraph; g != nil {
+		from := g.CreateNode(site.Parent())
+		to := g.CreateNode(callee)
+		AddEdge(from, site, to)
+	}
+}
+
+// ---------- addrTakenFuncs × dynCallSites ----------
+
+// visitAddrTakenFunc is called each time we encounter an
+// address-taken function f.
+func (r *rta) visitAddrTakenFunc(f *ir.Function) {
+	S := f.Signature
+	funcs, _ := r.addrTakenFuncsBySig.At(S).(map[*ir.Function]bool)
+	if funcs == nil {
+		funcs = make(map[*ir.Function]bool)
+		r.addrTakenFuncsBySig.Set(S, funcs)
+	}
+	if !funcs[f] {
+		// First time seeing f.
+		funcs[f] = true
+
+		// If we've seen any dyncalls of this type, mark it
+		// reachable, and add call graph edges.
+		sites, _ := r.dynCallSites.At(S).([]ir.CallInstruction)
+		for _, site := range sites {
+			r.addEdge(site, f, true)
+		}
+	}
+}
+
+// visitDynCall is called each time we encounter a dynamic
+// "call"-mode call.
+func (r *rta) visitDynCall(site ir.CallInstruction) {
+	S := site.Common().Signature()
+
+	// Record the call site.
+	sites, _ := r.dynCallSites.At(S).([]ir.CallInstruction)
+	r.dynCallSites.Set(S, append(sites, site))
+
+	// For each function of signature S that we know is
+	// address-taken, add an edge and mark it reachable.
+	funcs, _ := r.addrTakenFuncsBySig.At(S).(map[*ir.Function]bool)
+	for g := range funcs {
+		r.addEdge(site, g, true)
+	}
+}
+
+// ---------- concrete types × invoke sites ----------
+
+// addInvokeEdge is called for each new pair (site, C) in the matrix.
+func (r *rta) addInvokeEdge(site ir.CallInstruction, C types.Type) {
+	// Ascertain the concrete method of C to be called.
+	imethod := site.Common().Method
+	sel := r.prog.MethodSets.MethodSet(C).Lookup(imethod.Pkg(), imethod.Name())
+	if sel == nil {
+		return
+	}
+	r.addEdge(site, r.prog.MethodValue(sel), true)
+}
+
+// visitInvoke is called each time the algorithm encounters an
+// "invoke"-mode call.
+func (r *rta) visitInvoke(site ir.CallInstruction) {
+	I := invokedInterface(site.Common())
+
+	// Record the invoke site.
+	sites, _ := r.invokeSites.At(I).([]ir.CallInstruction)
+	r.invokeSites.Set(I, append(sites, site))
+
+	// Add callgraph edge for each existing address-taken concrete
+	// type implementing I.
+	for _, C := range r.implementations(I) {
+		r.addInvokeEdge(site, C)
+	}
+}
+
+// invokedInterface returns the interface whose method an
+// "invoke"-mode call calls. For calls of methods of type parameters,
+// this is the type parameter's constraint.
+func invokedInterface(call *ir.CallCommon) *types.Interface {
+	return call.Method.Type().(*types.Signature).Recv().Type().Underlying().(*types.Interface)
+}
+
+// ---------- main algorithm ----------
+
+// visitFunc processes function f.
+func (r *rta) visitFunc(f *ir.Function) {
+	var space [32]*ir.Value // preallocate space for common case
+
+	for _, b := range f.Blocks {
+		for _, instr := range b.Instrs {
+			rands := instr.Operands(space[:0])
+
+			switch instr := instr.(type) {
+			case ir.CallInstruction:
+				call := instr.Common()
+				if call.IsInvoke() {
+					r.visitInvoke(instr)
+				} else if g := staticCallee(call); g != nil {
+					r.addEdge(instr, g, false)
+				} else if _, ok := call.Value.(*ir.Builtin); !ok {
+					r.visitDynCall(instr)
+				}
+				// Generic code may call methods of its type
+				// arguments, or convert values of them to
+				// interfaces, without a MakeInterface of the
+				// concrete types.
+				for _, targ := range typeArguments(call) {
+					r.addRuntimeType(targ)
+				}
+
+				// Ignore the call-position operand when looking
+				// for address-taken Functions. The callee is
+				// always the first operand.
+				rands = rands[1:]
+
+			case *ir.MakeInterface:
+				r.addRuntimeType(instr.X.Type())
+			}
+
+			// Process all address-taken functions.
+			for _, op := range rands {
+				if g, ok := (*op).(*ir.Function); ok {
+					r.visitAddrTakenFunc(g)
+				}
+			}
+		}
+	}
+}
+
+// interfaces returns the set of interface types implemented by the
+// concrete type C, among those seen in invoke sites so far.
+func (r *rta) interfaces(C types.Type) []*types.Interface {
+	// Ascertain set of interfaces C implements and update
+	// 'implements' relation.
+	var ifaces []*types.Interface
+	r.interfaceTypes.Iterate(func(I types.Type, concs interface{}) {
+		if I := I.(*types.Interface); types.Implements(C, I) {
+			concs, _ := concs.([]types.Type)
+			r.interfaceTypes.Set(I, append(concs, C))
+			ifaces = append(ifaces, I)
+		}
+	})
+	r.concreteTypes.Set(C, ifaces)
+	return ifaces
+}
+
+// implementations returns the set of concrete types seen so far
+// that implement the interface type I.
+func (r *rta) implementations(I *types.Interface) []types.Type {
+	var concs []types.Type
+	if v := r.interfaceTypes.At(I); v != nil {
+		concs = v.([]types.Type)
+	} else {
+		// First time seeing this interface. Update the 'implements'
+		// relation.
+		r.concreteTypes.Iterate(func(C types.Type, ifaces interface{}) {
+			if types.Implements(C, I) {
+				ifaces, _ := ifaces.([]*types.Interface)
+				r.concreteTypes.Set(C, append(ifaces, I))
+				concs = append(concs, C)
+			}
+		})
+		r.interfaceTypes.Set(I, concs)
+	}
+	return concs
+}
+
+// addRuntimeType is called for each concrete type that can be the
+// dynamic type of some interface or reflect.Value, and recursively
+// for the types of its components.
+func (r *rta) addRuntimeType(T types.Type) {
+	if r.result.RuntimeTypes.At(T) != nil {
+		return
+	}
+	r.result.RuntimeTypes.Set(T, true)
+
+	if _, ok := T.(*typeparams.TypeParam); ok {
+		// The type argument is converted to an interface in each
+		// instantiation, not here.
+		return
+	}
+
+	mset := r.prog.MethodSets.MethodSet(T)
+
+	if _, ok := T.Underlying().(*types.Interface); !ok {
+		// T is a new concrete type.
+		for i, n := 0, mset.Len(); i < n; i++ {
+			sel := mset.At(i)
+			if sel.Obj().Exported() {
+				// Exported methods are always potentially
+				// callable via reflection.
+				r.addReachable(r.prog.MethodValue(sel), true)
+			}
+		}
+
+		// Add callgraph edge for each existing dynamic
+		// "invoke"-mode call via that interface.
+		for _, I := range r.interfaces(T) {
+			sites, _ := r.invokeSites.At(I).([]ir.CallInstruction)
+			for _, site := range sites {
+				r.addInvokeEdge(site, T)
+			}
+		}
+	}
+
+	// Recursion over signatures of each exported method, as
+	// reflection can produce values of their parameter and result
+	// types.
+	for i := 0; i < mset.Len(); i++ {
+		if mset.At(i).Obj().Exported() {
+			sig := mset.At(i).Type().(*types.Signature)
+			r.addRuntimeTypes(sig.Params())
+			r.addRuntimeTypes(sig.Results())
+		}
+	}
+
+	switch t := T.(type) {
+	case *types.Basic, *types.Interface:
+		// nop
+	case *types.Pointer:
+		r.addRuntimeType(t.Elem())
+	case *types.Slice:
+		r.addRuntimeType(t.Elem())
+	case *types.Chan:
+		r.addRuntimeType(t.Elem())
+	case *types.Map:
+		r.addRuntimeType(t.Key())
+		r.addRuntimeType(t.Elem())
+	case *types.Signature:
+		r.addRuntimeTypes(t.Params())
+		r.addRuntimeTypes(t.Results())
+	case *types.Named:
+		// A pointer-to-named type can be derived from a named
+		// type via reflection. It may have methods too.
+		r.addRuntimeType(types.NewPointer(T))
+		r.addRuntimeType(t.Underlying())
+	case *types.Array:
+		r.addRuntimeType(t.Elem())
+	case *types.Struct:
+		for i, n := 0, t.NumFields(); i < n; i++ {
+			r.addRuntimeType(t.Field(i).Type())
+		}
+	}
+}
+
+func (r *rta) addRuntimeTypes(tuple *types.Tuple) {
+	for i := 0; i < tuple.Len(); i++ {
+		r.addRuntimeType(tuple.At(i).Type())
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package callgraph
+
+import (
+	"honnef.co/go/tools/go/ir"
+)
+
+// Static computes the call graph edges for all static calls in the
+// program. Dynamic calls – calls of function values and interface
+// method calls – contribute no edges.
+//
+// The resulting graph has no root node.
+func Static(prog *ir.Program) *Graph {
+	cg := New(nil)
+	for f := range allFunctions(prog) {
+		if wrappedCall(f) != nil {
+			continue
+		}
+		fnode := cg.CreateNode(f)
+		calls(f, func(site ir.CallInstruction) {
+			if g := staticCallee(site.Common()); g != nil {
+				AddEdge(fnode, site, cg.CreateNode(g))
+			}
+		})
+	}
+	return cg
+}
@@ -0,0 +1,494 @@
+package callgraph
+
+// This file implements call graph summaries. A summary describes the
+// calls made by the functions of a single package, and which
+// functions and types they make available for dynamic calls. Unlike
+// the IR, summaries don't refer to types.Type or ir.Function, only to
+// strings, which makes them cheap to serialize as analysis facts and
+// to cache. Linking the summaries of a package and its dependencies
+// results in a call graph of the package, computed with a variant of
+// RTA.
+//
+// Functions are identified by their full names, as returned by
+// FuncID. Types are identified by their type strings, and methods by
+// their name and signature, which is sufficient for determining
+// whether a type implements an interface across package boundaries.
+
+import (
+	"bytes"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"honnef.co/go/tools/go/ir"
+
+	"golang.org/x/exp/typeparams"
+)
+
+// A Summary describes the calls made by the functions of a single
+// package.
+type Summary struct {
+	Funcs []FuncSummary
+	// Types lists the concrete types that the package's functions
+	// convert to interfaces, and their method sets.
+	Types []TypeSummary
+}
+
+// A FuncSummary describes the calls made by a single function.
+type FuncSummary struct {
+	ID    string
+	Calls []CallSummary
+	// AddrTaken lists the functions whose values are taken by this
+	// function, which may thus be called by dynamic calls anywhere.
+	AddrTaken []FuncRef
+	// Converts lists the keys of the types that this function
+	// converts to interfaces, or passes as type arguments.
+	Converts []string
+}
+
+// A FuncRef refers to a function by ID, together with the key of its
+// signature.
+type FuncRef struct {
+	ID        string
+	Signature string
+}
+
+type CallKind uint8
+
+const (
+	// A call of a statically known function.
+	StaticCall CallKind = iota + 1
+	// A call of a function value.
+	DynamicCall
+	// A call of an interface method.
+	InvokeCall
+)
+
+// A CallSummary describes a single call site.
+type CallSummary struct {
+	Kind CallKind
+	Pos  token.Position
+	// Callee is the ID of the called function, for static calls.
+	Callee string
+	// Signature is the key of the called function value's
+	// signature, for dynamic calls.
+	Signature string
+	// Method is the key of the called method, and Interface the
+	// keys of all methods of the interface, for invoke calls.
+	Method    string
+	Interface []string
+}
+
+// A TypeSummary describes the method set of a concrete type.
+type TypeSummary struct {
+	Key string
+	// Methods maps method keys to the IDs of the functions
+	// implementing them.
+	Methods map[string]string
+}
+
+// FuncID returns the string identifying fn in summaries. Wrappers,
+// and instantiations of generic functions, are identified with the
+// functions they wrap.
+func FuncID(fn *ir.Function) string {
+	if obj, ok := fn.Object().(*types.Func); ok {
+		return typeparams.OriginMethod(obj).FullName()
+	}
+	return fn.RelString(nil)
+}
+
+// TypeKey returns the string identifying T in summaries.
+func TypeKey(T types.Type) string {
+	return types.TypeString(T, nil)
+}
+
+// signatureKey returns the string identifying a signature, ignoring
+// the receiver and the names of parameters and results.
+func signatureKey(sig *types.Signature) string {
+	var b bytes.Buffer
+	tuple := func(t *types.Tuple, variadic bool) {
+		b.WriteByte('(')
+		for i := 0; i < t.Len(); i++ {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			typ := t.At(i).Type()
+			if variadic && i == t.Len()-1 {
+				b.WriteString("...")
+				typ = typ.(*types.Slice).Elem()
+			}
+			types.WriteType(&b, typ, nil)
+		}
+		b.WriteByte(')')
+	}
+	b.WriteString("func")
+	tuple(sig.Params(), sig.Variadic())
+	tuple(sig.Results(), false)
+	return b.String()
+}
+
+// methodKey returns the string identifying a method, consisting of
+// its name, qualified by its package if unexported, and signature.
+func methodKey(m *types.Func) string {
+	name := m.Name()
+	if !m.Exported() && m.Pkg() != nil {
+		name = m.Pkg().Path() + "." + name
+	}
+	return name + " " + signatureKey(m.Type().(*types.Signature))
+}
+
+// packageFunctions returns the functions that belong to pkg, including
+// methods and anonymous functions, sorted by name.
+func packageFunctions(pkg *ir.Package) []*ir.Function {
+	var out []*ir.Function
+	var add func(fn *ir.Function)
+	add = func(fn *ir.Function) {
+		if fn == nil || fn.Pkg != pkg {
+			return
+		}
+		out = append(out, fn)
+		for _, anon := range fn.AnonFuncs {
+			add(anon)
+		}
+	}
+	for _, mem := range pkg.Members {
+		switch mem := mem.(type) {
+		case *ir.Function:
+			add(mem)
+		case *ir.Type:
+			if named, ok := mem.Type().(*types.Named); ok {
+				for i := 0; i < named.NumMethods(); i++ {
+					add(pkg.Prog.FuncValue(named.Method(i)))
+				}
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].RelString(nil) < out[j].RelString(nil)
+	})
+	return out
+}
+
+// Summarize computes the summary of a package.
+func Summarize(pkg *ir.Package) *Summary {
+	prog := pkg.Prog
+	s := &Summary{}
+	seenTypes := map[string]bool{}
+	// converted contains the types converted by the current
+	// function.
+	var converted map[string]bool
+	var convert func(fs *FuncSummary, T types.Type)
+	convert = func(fs *FuncSummary, T types.Type) {
+		if _, ok := T.(*typeparams.TypeParam); ok {
+			return
+		}
+		key := TypeKey(T)
+		if converted[key] {
+			return
+		}
+		converted[key] = true
+
+		// Values of the components of the type can be converted
+		// to interfaces via reflection, or by generic code.
+		switch T := T.(type) {
+		case *types.Pointer:
+			convert(fs, T.Elem())
+		case *types.Slice:
+			convert(fs, T.Elem())
+		case *types.Array:
+			convert(fs, T.Elem())
+		case *types.Chan:
+			convert(fs, T.Elem())
+		case *types.Map:
+			convert(fs, T.Key())
+			convert(fs, T.Elem())
+		case *types.Struct:
+			for i := 0; i < T.NumFields(); i++ {
+				convert(fs, T.Field(i).Type())
+			}
+		}
+
+		mset := prog.MethodSets.MethodSet(T)
+		if _, ok := T.Underlying().(*types.Interface); ok || mset.Len() == 0 {
+			return
+		}
+		fs.Converts = append(fs.Converts, key)
+		if seenTypes[key] {
+			return
+		}
+		seenTypes[key] = true
+		ts := TypeSummary{Key: key, Methods: map[string]string{}}
+		for i := 0; i < mset.Len(); i++ {
+			obj := mset.At(i).Obj().(*types.Func)
+			ts.Methods[methodKey(obj)] = typeparams.OriginMethod(obj).FullName()
+		}
+		s.Types = append(s.Types, ts)
+	}
+
+	for _, fn := range packageFunctions(pkg) {
+		fs := FuncSummary{ID: FuncID(fn)}
+		converted = map[string]bool{}
+		var space [32]*ir.Value
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				rands := instr.Operands(space[:0])
+				switch instr := instr.(type) {
+				case ir.CallInstruction:
+					call := instr.Common()
+					cs := CallSummary{Pos: prog.Fset.Position(instr.Pos())}
+					if call.IsInvoke() {
+						cs.Kind = InvokeCall
+						cs.Method = methodKey(call.Method)
+						I := invokedInterface(call)
+						for i := 0; i < I.NumMethods(); i++ {
+							cs.Interface = append(cs.Interface, methodKey(I.Method(i)))
+						}
+					} else if g := staticCallee(call); g != nil {
+						cs.Kind = StaticCall
+						cs.Callee = FuncID(g)
+					} else if _, ok := call.Value.(*ir.Builtin); !ok {
+						cs.Kind = DynamicCall
+						cs.Signature = signatureKey(call.Signature())
+					}
+					if cs.Kind != 0 {
+						fs.Calls = append(fs.Calls, cs)
+					}
+					for _, targ := range typeArguments(call) {
+						convert(&fs, targ)
+					}
+					rands = rands[1:]
+				case *ir.MakeInterface:
+					convert(&fs, instr.X.Type())
+				}
+				for _, op := range rands {
+					if g, ok := (*op).(*ir.Function); ok {
+						fs.AddrTaken = append(fs.AddrTaken, FuncRef{ID: FuncID(g), Signature: signatureKey(g.Signature)})
+					}
+				}
+			}
+		}
+		s.Funcs = append(s.Funcs, fs)
+	}
+	sort.Slice(s.Types, func(i, j int) bool {
+		return s.Types[i].Key < s.Types[j].Key
+	})
+	return s
+}
+
+// A SummaryGraph is a call graph computed from summaries. Its nodes
+// are function IDs.
+type SummaryGraph struct {
+	// Reachable contains the functions reachable from the roots.
+	Reachable map[string]bool
+	// Out maps functions to the calls they may make, sorted by
+	// position and callee.
+	Out map[string][]SummaryEdge
+}
+
+// A SummaryEdge is an edge of a SummaryGraph.
+type SummaryEdge struct {
+	Pos    token.Position
+	Kind   CallKind
+	Callee string
+}
+
+// Link computes a call graph from the summaries of a package and all
+// of its dependencies, using a variant of RTA. If roots is empty, all
+// functions are considered roots, which is appropriate for libraries.
+//
+// Functions that are referred to but not described by any summary,
+// such as functions implemented in assembly, are reachable, but have
+// no outgoing edges.
+func Link(summaries []*Summary, roots []string) *SummaryGraph {
+	l := &linker{
+		g: &SummaryGraph{
+			Reachable: map[string]bool{},
+			Out:       map[string][]SummaryEdge{},
+		},
+		funcs:        map[string]*FuncSummary{},
+		types:        map[string]*TypeSummary{},
+		runtimeTypes: map[string]bool{},
+		addrTaken:    map[string]map[string]bool{},
+		dynSites:     map[string][]linkSite{},
+		invokeSites:  map[string][]linkSite{},
+		edges:        map[SummaryEdge]map[string]bool{},
+	}
+	for _, s := range summaries {
+		for i := range s.Funcs {
+			fs := &s.Funcs[i]
+			if _, ok := l.funcs[fs.ID]; !ok {
+				l.funcs[fs.ID] = fs
+			}
+		}
+		for i := range s.Types {
+			ts := &s.Types[i]
+			if _, ok := l.types[ts.Key]; !ok {
+				l.types[ts.Key] = ts
+			}
+		}
+	}
+	if len(roots) == 0 {
+		for id := range l.funcs {
+			roots = append(roots, id)
+		}
+		sort.Strings(roots)
+	}
+	for _, root := range roots {
+		l.addReachable(root)
+	}
+	for len(l.worklist) > 0 {
+		id := l.worklist[len(l.worklist)-1]
+		l.worklist = l.worklist[:len(l.worklist)-1]
+		l.visit(id)
+	}
+
+	for _, edges := range l.g.Out {
+		sort.Slice(edges, func(i, j int) bool {
+			a, b := edges[i], edges[j]
+			if a.Pos.Filename != b.Pos.Filename {
+				return a.Pos.Filename < b.Pos.Filename
+			}
+			if a.Pos.Offset != b.Pos.Offset {
+				return a.Pos.Offset < b.Pos.Offset
+			}
+			return a.Callee < b.Callee
+		})
+	}
+	return l.g
+}
+
+type linkSite struct {
+	caller string
+	site   *CallSummary
+}
+
+type linker struct {
+	g        *SummaryGraph
+	worklist []string
+
+	funcs map[string]*FuncSummary
+	types map[string]*TypeSummary
+
+	// runtimeTypes contains the keys of all types converted to
+	// interfaces by reachable functions.
+	runtimeTypes map[string]bool
+	// addrTaken maps signature keys to the IDs of address-taken
+	// functions.
+	addrTaken map[string]map[string]bool
+	// dynSites maps signature keys to dynamic call sites.
+	dynSites map[string][]linkSite
+	// invokeSites maps method keys to invoke call sites.
+	invokeSites map[string][]linkSite
+
+	// edges is used to eliminate duplicate edges. Edges are keyed
+	// by their position, kind and callee, and mapped to the set of
+	// their callers.
+	edges map[SummaryEdge]map[string]bool
+}
+
+func (l *linker) addReachable(id string) {
+	if !l.g.Reachable[id] {
+		l.g.Reachable[id] = true
+		l.worklist = append(l.worklist, id)
+	}
+}
+
+func (l *linker) addEdge(caller string, site *CallSummary, callee string) {
+	e := SummaryEdge{Pos: site.Pos, Kind: site.Kind, Callee: callee}
+	callers := l.edges[e]
+	if callers == nil {
+		callers = map[string]bool{}
+		l.edges[e] = callers
+	}
+	if !callers[caller] {
+		callers[caller] = true
+		l.g.Out[caller] = append(l.g.Out[caller], e)
+	}
+	l.addReachable(callee)
+}
+
+func (l *linker) visit(id string) {
+	fs, ok := l.funcs[id]
+	if !ok {
+		return
+	}
+	for _, ref := range fs.AddrTaken {
+		l.addAddrTaken(ref)
+	}
+	for _, key := range fs.Converts {
+		l.addRuntimeType(key)
+	}
+	for i := range fs.Calls {
+		site := &fs.Calls[i]
+		switch site.Kind {
+		case StaticCall:
+			l.addEdge(id, site, site.Callee)
+		case DynamicCall:
+			l.dynSites[site.Signature] = append(l.dynSites[site.Signature], linkSite{id, site})
+			for callee := range l.addrTaken[site.Signature] {
+				l.addEdge(id, site, callee)
+			}
+		case InvokeCall:
+			l.invokeSites[site.Method] = append(l.invokeSites[site.Method], linkSite{id, site})
+			for key := range l.runtimeTypes {
+				l.addInvokeEdge(linkSite{id, site}, l.types[key])
+			}
+		}
+	}
+}
+
+func (l *linker) addAddrTaken(ref FuncRef) {
+	fns := l.addrTaken[ref.Signature]
+	if fns == nil {
+		fns = map[string]bool{}
+		l.addrTaken[ref.Signature] = fns
+	}
+	if fns[ref.ID] {
+		return
+	}
+	fns[ref.ID] = true
+	for _, s := range l.dynSites[ref.Signature] {
+		l.addEdge(s.caller, s.site, ref.ID)
+	}
+}
+
+func (l *linker) addRuntimeType(key string) {
+	if l.runtimeTypes[key] {
+		return
+	}
+	l.runtimeTypes[key] = true
+	ts := l.types[key]
+	if ts == nil {
+		return
+	}
+	for mkey, fn := range ts.Methods {
+		if name := mkey[:strings.IndexByte(mkey, ' ')]; token.IsExported(name) {
+			// Exported methods are always potentially callable via
+			// reflection.
+			l.addReachable(fn)
+		}
+		for _, s := range l.invokeSites[mkey] {
+			l.addInvokeEdge(s, ts)
+		}
+	}
+}
+
+// addInvokeEdge adds an edge from an invoke call site to the
+// implementation of the called method, if the type implements the
+// called interface.
+func (l *linker) addInvokeEdge(s linkSite, ts *TypeSummary) {
+	if ts == nil {
+		return
+	}
+	fn, ok := ts.Methods[s.site.Method]
+	if !ok {
+		return
+	}
+	for _, m := range s.site.Interface {
+		if _, ok := ts.Methods[m]; !ok {
+			return
+		}
+	}
+	l.addEdge(s.caller, s.site, fn)
+}
@@ -0,0 +1,199 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package callgraph
+
+import (
+	"go/types"
+
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/ir/irutil"
+
+	"golang.org/x/exp/typeparams"
+)
+
+// This file provides various utilities over call graphs, such as
+// visitation and path search.
+
+// CalleesOf returns a new set containing all direct callees of the
+// caller node.
+func CalleesOf(caller *Node) map[*Node]bool {
+	callees := make(map[*Node]bool)
+	for _, e := range caller.Out {
+		callees[e.Callee] = true
+	}
+	return callees
+}
+
+// GraphVisitEdges visits all the edges in graph g in depth-first order.
+// The edge function is called for each edge in postorder.  If it
+// returns non-nil, visitation stops and GraphVisitEdges returns that
+// value.
+//
+func GraphVisitEdges(g *Graph, edge func(*Edge) error) error {
+	seen := make(map[*Node]bool)
+	var visit func(n *Node) error
+	visit = func(n *Node) error {
+		if !seen[n] {
+			seen[n] = true
+			for _, e := range n.Out {
+				if err := visit(e.Callee); err != nil {
+					return err
+				}
+				if err := edge(e); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, n := range g.Nodes {
+		if err := visit(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PathSearch finds an arbitrary path starting at node start and
+// ending at some node for which isEnd() returns true.  On success,
+// PathSearch returns the path as an ordered list of edges; on
+// failure, it returns nil.
+//
+func PathSearch(start *Node, isEnd func(*Node) bool) []*Edge {
+	stack := make([]*Edge, 0, 32)
+	seen := make(map[*Node]bool)
+	var search func(n *Node) []*Edge
+	search = func(n *Node) []*Edge {
+		if !seen[n] {
+			seen[n] = true
+			if isEnd(n) {
+				return stack
+			}
+			for _, e := range n.Out {
+				stack = append(stack, e) // push
+				if found := search(e.Callee); found != nil {
+					return found
+				}
+				stack = stack[:len(stack)-1] // pop
+			}
+		}
+		return nil
+	}
+	return search(start)
+}
+
+// allFunctions returns all functions of the program, including
+// methods of types that aren't needed at runtime, and anonymous
+// functions.
+func allFunctions(prog *ir.Program) map[*ir.Function]bool {
+	fns := irutil.AllFunctions(prog)
+	var add func(fn *ir.Function)
+	add = func(fn *ir.Function) {
+		if fn == nil || fns[fn] {
+			return
+		}
+		fns[fn] = true
+		for _, anon := range fn.AnonFuncs {
+			add(anon)
+		}
+	}
+	for fn := range fns {
+		for _, anon := range fn.AnonFuncs {
+			add(anon)
+		}
+	}
+	for _, pkg := range prog.AllPackages() {
+		for _, mem := range pkg.Members {
+			typ, ok := mem.(*ir.Type)
+			if !ok {
+				continue
+			}
+			named, ok := typ.Type().(*types.Named)
+			if !ok {
+				continue
+			}
+			for i := 0; i < named.NumMethods(); i++ {
+				add(prog.FuncValue(named.Method(i)))
+			}
+		}
+	}
+	return fns
+}
+
+// calls calls fn for every call instruction in fn.
+func calls(fn *ir.Function, f func(site ir.CallInstruction)) {
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			if site, ok := instr.(ir.CallInstruction); ok {
+				f(site)
+			}
+		}
+	}
+}
+
+// isGeneric reports whether fn is a generic function or a method of a
+// generic type, as opposed to one of their instantiations.
+func isGeneric(fn *ir.Function) bool {
+	return typeparams.ForSignature(fn.Signature).Len() > 0 || typeparams.RecvTypeParams(fn.Signature).Len() > 0
+}
+
+// wrappedCall returns the call of the generic function in fn if fn is
+// a wrapper for an instantiation of a generic function, and nil
+// otherwise.
+func wrappedCall(fn *ir.Function) *ir.CallCommon {
+	if fn == nil || fn.Synthetic != ir.SyntheticGeneric {
+		return nil
+	}
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			if call, ok := instr.(*ir.Call); ok {
+				return call.Common()
+			}
+		}
+	}
+	return nil
+}
+
+// unwrap returns the generic function that fn calls if fn is a
+// wrapper for an instantiation of a generic function, and fn
+// otherwise. Call graphs contain the generic functions instead of
+// their wrappers.
+func unwrap(fn *ir.Function) *ir.Function {
+	if inner := wrappedCall(fn); inner != nil {
+		return inner.StaticCallee()
+	}
+	return fn
+}
+
+// staticCallee is like ir.CallCommon.StaticCallee, but resolves
+// wrappers for instantiations of generic functions.
+func staticCallee(call *ir.CallCommon) *ir.Function {
+	if g := call.StaticCallee(); g != nil {
+		return unwrap(g)
+	}
+	return nil
+}
+
+// typeArguments returns the types that the type parameters of the
+// function called by call may be instantiated with. Calls of generic
+// functions don't always record their type arguments, so we
+// approximate them with the types of the arguments.
+func typeArguments(call *ir.CallCommon) []types.Type {
+	targs := call.TypeArgs
+	g := call.StaticCallee()
+	if inner := wrappedCall(g); inner != nil {
+		// The wrapper passes its type arguments on to the generic
+		// function.
+		targs = inner.TypeArgs
+		g = inner.StaticCallee()
+	}
+	if g != nil && isGeneric(g) {
+		targs = append([]types.Type(nil), targs...)
+		for _, arg := range call.Args {
+			targs = append(targs, arg.Type())
+		}
+	}
+	return targs
+}
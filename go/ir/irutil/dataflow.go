@@ -0,0 +1,225 @@
+package irutil
+
+import "honnef.co/go/tools/go/ir"
+
+// A Lattice describes the domain of a dataflow analysis. Its
+// elements can be of any type, but must be treated as immutable by
+// the analysis.
+type Lattice interface {
+	// Bottom returns the least element of the lattice. It is the
+	// initial state of all blocks.
+	Bottom() interface{}
+	// Join returns the least upper bound of a and b.
+	Join(a, b interface{}) interface{}
+	// Equal reports whether a and b are the same element.
+	Equal(a, b interface{}) bool
+}
+
+type Direction int
+
+const (
+	// Forward analyses propagate facts from a function's entry
+	// towards its exits, along control flow.
+	Forward Direction = iota
+	// Backward analyses propagate facts from a function's exits
+	// towards its entry, against control flow.
+	Backward
+)
+
+// A DataflowProblem describes a dataflow analysis over the basic
+// blocks of a function.
+type DataflowProblem struct {
+	Direction Direction
+	Lattice   Lattice
+	// Boundary is the state at the boundary of the function: on
+	// entry to the entry block of forward analyses, and on exit from
+	// the blocks without successors of backward analyses.
+	Boundary interface{}
+	// Transfer computes the effect of an instruction. For forward
+	// analyses, it maps the state before the instruction to the
+	// state after it, and for backward analyses the state after the
+	// instruction to the state before it.
+	//
+	// Phi and Sigma nodes are transferred like any other
+	// instruction, with the state that results from joining all
+	// incoming edges. Analyses that need to distinguish edges should
+	// use Edge instead.
+	Transfer func(instr ir.Instruction, state interface{}) interface{}
+	// Edge, if not nil, refines the state flowing along the control
+	// flow edge from block from to block to, for example based on
+	// the outcome of the If instruction that ends from, or on the
+	// Sigma nodes in to whose From field is from. For forward
+	// analyses, the state is the one at the end of from, and for
+	// backward analyses the one at the beginning of to.
+	Edge func(from, to *ir.BasicBlock, state interface{}) interface{}
+}
+
+// A DataflowResult holds the solution of a dataflow problem.
+type DataflowResult struct {
+	problem *DataflowProblem
+	// In and Out hold the states at the beginning and end of each
+	// block, in the order of execution, indexed by the blocks'
+	// indices.
+	In  []interface{}
+	Out []interface{}
+}
+
+// SolveDataflow computes the least fixed point of a dataflow problem
+// over fn's blocks.
+//
+// Blocks are processed in dominator tree preorder for forward
+// analyses, and in reverse of that for backward analyses, which
+// approximates the order in which states propagate and keeps the
+// number of iterations low.
+func SolveDataflow(fn *ir.Function, p *DataflowProblem) *DataflowResult {
+	n := len(fn.Blocks)
+	res := &DataflowResult{
+		problem: p,
+		In:      make([]interface{}, n),
+		Out:     make([]interface{}, n),
+	}
+	if n == 0 {
+		return res
+	}
+	for i := range fn.Blocks {
+		res.In[i] = p.Lattice.Bottom()
+		res.Out[i] = p.Lattice.Bottom()
+	}
+
+	order := fn.DomPreorder()
+	if p.Direction == Backward {
+		for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+			order[i], order[j] = order[j], order[i]
+		}
+	}
+
+	queued := make([]bool, n)
+	for _, b := range order {
+		queued[b.Index] = true
+	}
+	for pending := n; pending > 0; {
+		for _, b := range order {
+			if !queued[b.Index] {
+				continue
+			}
+			queued[b.Index] = false
+			pending--
+
+			var changed bool
+			if p.Direction == Forward {
+				changed = res.forward(fn, b)
+			} else {
+				changed = res.backward(b)
+			}
+			if !changed {
+				continue
+			}
+			next := b.Succs
+			if p.Direction == Backward {
+				next = b.Preds
+			}
+			for _, d := range next {
+				if !queued[d.Index] {
+					queued[d.Index] = true
+					pending++
+				}
+			}
+		}
+	}
+	return res
+}
+
+// forward recomputes the states of b, reporting whether its out state
+// changed.
+func (res *DataflowResult) forward(fn *ir.Function, b *ir.BasicBlock) bool {
+	p := res.problem
+	l := p.Lattice
+	in := l.Bottom()
+	if b == fn.Blocks[0] {
+		in = l.Join(in, p.Boundary)
+	}
+	for _, pred := range b.Preds {
+		s := res.Out[pred.Index]
+		if p.Edge != nil {
+			s = p.Edge(pred, b, s)
+		}
+		in = l.Join(in, s)
+	}
+	res.In[b.Index] = in
+
+	out := in
+	for _, instr := range b.Instrs {
+		out = p.Transfer(instr, out)
+	}
+	if l.Equal(out, res.Out[b.Index]) {
+		return false
+	}
+	res.Out[b.Index] = out
+	return true
+}
+
+// backward recomputes the states of b, reporting whether its in state
+// changed.
+func (res *DataflowResult) backward(b *ir.BasicBlock) bool {
+	p := res.problem
+	l := p.Lattice
+	out := l.Bottom()
+	if len(b.Succs) == 0 {
+		out = l.Join(out, p.Boundary)
+	}
+	for _, succ := range b.Succs {
+		s := res.In[succ.Index]
+		if p.Edge != nil {
+			s = p.Edge(b, succ, s)
+		}
+		out = l.Join(out, s)
+	}
+	res.Out[b.Index] = out
+
+	in := out
+	for i := len(b.Instrs) - 1; i >= 0; i-- {
+		in = p.Transfer(b.Instrs[i], in)
+	}
+	if l.Equal(in, res.In[b.Index]) {
+		return false
+	}
+	res.In[b.Index] = in
+	return true
+}
+
+// Before returns the state immediately before instr executes.
+func (res *DataflowResult) Before(instr ir.Instruction) interface{} {
+	before, _ := res.at(instr)
+	return before
+}
+
+// After returns the state immediately after instr executes.
+func (res *DataflowResult) After(instr ir.Instruction) interface{} {
+	_, after := res.at(instr)
+	return after
+}
+
+func (res *DataflowResult) at(instr ir.Instruction) (before, after interface{}) {
+	b := instr.Block()
+	p := res.problem
+	if p.Direction == Forward {
+		s := res.In[b.Index]
+		for _, other := range b.Instrs {
+			next := p.Transfer(other, s)
+			if other == instr {
+				return s, next
+			}
+			s = next
+		}
+	} else {
+		s := res.Out[b.Index]
+		for i := len(b.Instrs) - 1; i >= 0; i-- {
+			next := p.Transfer(b.Instrs[i], s)
+			if b.Instrs[i] == instr {
+				return next, s
+			}
+			s = next
+		}
+	}
+	panic("couldn't find instruction in its block")
+}
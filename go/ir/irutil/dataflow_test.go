@@ -0,0 +1,144 @@
+package irutil_test
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/ir/irutil"
+)
+
+// nonNil is a must-analysis of the values known to not be nil. Its
+// elements are sets of values, and nil, which means that the block
+// hasn't been reached yet.
+type nonNil struct{}
+
+type valueSet map[ir.Value]bool
+
+func (nonNil) Bottom() interface{} { return valueSet(nil) }
+
+func (nonNil) Join(a, b interface{}) interface{} {
+	x, y := a.(valueSet), b.(valueSet)
+	if x == nil {
+		return y
+	}
+	if y == nil {
+		return x
+	}
+	out := valueSet{}
+	for v := range x {
+		if y[v] {
+			out[v] = true
+		}
+	}
+	return out
+}
+
+func (nonNil) Equal(a, b interface{}) bool {
+	x, y := a.(valueSet), b.(valueSet)
+	if (x == nil) != (y == nil) || len(x) != len(y) {
+		return false
+	}
+	for v := range x {
+		if !y[v] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s valueSet) with(v ir.Value) valueSet {
+	out := valueSet{v: true}
+	for w := range s {
+		out[w] = true
+	}
+	return out
+}
+
+const dataflowSrc = `package pkg
+
+func fn(x *int, c bool) int {
+	if x != nil {
+		if c {
+			println()
+		}
+		return *x
+	}
+	return *x
+}
+`
+
+func TestDataflow(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "pkg.go", dataflowSrc, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, _, err := irutil.BuildPackage(&types.Config{Importer: importer.Default()}, fset, types.NewPackage("pkg", ""), []*ast.File{f}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := pkg.Func("fn")
+
+	res := irutil.SolveDataflow(fn, &irutil.DataflowProblem{
+		Direction: irutil.Forward,
+		Lattice:   nonNil{},
+		Boundary:  valueSet{},
+		Transfer: func(instr ir.Instruction, state interface{}) interface{} {
+			s := state.(valueSet)
+			if sigma, ok := instr.(*ir.Sigma); ok && s[sigma.X] {
+				return s.with(sigma)
+			}
+			return s
+		},
+		Edge: func(from, to *ir.BasicBlock, state interface{}) interface{} {
+			s := state.(valueSet)
+			if s == nil {
+				return s
+			}
+			ifInstr, ok := from.Control().(*ir.If)
+			if !ok {
+				return s
+			}
+			cond, ok := ifInstr.Cond.(*ir.BinOp)
+			if !ok {
+				return s
+			}
+			if k, ok := cond.Y.(*ir.Const); !ok || !k.IsNil() {
+				return s
+			}
+			if (cond.Op == token.NEQ && to == from.Succs[0]) || (cond.Op == token.EQL && to == from.Succs[1]) {
+				return s.with(cond.X)
+			}
+			return s
+		},
+	})
+
+	// Map the lines of the two dereferences to whether x is known
+	// to not be nil.
+	want := map[int]bool{8: true, 10: false}
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			load, ok := instr.(*ir.Load)
+			if !ok {
+				continue
+			}
+			line := fset.Position(load.Pos()).Line
+			exp, ok := want[line]
+			if !ok {
+				t.Fatalf("unexpected load on line %d", line)
+			}
+			delete(want, line)
+			if got := res.Before(load).(valueSet)[load.X]; got != exp {
+				t.Errorf("line %d: got %t, want %t", line, got, exp)
+			}
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("didn't find loads on lines %v", want)
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"honnef.co/go/tools/go/ir"
 
+	"golang.org/x/exp/typeparams"
 	"golang.org/x/tools/go/loader"
 	"golang.org/x/tools/go/packages"
 )
@@ -156,6 +157,7 @@ func BuildPackage(tc *types.Config, fset *token.FileSet, pkg *types.Package, fil
 		Scopes:     make(map[ast.Node]*types.Scope),
 		Selections: make(map[*ast.SelectorExpr]*types.Selection),
 	}
+	typeparams.InitInstances(info)
 	if err := types.NewChecker(tc, fset, pkg, info).Files(files); err != nil {
 		return nil, nil, err
 	}
@@ -1077,7 +1077,6 @@ func splitOnNewInformation(u *BasicBlock, renaming *StackMap) {
 				continue
 			}
 			if r, ok := replacement(*arg); ok {
-				*arg = r
 				replace(instr, *arg, r)
 			}
 		}
@@ -29,6 +29,7 @@ const (
 	NaiveForm                                        // Build naïve IR form: don't replace local loads/stores with registers
 	GlobalDebug                                      // Enable debug info for all packages
 	SplitAfterNewInformation                         // Split live range after we learn something new about a value
+	InstantiateGenerics                              // Build a body for each instantiation of a generic function
 )
 
 const BuilderModeDoc = `Options controlling the IR builder.
@@ -41,6 +42,7 @@ A	print [A]ST nodes responsible for IR instructions
 S	log [S]ource locations as IR builder progresses.
 N	build [N]aive IR form: don't replace local loads/stores with registers.
 I	Split live range after a value is used as slice or array index
+G	build a body for each instantiation of a [G]eneric function.
 `
 
 func (m BuilderMode) String() string {
@@ -69,6 +71,9 @@ func (m BuilderMode) String() string {
 	if m&SplitAfterNewInformation != 0 {
 		buf.WriteByte('I')
 	}
+	if m&InstantiateGenerics != 0 {
+		buf.WriteByte('G')
+	}
 	return buf.String()
 }
 
@@ -93,6 +98,8 @@ func (m *BuilderMode) Set(s string) error {
 			mode |= NaiveForm
 		case 'I':
 			mode |= SplitAfterNewInformation
+		case 'G':
+			mode |= InstantiateGenerics
 		default:
 			return fmt.Errorf("unknown BuilderMode option: %q", c)
 		}
@@ -15,7 +15,6 @@ import (
 	"go/types"
 	"sync"
 
-	"golang.org/x/exp/typeparams"
 	"honnef.co/go/tools/go/types/typeutil"
 )
 
@@ -353,6 +352,9 @@ type Function struct {
 	method    *types.Selection // info about provenance of synthetic methods
 	Signature *types.Signature
 	generics  instanceWrapperMap
+	origin    *Function    // generic function this is an instantiation of
+	typeArgs  []types.Type // type arguments of the instantiation
+	instances []*Function  // instantiations of this generic function, in creation order
 
 	Synthetic Synthetic
 	parent    *Function     // enclosing function if anon; nil if global
@@ -373,38 +375,35 @@ type Function struct {
 type instanceWrapperMap struct {
 	h       typeutil.Hasher
 	entries map[uint32][]struct {
-		key *typeparams.TypeList
+		key []types.Type
 		val *Function
 	}
 	len int
 }
 
-func typeListIdentical(l1, l2 *typeparams.TypeList) bool {
-	if l1.Len() != l2.Len() {
+func typeListIdentical(l1, l2 []types.Type) bool {
+	if len(l1) != len(l2) {
 		return false
 	}
-	for i := 0; i < l1.Len(); i++ {
-		t1 := l1.At(i)
-		t2 := l2.At(i)
-		if !types.Identical(t1, t2) {
+	for i := range l1 {
+		if !types.Identical(l1[i], l2[i]) {
 			return false
 		}
 	}
 	return true
 }
 
-func (m *instanceWrapperMap) At(key *typeparams.TypeList) *Function {
+func (m *instanceWrapperMap) At(key []types.Type) *Function {
 	if m.entries == nil {
 		m.entries = make(map[uint32][]struct {
-			key *typeparams.TypeList
+			key []types.Type
 			val *Function
 		})
 		m.h = typeutil.MakeHasher()
 	}
 
 	var hash uint32
-	for i := 0; i < key.Len(); i++ {
-		t := key.At(i)
+	for _, t := range key {
 		hash += m.h.Hash(t)
 	}
 
@@ -416,18 +415,17 @@ func (m *instanceWrapperMap) At(key *typeparams.TypeList) *Function {
 	return nil
 }
 
-func (m *instanceWrapperMap) Set(key *typeparams.TypeList, val *Function) {
+func (m *instanceWrapperMap) Set(key []types.Type, val *Function) {
 	if m.entries == nil {
 		m.entries = make(map[uint32][]struct {
-			key *typeparams.TypeList
+			key []types.Type
 			val *Function
 		})
 		m.h = typeutil.MakeHasher()
 	}
 
 	var hash uint32
-	for i := 0; i < key.Len(); i++ {
-		t := key.At(i)
+	for _, t := range key {
 		hash += m.h.Hash(t)
 	}
 	for i, e := range m.entries[hash] {
@@ -437,7 +435,7 @@ func (m *instanceWrapperMap) Set(key *typeparams.TypeList, val *Function) {
 		}
 	}
 	m.entries[hash] = append(m.entries[hash], struct {
-		key *typeparams.TypeList
+		key []types.Type
 		val *Function
 	}{key, val})
 	m.len++
@@ -466,6 +464,7 @@ type functionBody struct {
 	targets         *targets                 // linked stack of branch targets
 	lblocks         map[types.Object]*lblock // labelled blocks
 	consts          []Constant
+	subst           *subster // type arguments of instantiations
 	wr              *HTMLWriter
 	fakeExits       BlockSet
 	blocksets       [5]BlockSet
@@ -1586,7 +1585,18 @@ func (n *node) setID(id ID) { n.id = id }
 func (n node) ID() ID       { return n.id }
 
 func (n *node) setSource(source ast.Node) { n.source = source }
-func (n *node) Source() ast.Node          { return n.source }
+
+func (n *node) Source() ast.Node {
+	if _, ok := n.source.(*decodedSource); ok {
+		// Decoded IR has positions, but no syntax.
+		return nil
+	}
+	return n.source
+}
+
+// syntax returns the node's source, including the positions of
+// decoded nodes.
+func (n *node) syntax() ast.Node { return n.source }
 
 func (n *node) Pos() token.Pos {
 	if n.source != nil {
@@ -1760,6 +1770,19 @@ func (v *Function) Object() types.Object { return v.object }
 func (v *Function) String() string       { return v.RelString(nil) }
 func (v *Function) Package() *Package    { return v.Pkg }
 func (v *Function) Parent() *Function    { return v.parent }
+
+// Origin returns the generic function that v is an instantiation of,
+// or nil if v isn't an instantiation. Instantiations are only built
+// in InstantiateGenerics mode. They share their origin's syntax and
+// positions.
+func (v *Function) Origin() *Function { return v.origin }
+
+// TypeArgs returns the type arguments of an instantiation.
+func (v *Function) TypeArgs() []types.Type { return v.typeArgs }
+
+// Instances returns the instantiations of the generic function v, in
+// the order they were created.
+func (v *Function) Instances() []*Function { return v.instances }
 func (v *Function) Referrers() *[]Instruction {
 	if v.parent != nil {
 		return &v.referrers
@@ -17,6 +17,7 @@ package ir_test
 // Run with "go test -cpu=8 to" set GOMAXPROCS.
 
 import (
+	"bytes"
 	"go/ast"
 	"go/token"
 	"runtime"
@@ -114,6 +115,8 @@ func TestStdlib(t *testing.T) {
 			}
 		}
 
+		checkEncodingRoundTrip(t, irpkg)
+
 		// Dump some statistics.
 		var numInstrs int
 		for fn := range allFuncs {
@@ -147,3 +150,43 @@ func TestStdlib(t *testing.T) {
 	t.Log("#MB AST+types:        ", allocLoad/1e6)
 	t.Log("#MB IR:              ", allocBuild/1e6)
 }
+
+// checkEncodingRoundTrip encodes the IR of pkg, decodes it into a new
+// program with sanity checking enabled, and compares the
+// disassemblies of all functions.
+func checkEncodingRoundTrip(t *testing.T, pkg *ir.Package) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := ir.EncodePackage(&buf, pkg); err != nil {
+		t.Errorf("couldn't encode %s: %s", pkg.Pkg.Path(), err)
+		return
+	}
+	prog := ir.NewProgram(pkg.Prog.Fset, ir.SanityCheckFunctions)
+	decoded, err := prog.DecodePackage(pkg.Pkg, &buf)
+	if err != nil {
+		t.Errorf("couldn't decode %s: %s", pkg.Pkg.Path(), err)
+		return
+	}
+
+	disassemble := func(fn *ir.Function) string {
+		var buf bytes.Buffer
+		ir.WriteFunction(&buf, fn)
+		return buf.String()
+	}
+	var compare func(want, got []*ir.Function)
+	compare = func(want, got []*ir.Function) {
+		if len(want) != len(got) {
+			t.Errorf("%s: got %d functions, want %d", pkg.Pkg.Path(), len(got), len(want))
+			return
+		}
+		for i := range want {
+			if w, g := disassemble(want[i]), disassemble(got[i]); w != g {
+				t.Errorf("%s: decoded function differs\nwant:\n%s\ngot:\n%s", want[i], w, g)
+				continue
+			}
+			compare(want[i].AnonFuncs, got[i].AnonFuncs)
+			compare(want[i].Instances(), got[i].Instances())
+		}
+	}
+	compare(pkg.Functions, decoded.Functions)
+}
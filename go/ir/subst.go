@@ -0,0 +1,318 @@
+package ir
+
+// This file implements the substitution of type arguments for type
+// parameters, used when building instantiations of generic
+// functions.
+
+import (
+	"fmt"
+	"go/types"
+
+	"golang.org/x/exp/typeparams"
+)
+
+// A substError is the panic value used by a subster when it cannot
+// substitute a type. buildInstance recovers it and falls back to a
+// wrapper.
+type substError struct {
+	err error
+}
+
+func (err substError) Error() string {
+	return "couldn't substitute type arguments: " + err.err.Error()
+}
+
+// A subster replaces type parameters with type arguments.
+type subster struct {
+	m     map[*typeparams.TypeParam]types.Type
+	ctxt  *typeparams.Context
+	cache map[types.Type]types.Type
+}
+
+func makeSubster(tparams *typeparams.TypeParamList, targs []types.Type) *subster {
+	assert(tparams.Len() == len(targs))
+	s := &subster{
+		m:     map[*typeparams.TypeParam]types.Type{},
+		ctxt:  typeparams.NewContext(),
+		cache: map[types.Type]types.Type{},
+	}
+	for i := 0; i < tparams.Len(); i++ {
+		s.m[tparams.At(i)] = targs[i]
+	}
+	return s
+}
+
+// typ returns t with all type parameters replaced by their type
+// arguments. The result is identical to t if t doesn't refer to any
+// of the type parameters.
+func (s *subster) typ(t types.Type) types.Type {
+	if t == nil {
+		return nil
+	}
+	if r, ok := s.cache[t]; ok {
+		return r
+	}
+	r := s.typ0(t)
+	s.cache[t] = r
+	return r
+}
+
+func (s *subster) typ0(t types.Type) types.Type {
+	switch t := t.(type) {
+	case *typeparams.TypeParam:
+		if r, ok := s.m[t]; ok {
+			return r
+		}
+		return t
+
+	case *types.Basic:
+		return t
+
+	case *types.Pointer:
+		if elem := s.typ(t.Elem()); elem != t.Elem() {
+			return types.NewPointer(elem)
+		}
+		return t
+
+	case *types.Slice:
+		if elem := s.typ(t.Elem()); elem != t.Elem() {
+			return types.NewSlice(elem)
+		}
+		return t
+
+	case *types.Array:
+		if elem := s.typ(t.Elem()); elem != t.Elem() {
+			return types.NewArray(elem, t.Len())
+		}
+		return t
+
+	case *types.Map:
+		key, elem := s.typ(t.Key()), s.typ(t.Elem())
+		if key != t.Key() || elem != t.Elem() {
+			return types.NewMap(key, elem)
+		}
+		return t
+
+	case *types.Chan:
+		if elem := s.typ(t.Elem()); elem != t.Elem() {
+			return types.NewChan(t.Dir(), elem)
+		}
+		return t
+
+	case *types.Tuple:
+		if vars, ok := s.vars(t); ok {
+			return types.NewTuple(vars...)
+		}
+		return t
+
+	case *types.Struct:
+		var fields []*types.Var
+		var tags []string
+		changed := false
+		for i := 0; i < t.NumFields(); i++ {
+			f := t.Field(i)
+			typ := s.typ(f.Type())
+			if typ != f.Type() {
+				changed = true
+				f = types.NewField(f.Pos(), f.Pkg(), f.Name(), typ, f.Embedded())
+			}
+			fields = append(fields, f)
+			tags = append(tags, t.Tag(i))
+		}
+		if changed {
+			return types.NewStruct(fields, tags)
+		}
+		return t
+
+	case *types.Signature:
+		return s.signature(t)
+
+	case *types.Interface:
+		var methods []*types.Func
+		var embeddeds []types.Type
+		changed := false
+		for i := 0; i < t.NumExplicitMethods(); i++ {
+			m := t.ExplicitMethod(i)
+			sig := m.Type().(*types.Signature)
+			// The receiver of interface methods is the interface
+			// itself, which NewInterfaceType sets for us.
+			params, ok1 := s.vars(sig.Params())
+			results, ok2 := s.vars(sig.Results())
+			if ok1 || ok2 {
+				changed = true
+				sig = types.NewSignature(nil, types.NewTuple(params...), types.NewTuple(results...), sig.Variadic())
+				m = types.NewFunc(m.Pos(), m.Pkg(), m.Name(), sig)
+			}
+			methods = append(methods, m)
+		}
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			e := t.EmbeddedType(i)
+			if r := s.typ(e); r != e {
+				changed = true
+				e = r
+			}
+			embeddeds = append(embeddeds, e)
+		}
+		if changed {
+			return types.NewInterfaceType(methods, embeddeds).Complete()
+		}
+		return t
+
+	case *typeparams.Union:
+		var terms []*typeparams.Term
+		changed := false
+		for i := 0; i < t.Len(); i++ {
+			term := t.Term(i)
+			if typ := s.typ(term.Type()); typ != term.Type() {
+				changed = true
+				term = typeparams.NewTerm(term.Tilde(), typ)
+			}
+			terms = append(terms, term)
+		}
+		if changed {
+			return typeparams.NewUnion(terms)
+		}
+		return t
+
+	case *types.Named:
+		targs := typeparams.NamedTypeArgs(t)
+		if targs.Len() == 0 {
+			if hasTypeParams(t.Underlying()) {
+				// A type declared inside of a generic function. We
+				// can't create a copy of it for each instantiation.
+				panic(substError{fmt.Errorf("can't substitute type parameters in local type %s", t)})
+			}
+			return t
+		}
+		args := make([]types.Type, targs.Len())
+		changed := false
+		for i := range args {
+			args[i] = s.typ(targs.At(i))
+			if args[i] != targs.At(i) {
+				changed = true
+			}
+		}
+		if !changed {
+			return t
+		}
+		inst, err := typeparams.Instantiate(s.ctxt, typeparams.NamedTypeOrigin(t), args, false)
+		if err != nil {
+			panic(substError{err})
+		}
+		return inst
+
+	default:
+		panic(substError{fmt.Errorf("unexpected type %T", t)})
+	}
+}
+
+// vars substitutes the types of the variables in t. It returns false
+// if none of the types changed.
+func (s *subster) vars(t *types.Tuple) ([]*types.Var, bool) {
+	var vars []*types.Var
+	changed := false
+	for i := 0; i < t.Len(); i++ {
+		v := t.At(i)
+		if typ := s.typ(v.Type()); typ != v.Type() {
+			changed = true
+			v = types.NewParam(v.Pos(), v.Pkg(), v.Name(), typ)
+		}
+		vars = append(vars, v)
+	}
+	return vars, changed
+}
+
+func (s *subster) signature(t *types.Signature) types.Type {
+	params, ok1 := s.vars(t.Params())
+	results, ok2 := s.vars(t.Results())
+	recv := t.Recv()
+	ok3 := false
+	if recv != nil {
+		if typ := s.typ(recv.Type()); typ != recv.Type() {
+			ok3 = true
+			recv = types.NewParam(recv.Pos(), recv.Pkg(), recv.Name(), typ)
+		}
+	}
+	if !ok1 && !ok2 && !ok3 {
+		return t
+	}
+	return typeparams.NewSignatureType(recv, nil, nil, types.NewTuple(params...), types.NewTuple(results...), t.Variadic())
+}
+
+// hasTypeParams reports whether t refers to any type parameters. It
+// also returns true for types it doesn't know how to inspect.
+func hasTypeParams(t types.Type) bool {
+	return hasTypeParams0(t, map[types.Type]bool{})
+}
+
+func hasTypeParams0(t types.Type, seen map[types.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	tuple := func(t *types.Tuple) bool {
+		for i := 0; i < t.Len(); i++ {
+			if hasTypeParams0(t.At(i).Type(), seen) {
+				return true
+			}
+		}
+		return false
+	}
+	switch t := t.(type) {
+	case *typeparams.TypeParam:
+		return true
+	case *types.Basic:
+		return false
+	case *types.Pointer:
+		return hasTypeParams0(t.Elem(), seen)
+	case *types.Slice:
+		return hasTypeParams0(t.Elem(), seen)
+	case *types.Array:
+		return hasTypeParams0(t.Elem(), seen)
+	case *types.Map:
+		return hasTypeParams0(t.Key(), seen) || hasTypeParams0(t.Elem(), seen)
+	case *types.Chan:
+		return hasTypeParams0(t.Elem(), seen)
+	case *types.Tuple:
+		return tuple(t)
+	case *types.Signature:
+		return tuple(t.Params()) || tuple(t.Results())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if hasTypeParams0(t.Field(i).Type(), seen) {
+				return true
+			}
+		}
+		return false
+	case *types.Interface:
+		for i := 0; i < t.NumExplicitMethods(); i++ {
+			if hasTypeParams0(t.ExplicitMethod(i).Type(), seen) {
+				return true
+			}
+		}
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			if hasTypeParams0(t.EmbeddedType(i), seen) {
+				return true
+			}
+		}
+		return false
+	case *typeparams.Union:
+		for i := 0; i < t.Len(); i++ {
+			if hasTypeParams0(t.Term(i).Type(), seen) {
+				return true
+			}
+		}
+		return false
+	case *types.Named:
+		targs := typeparams.NamedTypeArgs(t)
+		for i := 0; i < targs.Len(); i++ {
+			if hasTypeParams0(targs.At(i), seen) {
+				return true
+			}
+		}
+		return false
+	default:
+		// Be conservative about types we don't know.
+		return true
+	}
+}
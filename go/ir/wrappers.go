@@ -22,6 +22,7 @@ package ir
 import (
 	"fmt"
 	"go/types"
+	"strings"
 
 	"golang.org/x/exp/typeparams"
 )
@@ -293,11 +294,15 @@ type selectionKey struct {
 // makeInstance creates a wrapper function with signature sig that calls the generic function fn.
 // If targs is not nil, fn is a function and targs describes the concrete type arguments.
 // If targs is nil, fn is a method and the type arguments are derived from the receiver.
-func makeInstance(prog *Program, fn *Function, sig *types.Signature, targs *typeparams.TypeList) *Function {
+//
+// In InstantiateGenerics mode, if the type arguments are concrete and
+// fn's syntax is available, makeInstance instead builds an
+// instantiation of fn. See buildInstance.
+func makeInstance(prog *Program, fn *Function, sig *types.Signature, targs []types.Type) *Function {
 	if sig.Recv() != nil {
 		assert(targs == nil)
 		// Methods don't have their own type parameters, but the receiver does
-		targs = typeparams.NamedTypeArgs(deref(sig.Recv().Type()).(*types.Named))
+		targs = typeList(typeparams.NamedTypeArgs(deref(sig.Recv().Type()).(*types.Named)))
 	} else {
 		assert(targs != nil)
 	}
@@ -306,14 +311,28 @@ func makeInstance(prog *Program, fn *Function, sig *types.Signature, targs *type
 	if wrapper != nil {
 		return wrapper
 	}
+	if prog.mode&InstantiateGenerics != 0 && canInstantiate(fn, targs) {
+		return buildInstance(prog, fn, sig, targs)
+	}
+
+	w := new(Function)
+	buildWrapper(prog, w, fn, sig, targs, fn.generics.Len())
+	fn.generics.Set(targs, w)
+	return w
+}
 
+// buildWrapper turns w into a wrapper with signature sig that calls
+// the generic function fn with type arguments targs. n is the index
+// of the wrapper among fn's instances and wrappers, used to give it
+// a unique name.
+func buildWrapper(prog *Program, w, fn *Function, sig *types.Signature, targs []types.Type, n int) {
 	var name string
 	if sig.Recv() != nil {
 		name = fn.name
 	} else {
-		name = fmt.Sprintf("%s$generic#%d", fn.name, fn.generics.Len())
+		name = fmt.Sprintf("%s$generic#%d", fn.name, n)
 	}
-	w := &Function{
+	*w = Function{
 		name:         name,
 		object:       fn.object,
 		Signature:    sig,
@@ -357,10 +376,7 @@ func makeInstance(prog *Program, fn *Function, sig *types.Signature, targs *type
 			c.Call.Args = append(c.Call.Args, changeType(arg, fn.Signature.Params().At(i).Type()))
 		}
 	}
-	for i := 0; i < targs.Len(); i++ {
-		arg := targs.At(i)
-		c.Call.TypeArgs = append(c.Call.TypeArgs, arg)
-	}
+	c.Call.TypeArgs = append(c.Call.TypeArgs, targs...)
 	results := w.emit(&c, nil)
 	var ret Return
 	switch tresults.Len() {
@@ -381,7 +397,97 @@ func makeInstance(prog *Program, fn *Function, sig *types.Signature, targs *type
 	w.currentBlock = nil
 
 	w.finishBody()
+}
 
+// maxInstances is the maximum number of instantiations that we build
+// per generic function. Further instantiations use wrappers.
+const maxInstances = 100
+
+// canInstantiate reports whether we can build the instantiation of
+// fn with type arguments targs.
+func canInstantiate(fn *Function, targs []types.Type) bool {
+	if fn.source == nil || fn.Pkg == nil || fn.Pkg.info == nil {
+		// We need fn's syntax and type information, which we only
+		// have while fn's package is being built.
+		return false
+	}
+	if len(fn.instances) >= maxInstances {
+		return false
+	}
+	for _, targ := range targs {
+		if hasTypeParams(targ) {
+			return false
+		}
+	}
+	return true
+}
+
+// buildInstance builds the instantiation of the generic function fn
+// with type arguments targs and signature sig. The instantiation has
+// the same syntax as fn, but all of its types have the type
+// parameters replaced by the type arguments.
+//
+// If we fail to substitute the type arguments, the instantiation
+// turns into a wrapper, as if we weren't in InstantiateGenerics mode.
+func buildInstance(prog *Program, fn *Function, sig *types.Signature, targs []types.Type) (w *Function) {
+	var tparams *typeparams.TypeParamList
+	name := fn.name
+	if sig.Recv() != nil {
+		tparams = typeparams.RecvTypeParams(fn.Signature)
+	} else {
+		tparams = typeparams.ForSignature(fn.Signature)
+		args := make([]string, len(targs))
+		for i, targ := range targs {
+			args[i] = relType(targ, fn.pkg())
+		}
+		name = fmt.Sprintf("%s[%s]", fn.name, strings.Join(args, ", "))
+	}
+	w = &Function{
+		name:         name,
+		object:       fn.object,
+		Signature:    sig,
+		Pkg:          fn.Pkg,
+		Prog:         prog,
+		origin:       fn,
+		typeArgs:     targs,
+		functionBody: &functionBody{subst: makeSubster(tparams, targs)},
+	}
+	w.source = fn.source
+	w.initHTML(fn.Pkg.printFunc)
+	// Register the instantiation before building it, so that
+	// recursive calls refer to it.
+	n := fn.generics.Len()
 	fn.generics.Set(targs, w)
+	fn.instances = append(fn.instances, w)
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if _, ok := r.(substError); !ok {
+			panic(r)
+		}
+		// Other functions may already refer to w, so we have to
+		// reuse it for the wrapper.
+		for i, inst := range fn.instances {
+			if inst == w {
+				fn.instances = append(fn.instances[:i], fn.instances[i+1:]...)
+				break
+			}
+		}
+		w.wr.Close()
+		buildWrapper(prog, w, fn, sig, targs, n)
+	}()
+	b := builder{printFunc: fn.Pkg.printFunc}
+	b.buildFunction(w)
 	return w
 }
+
+func typeList(l *typeparams.TypeList) []types.Type {
+	out := make([]types.Type, l.Len())
+	for i := range out {
+		out[i] = l.At(i)
+	}
+	return out
+}
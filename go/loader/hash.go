@@ -1,18 +1,20 @@
 package loader
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
 
 	"honnef.co/go/tools/go/buildid"
 	"honnef.co/go/tools/lintcmd/cache"
 )
 
 // computeHash computes a package's hash. The hash is based on all Go
-// files that make up the package, as well as the hashes of imported
-// packages.
+// files that make up the package, including the contents of overlaid
+// files, as well as the hashes of imported packages.
 func computeHash(c *cache.Cache, pkg *PackageSpec) (cache.ActionID, error) {
 	key := c.NewHash("package " + pkg.PkgPath)
 	fmt.Fprintf(key, "goos %s goarch %s\n", runtime.GOOS, runtime.GOARCH)
@@ -34,6 +36,11 @@ func computeHash(c *cache.Cache, pkg *PackageSpec) (cache.ActionID, error) {
 	}
 	if !success {
 		for _, f := range pkg.CompiledGoFiles {
+			if _, ok := pkg.Overlay[f]; ok {
+				// Overlaid files may not exist on disk; they're
+				// hashed below.
+				continue
+			}
 			h, err := cache.FileHash(f)
 			if err != nil {
 				return cache.ActionID{}, err
@@ -41,6 +48,17 @@ func computeHash(c *cache.Cache, pkg *PackageSpec) (cache.ActionID, error) {
 			fmt.Fprintf(key, "file %s %x\n", f, h)
 		}
 	}
+	// The build ID should already reflect the contents of overlaid
+	// files, but we don't want to rely on that, nor on the export
+	// data existing at all.
+	overlaid := make([]string, 0, len(pkg.Overlay))
+	for f := range pkg.Overlay {
+		overlaid = append(overlaid, f)
+	}
+	sort.Strings(overlaid)
+	for _, f := range overlaid {
+		fmt.Fprintf(key, "overlay %s %x\n", f, sha256.Sum256(pkg.Overlay[f]))
+	}
 
 	imps := make([]*PackageSpec, 0, len(pkg.Imports))
 	for _, v := range pkg.Imports {
@@ -69,16 +87,24 @@ func computeHash(c *cache.Cache, pkg *PackageSpec) (cache.ActionID, error) {
 	return key.Sum(), nil
 }
 
-var buildidCache = map[string]string{}
+var (
+	buildidCacheMu sync.Mutex
+	buildidCache   = map[string]string{}
+)
 
 func getBuildid(f string) (string, error) {
-	if h, ok := buildidCache[f]; ok {
+	buildidCacheMu.Lock()
+	h, ok := buildidCache[f]
+	buildidCacheMu.Unlock()
+	if ok {
 		return h, nil
 	}
 	h, err := buildid.ReadFile(f)
 	if err != nil {
 		return "", err
 	}
+	buildidCacheMu.Lock()
 	buildidCache[f] = h
+	buildidCacheMu.Unlock()
 	return h, nil
 }
@@ -39,6 +39,10 @@ type PackageSpec struct {
 	TypesSizes      types.Sizes
 	Hash            cache.ActionID
 	Module          *packages.Module
+	// Overlay holds the contents of the package's files that differ
+	// from the files on disk, keyed by file name. See
+	// packages.Config.Overlay.
+	Overlay map[string][]byte
 
 	Config config.Config
 }
@@ -60,12 +64,34 @@ type Package struct {
 	TypesInfo *types.Info
 }
 
+// GraphOptions controls aspects of Graph that go beyond the
+// packages.Config.
+type GraphOptions struct {
+	// If set to true, the configuration of each package only
+	// consists of the configuration files in its module. See
+	// config.LoadModule.
+	ModuleConfigs bool
+}
+
 // Graph resolves patterns and returns packages with all the
 // information required to later load type information, and optionally
 // syntax trees.
 //
 // The provided config can set any setting with the exception of Mode.
+// If it sets Overlay, the overlaid files are used in place of the
+// files on disk, both when resolving patterns and when loading
+// packages.
 func Graph(c *cache.Cache, cfg *packages.Config, patterns ...string) ([]*PackageSpec, error) {
+	return GraphWithOptions(c, cfg, nil, patterns...)
+}
+
+// GraphWithOptions is like Graph, but additionally accepts options.
+// A nil opts is equivalent to the zero value.
+func GraphWithOptions(c *cache.Cache, cfg *packages.Config, opts *GraphOptions, patterns ...string) ([]*PackageSpec, error) {
+	var gopts GraphOptions
+	if opts != nil {
+		gopts = *opts
+	}
 	var dcfg packages.Config
 	if cfg != nil {
 		dcfg = *cfg
@@ -101,8 +127,20 @@ func Graph(c *cache.Cache, cfg *packages.Config, patterns ...string) ([]*Package
 		for path, imp := range pkg.Imports {
 			spec.Imports[path] = m[imp]
 		}
+		for _, f := range pkg.CompiledGoFiles {
+			if b, ok := dcfg.Overlay[f]; ok {
+				if spec.Overlay == nil {
+					spec.Overlay = map[string][]byte{}
+				}
+				spec.Overlay[f] = b
+			}
+		}
 		if cdir := config.Dir(pkg.GoFiles); cdir != "" {
-			cfg, err := config.Load(cdir)
+			load := config.Load
+			if gopts.ModuleConfigs {
+				load = config.LoadModule
+			}
+			cfg, err := load(cdir)
 			if err != nil {
 				spec.Errors = append(spec.Errors, convertError(err)...)
 			}
@@ -244,20 +282,12 @@ func (prog *program) loadFromSource(spec *PackageSpec) (*Package, error) {
 	// be faster, and tends to be slower due to extra scheduling,
 	// bookkeeping and potentially false sharing of cache lines.
 	for i, file := range spec.CompiledGoFiles {
-		f, err := os.Open(file)
-		if err != nil {
-			return nil, err
-		}
-		fi, err := f.Stat()
-		if err != nil {
-			return nil, err
-		}
-		if fi.Size() >= MaxFileSize {
-			return nil, errMaxFileSize
-		}
-		af, err := parser.ParseFile(prog.fset, file, f, parser.ParseComments)
-		f.Close()
+		af, err := prog.parseFile(spec, file)
 		if err != nil {
+			if _, ok := err.(scanner.ErrorList); !ok {
+				// Failure to read the file, not a syntax error
+				return nil, err
+			}
 			pkg.Errors = append(pkg.Errors, convertError(err)...)
 			return pkg, nil
 		}
@@ -293,6 +323,31 @@ func (prog *program) loadFromSource(spec *PackageSpec) (*Package, error) {
 	return pkg, nil
 }
 
+// parseFile parses one of spec's files, using the contents of the
+// overlay if there is one.
+func (prog *program) parseFile(spec *PackageSpec, file string) (*ast.File, error) {
+	if b, ok := spec.Overlay[file]; ok {
+		if len(b) >= MaxFileSize {
+			return nil, errMaxFileSize
+		}
+		return parser.ParseFile(prog.fset, file, b, parser.ParseComments)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() >= MaxFileSize {
+		return nil, errMaxFileSize
+	}
+	return parser.ParseFile(prog.fset, file, f, parser.ParseComments)
+}
+
 func convertError(err error) []packages.Error {
 	var errs []packages.Error
 	// taken from go/packages
@@ -1,10 +1,12 @@
+// gosmith generates random, but legal, Go programs.
 package main
 
 import (
 	"flag"
 	"fmt"
-	"math/rand"
 	"os"
+
+	"honnef.co/go/tools/internal/gosmith"
 )
 
 var (
@@ -20,9 +22,11 @@ func main() {
 		fmt.Fprintf(os.Stderr, "-dir flag is missing\n")
 		os.Exit(1)
 	}
-	rand.Seed(*seed)
-	smith := &Smith{
-		rng: rand.New(rand.NewSource(*seed)),
+	smith := gosmith.New(*seed)
+	smith.SinglePackage = *singlepkg
+	smith.SingleFile = *singlefile
+	if err := smith.WriteProgram(*workdir); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write program: %v\n", err)
+		os.Exit(1)
 	}
-	smith.writeProgram(*workdir)
 }
@@ -25,14 +25,16 @@ var (
 	testFlag   = flag.Bool("test", false, "include implicit test packages and executables")
 	cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 	dot        bool
-	html       string
+	htmlFunc   string
+	httpAddr   string
 )
 
 func init() {
 	flag.Var(&mode, "build", ir.BuilderModeDoc)
 	flag.Var((*buildutil.TagsFlag)(&build.Default.BuildTags), "tags", buildutil.TagsFlagDoc)
 	flag.BoolVar(&dot, "dot", false, "Print Graphviz dot of CFG")
-	flag.StringVar(&html, "html", "", "Print HTML for 'function'")
+	flag.StringVar(&htmlFunc, "html", "", "Print HTML for 'function'")
+	flag.StringVar(&httpAddr, "http", "", "Serve an interactive IR explorer on `address`, e.g. :8080")
 }
 
 const usage = `IR builder.
@@ -42,6 +44,7 @@ Use -help flag to display options.
 Examples:
 % irdump -build=F hello.go              # dump IR form of a single package
 % irdump -build=F -test fmt             # dump IR form of a package and its tests
+% irdump -http=:8080 fmt                # explore IR form of a package in the browser
 `
 
 func main() {
@@ -86,8 +89,12 @@ func doMain() error {
 		return fmt.Errorf("packages contain errors")
 	}
 
+	if httpAddr != "" {
+		return serve(httpAddr, initial, mode)
+	}
+
 	// Create IR-form program representation.
-	_, pkgs := irutil.Packages(initial, mode, &irutil.Options{PrintFunc: html})
+	_, pkgs := irutil.Packages(initial, mode, &irutil.Options{PrintFunc: htmlFunc})
 
 	for i, p := range pkgs {
 		if p == nil {
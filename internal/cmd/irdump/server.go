@@ -0,0 +1,307 @@
+package main
+
+// This file implements an HTTP server for interactively exploring the
+// IR of packages.
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/ir/irutil"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// A phase is a variant of the IR that the server can display.
+type phase struct {
+	name string
+	doc  string
+	mode ir.BuilderMode
+}
+
+var phases = []phase{
+	{"naive", "naive form, without lifting", ir.NaiveForm},
+	{"lifted", "lifted form", 0},
+	{"split", "lifted form, with live ranges split after new information", ir.SplitAfterNewInformation},
+}
+
+type server struct {
+	initial []*packages.Package
+	mode    ir.BuilderMode
+	dot     string // path of the dot binary, if available
+
+	mu    sync.Mutex
+	progs map[string][]*ir.Package // built packages, keyed by phase
+}
+
+func serve(addr string, initial []*packages.Package, mode ir.BuilderMode) error {
+	s := &server{
+		initial: initial,
+		// The server builds each phase itself and never prints IR.
+		mode:  mode &^ (ir.PrintPackages | ir.PrintFunctions | ir.NaiveForm | ir.SplitAfterNewInformation),
+		progs: map[string][]*ir.Package{},
+	}
+	s.dot, _ = exec.LookPath("dot")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/pkg", s.handlePackage)
+	mux.HandleFunc("/func", s.handleFunction)
+	log.Printf("serving IR on http://%s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// packages returns the IR packages of the initial packages, built in
+// the given phase.
+func (s *server) packages(ph phase) []*ir.Package {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pkgs, ok := s.progs[ph.name]; ok {
+		return pkgs
+	}
+	_, pkgs := irutil.Packages(s.initial, s.mode|ph.mode, nil)
+	for _, p := range pkgs {
+		if p != nil {
+			p.Build()
+		}
+	}
+	s.progs[ph.name] = pkgs
+	return pkgs
+}
+
+func (s *server) pkg(ph phase, path string) *ir.Package {
+	for _, p := range s.packages(ph) {
+		if p != nil && p.Pkg.Path() == path {
+			return p
+		}
+	}
+	return nil
+}
+
+// functions returns all functions of pkg, including anonymous
+// functions and instantiations, keyed by their names.
+func functions(pkg *ir.Package) map[string]*ir.Function {
+	out := map[string]*ir.Function{}
+	var add func(fn *ir.Function)
+	add = func(fn *ir.Function) {
+		out[fn.String()] = fn
+		for _, anon := range fn.AnonFuncs {
+			add(anon)
+		}
+		for _, inst := range fn.Instances() {
+			add(inst)
+		}
+	}
+	for _, fn := range pkg.Functions {
+		add(fn)
+	}
+	return out
+}
+
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	writeHeader(w, "Packages")
+	fmt.Fprint(w, "<ul>")
+	for _, p := range s.initial {
+		fmt.Fprintf(w, `<li><a href="/pkg?path=%s">%s</a></li>`, url.QueryEscape(p.PkgPath), html.EscapeString(p.PkgPath))
+	}
+	fmt.Fprint(w, "</ul></body></html>")
+}
+
+func (s *server) handlePackage(w http.ResponseWriter, r *http.Request) {
+	path := r.FormValue("path")
+	pkg := s.pkg(phases[1], path)
+	if pkg == nil {
+		http.Error(w, "no such package", http.StatusNotFound)
+		return
+	}
+	fns := functions(pkg)
+	names := make([]string, 0, len(fns))
+	for name := range fns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writeHeader(w, path)
+	fmt.Fprint(w, `<p><a href="/">all packages</a></p><ul>`)
+	for _, name := range names {
+		fn := fns[name]
+		var note string
+		if fn.Synthetic != 0 {
+			note = " <i>(" + html.EscapeString(fn.Synthetic.String()) + ")</i>"
+		} else if fn.Blocks == nil {
+			note = " <i>(external)</i>"
+		}
+		fmt.Fprintf(w, `<li><a href="/func?pkg=%s&fn=%s">%s</a>%s</li>`,
+			url.QueryEscape(path), url.QueryEscape(name), html.EscapeString(name), note)
+	}
+	fmt.Fprint(w, "</ul></body></html>")
+}
+
+func (s *server) handleFunction(w http.ResponseWriter, r *http.Request) {
+	path := r.FormValue("pkg")
+	name := r.FormValue("fn")
+
+	// Determine the selected phases. By default, we show all of them.
+	selected := map[string]bool{}
+	for _, ph := range r.Form["phase"] {
+		selected[ph] = true
+	}
+	if len(selected) == 0 {
+		for _, ph := range phases {
+			selected[ph.name] = true
+		}
+	}
+
+	type built struct {
+		phase phase
+		fn    *ir.Function
+	}
+	var fns []built
+	for _, ph := range phases {
+		if !selected[ph.name] {
+			continue
+		}
+		pkg := s.pkg(ph, path)
+		if pkg == nil {
+			http.Error(w, "no such package", http.StatusNotFound)
+			return
+		}
+		fn := functions(pkg)[name]
+		if fn == nil {
+			http.Error(w, "no such function", http.StatusNotFound)
+			return
+		}
+		fns = append(fns, built{ph, fn})
+	}
+	if len(fns) == 0 {
+		http.Error(w, "no phases selected", http.StatusBadRequest)
+		return
+	}
+
+	hw := ir.NewHTMLWriterTo(w, name)
+	defer hw.Close()
+
+	// Navigation and phase selection
+	var nav bytes.Buffer
+	fmt.Fprintf(&nav, `<p><a href="/pkg?path=%s">%s</a></p>`, url.QueryEscape(path), html.EscapeString(path))
+	fmt.Fprint(&nav, `<form method="get" action="/func">`)
+	fmt.Fprintf(&nav, `<input type="hidden" name="pkg" value="%s">`, html.EscapeString(path))
+	fmt.Fprintf(&nav, `<input type="hidden" name="fn" value="%s">`, html.EscapeString(name))
+	for _, ph := range phases {
+		checked := ""
+		if selected[ph.name] {
+			checked = " checked"
+		}
+		fmt.Fprintf(&nav, `<label title="%s"><input type="checkbox" name="phase" value="%s"%s> %s</label><br>`,
+			html.EscapeString(ph.doc), ph.name, checked, ph.name)
+	}
+	fmt.Fprint(&nav, `<input type="submit" value="show"></form>`)
+	hw.WriteColumn("options", "options", "", nav.String())
+
+	hw.WriteColumn("source", "source", "", sourceHTML(fns[0].fn))
+	for _, b := range fns {
+		hw.WriteFunc(b.phase.name, b.phase.name, b.fn)
+	}
+
+	// The dominator trees and loops only depend on the control
+	// flow graph, which is the same in all phases.
+	fn := fns[len(fns)-1].fn
+	if fn.Blocks == nil {
+		return
+	}
+	var dom, pdom bytes.Buffer
+	ir.PrintDomTreeDot(&dom, fn)
+	ir.PrintPostDomTreeDot(&pdom, fn)
+	hw.WriteColumn("dominator tree", "dominator tree", "", s.dotHTML(dom.String()))
+	hw.WriteColumn("post-dominator tree", "post-dominator tree", "", s.dotHTML(pdom.String()))
+	hw.WriteColumn("loops", "loops", "", loopsHTML(fn))
+}
+
+// sourceHTML returns the source code of fn, with line numbers.
+func sourceHTML(fn *ir.Function) string {
+	src := fn.Source()
+	if src == nil {
+		return "<p>no source</p>"
+	}
+	fset := fn.Prog.Fset
+	start := fset.Position(src.Pos())
+	end := fset.Position(src.End())
+	data, err := os.ReadFile(start.Filename)
+	if err != nil || end.Offset > len(data) {
+		return "<p>couldn't read source</p>"
+	}
+	// Start at the beginning of the first line, to keep indentation
+	// intact.
+	off := start.Offset - (start.Column - 1)
+	lines := strings.Split(string(data[off:end.Offset]), "\n")
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<p>%s</p><pre>", html.EscapeString(start.String()))
+	for i, l := range lines {
+		fmt.Fprintf(&buf, "%5d  %s\n", start.Line+i, html.EscapeString(l))
+	}
+	fmt.Fprint(&buf, "</pre>")
+	return buf.String()
+}
+
+// dotHTML renders a graph in dot format as SVG, or as text if dot is
+// not available.
+func (s *server) dotHTML(graph string) string {
+	if s.dot != "" {
+		cmd := exec.Command(s.dot, "-Tsvg")
+		cmd.Stdin = strings.NewReader(graph)
+		out, err := cmd.Output()
+		if err == nil {
+			// Skip the XML preamble, which isn't valid inside of HTML.
+			if i := bytes.Index(out, []byte("<svg")); i != -1 {
+				return string(out[i:])
+			}
+		}
+	}
+	return "<pre>" + html.EscapeString(graph) + "</pre>"
+}
+
+// loopsHTML describes the loops of fn, as found by irutil.FindLoops.
+func loopsHTML(fn *ir.Function) string {
+	loops := irutil.FindLoops(fn)
+	if len(loops) == 0 {
+		return "<p>no loops</p>"
+	}
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, "<ul>")
+	for _, l := range loops {
+		var header *ir.BasicBlock
+		var blocks []string
+		for _, b := range fn.Blocks {
+			if !l.Has(b) {
+				continue
+			}
+			if header == nil || b.Dominates(header) {
+				header = b
+			}
+			blocks = append(blocks, b.String())
+		}
+		fmt.Fprintf(&buf, "<li>header %s: %s</li>", header, strings.Join(blocks, " "))
+	}
+	fmt.Fprint(&buf, "</ul>")
+	return buf.String()
+}
+
+func writeHeader(w io.Writer, title string) {
+	fmt.Fprintf(w, "<html><head><meta charset=\"utf-8\"><title>%[1]s</title></head><body><h1>%[1]s</h1>", html.EscapeString(title))
+}
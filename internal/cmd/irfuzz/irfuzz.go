@@ -0,0 +1,86 @@
+// irfuzz checks the IR builder and our analyzers on random programs
+// generated by gosmith, and minimizes the programs that make them
+// fail.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"honnef.co/go/tools/internal/gosmith"
+	"honnef.co/go/tools/internal/irfuzz"
+)
+
+var (
+	firstSeed = flag.Int64("seed", 0, "first random generator seed; defaults to the current time")
+	n         = flag.Int64("n", 0, "number of programs to check; 0 means no limit")
+	dir       = flag.String("dir", "irfuzz-failures", "directory to write failing programs to")
+	minimize  = flag.Bool("minimize", true, "minimize failing programs")
+	parallel  = flag.Int("p", runtime.GOMAXPROCS(0), "number of programs to check in parallel")
+)
+
+func main() {
+	flag.Parse()
+	if *firstSeed == 0 {
+		*firstSeed = time.Now().UnixNano()
+	}
+	log.Printf("starting at seed %d", *firstSeed)
+
+	var checked, invalid, failed int64
+	next := *firstSeed - 1
+	var wg sync.WaitGroup
+	for i := 0; i < *parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				seed := atomic.AddInt64(&next, 1)
+				if *n != 0 && seed-*firstSeed >= *n {
+					return
+				}
+				prog := irfuzz.Generate(seed)
+				f, err := irfuzz.Check(prog)
+				switch {
+				case err != nil:
+					atomic.AddInt64(&invalid, 1)
+				case f != nil:
+					atomic.AddInt64(&failed, 1)
+					report(seed, prog, f)
+				}
+				if c := atomic.AddInt64(&checked, 1); c%100 == 0 {
+					log.Printf("checked %d programs, %d invalid, %d failed", c, atomic.LoadInt64(&invalid), atomic.LoadInt64(&failed))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	log.Printf("checked %d programs, %d invalid, %d failed", checked, invalid, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// report minimizes and writes a failing program to the output
+// directory.
+func report(seed int64, prog gosmith.Program, f *irfuzz.Failure) {
+	log.Printf("seed %d: %s", seed, f)
+	if *minimize {
+		prog = irfuzz.Minimize(prog, f)
+	}
+	out := filepath.Join(*dir, fmt.Sprintf("seed-%d", seed))
+	if err := prog.Write(out); err != nil {
+		log.Fatal(err)
+	}
+	msg := fmt.Sprintf("%s\n\n%s", f, f.Stack)
+	if err := os.WriteFile(filepath.Join(out, "failure.txt"), []byte(msg), 0666); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("seed %d: wrote program to %s", seed, out)
+}
@@ -1,4 +1,5 @@
-package main
+// Package gosmith generates random, but legal, Go programs.
+package gosmith
 
 /*
 Large uncovered parts are:
@@ -11,6 +12,7 @@ Large uncovered parts are:
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"math/rand"
 	"os"
@@ -19,6 +21,11 @@ import (
 )
 
 type Smith struct {
+	// SinglePackage causes the generation of single-package programs.
+	SinglePackage bool
+	// SingleFile causes the generation of single-file packages.
+	SingleFile bool
+
 	curPackage  int
 	curBlock    *Block
 	curBlockPos int
@@ -111,7 +118,20 @@ type Var struct {
 type Const struct {
 }
 
-func (smith *Smith) writeProgram(dir string) {
+// New returns a Smith that generates programs using the given seed.
+func New(seed int64) *Smith {
+	return &Smith{
+		rng: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// A Program is a generated program. It maps file names, relative to
+// a GOPATH, to their contents.
+type Program map[string][]byte
+
+// Program generates a random program. It must be called at most once
+// per Smith.
+func (smith *Smith) Program() Program {
 	smith.initTypes()
 	smith.initExpressions()
 	smith.initStatements()
@@ -119,7 +139,26 @@ func (smith *Smith) writeProgram(dir string) {
 	for pi := range smith.packages {
 		smith.genPackage(pi)
 	}
-	smith.serializeProgram(dir)
+	return smith.serializeProgram()
+}
+
+// WriteProgram generates a random program and writes it to dir.
+func (smith *Smith) WriteProgram(dir string) error {
+	return smith.Program().Write(dir)
+}
+
+// Write writes the program's files to dir.
+func (prog Program) Write(dir string) error {
+	for name, data := range prog {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (smith *Smith) initProgram() {
@@ -129,7 +168,7 @@ func (smith *Smith) initProgram() {
 		{name: "init", args: []*Type{}, rets: []*Type{}},
 		{name: "main", args: []*Type{}, rets: []*Type{}},
 	}
-	if !*singlepkg {
+	if !smith.SinglePackage {
 		smith.packages[1] = smith.newPackage("a")
 		smith.packages[2] = smith.newPackage("b")
 	}
@@ -234,31 +273,22 @@ func (smith *Smith) genBlock() {
 	smith.leaveBlock()
 }
 
-func (smith *Smith) serializeProgram(dir string) {
+func (smith *Smith) serializeProgram() Program {
+	prog := Program{}
 	for _, p := range smith.packages {
 		if p == nil {
 			continue
 		}
-		path := filepath.Join(dir, "src", p.name)
-		os.MkdirAll(path, os.ModePerm)
 		nf := NFiles
-		if *singlefile {
+		if smith.SingleFile {
 			nf = 1
 		}
+		bufs := make([]*bytes.Buffer, nf)
 		files := make([]*bufio.Writer, nf)
 		for i := range files {
-			fname := filepath.Join(path, fmt.Sprintf("%v.go", i))
-			f, err := os.Create(fname)
-			if err != nil {
-				fmt.Fprintf(os.Stdout, "failed to create a file: %v\n", err)
-				os.Exit(1)
-			}
-			w := bufio.NewWriter(bufio.NewWriter(f))
+			bufs[i] = new(bytes.Buffer)
+			w := bufio.NewWriter(bufs[i])
 			files[i] = w
-			defer func() {
-				w.Flush()
-				f.Close()
-			}()
 			fmt.Fprintf(w, "package %s\n", p.name)
 			for imp := range p.imports {
 				fmt.Fprintf(w, "import \"%s\"\n", imp)
@@ -285,18 +315,14 @@ func (smith *Smith) serializeProgram(dir string) {
 		for _, decl := range p.top.sub {
 			serializeBlock(files[smith.rnd(len(files))], decl, 0)
 		}
+		for i, w := range files {
+			w.Flush()
+			prog[fmt.Sprintf("src/%s/%v.go", p.name, i)] = bufs[i].Bytes()
+		}
 	}
 
-	path := filepath.Join(dir, "src", "a")
-	os.MkdirAll(path, os.ModePerm)
-	fname := filepath.Join(path, "0_test.go")
-	f, err := os.Create(fname)
-	if err != nil {
-		fmt.Fprintf(os.Stdout, "failed to create a file: %v\n", err)
-		os.Exit(1)
-	}
-	f.Write([]byte("package a\n"))
-	f.Close()
+	prog["src/a/0_test.go"] = []byte("package a\n")
+	return prog
 }
 
 func serializeBlock(w *bufio.Writer, b *Block, d int) {
@@ -442,7 +468,7 @@ loop:
 	}
 	if smith.curBlock.parent == nil {
 		for i := smith.curPackage; i < NPackages; i++ {
-			if smith.rndBool() || i == NPackages-1 || *singlepkg {
+			if smith.rndBool() || i == NPackages-1 || smith.SinglePackage {
 				if i == smith.curPackage {
 					// emit global var into the current package
 					smith.enterBlock(true)
@@ -484,7 +510,7 @@ func (smith *Smith) materializeFunc(rets []*Type) *Func {
 		smith.exprCount = exprCount0
 	}()
 
-	if smith.rndBool() && !*singlepkg && smith.curPackage != NPackages-1 {
+	if smith.rndBool() && !smith.SinglePackage && smith.curPackage != NPackages-1 {
 		for _, r1 := range rets {
 			if dependsOn(r1, nil) {
 				goto thisPackage
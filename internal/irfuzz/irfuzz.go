@@ -0,0 +1,471 @@
+// Package irfuzz tests the IR builder and our analyzers on random
+// programs generated by gosmith.
+//
+// For every program, we build IR in several builder modes, all of
+// which sanity check the built functions, compare the IR against the
+// result of encoding and decoding it, and run all analyzers. Any
+// panic, analyzer error or mismatch is reported as a Failure.
+//
+// Programs can be checked with 'go test -fuzz FuzzIR' or with the
+// long-running irfuzz command, both of which minimize failing
+// programs.
+package irfuzz
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"honnef.co/go/tools/analysis/lint"
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/internal/gosmith"
+	"honnef.co/go/tools/quickfix"
+	"honnef.co/go/tools/simple"
+	"honnef.co/go/tools/staticcheck"
+	"honnef.co/go/tools/stylecheck"
+	"honnef.co/go/tools/unused"
+
+	"golang.org/x/exp/typeparams"
+	"golang.org/x/tools/go/analysis"
+)
+
+// Modes are the builder modes that programs get built in.
+var Modes = []ir.BuilderMode{
+	ir.SanityCheckFunctions | ir.NaiveForm,
+	ir.SanityCheckFunctions,
+	ir.SanityCheckFunctions | ir.SplitAfterNewInformation,
+	ir.SanityCheckFunctions | ir.GlobalDebug,
+}
+
+// Analyzers are the analyzers that get run on programs.
+var Analyzers []*analysis.Analyzer
+
+func init() {
+	for _, as := range [][]*lint.Analyzer{
+		simple.Analyzers,
+		staticcheck.Analyzers,
+		stylecheck.Analyzers,
+		quickfix.Analyzers,
+		{unused.Analyzer},
+	} {
+		for _, a := range as {
+			Analyzers = append(Analyzers, a.Analyzer)
+		}
+	}
+	sort.Slice(Analyzers, func(i, j int) bool {
+		return Analyzers[i].Name < Analyzers[j].Name
+	})
+}
+
+// A Failure describes a bug found by Check.
+type Failure struct {
+	// What was being done, e.g. "building IR in mode S" or "running SA4006"
+	Phase string
+	// The function that panicked, if any
+	Func string
+	// The panic value or a description of the problem
+	Msg string
+	// The stack trace of the panic, if any
+	Stack []byte
+}
+
+func (f *Failure) Error() string {
+	if f.Func != "" {
+		return fmt.Sprintf("%s: panic in %s: %s", f.Phase, f.Func, f.Msg)
+	}
+	return fmt.Sprintf("%s: %s", f.Phase, f.Msg)
+}
+
+// Same reports whether f and o are likely to be caused by the same
+// bug. It ignores the message, which tends to contain positions and
+// names that change when a program gets minimized.
+func (f *Failure) Same(o *Failure) bool {
+	return f.Phase == o.Phase && f.Func == o.Func
+}
+
+// Generate generates the program for a seed.
+func Generate(seed int64) gosmith.Program {
+	return gosmith.New(seed).Program()
+}
+
+// Check checks a program. It returns an error if the program isn't
+// valid Go, which is a bug in gosmith, not in us.
+func Check(prog gosmith.Program) (*Failure, error) {
+	return check(prog, "")
+}
+
+// check checks a program. If phase isn't empty, only that phase is
+// checked, which speeds up minimization.
+func check(prog gosmith.Program, phase string) (*Failure, error) {
+	fset := token.NewFileSet()
+	pkgs, err := load(fset, prog)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mode := range Modes {
+		buildPhase := fmt.Sprintf("building IR in mode %s", mode)
+		encode := mode == ir.SanityCheckFunctions
+		if phase != "" && phase != buildPhase && !(encode && phase == encodePhase) {
+			continue
+		}
+		var irpkgs []*ir.Package
+		if f := try(buildPhase, func() { irpkgs = build(fset, pkgs, mode) }); f != nil {
+			return f, nil
+		}
+		if encode {
+			for _, irpkg := range irpkgs {
+				var f *Failure
+				if ff := try(encodePhase, func() { f = checkEncoding(irpkg) }); ff != nil {
+					return ff, nil
+				}
+				if f != nil {
+					return f, nil
+				}
+			}
+		}
+	}
+
+	var analyzers []*analysis.Analyzer
+	for _, a := range Analyzers {
+		if phase == "" || phase == analyzerPhase(a) {
+			analyzers = append(analyzers, a)
+		}
+	}
+	if len(analyzers) == 0 {
+		return nil, nil
+	}
+	c := &checker{
+		objFacts: map[objectFactKey]analysis.Fact{},
+		pkgFacts: map[packageFactKey]analysis.Fact{},
+	}
+	for _, pkg := range pkgs {
+		if f := c.run(fset, pkg, analyzers); f != nil {
+			return f, nil
+		}
+	}
+	return nil, nil
+}
+
+const encodePhase = "encoding IR"
+
+func analyzerPhase(a *analysis.Analyzer) string {
+	return fmt.Sprintf("running %s", a.Name)
+}
+
+// try calls fn and turns panics into failures.
+func try(phase string, fn func()) (f *Failure) {
+	defer func() {
+		if r := recover(); r != nil {
+			f = &Failure{
+				Phase: phase,
+				Func:  panickingFunc(),
+				Msg:   fmt.Sprint(r),
+				Stack: debug.Stack(),
+			}
+		}
+	}()
+	fn()
+	return nil
+}
+
+// panickingFunc returns the name of the function that caused the
+// current panic. It must be called by a deferred function.
+func panickingFunc() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(0, pcs)])
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+		} else if panicking && !strings.HasPrefix(frame.Function, "runtime.") {
+			return frame.Function
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+type pkg struct {
+	types *types.Package
+	files []*ast.File
+	info  *types.Info
+}
+
+// load parses and type-checks the packages of a program. Packages are
+// returned in dependency order.
+func load(fset *token.FileSet, prog gosmith.Program) ([]*pkg, error) {
+	names := make([]string, 0, len(prog))
+	for name := range prog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := map[string][]*ast.File{}
+	for _, name := range names {
+		f, err := parser.ParseFile(fset, name, prog[name], parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		path := path.Dir(strings.TrimPrefix(name, "src/"))
+		files[path] = append(files[path], f)
+	}
+
+	var out []*pkg
+	checked := map[string]*types.Package{}
+	std := importer.ForCompiler(fset, "gc", nil)
+	conf := &types.Config{
+		Importer: importerFunc(func(path string) (*types.Package, error) {
+			if pkg, ok := checked[path]; ok {
+				return pkg, nil
+			}
+			return std.Import(path)
+		}),
+		Sizes: types.SizesFor("gc", "amd64"),
+	}
+
+	var check func(path string) error
+	check = func(path string) error {
+		if _, ok := checked[path]; ok {
+			return nil
+		}
+		for _, f := range files[path] {
+			for _, imp := range f.Imports {
+				dep := strings.Trim(imp.Path.Value, `"`)
+				if _, ok := files[dep]; ok {
+					if err := check(dep); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		info := &types.Info{
+			Types:      map[ast.Expr]types.TypeAndValue{},
+			Defs:       map[*ast.Ident]types.Object{},
+			Uses:       map[*ast.Ident]types.Object{},
+			Implicits:  map[ast.Node]types.Object{},
+			Scopes:     map[ast.Node]*types.Scope{},
+			Selections: map[*ast.SelectorExpr]*types.Selection{},
+		}
+		typeparams.InitInstances(info)
+		tpkg, err := conf.Check(path, fset, files[path], info)
+		if err != nil {
+			return err
+		}
+		checked[path] = tpkg
+		out = append(out, &pkg{tpkg, files[path], info})
+		return nil
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := check(path); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (fn importerFunc) Import(path string) (*types.Package, error) { return fn(path) }
+
+// build builds the IR of all packages.
+func build(fset *token.FileSet, pkgs []*pkg, mode ir.BuilderMode) []*ir.Package {
+	prog := ir.NewProgram(fset, mode)
+
+	created := map[*types.Package]bool{}
+	var irpkgs []*ir.Package
+	for _, pkg := range pkgs {
+		created[pkg.types] = true
+		irpkgs = append(irpkgs, prog.CreatePackage(pkg.types, pkg.files, pkg.info, true))
+	}
+	var createAll func(pkgs []*types.Package)
+	createAll = func(pkgs []*types.Package) {
+		for _, p := range pkgs {
+			if !created[p] {
+				created[p] = true
+				prog.CreatePackage(p, nil, nil, true)
+				createAll(p.Imports())
+			}
+		}
+	}
+	for _, pkg := range pkgs {
+		createAll(pkg.types.Imports())
+	}
+
+	for _, irpkg := range irpkgs {
+		irpkg.Build()
+	}
+	return irpkgs
+}
+
+// checkEncoding checks that encoding and decoding pkg doesn't change
+// its functions.
+func checkEncoding(pkg *ir.Package) *Failure {
+	fail := func(format string, args ...interface{}) *Failure {
+		return &Failure{Phase: encodePhase, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	var buf bytes.Buffer
+	if err := ir.EncodePackage(&buf, pkg); err != nil {
+		return fail("couldn't encode %s: %s", pkg.Pkg.Path(), err)
+	}
+	prog := ir.NewProgram(pkg.Prog.Fset, ir.SanityCheckFunctions)
+	decoded, err := prog.DecodePackage(pkg.Pkg, &buf)
+	if err != nil {
+		return fail("couldn't decode %s: %s", pkg.Pkg.Path(), err)
+	}
+
+	disassemble := func(fn *ir.Function) string {
+		var buf bytes.Buffer
+		ir.WriteFunction(&buf, fn)
+		return buf.String()
+	}
+	var compare func(want, got []*ir.Function) *Failure
+	compare = func(want, got []*ir.Function) *Failure {
+		if len(want) != len(got) {
+			return fail("%s: got %d functions, want %d", pkg.Pkg.Path(), len(got), len(want))
+		}
+		for i := range want {
+			if w, g := disassemble(want[i]), disassemble(got[i]); w != g {
+				return fail("%s: decoded function differs\nwant:\n%s\ngot:\n%s", want[i], w, g)
+			}
+			if f := compare(want[i].AnonFuncs, got[i].AnonFuncs); f != nil {
+				return f
+			}
+			if f := compare(want[i].Instances(), got[i].Instances()); f != nil {
+				return f
+			}
+		}
+		return nil
+	}
+	return compare(pkg.Functions, decoded.Functions)
+}
+
+type objectFactKey struct {
+	obj types.Object
+	typ reflect.Type
+}
+
+type packageFactKey struct {
+	pkg *types.Package
+	typ reflect.Type
+}
+
+// checker runs analyzers on packages, keeping facts in memory.
+type checker struct {
+	objFacts map[objectFactKey]analysis.Fact
+	pkgFacts map[packageFactKey]analysis.Fact
+}
+
+// run runs analyzers and their requirements on pkg. It must be called
+// for packages in dependency order.
+func (c *checker) run(fset *token.FileSet, pkg *pkg, analyzers []*analysis.Analyzer) *Failure {
+	results := map[*analysis.Analyzer]interface{}{}
+	var do func(a *analysis.Analyzer) *Failure
+	do = func(a *analysis.Analyzer) *Failure {
+		if _, ok := results[a]; ok {
+			return nil
+		}
+		for _, req := range a.Requires {
+			if f := do(req); f != nil {
+				return f
+			}
+		}
+
+		factTypes := map[reflect.Type]bool{}
+		for _, f := range a.FactTypes {
+			factTypes[reflect.TypeOf(f)] = true
+		}
+		pass := &analysis.Pass{
+			Analyzer:   a,
+			Fset:       fset,
+			Files:      pkg.files,
+			Pkg:        pkg.types,
+			TypesInfo:  pkg.info,
+			TypesSizes: types.SizesFor("gc", "amd64"),
+			Report:     func(analysis.Diagnostic) {},
+			ResultOf:   results,
+			ImportObjectFact: func(obj types.Object, fact analysis.Fact) bool {
+				f, ok := c.objFacts[objectFactKey{obj, reflect.TypeOf(fact)}]
+				if ok {
+					reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(f).Elem())
+				}
+				return ok
+			},
+			ImportPackageFact: func(pkg *types.Package, fact analysis.Fact) bool {
+				f, ok := c.pkgFacts[packageFactKey{pkg, reflect.TypeOf(fact)}]
+				if ok {
+					reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(f).Elem())
+				}
+				return ok
+			},
+			ExportObjectFact: func(obj types.Object, fact analysis.Fact) {
+				if obj.Pkg() != pkg.types {
+					panic(fmt.Sprintf("%s exported fact for object %s of another package", a.Name, obj))
+				}
+				c.objFacts[objectFactKey{obj, reflect.TypeOf(fact)}] = fact
+			},
+			ExportPackageFact: func(fact analysis.Fact) {
+				c.pkgFacts[packageFactKey{pkg.types, reflect.TypeOf(fact)}] = fact
+			},
+			AllObjectFacts: func() []analysis.ObjectFact {
+				var out []analysis.ObjectFact
+				for k, f := range c.objFacts {
+					if !factTypes[k.typ] {
+						continue
+					}
+					out = append(out, analysis.ObjectFact{Object: k.obj, Fact: f})
+				}
+				return out
+			},
+			AllPackageFacts: func() []analysis.PackageFact {
+				var out []analysis.PackageFact
+				for k, f := range c.pkgFacts {
+					if !factTypes[k.typ] {
+						continue
+					}
+					out = append(out, analysis.PackageFact{Package: k.pkg, Fact: f})
+				}
+				return out
+			},
+		}
+
+		phase := analyzerPhase(a)
+		var res interface{}
+		var err error
+		if f := try(phase, func() { res, err = a.Run(pass) }); f != nil {
+			return f
+		}
+		if err != nil {
+			return &Failure{Phase: phase, Msg: err.Error()}
+		}
+		results[a] = res
+		return nil
+	}
+
+	for _, a := range analyzers {
+		if f := do(a); f != nil {
+			return f
+		}
+	}
+	return nil
+}
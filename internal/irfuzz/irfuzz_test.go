@@ -0,0 +1,42 @@
+//go:build go1.18
+// +build go1.18
+
+package irfuzz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"honnef.co/go/tools/internal/gosmith"
+)
+
+func FuzzIR(f *testing.F) {
+	for seed := int64(0); seed < 10; seed++ {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		prog := Generate(seed)
+		fail, err := Check(prog)
+		if err != nil {
+			t.Skipf("gosmith generated an invalid program: %s", err)
+		}
+		if fail != nil {
+			t.Fatalf("seed %d: %s\n%s\nminimized program:\n%s", seed, fail, fail.Stack, format(Minimize(prog, fail)))
+		}
+	})
+}
+
+func format(prog gosmith.Program) string {
+	names := make([]string, 0, len(prog))
+	for name := range prog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&sb, "-- %s --\n%s", name, prog[name])
+	}
+	return sb.String()
+}
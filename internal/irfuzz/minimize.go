@@ -0,0 +1,108 @@
+package irfuzz
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"sort"
+
+	"honnef.co/go/tools/internal/gosmith"
+)
+
+// Minimize returns a smaller version of prog that still fails in the
+// same way as f. It repeatedly removes files, top-level declarations
+// and chunks of lines, keeping those removals that preserve the
+// failure, until no further progress can be made.
+func Minimize(prog gosmith.Program, f *Failure) gosmith.Program {
+	fails := func(prog gosmith.Program) bool {
+		got, err := check(prog, f.Phase)
+		return err == nil && got != nil && got.Same(f)
+	}
+
+	prog = copyProgram(prog)
+	for progress := true; progress; {
+		progress = false
+
+		names := make([]string, 0, len(prog))
+		for name := range prog {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			data := prog[name]
+			delete(prog, name)
+			if fails(prog) {
+				progress = true
+				continue
+			}
+			prog[name] = data
+		}
+
+		for _, name := range names {
+			data, ok := prog[name]
+			if !ok {
+				continue
+			}
+			fset := token.NewFileSet()
+			f, err := parser.ParseFile(fset, name, data, 0)
+			if err != nil {
+				continue
+			}
+			// Remove declarations back to front so that the offsets of
+			// the remaining ones stay valid.
+			for i := len(f.Decls) - 1; i >= 0; i-- {
+				start := fset.Position(f.Decls[i].Pos()).Offset
+				end := fset.Position(f.Decls[i].End()).Offset
+				candidate := make([]byte, 0, len(data)-(end-start))
+				candidate = append(candidate, data[:start]...)
+				candidate = append(candidate, data[end:]...)
+				prog[name] = candidate
+				if fails(prog) {
+					data = candidate
+					progress = true
+				}
+			}
+			prog[name] = data
+		}
+
+		for _, name := range names {
+			data, ok := prog[name]
+			if !ok {
+				continue
+			}
+			lines := bytes.SplitAfter(data, []byte("\n"))
+			if len(lines[len(lines)-1]) == 0 {
+				lines = lines[:len(lines)-1]
+			}
+			for n := len(lines) / 2; n > 0; n /= 2 {
+				for i := 0; i < len(lines); {
+					end := i + n
+					if end > len(lines) {
+						end = len(lines)
+					}
+					candidate := make([][]byte, 0, len(lines)-(end-i))
+					candidate = append(candidate, lines[:i]...)
+					candidate = append(candidate, lines[end:]...)
+					prog[name] = bytes.Join(candidate, nil)
+					if fails(prog) {
+						lines = candidate
+						progress = true
+					} else {
+						i = end
+					}
+				}
+			}
+			prog[name] = bytes.Join(lines, nil)
+		}
+	}
+	return prog
+}
+
+func copyProgram(prog gosmith.Program) gosmith.Program {
+	out := make(gosmith.Program, len(prog))
+	for name, data := range prog {
+		out[name] = data
+	}
+	return out
+}
@@ -17,6 +17,7 @@ import (
 
 	"honnef.co/go/tools/go/ir"
 
+	"golang.org/x/exp/typeparams"
 	"golang.org/x/tools/go/analysis"
 )
 
@@ -34,14 +35,124 @@ var Analyzer = &analysis.Analyzer{
 	FactTypes:  []analysis.Fact{new(noReturn)},
 }
 
+// InstancesAnalyzer is like Analyzer, but also populates
+// IR.Instances. Building instantiations is costly, so only analyzers
+// that need them should depend on InstancesAnalyzer.
+var InstancesAnalyzer = &analysis.Analyzer{
+	Name:       "buildir_instances",
+	Doc:        "build IR, including instantiations of generic functions, for later passes",
+	Run:        runInstances,
+	Requires:   []*analysis.Analyzer{Analyzer},
+	ResultType: reflect.TypeOf(new(IR)),
+}
+
 // IR provides intermediate representation for all the
 // non-blank source functions in the current package.
 type IR struct {
 	Pkg      *ir.Package
 	SrcFuncs []*ir.Function
+	// Instances holds the instantiations of the generic functions in
+	// SrcFuncs, including their function literals. They share the
+	// syntax of their generic origins, but have concrete types, and
+	// belong to a separate program. It is only populated by
+	// InstancesAnalyzer.
+	Instances []*ir.Function
 }
 
 func run(pass *analysis.Pass) (interface{}, error) {
+	importNoReturn := func(fn *ir.Function) {
+		var noRet noReturn
+		if pass.ImportObjectFact(fn.Object(), &noRet) {
+			fn.NoReturn = noRet.Kind
+		}
+	}
+	res := build(pass, ir.GlobalDebug, importNoReturn)
+	for _, fn := range res.Pkg.Functions {
+		if fn.NoReturn > 0 {
+			pass.ExportObjectFact(fn.Object(), &noReturn{fn.NoReturn})
+		}
+	}
+	return res, nil
+}
+
+func runInstances(pass *analysis.Pass) (interface{}, error) {
+	base := pass.ResultOf[Analyzer].(*IR)
+	res := &IR{Pkg: base.Pkg, SrcFuncs: base.SrcFuncs}
+	if !hasInstances(pass) {
+		// Most packages don't instantiate any of their own generic
+		// code; don't create a second program for them.
+		return res, nil
+	}
+
+	// We can't import Analyzer's facts, but its program already
+	// knows about the functions that don't return.
+	importNoReturn := func(fn *ir.Function) {
+		if obj, ok := fn.Object().(*types.Func); ok {
+			if bfn := base.Pkg.Prog.FuncValue(obj); bfn != nil {
+				fn.NoReturn = bfn.NoReturn
+			}
+		}
+	}
+	irpkg := create(pass, ir.GlobalDebug|ir.InstantiateGenerics, importNoReturn)
+	for _, fn := range irpkg.Functions {
+		importNoReturn(fn)
+	}
+	irpkg.BuildInstances()
+
+	var addInstances func(f *ir.Function)
+	addInstances = func(f *ir.Function) {
+		res.Instances = append(res.Instances, f)
+		for _, anon := range f.AnonFuncs {
+			addInstances(anon)
+		}
+	}
+	for _, fn := range irpkg.Functions {
+		for _, inst := range fn.Instances() {
+			addInstances(inst)
+		}
+	}
+	return res, nil
+}
+
+// hasInstances reports whether the package refers to instantiations
+// of its own generic functions or types.
+func hasInstances(pass *analysis.Pass) bool {
+	for id := range typeparams.GetInstances(pass.TypesInfo) {
+		if obj := pass.TypesInfo.Uses[id]; obj != nil && obj.Pkg() == pass.Pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// build builds the IR of the package in the given mode. importNoReturn
+// is called for the exported functions of all imported packages.
+func build(pass *analysis.Pass, mode ir.BuilderMode, importNoReturn func(fn *ir.Function)) *IR {
+	irpkg := create(pass, mode, importNoReturn)
+	irpkg.Build()
+
+	// Compute list of source functions, including literals,
+	// in source order.
+	var addAnons func(f *ir.Function)
+	funcs := make([]*ir.Function, len(irpkg.Functions))
+	copy(funcs, irpkg.Functions)
+	addAnons = func(f *ir.Function) {
+		for _, anon := range f.AnonFuncs {
+			funcs = append(funcs, anon)
+			addAnons(anon)
+		}
+	}
+	for _, fn := range irpkg.Functions {
+		addAnons(fn)
+	}
+
+	return &IR{Pkg: irpkg, SrcFuncs: funcs}
+}
+
+// create creates the IR packages of the package and its imports in
+// the given mode, without building them. importNoReturn is called for
+// the exported functions of all imported packages.
+func create(pass *analysis.Pass, mode ir.BuilderMode, importNoReturn func(fn *ir.Function)) *ir.Package {
 	// Plundered from ssautil.BuildPackage.
 
 	// We must create a new Program for each Package because the
@@ -54,8 +165,6 @@ func run(pass *analysis.Pass) (interface{}, error) {
 	// Analysis.Run on a package will see only IR objects belonging
 	// to a single Program.
 
-	mode := ir.GlobalDebug
-
 	prog := ir.NewProgram(pass.Fset, mode)
 
 	// Create IR packages for all imports.
@@ -69,10 +178,7 @@ func run(pass *analysis.Pass) (interface{}, error) {
 				irpkg := prog.CreatePackage(p, nil, nil, true)
 				for _, fn := range irpkg.Functions {
 					if ast.IsExported(fn.Name()) {
-						var noRet noReturn
-						if pass.ImportObjectFact(fn.Object(), &noRet) {
-							fn.NoReturn = noRet.Kind
-						}
+						importNoReturn(fn)
 					}
 				}
 				createAll(p.Imports())
@@ -81,27 +187,6 @@ func run(pass *analysis.Pass) (interface{}, error) {
 	}
 	createAll(pass.Pkg.Imports())
 
-	// Create and build the primary package.
-	irpkg := prog.CreatePackage(pass.Pkg, pass.Files, pass.TypesInfo, false)
-	irpkg.Build()
-
-	// Compute list of source functions, including literals,
-	// in source order.
-	var addAnons func(f *ir.Function)
-	funcs := make([]*ir.Function, len(irpkg.Functions))
-	copy(funcs, irpkg.Functions)
-	addAnons = func(f *ir.Function) {
-		for _, anon := range f.AnonFuncs {
-			funcs = append(funcs, anon)
-			addAnons(anon)
-		}
-	}
-	for _, fn := range irpkg.Functions {
-		addAnons(fn)
-		if fn.NoReturn > 0 {
-			pass.ExportObjectFact(fn.Object(), &noReturn{fn.NoReturn})
-		}
-	}
-
-	return &IR{Pkg: irpkg, SrcFuncs: funcs}, nil
+	// Create the primary package.
+	return prog.CreatePackage(pass.Pkg, pass.Files, pass.TypesInfo, false)
 }
@@ -0,0 +1,542 @@
+// Package sccp defines an Analyzer that performs sparse conditional
+// constant propagation on the functions of a package. It does not
+// report any diagnostics itself but may be used as an input to other
+// analyzers.
+//
+// Unlike the constant folding done by the type checker, which only
+// applies to constant expressions, the analysis finds values that are
+// constant because they are computed from constants at runtime, and
+// values that are constant because the branches that would make them
+// vary can never execute. In
+//
+//	sep := ","
+//	pattern := "[" + sep + "]"
+//	verbose := false
+//	if verbose {
+//		pattern = "(" + pattern
+//	}
+//
+// pattern is known to be "[,]".
+//
+// THIS INTERFACE IS EXPERIMENTAL AND MAY BE SUBJECT TO INCOMPATIBLE CHANGE.
+package sccp
+
+import (
+	"go/constant"
+	"go/token"
+	"go/types"
+	"reflect"
+
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/internal/passes/buildir"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name:       "sccp",
+	Doc:        "propagate constants through control flow",
+	Run:        run,
+	Requires:   []*analysis.Analyzer{buildir.Analyzer},
+	ResultType: reflect.TypeOf(new(Result)),
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	r := newResult()
+	for _, fn := range pass.ResultOf[buildir.Analyzer].(*buildir.IR).SrcFuncs {
+		r.compute(fn)
+	}
+	return r, nil
+}
+
+// A Kind describes what is known about a value.
+type Kind int
+
+const (
+	// Undefined values have not been computed, because the code that
+	// computes them never executes.
+	Undefined Kind = iota
+	// Constant values are always the same constant.
+	Constant
+	// Overdefined values may not be constant.
+	Overdefined
+)
+
+// A Lattice is an element of the lattice of the analysis.
+type Lattice struct {
+	Kind Kind
+	// Value is the value of constants.
+	Value constant.Value
+}
+
+var overdefined = Lattice{Kind: Overdefined}
+
+func constLattice(v constant.Value) Lattice {
+	if v == nil || v.Kind() == constant.Unknown {
+		return overdefined
+	}
+	return Lattice{Kind: Constant, Value: v}
+}
+
+// meet returns the greatest lower bound of a and b.
+func meet(a, b Lattice) Lattice {
+	switch {
+	case a.Kind == Undefined:
+		return b
+	case b.Kind == Undefined:
+		return a
+	case a.Kind == Overdefined || b.Kind == Overdefined:
+		return overdefined
+	case a.Value.Kind() == b.Value.Kind() && constant.Compare(a.Value, token.EQL, b.Value):
+		return a
+	default:
+		return overdefined
+	}
+}
+
+func (l Lattice) equal(o Lattice) bool {
+	if l.Kind != o.Kind {
+		return false
+	}
+	if l.Kind != Constant {
+		return true
+	}
+	return l.Value.Kind() == o.Value.Kind() && constant.Compare(l.Value, token.EQL, o.Value)
+}
+
+// Result holds the outcome of the analysis for a set of functions.
+type Result struct {
+	values map[ir.Value]Lattice
+	live   map[*ir.BasicBlock]bool
+}
+
+func newResult() *Result {
+	return &Result{
+		values: map[ir.Value]Lattice{},
+		live:   map[*ir.BasicBlock]bool{},
+	}
+}
+
+// Compute analyzes fn.
+func Compute(fn *ir.Function) *Result {
+	r := newResult()
+	r.compute(fn)
+	return r
+}
+
+// Lattice returns what is known about v. Values that don't belong to
+// an analyzed function are overdefined, unless they are constants.
+func (r *Result) Lattice(v ir.Value) Lattice {
+	if k, ok := v.(*ir.Const); ok {
+		return constLattice(k.Value)
+	}
+	if l, ok := r.values[v]; ok {
+		return l
+	}
+	return overdefined
+}
+
+// Const returns the constant value of v, if it has one.
+func (r *Result) Const(v ir.Value) (constant.Value, bool) {
+	l := r.Lattice(v)
+	return l.Value, l.Kind == Constant
+}
+
+// Dead reports whether b, which must belong to an analyzed function,
+// can never execute.
+func (r *Result) Dead(b *ir.BasicBlock) bool {
+	return !r.live[b]
+}
+
+type edge struct {
+	from, to *ir.BasicBlock
+}
+
+type solver struct {
+	*Result
+	edges    map[edge]bool
+	flowWork []edge
+	ssaWork  []ir.Instruction
+}
+
+func (r *Result) compute(fn *ir.Function) {
+	if len(fn.Blocks) == 0 {
+		return
+	}
+	s := &solver{Result: r, edges: map[edge]bool{}}
+	s.visitBlock(fn.Blocks[0])
+	for len(s.flowWork) > 0 || len(s.ssaWork) > 0 {
+		for len(s.flowWork) > 0 {
+			e := s.flowWork[len(s.flowWork)-1]
+			s.flowWork = s.flowWork[:len(s.flowWork)-1]
+			if s.live[e.to] {
+				// Only the φ- and σ-nodes can learn something from the
+				// new edge.
+				for _, instr := range e.to.Instrs {
+					switch instr.(type) {
+					case *ir.Phi, *ir.Sigma:
+						s.visit(instr)
+					}
+				}
+			} else {
+				s.visitBlock(e.to)
+			}
+		}
+		for len(s.ssaWork) > 0 {
+			instr := s.ssaWork[len(s.ssaWork)-1]
+			s.ssaWork = s.ssaWork[:len(s.ssaWork)-1]
+			if s.live[instr.Block()] {
+				s.visit(instr)
+			}
+		}
+	}
+}
+
+func (s *solver) visitBlock(b *ir.BasicBlock) {
+	s.live[b] = true
+	for _, instr := range b.Instrs {
+		s.visit(instr)
+	}
+}
+
+func (s *solver) markEdge(from, to *ir.BasicBlock) {
+	e := edge{from, to}
+	if !s.edges[e] {
+		s.edges[e] = true
+		s.flowWork = append(s.flowWork, e)
+	}
+}
+
+// visit evaluates instr, propagating changes to its referrers and
+// successors.
+func (s *solver) visit(instr ir.Instruction) {
+	if v, ok := instr.(ir.Value); ok {
+		old, ok := s.values[v]
+		if !ok {
+			old = Lattice{Kind: Undefined}
+		}
+		// Values may only ever move down the lattice.
+		cur := meet(old, s.eval(v))
+		if !cur.equal(old) || !ok {
+			s.values[v] = cur
+			if refs := v.Referrers(); refs != nil {
+				s.ssaWork = append(s.ssaWork, *refs...)
+			}
+		}
+	}
+
+	b := instr.Block()
+	switch instr := instr.(type) {
+	case *ir.If:
+		cond := s.Lattice(instr.Cond)
+		switch cond.Kind {
+		case Constant:
+			if constant.BoolVal(cond.Value) {
+				s.markEdge(b, b.Succs[0])
+			} else {
+				s.markEdge(b, b.Succs[1])
+			}
+		case Overdefined:
+			s.markEdge(b, b.Succs[0])
+			s.markEdge(b, b.Succs[1])
+		}
+	case *ir.ConstantSwitch:
+		if succ := s.switchTarget(instr); succ != nil {
+			s.markEdge(b, succ)
+		} else {
+			for _, succ := range b.Succs {
+				s.markEdge(b, succ)
+			}
+		}
+	default:
+		if instr == b.Control() {
+			for _, succ := range b.Succs {
+				s.markEdge(b, succ)
+			}
+		}
+	}
+}
+
+// switchTarget returns the only successor a constant switch can
+// branch to, if there is one.
+func (s *solver) switchTarget(sw *ir.ConstantSwitch) *ir.BasicBlock {
+	b := sw.Block()
+	tag, ok := s.Const(sw.Tag)
+	if !ok || len(b.Succs) != len(sw.Conds) {
+		return nil
+	}
+	var def *ir.BasicBlock
+	for i, cond := range sw.Conds {
+		if cond == nil {
+			def = b.Succs[i]
+			continue
+		}
+		c, ok := s.Const(cond)
+		if !ok || c.Kind() != tag.Kind() {
+			return nil
+		}
+		if constant.Compare(tag, token.EQL, c) {
+			return b.Succs[i]
+		}
+	}
+	return def
+}
+
+// eval computes the lattice value of v from the current lattice
+// values of its operands.
+func (s *solver) eval(v ir.Value) Lattice {
+	switch v := v.(type) {
+	case *ir.Const:
+		return constLattice(v.Value)
+	case *ir.Phi:
+		out := Lattice{Kind: Undefined}
+		for i, e := range v.Edges {
+			if s.edges[edge{v.Block().Preds[i], v.Block()}] {
+				out = meet(out, s.Lattice(e))
+			}
+		}
+		return out
+	case *ir.Sigma:
+		if !s.edges[edge{v.From, v.Block()}] {
+			return Lattice{Kind: Undefined}
+		}
+		return s.sigma(v)
+	case *ir.Copy:
+		return s.Lattice(v.X)
+	case *ir.ChangeType:
+		return s.Lattice(v.X)
+	case *ir.Convert:
+		x := s.Lattice(v.X)
+		if x.Kind != Constant {
+			return x
+		}
+		return constLattice(convert(x.Value, v.Type()))
+	case *ir.UnOp:
+		x := s.Lattice(v.X)
+		if x.Kind != Constant || v.Op == token.MUL || v.Op == token.ARROW {
+			if x.Kind == Undefined {
+				return x
+			}
+			return overdefined
+		}
+		return constLattice(unop(v.Op, x.Value, v.Type()))
+	case *ir.BinOp:
+		x, y := s.Lattice(v.X), s.Lattice(v.Y)
+		if x.Kind == Undefined || y.Kind == Undefined {
+			return Lattice{Kind: Undefined}
+		}
+		if x.Kind == Overdefined || y.Kind == Overdefined {
+			return overdefined
+		}
+		return constLattice(binop(v.Op, x.Value, y.Value, v.X.Type(), v.Type()))
+	case *ir.Call:
+		if builtin, ok := v.Call.Value.(*ir.Builtin); ok && builtin.Name() == "len" {
+			x := s.Lattice(v.Call.Args[0])
+			if x.Kind == Constant && x.Value.Kind() == constant.String {
+				return constLattice(constant.MakeInt64(int64(len(constant.StringVal(x.Value)))))
+			}
+			if x.Kind == Undefined {
+				return x
+			}
+		}
+	}
+	return overdefined
+}
+
+// sigma computes the lattice value of a σ-node, learning from
+// comparisons against constants.
+func (s *solver) sigma(sigma *ir.Sigma) Lattice {
+	x := s.Lattice(sigma.X)
+	ifInstr, ok := sigma.From.Control().(*ir.If)
+	if !ok || sigma.From.Succs[0] == sigma.From.Succs[1] {
+		return x
+	}
+	taken := sigma.Block() == sigma.From.Succs[0]
+	if ifInstr.Cond == sigma.X {
+		return constLattice(constant.MakeBool(taken))
+	}
+	cond, ok := ifInstr.Cond.(*ir.BinOp)
+	if !ok || !(cond.Op == token.EQL && taken || cond.Op == token.NEQ && !taken) {
+		return x
+	}
+	var other ir.Value
+	switch sigma.X {
+	case cond.X:
+		other = cond.Y
+	case cond.Y:
+		other = cond.X
+	default:
+		return x
+	}
+	k, ok := other.(*ir.Const)
+	if !ok || k.Value == nil {
+		return x
+	}
+	// Floats compare equal to values that differ from them, such as
+	// -0 and 0.
+	switch k.Value.Kind() {
+	case constant.Int, constant.String, constant.Bool:
+		if x.Kind == Undefined {
+			return x
+		}
+		return constLattice(k.Value)
+	default:
+		return x
+	}
+}
+
+func isInteger(T types.Type) bool {
+	basic, ok := T.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsInteger != 0
+}
+
+func isString(T types.Type) bool {
+	basic, ok := T.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsString != 0
+}
+
+func isExact(v constant.Value) bool {
+	switch v.Kind() {
+	case constant.Int, constant.String, constant.Bool:
+		return true
+	default:
+		return false
+	}
+}
+
+// binop computes x op y, returning nil if the result isn't a known
+// constant.
+func binop(op token.Token, x, y constant.Value, operand, result types.Type) constant.Value {
+	// Floating-point arithmetic at runtime rounds, while package
+	// constant computes exact results, so we only evaluate integer,
+	// string and boolean operations.
+	if !isExact(x) || !isExact(y) {
+		return nil
+	}
+	switch op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		if x.Kind() != y.Kind() {
+			return nil
+		}
+		return constant.MakeBool(constant.Compare(x, op, y))
+	case token.SHL, token.SHR:
+		if x.Kind() != constant.Int || y.Kind() != constant.Int {
+			return nil
+		}
+		n, ok := constant.Uint64Val(y)
+		if !ok || n > 64 {
+			return nil
+		}
+		return representable(constant.Shift(x, op, uint(n)), result)
+	case token.QUO, token.REM:
+		if x.Kind() != constant.Int || y.Kind() != constant.Int || constant.Sign(y) == 0 {
+			return nil
+		}
+		if op == token.QUO {
+			// Integer division
+			op = token.QUO_ASSIGN
+		}
+		return representable(constant.BinaryOp(x, op, y), result)
+	case token.ADD:
+		if x.Kind() != y.Kind() || x.Kind() == constant.Bool {
+			return nil
+		}
+		return representable(constant.BinaryOp(x, op, y), result)
+	case token.SUB, token.MUL, token.AND, token.OR, token.XOR, token.AND_NOT:
+		if x.Kind() != constant.Int || y.Kind() != constant.Int {
+			return nil
+		}
+		return representable(constant.BinaryOp(x, op, y), result)
+	default:
+		return nil
+	}
+}
+
+// unop computes op x, returning nil if the result isn't a known
+// constant.
+func unop(op token.Token, x constant.Value, typ types.Type) constant.Value {
+	switch op {
+	case token.NOT:
+		if x.Kind() != constant.Bool {
+			return nil
+		}
+		return constant.UnaryOp(op, x, 0)
+	case token.SUB:
+		if x.Kind() != constant.Int {
+			return nil
+		}
+		return representable(constant.UnaryOp(op, x, 0), typ)
+	case token.XOR:
+		// The bitwise complement of unsigned integers depends on
+		// their size, so we only compute it for signed ones.
+		if x.Kind() != constant.Int || !isInteger(typ) || typ.Underlying().(*types.Basic).Info()&types.IsUnsigned != 0 {
+			return nil
+		}
+		return representable(constant.UnaryOp(op, x, 0), typ)
+	default:
+		return nil
+	}
+}
+
+// convert converts x to typ, returning nil if the result isn't a
+// known constant.
+func convert(x constant.Value, typ types.Type) constant.Value {
+	switch {
+	case x.Kind() == constant.Int && isInteger(typ):
+		return representable(x, typ)
+	case x.Kind() == constant.Int && isString(typ):
+		// string(rune)
+		n, ok := constant.Int64Val(x)
+		if !ok {
+			return nil
+		}
+		if n < 0 || n > 0x10FFFF {
+			n = 0xFFFD
+		}
+		return constant.MakeString(string(rune(n)))
+	case x.Kind() == constant.String && isString(typ):
+		return x
+	default:
+		return nil
+	}
+}
+
+// representable returns v if a value of type typ can hold it on all
+// platforms, and nil otherwise. Results that overflow would wrap
+// around at runtime, which we don't model.
+func representable(v constant.Value, typ types.Type) constant.Value {
+	if v.Kind() != constant.Int {
+		return v
+	}
+	basic, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		return nil
+	}
+	var bits uint
+	signed := basic.Info()&types.IsUnsigned == 0
+	switch basic.Kind() {
+	case types.Int8, types.Uint8:
+		bits = 8
+	case types.Int16, types.Uint16:
+		bits = 16
+	case types.Int32, types.Uint32, types.Int, types.Uint, types.Uintptr:
+		// The size of int, uint and uintptr depends on the platform.
+		bits = 32
+	case types.Int64, types.Uint64:
+		bits = 64
+	default:
+		return nil
+	}
+	var min, max constant.Value
+	if signed {
+		min = constant.Shift(constant.MakeInt64(-1), token.SHL, bits-1)
+		max = constant.BinaryOp(constant.Shift(constant.MakeInt64(1), token.SHL, bits-1), token.SUB, constant.MakeInt64(1))
+	} else {
+		min = constant.MakeInt64(0)
+		max = constant.BinaryOp(constant.Shift(constant.MakeInt64(1), token.SHL, bits), token.SUB, constant.MakeInt64(1))
+	}
+	if constant.Compare(v, token.LSS, min) || constant.Compare(v, token.GTR, max) {
+		return nil
+	}
+	return v
+}
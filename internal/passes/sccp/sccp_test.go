@@ -0,0 +1,190 @@
+package sccp_test
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/ir/irutil"
+	"honnef.co/go/tools/internal/passes/sccp"
+)
+
+const src = `package pkg
+
+func sink(interface{}) {}
+
+func concat() {
+	sep := ","
+	sink("[" + sep + "]")
+}
+
+func deadBranch() {
+	s := "a"
+	verbose := false
+	if verbose {
+		s = "b"
+	}
+	sink(s)
+}
+
+func liveBranch(b bool) {
+	s := "a"
+	if b {
+		s = "b"
+	}
+	sink(s)
+}
+
+func loop() {
+	x := 1
+	for i := 0; i < 10; i++ {
+		x = x * 1
+	}
+	sink(x)
+}
+
+func counter() {
+	n := 0
+	for i := 0; i < 10; i++ {
+		n++
+	}
+	sink(n)
+}
+
+func refine(s string) {
+	if s == "x" {
+		sink(s + "y")
+	}
+}
+
+func switchStmt() {
+	x := 2
+	s := ""
+	switch x {
+	case 1:
+		s = "one"
+	case 2:
+		s = "two"
+	default:
+		s = "many"
+	}
+	sink(s)
+}
+
+func arith() {
+	x := 7
+	sink(x/2 + x%2 - len("abc"))
+}
+
+func conv() {
+	sink(string(rune(65)))
+}
+
+func float() {
+	x := 0.1
+	sink(x * 3)
+}
+`
+
+// TestConstants checks the lattice values of the arguments to sink.
+func TestConstants(t *testing.T) {
+	want := map[string]string{
+		"concat":     `"[,]"`,
+		"deadBranch": `"a"`,
+		"liveBranch": "",
+		"loop":       "1",
+		"counter":    "",
+		"refine":     `"xy"`,
+		"switchStmt": `"two"`,
+		"arith":      "1",
+		"conv":       `"A"`,
+		"float":      "",
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "pkg.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, _, err := irutil.BuildPackage(&types.Config{Importer: importer.Default()}, fset, types.NewPackage("pkg", ""), []*ast.File{f}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, exp := range want {
+		fn := pkg.Func(name)
+		r := sccp.Compute(fn)
+		var found bool
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				call, ok := instr.(*ir.Call)
+				if !ok || call.Common().StaticCallee() != pkg.Func("sink") {
+					continue
+				}
+				found = true
+				arg := call.Common().Args[0]
+				if mi, ok := arg.(*ir.MakeInterface); ok {
+					arg = mi.X
+				}
+				got := ""
+				if v, ok := r.Const(arg); ok {
+					got = v.ExactString()
+				}
+				if got != exp {
+					t.Errorf("%s: got %q, want %q", name, got, exp)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s: didn't find call to sink", name)
+		}
+	}
+}
+
+// TestDead checks that blocks guarded by constant conditions are dead.
+func TestDead(t *testing.T) {
+	const src = `package pkg
+
+func sink() {}
+
+func fn() {
+	debug := 0
+	if debug > 1 {
+		sink()
+	}
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "pkg.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, _, err := irutil.BuildPackage(&types.Config{Importer: importer.Default()}, fset, types.NewPackage("pkg", ""), []*ast.File{f}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := pkg.Func("fn")
+	r := sccp.Compute(fn)
+	if r.Dead(fn.Blocks[0]) {
+		t.Errorf("entry block is dead")
+	}
+	var found bool
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			call, ok := instr.(*ir.Call)
+			if !ok || call.Common().StaticCallee() != pkg.Func("sink") {
+				continue
+			}
+			found = true
+			if !r.Dead(b) {
+				t.Errorf("call to sink isn't dead")
+			}
+		}
+	}
+	if !found {
+		t.Errorf("didn't find call to sink")
+	}
+}
@@ -0,0 +1,233 @@
+package vrp
+
+import (
+	"fmt"
+	"go/types"
+	"math/big"
+)
+
+// An Interval is the closed range [Lower, Upper] of the values an
+// integer may take on. The zero Interval is empty; it describes values
+// that are never computed, for example because they're only computed
+// in code that can't execute.
+//
+// Bounds are always finite: an integer of unknown value is described
+// by the range of its type. Bounds are shared between intervals and
+// must not be modified.
+type Interval struct {
+	Lower, Upper *big.Int
+}
+
+// Empty reports whether the interval contains no values.
+func (i Interval) Empty() bool {
+	return i.Lower == nil || i.Lower.Cmp(i.Upper) > 0
+}
+
+// Const returns the interval's only value, if it contains exactly one.
+func (i Interval) Const() (*big.Int, bool) {
+	if i.Empty() || i.Lower.Cmp(i.Upper) != 0 {
+		return nil, false
+	}
+	return i.Lower, true
+}
+
+// Contains reports whether n is in the interval.
+func (i Interval) Contains(n *big.Int) bool {
+	return !i.Empty() && i.Lower.Cmp(n) <= 0 && i.Upper.Cmp(n) >= 0
+}
+
+// Equal reports whether i and j contain the same values.
+func (i Interval) Equal(j Interval) bool {
+	if i.Empty() || j.Empty() {
+		return i.Empty() == j.Empty()
+	}
+	return i.Lower.Cmp(j.Lower) == 0 && i.Upper.Cmp(j.Upper) == 0
+}
+
+func (i Interval) String() string {
+	if i.Empty() {
+		return "[]"
+	}
+	return fmt.Sprintf("[%s, %s]", i.Lower, i.Upper)
+}
+
+// within reports whether j contains all values of i.
+func (i Interval) within(j Interval) bool {
+	return i.Empty() || !j.Empty() && i.Lower.Cmp(j.Lower) >= 0 && i.Upper.Cmp(j.Upper) <= 0
+}
+
+// Union returns the smallest interval containing both i and j.
+func (i Interval) Union(j Interval) Interval {
+	if i.Empty() {
+		return j
+	}
+	if j.Empty() {
+		return i
+	}
+	return Interval{minInt(i.Lower, j.Lower), maxInt(i.Upper, j.Upper)}
+}
+
+// Intersect returns the values contained in both i and j.
+func (i Interval) Intersect(j Interval) Interval {
+	if i.Empty() || j.Empty() {
+		return Interval{}
+	}
+	out := Interval{maxInt(i.Lower, j.Lower), minInt(i.Upper, j.Upper)}
+	if out.Empty() {
+		return Interval{}
+	}
+	return out
+}
+
+// NewInterval returns the interval [lower, upper].
+func NewInterval(lower, upper int64) Interval {
+	return Interval{big.NewInt(lower), big.NewInt(upper)}
+}
+
+func point(n *big.Int) Interval {
+	return Interval{n, n}
+}
+
+var (
+	maxInt64  = big.NewInt(1<<63 - 1)
+	minInt64  = big.NewInt(-1 << 63)
+	maxUint64 = new(big.Int).SetUint64(1<<64 - 1)
+	zero      = big.NewInt(0)
+	one       = big.NewInt(1)
+)
+
+// TypeInterval returns the range of values of typ, if it is an integer
+// type. int, uint and uintptr are assumed to be 64 bits wide.
+func TypeInterval(typ types.Type) (Interval, bool) {
+	basic, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		return Interval{}, false
+	}
+	switch basic.Kind() {
+	case types.Int8:
+		return NewInterval(-1<<7, 1<<7-1), true
+	case types.Int16:
+		return NewInterval(-1<<15, 1<<15-1), true
+	case types.Int32:
+		return NewInterval(-1<<31, 1<<31-1), true
+	case types.Int, types.Int64:
+		return Interval{minInt64, maxInt64}, true
+	case types.Uint8:
+		return NewInterval(0, 1<<8-1), true
+	case types.Uint16:
+		return NewInterval(0, 1<<16-1), true
+	case types.Uint32:
+		return NewInterval(0, 1<<32-1), true
+	case types.Uint, types.Uint64, types.Uintptr:
+		return Interval{zero, maxUint64}, true
+	default:
+		return Interval{}, false
+	}
+}
+
+// portableInterval returns the range of values of typ that it can
+// hold on all platforms, which for int, uint and uintptr is that of
+// their 32-bit variants.
+func portableInterval(typ types.Type) (Interval, bool) {
+	basic, ok := typ.Underlying().(*types.Basic)
+	if !ok {
+		return Interval{}, false
+	}
+	switch basic.Kind() {
+	case types.Int:
+		return TypeInterval(types.Typ[types.Int32])
+	case types.Uint, types.Uintptr:
+		return TypeInterval(types.Typ[types.Uint32])
+	default:
+		return TypeInterval(typ)
+	}
+}
+
+// anyLength is the range of the lengths of strings, slices, arrays,
+// maps and channels.
+var anyLength = Interval{zero, maxInt64}
+
+func minInt(a, b *big.Int) *big.Int {
+	if a.Cmp(b) <= 0 {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b *big.Int) *big.Int {
+	if a.Cmp(b) >= 0 {
+		return a
+	}
+	return b
+}
+
+// hull returns the smallest interval containing all of ns.
+func hull(ns ...*big.Int) Interval {
+	out := point(ns[0])
+	for _, n := range ns[1:] {
+		out = out.Union(point(n))
+	}
+	return out
+}
+
+func add(a, b Interval) Interval {
+	return Interval{new(big.Int).Add(a.Lower, b.Lower), new(big.Int).Add(a.Upper, b.Upper)}
+}
+
+func sub(a, b Interval) Interval {
+	return Interval{new(big.Int).Sub(a.Lower, b.Upper), new(big.Int).Sub(a.Upper, b.Lower)}
+}
+
+func mul(a, b Interval) Interval {
+	return hull(
+		new(big.Int).Mul(a.Lower, b.Lower),
+		new(big.Int).Mul(a.Lower, b.Upper),
+		new(big.Int).Mul(a.Upper, b.Lower),
+		new(big.Int).Mul(a.Upper, b.Upper),
+	)
+}
+
+// quo computes the truncated quotient a/b, ignoring division by zero.
+func quo(a, b Interval) Interval {
+	// The extremes of the quotient are found at the bounds of the
+	// dividend and the divisor values closest to zero on either
+	// side of it.
+	var divisors []*big.Int
+	if b.Lower.Sign() < 0 {
+		divisors = append(divisors, b.Lower, minInt(b.Upper, big.NewInt(-1)))
+	}
+	if b.Upper.Sign() > 0 {
+		divisors = append(divisors, b.Upper, maxInt(b.Lower, one))
+	}
+	if len(divisors) == 0 {
+		return Interval{}
+	}
+	var ns []*big.Int
+	for _, d := range divisors {
+		ns = append(ns, new(big.Int).Quo(a.Lower, d), new(big.Int).Quo(a.Upper, d))
+	}
+	return hull(ns...)
+}
+
+// rem computes the truncated remainder a%b, ignoring division by zero.
+func rem(a, b Interval) Interval {
+	// The remainder is smaller in magnitude than the divisor and has
+	// the sign of the dividend.
+	m := maxInt(new(big.Int).Abs(b.Lower), new(big.Int).Abs(b.Upper))
+	m = new(big.Int).Sub(m, one)
+	if m.Sign() < 0 {
+		return Interval{}
+	}
+	switch {
+	case a.Lower.Sign() >= 0:
+		return Interval{zero, minInt(m, a.Upper)}
+	case a.Upper.Sign() <= 0:
+		return Interval{maxInt(new(big.Int).Neg(m), a.Lower), zero}
+	default:
+		return Interval{new(big.Int).Neg(m), m}
+	}
+}
+
+func neg(a Interval) Interval {
+	return Interval{new(big.Int).Neg(a.Upper), new(big.Int).Neg(a.Lower)}
+}
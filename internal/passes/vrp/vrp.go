@@ -0,0 +1,649 @@
+// Package vrp defines an Analyzer that computes the ranges of the
+// integer values in the functions of a package. It does not report
+// any diagnostics itself but may be used as an input to other
+// analyzers.
+//
+// The analysis is an interval analysis on the IR. It uses the σ-nodes
+// that the IR places after branches to learn about values from the
+// conditions that have been checked, so that in
+//
+//	if x < 10 {
+//		return x
+//	}
+//
+// the returned value is known to be less than 10.
+//
+// THIS INTERFACE IS EXPERIMENTAL AND MAY BE SUBJECT TO INCOMPATIBLE CHANGE.
+package vrp
+
+import (
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math/big"
+	"reflect"
+
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/types/typeutil"
+	"honnef.co/go/tools/internal/passes/buildir"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name:       "vrp",
+	Doc:        "compute the ranges of integer values",
+	Run:        run,
+	Requires:   []*analysis.Analyzer{buildir.Analyzer},
+	ResultType: reflect.TypeOf(new(Ranges)),
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	r := &Ranges{intervals: map[ir.Value]Interval{}, lengths: map[ir.Value]Interval{}}
+	for _, fn := range pass.ResultOf[buildir.Analyzer].(*buildir.IR).SrcFuncs {
+		r.compute(fn)
+	}
+	return r, nil
+}
+
+const (
+	// widenAfter is the number of times a φ-node may grow before
+	// its growing bounds are widened to the bounds of its type.
+	widenAfter = 3
+	// maxRounds limits the number of rounds spent looking for a
+	// fixed point. It is never reached in practice.
+	maxRounds = 100
+	// narrowRounds is the number of rounds spent recovering
+	// precision lost to widening.
+	narrowRounds = 2
+)
+
+// Ranges holds the ranges of the integer values of a set of
+// functions.
+type Ranges struct {
+	intervals map[ir.Value]Interval
+	// lengths holds the ranges of the lengths of slices and strings.
+	lengths map[ir.Value]Interval
+}
+
+// Compute computes the ranges of the integer values of fn.
+func Compute(fn *ir.Function) *Ranges {
+	r := &Ranges{intervals: map[ir.Value]Interval{}, lengths: map[ir.Value]Interval{}}
+	r.compute(fn)
+	return r
+}
+
+// Get returns the range of v. It returns false if v isn't an integer.
+//
+// The range of an integer that isn't computed by an instruction of an
+// analyzed function, such as a parameter, is the range of its type.
+func (r *Ranges) Get(v ir.Value) (Interval, bool) {
+	if k, ok := v.(*ir.Const); ok {
+		return constInterval(k)
+	}
+	if i, ok := r.intervals[v]; ok {
+		return i, true
+	}
+	return TypeInterval(v.Type())
+}
+
+func (r *Ranges) get(v ir.Value) Interval {
+	i, _ := r.Get(v)
+	return i
+}
+
+func constInterval(k *ir.Const) (Interval, bool) {
+	typ, ok := TypeInterval(k.Type())
+	if !ok {
+		return Interval{}, false
+	}
+	if k.Value == nil {
+		return point(zero), true
+	}
+	switch n := constant.Val(constant.ToInt(k.Value)).(type) {
+	case int64:
+		return point(big.NewInt(n)), true
+	case *big.Int:
+		return point(n), true
+	default:
+		return typ, true
+	}
+}
+
+// Len returns the range of the length of v, which must be a string,
+// slice, array, pointer to array, map or channel.
+func (r *Ranges) Len(v ir.Value) Interval {
+	switch T := typeutil.CoreType(v.Type()).(type) {
+	case *types.Array:
+		return point(big.NewInt(T.Len()))
+	case *types.Pointer:
+		if T, ok := T.Elem().Underlying().(*types.Array); ok {
+			return point(big.NewInt(T.Len()))
+		}
+	}
+	if k, ok := v.(*ir.Const); ok {
+		return constLen(k)
+	}
+	if i, ok := r.lengths[v]; ok {
+		return i
+	}
+	return anyLength
+}
+
+func constLen(k *ir.Const) Interval {
+	if k.Value == nil {
+		return point(zero)
+	}
+	if k.Value.Kind() == constant.String {
+		return point(big.NewInt(int64(len(constant.StringVal(k.Value)))))
+	}
+	return anyLength
+}
+
+// hasLength reports whether we track the lengths of values of type T.
+func hasLength(T types.Type) bool {
+	switch T := typeutil.CoreType(T).(type) {
+	case *types.Slice:
+		return true
+	case *types.Basic:
+		return T.Info()&types.IsString != 0
+	default:
+		return false
+	}
+}
+
+// evalLen computes the range of the length of v from the current
+// ranges of its operands.
+func (r *Ranges) evalLen(v ir.Value) Interval {
+	switch v := v.(type) {
+	case *ir.Const:
+		return constLen(v)
+	case *ir.MakeSlice:
+		return r.get(v.Len).Intersect(anyLength)
+	case *ir.Slice:
+		var hi Interval
+		if v.High != nil {
+			hi = r.get(v.High)
+		} else {
+			hi = r.Len(v.X)
+		}
+		lo := point(zero)
+		if v.Low != nil {
+			lo = r.get(v.Low)
+		}
+		if hi.Empty() || lo.Empty() {
+			return Interval{}
+		}
+		return sub(hi, lo).Intersect(anyLength)
+	case *ir.Phi:
+		var out Interval
+		for _, e := range v.Edges {
+			out = out.Union(r.Len(e))
+		}
+		return out
+	case *ir.Sigma:
+		return r.Len(v.X)
+	case *ir.Copy:
+		return r.Len(v.X)
+	case *ir.ChangeType:
+		return r.Len(v.X)
+	case *ir.Convert:
+		// Conversions between strings and byte slices preserve the
+		// length.
+		if isString(v.Type()) && isBytes(v.X.Type()) || isBytes(v.Type()) && isString(v.X.Type()) {
+			return r.Len(v.X)
+		}
+	}
+	return anyLength
+}
+
+// Decide returns the outcome of the integer comparison cond, if the
+// ranges of its operands determine it.
+func (r *Ranges) Decide(cond *ir.BinOp) (outcome bool, ok bool) {
+	x, ok1 := r.Get(cond.X)
+	y, ok2 := r.Get(cond.Y)
+	if !ok1 || !ok2 || x.Empty() || y.Empty() {
+		return false, false
+	}
+	switch cond.Op {
+	case token.LSS:
+		return compare(x, y, false)
+	case token.LEQ:
+		return compare(x, y, true)
+	case token.GTR:
+		return compare(y, x, false)
+	case token.GEQ:
+		return compare(y, x, true)
+	case token.EQL, token.NEQ:
+		if x.Intersect(y).Empty() {
+			return cond.Op == token.NEQ, true
+		}
+		c1, ok1 := x.Const()
+		c2, ok2 := y.Const()
+		if ok1 && ok2 && c1.Cmp(c2) == 0 {
+			return cond.Op == token.EQL, true
+		}
+	}
+	return false, false
+}
+
+// compare decides x < y, or x <= y if orEqual is true.
+func compare(x, y Interval, orEqual bool) (outcome bool, ok bool) {
+	if orEqual {
+		if x.Upper.Cmp(y.Lower) <= 0 {
+			return true, true
+		}
+		if x.Lower.Cmp(y.Upper) > 0 {
+			return false, true
+		}
+	} else {
+		if x.Upper.Cmp(y.Lower) < 0 {
+			return true, true
+		}
+		if x.Lower.Cmp(y.Upper) >= 0 {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// Dead reports whether b never executes because it is dominated by
+// the branch of a comparison that is decided against it.
+func (r *Ranges) Dead(b *ir.BasicBlock) bool {
+	for {
+		if r.deadEdge(b) {
+			return true
+		}
+		// The entry block is its own immediate dominator.
+		idom := b.Idom()
+		if idom == nil || idom == b {
+			return false
+		}
+		b = idom
+	}
+}
+
+// deadEdge reports whether b has a single predecessor whose branch to
+// b is never taken.
+func (r *Ranges) deadEdge(b *ir.BasicBlock) bool {
+	if len(b.Preds) != 1 {
+		return false
+	}
+	pred := b.Preds[0]
+	ifInstr, ok := pred.Control().(*ir.If)
+	if !ok || pred.Succs[0] == pred.Succs[1] {
+		return false
+	}
+	cond, ok := ifInstr.Cond.(*ir.BinOp)
+	if !ok {
+		return false
+	}
+	outcome, ok := r.Decide(cond)
+	return ok && (b == pred.Succs[0]) != outcome
+}
+
+func isString(T types.Type) bool {
+	basic, ok := T.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsString != 0
+}
+
+func isBytes(T types.Type) bool {
+	s, ok := T.Underlying().(*types.Slice)
+	if !ok {
+		return false
+	}
+	basic, ok := s.Elem().Underlying().(*types.Basic)
+	return ok && basic.Kind() == types.Byte
+}
+
+func (r *Ranges) compute(fn *ir.Function) {
+	// We compute the ranges of integers and of the lengths of slices
+	// and strings at the same time, as they depend on each other.
+	var values []ir.Value
+	for _, b := range fn.DomPreorder() {
+		for _, instr := range b.Instrs {
+			v, ok := instr.(ir.Value)
+			if !ok {
+				continue
+			}
+			if m := r.slot(v); m != nil {
+				values = append(values, v)
+				m[v] = Interval{}
+			}
+		}
+	}
+
+	// Find the least fixed point, starting from empty intervals.
+	// Ranges only ever grow, and the φ-nodes of loop headers that keep
+	// growing are widened, which guarantees termination for reducible
+	// control flow. Every cycle in the data flow passes through such a
+	// φ-node.
+	updates := map[*ir.Phi]int{}
+	converged := false
+	for i := 0; i < maxRounds && !converged; i++ {
+		converged = true
+		for _, v := range values {
+			m := r.slot(v)
+			old := m[v]
+			cur := old.Union(r.evalSlot(v))
+			if cur.Equal(old) {
+				continue
+			}
+			if phi, ok := v.(*ir.Phi); ok && isLoopHeader(phi.Block()) {
+				updates[phi]++
+				if updates[phi] > widenAfter {
+					cur = widen(old, cur, r.top(v))
+				}
+			}
+			m[v] = cur
+			converged = false
+		}
+	}
+	if !converged {
+		for _, v := range values {
+			r.slot(v)[v] = r.top(v)
+		}
+		return
+	}
+
+	// Reevaluating values of a fixed point that was reached by
+	// widening can only shrink their ranges, without going past the
+	// least fixed point.
+	for i := 0; i < narrowRounds; i++ {
+		for _, v := range values {
+			r.slot(v)[v] = r.evalSlot(v)
+		}
+	}
+}
+
+// slot returns the map that holds the range we track for v, if any.
+func (r *Ranges) slot(v ir.Value) map[ir.Value]Interval {
+	if _, ok := TypeInterval(v.Type()); ok {
+		return r.intervals
+	}
+	if hasLength(v.Type()) {
+		return r.lengths
+	}
+	return nil
+}
+
+func (r *Ranges) evalSlot(v ir.Value) Interval {
+	if _, ok := TypeInterval(v.Type()); ok {
+		return r.eval(v)
+	}
+	return r.evalLen(v)
+}
+
+// top returns the range that describes any value v may take on.
+func (r *Ranges) top(v ir.Value) Interval {
+	if typ, ok := TypeInterval(v.Type()); ok {
+		return typ
+	}
+	return anyLength
+}
+
+// isLoopHeader reports whether b is the target of a back edge.
+func isLoopHeader(b *ir.BasicBlock) bool {
+	for _, pred := range b.Preds {
+		if b.Dominates(pred) {
+			return true
+		}
+	}
+	return false
+}
+
+// widen returns cur, with the bounds that grew compared to old moved
+// towards the bounds of the value's type.
+//
+// Bounds are first moved to one short of the type's bounds, which
+// keeps loops that increment or decrement their induction variables
+// before checking them from overflowing on paper.
+func widen(old, cur, typ Interval) Interval {
+	if old.Empty() || cur.Empty() {
+		return cur
+	}
+	out := cur
+	if cur.Lower.Cmp(old.Lower) < 0 {
+		out.Lower = typ.Lower
+		if t := new(big.Int).Add(typ.Lower, one); cur.Lower.Cmp(t) > 0 {
+			out.Lower = t
+		}
+	}
+	if cur.Upper.Cmp(old.Upper) > 0 {
+		out.Upper = typ.Upper
+		if t := new(big.Int).Sub(typ.Upper, one); cur.Upper.Cmp(t) < 0 {
+			out.Upper = t
+		}
+	}
+	return out
+}
+
+// fit returns i if the type's range contains it, and the type's range
+// otherwise, which models integer overflow.
+func fit(i, typ Interval) Interval {
+	if i.Empty() || i.within(typ) {
+		return i
+	}
+	return typ
+}
+
+// eval computes the range of v from the current ranges of its
+// operands.
+func (r *Ranges) eval(v ir.Value) Interval {
+	typ, _ := TypeInterval(v.Type())
+	switch v := v.(type) {
+	case *ir.Const:
+		i, _ := constInterval(v)
+		return i
+	case *ir.Phi:
+		var out Interval
+		for _, e := range v.Edges {
+			out = out.Union(r.get(e))
+		}
+		return out
+	case *ir.Sigma:
+		return r.sigma(v)
+	case *ir.Copy:
+		x := r.get(v.X)
+		if v.Info&ir.CopyInfoNotNegative != 0 {
+			x = x.Intersect(Interval{zero, typ.Upper})
+		}
+		return x
+	case *ir.ChangeType:
+		return r.get(v.X)
+	case *ir.Convert:
+		x, ok := r.Get(v.X)
+		if !ok {
+			return typ
+		}
+		// Whether a conversion to int preserves the value depends on
+		// the platform, and we don't want to report problems that
+		// only exist on some platforms.
+		portable, _ := portableInterval(v.Type())
+		if !x.Empty() && !x.within(portable) {
+			return typ
+		}
+		return x
+	case *ir.UnOp:
+		if v.Op != token.SUB {
+			return typ
+		}
+		x := r.get(v.X)
+		if x.Empty() {
+			return x
+		}
+		return fit(neg(x), typ)
+	case *ir.BinOp:
+		return r.binOp(v, typ)
+	case *ir.Call:
+		builtin, ok := v.Call.Value.(*ir.Builtin)
+		if !ok {
+			return typ
+		}
+		switch builtin.Name() {
+		case "len":
+			return r.Len(v.Call.Args[0]).Intersect(typ)
+		case "cap":
+			switch typeutil.CoreType(typeutil.Dereference(v.Call.Args[0].Type())).(type) {
+			case *types.Array:
+				return r.Len(v.Call.Args[0]).Intersect(typ)
+			}
+			return anyLength.Intersect(typ)
+		}
+	}
+	return typ
+}
+
+func (r *Ranges) binOp(v *ir.BinOp, typ Interval) Interval {
+	x, y := r.get(v.X), r.get(v.Y)
+	if x.Empty() || y.Empty() {
+		return Interval{}
+	}
+	var out Interval
+	switch v.Op {
+	case token.ADD:
+		out = add(x, y)
+	case token.SUB:
+		out = sub(x, y)
+	case token.MUL:
+		out = mul(x, y)
+	case token.QUO:
+		out = quo(x, y)
+	case token.REM:
+		out = rem(x, y)
+	case token.AND:
+		// The result of a bitwise and is no larger than its
+		// non-negative operands.
+		switch {
+		case x.Lower.Sign() >= 0 && y.Lower.Sign() >= 0:
+			out = Interval{zero, minInt(x.Upper, y.Upper)}
+		case x.Lower.Sign() >= 0:
+			out = Interval{zero, x.Upper}
+		case y.Lower.Sign() >= 0:
+			out = Interval{zero, y.Upper}
+		default:
+			return typ
+		}
+	case token.SHR:
+		if x.Lower.Sign() < 0 || y.Lower.Sign() < 0 {
+			return typ
+		}
+		shift := func(n *big.Int) uint {
+			if n.Cmp(big.NewInt(64)) > 0 {
+				return 64
+			}
+			return uint(n.Uint64())
+		}
+		out = Interval{new(big.Int).Rsh(x.Lower, shift(y.Upper)), new(big.Int).Rsh(x.Upper, shift(y.Lower))}
+	default:
+		return typ
+	}
+	return fit(out, typ)
+}
+
+// sigma computes the range of a σ-node, which is the range of the
+// value it splits, restricted by the outcome of the comparison that
+// led to its block.
+func (r *Ranges) sigma(sigma *ir.Sigma) Interval {
+	x := r.get(sigma.X)
+	if x.Empty() {
+		return x
+	}
+	ifInstr, ok := sigma.From.Control().(*ir.If)
+	if !ok {
+		return x
+	}
+	cond, ok := ifInstr.Cond.(*ir.BinOp)
+	if !ok {
+		return x
+	}
+	succs := sigma.From.Succs
+	if succs[0] == succs[1] {
+		return x
+	}
+
+	// Normalize the condition to the form 'sigma.X op y'.
+	op := cond.Op
+	var y ir.Value
+	switch sigma.X {
+	case cond.X:
+		y = cond.Y
+	case cond.Y:
+		y = cond.X
+		op = flip(op)
+	default:
+		return x
+	}
+	if sigma.Block() == succs[1] {
+		op = negate(op)
+	}
+	yi, ok := r.Get(y)
+	if !ok {
+		return x
+	}
+	if yi.Empty() {
+		return yi
+	}
+
+	switch op {
+	case token.LSS:
+		return x.Intersect(Interval{x.Lower, new(big.Int).Sub(yi.Upper, one)})
+	case token.LEQ:
+		return x.Intersect(Interval{x.Lower, yi.Upper})
+	case token.GTR:
+		return x.Intersect(Interval{new(big.Int).Add(yi.Lower, one), x.Upper})
+	case token.GEQ:
+		return x.Intersect(Interval{yi.Lower, x.Upper})
+	case token.EQL:
+		return x.Intersect(yi)
+	case token.NEQ:
+		c, ok := yi.Const()
+		if !ok {
+			return x
+		}
+		if x.Lower.Cmp(c) == 0 {
+			return x.Intersect(Interval{new(big.Int).Add(c, one), x.Upper})
+		}
+		if x.Upper.Cmp(c) == 0 {
+			return x.Intersect(Interval{x.Lower, new(big.Int).Sub(c, one)})
+		}
+	}
+	return x
+}
+
+// flip returns the operator op' such that 'y op' x' is equivalent to
+// 'x op y'.
+func flip(op token.Token) token.Token {
+	switch op {
+	case token.LSS:
+		return token.GTR
+	case token.LEQ:
+		return token.GEQ
+	case token.GTR:
+		return token.LSS
+	case token.GEQ:
+		return token.LEQ
+	default:
+		return op
+	}
+}
+
+// negate returns the operator that negates the comparison op.
+func negate(op token.Token) token.Token {
+	switch op {
+	case token.LSS:
+		return token.GEQ
+	case token.LEQ:
+		return token.GTR
+	case token.GTR:
+		return token.LEQ
+	case token.GEQ:
+		return token.LSS
+	case token.EQL:
+		return token.NEQ
+	case token.NEQ:
+		return token.EQL
+	default:
+		return op
+	}
+}
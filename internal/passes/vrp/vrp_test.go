@@ -0,0 +1,125 @@
+package vrp_test
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/ir/irutil"
+	"honnef.co/go/tools/internal/passes/vrp"
+)
+
+const src = `package pkg
+
+func sink(int) {}
+
+func branch(x int) {
+	if x >= 0 && x < 10 {
+		sink(x)
+	}
+}
+
+func loop() {
+	for i := 0; i < 10; i++ {
+		sink(i)
+	}
+}
+
+func rangeLoop(s []int) {
+	for i := range s {
+		sink(i)
+	}
+}
+
+func countdown(n uint8) {
+	for n > 0 {
+		n--
+		sink(int(n))
+	}
+}
+
+func arith(x uint8) {
+	sink(int(x)*2 + 1)
+}
+
+func overflow(x uint8) {
+	sink(int(x + 1))
+}
+
+func rem(x int) {
+	sink(x % 4)
+}
+
+func neq(x uint8) {
+	if x != 0 {
+		sink(int(x))
+	}
+}
+
+func length(b bool) {
+	s := make([]int, 3)
+	if b {
+		s = s[1:]
+	}
+	sink(len(s))
+}
+
+func cmp(x, y int) {
+	if y < 5 && x < y {
+		sink(x)
+	}
+}
+`
+
+// TestRanges checks the ranges of the arguments to sink.
+func TestRanges(t *testing.T) {
+	want := map[string]string{
+		"branch":    "[0, 9]",
+		"loop":      "[0, 9]",
+		"rangeLoop": "[0, 9223372036854775806]",
+		"countdown": "[0, 254]",
+		"arith":     "[1, 511]",
+		"overflow":  "[0, 255]",
+		"rem":       "[-3, 3]",
+		"neq":       "[1, 255]",
+		"length":    "[2, 3]",
+		"cmp":       "[-9223372036854775808, 3]",
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "pkg.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, _, err := irutil.BuildPackage(&types.Config{Importer: importer.Default()}, fset, types.NewPackage("pkg", ""), []*ast.File{f}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, exp := range want {
+		fn := pkg.Func(name)
+		r := vrp.Compute(fn)
+		var found bool
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				call, ok := instr.(*ir.Call)
+				if !ok || call.Common().StaticCallee() != pkg.Func("sink") {
+					continue
+				}
+				found = true
+				got, ok := r.Get(call.Common().Args[0])
+				if !ok {
+					t.Errorf("%s: argument isn't an integer", name)
+				} else if got.String() != exp {
+					t.Errorf("%s: got %s, want %s", name, got, exp)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s: didn't find call to sink", name)
+		}
+	}
+}
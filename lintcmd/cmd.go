@@ -1,21 +1,30 @@
 // Package lintcmd implements the frontend of an analysis runner.
 // It serves as the entry-point for the staticcheck command, and can also be used to implement custom linters that behave like staticcheck.
+//
+// Programs that want to process diagnostics themselves, instead of
+// printing them, can use Lint. Unlike Command, Lint never terminates
+// the process.
 package lintcmd
 
 import (
 	"bufio"
+	"context"
 	"encoding/gob"
 	"flag"
 	"fmt"
 	"go/token"
 	"io"
+	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,6 +32,7 @@ import (
 	"honnef.co/go/tools/analysis/lint"
 	"honnef.co/go/tools/config"
 	"honnef.co/go/tools/go/loader"
+	"honnef.co/go/tools/lintcmd/runner"
 	"honnef.co/go/tools/lintcmd/version"
 
 	"golang.org/x/tools/go/analysis"
@@ -42,6 +52,11 @@ type Command struct {
 	version        string
 	machineVersion string
 
+	timeline *timeline
+	// If set, only diagnostics in this file are reported, see
+	// -stdin-filename.
+	onlyFile string
+
 	flags struct {
 		fs *flag.FlagSet
 
@@ -49,6 +64,12 @@ type Command struct {
 		tests       bool
 		showIgnored bool
 		formatter   string
+		stream      bool
+		progress    string
+
+		stdinFilename string
+		modified      bool
+		allModules    bool
 
 		// mutually exclusive mode flags
 		explain      string
@@ -56,7 +77,7 @@ type Command struct {
 		listChecks   bool
 		merge        bool
 
-		matrix bool
+		matrix matrixFlag
 
 		debugCpuprofile       string
 		debugMemprofile       string
@@ -64,10 +85,17 @@ type Command struct {
 		debugNoCompileErrors  bool
 		debugMeasureAnalyzers string
 		debugTrace            string
+		debugTimeline         string
+
+		debugSummarizeMeasurements bool
+		debugTop                   int
 
 		checks    list
 		fail      list
 		goVersion versionFlag
+		maxMemory memoryFlag
+
+		analyzerTimeout time.Duration
 	}
 }
 
@@ -141,11 +169,16 @@ func (cmd *Command) initFlagSet(name string) {
 	flags.BoolVar(&cmd.flags.tests, "tests", true, "Include tests")
 	flags.BoolVar(&cmd.flags.printVersion, "version", false, "Print version and exit")
 	flags.BoolVar(&cmd.flags.showIgnored, "show-ignored", false, "Don't filter ignored diagnostics")
-	flags.StringVar(&cmd.flags.formatter, "f", "text", "Output `format` (valid choices are 'stylish', 'text' and 'json')")
+	flags.StringVar(&cmd.flags.formatter, "f", "text", "Output `format` (valid choices are 'stylish', 'text', 'pretty', 'json', 'jsonl', 'summary', 'summary-json' and 'matrix-report')")
+	flags.BoolVar(&cmd.flags.stream, "stream", false, "Print diagnostics as soon as packages have been processed, instead of sorting all of them first. Implied by -f jsonl")
 	flags.StringVar(&cmd.flags.explain, "explain", "", "Print description of `check`")
+	flags.StringVar(&cmd.flags.progress, "progress", "", "Display progress on stderr (valid choices are 'tty' and 'json')")
 	flags.BoolVar(&cmd.flags.listChecks, "list-checks", false, "List all available checks")
-	flags.BoolVar(&cmd.flags.merge, "merge", false, "Merge results of multiple Staticcheck runs")
-	flags.BoolVar(&cmd.flags.matrix, "matrix", false, "Read a build config matrix from stdin")
+	flags.BoolVar(&cmd.flags.merge, "merge", false, "Merge results of multiple Staticcheck runs and SARIF files of other tools")
+	flags.Var(&cmd.flags.matrix, "matrix", "Read a build config matrix from stdin, or derive one from build constraints with -matrix=auto")
+	flags.StringVar(&cmd.flags.stdinFilename, "stdin-filename", "", "Read the contents of `file` from stdin and only report problems in it. Checks the file's package if no packages are specified")
+	flags.BoolVar(&cmd.flags.allModules, "all-modules", false, "Check every module below the current directory, resolving patterns relative to each module")
+	flags.BoolVar(&cmd.flags.modified, "modified", false, "Read an archive of modified files from stdin, in the format used by guru")
 
 	flags.StringVar(&cmd.flags.debugCpuprofile, "debug.cpuprofile", "", "Write CPU profile to `file`")
 	flags.StringVar(&cmd.flags.debugMemprofile, "debug.memprofile", "", "Write memory profile to `file`")
@@ -153,6 +186,9 @@ func (cmd *Command) initFlagSet(name string) {
 	flags.BoolVar(&cmd.flags.debugNoCompileErrors, "debug.no-compile-errors", false, "Don't print compile errors")
 	flags.StringVar(&cmd.flags.debugMeasureAnalyzers, "debug.measure-analyzers", "", "Write analysis measurements to `file`. `file` will be opened for appending if it already exists.")
 	flags.StringVar(&cmd.flags.debugTrace, "debug.trace", "", "Write trace to `file`")
+	flags.StringVar(&cmd.flags.debugTimeline, "debug.timeline", "", "Write a timeline of packages and analyzers to `file`, in the Chrome trace event format")
+	flags.BoolVar(&cmd.flags.debugSummarizeMeasurements, "debug.summarize-measurements", false, "Summarize the output of -debug.measure-analyzers, read from the files named as arguments or from stdin")
+	flags.IntVar(&cmd.flags.debugTop, "debug.top", 10, "Number of entries to print with -debug.summarize-measurements")
 
 	cmd.flags.checks = list{"inherit"}
 	cmd.flags.fail = list{"all"}
@@ -160,6 +196,8 @@ func (cmd *Command) initFlagSet(name string) {
 	flags.Var(&cmd.flags.checks, "checks", "Comma-separated list of `checks` to enable.")
 	flags.Var(&cmd.flags.fail, "fail", "Comma-separated list of `checks` that can cause a non-zero exit status.")
 	flags.Var(&cmd.flags.goVersion, "go", "Target Go `version` in the format '1.x', or the literal 'module' to use the module's Go version")
+	flags.Var(&cmd.flags.maxMemory, "max-memory", "Approximate memory `limit`, such as 4GiB. Parallelism is reduced to stay below it")
+	flags.DurationVar(&cmd.flags.analyzerTimeout, "analyzer-timeout", 0, "Abandon analyzers that spend more than `duration` on a single package")
 }
 
 type list []string
@@ -201,6 +239,107 @@ func (v *versionFlag) Set(s string) error {
 	return nil
 }
 
+// matrixFlag selects the source of the build matrix. It can be used
+// like a boolean flag, which means that modes have to be specified as
+// -matrix=mode. See checkMatrixArgs.
+type matrixFlag string
+
+const (
+	matrixNone  matrixFlag = ""
+	matrixStdin matrixFlag = "stdin"
+	matrixAuto  matrixFlag = "auto"
+)
+
+func (m *matrixFlag) IsBoolFlag() bool { return true }
+
+func (m *matrixFlag) String() string {
+	if m == nil || *m == matrixNone {
+		return "false"
+	}
+	if *m == matrixStdin {
+		return "true"
+	}
+	return string(*m)
+}
+
+func (m *matrixFlag) Set(s string) error {
+	if s == string(matrixAuto) {
+		*m = matrixAuto
+		return nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("must be a boolean or 'auto'")
+	}
+	if b {
+		*m = matrixStdin
+	} else {
+		*m = matrixNone
+	}
+	return nil
+}
+
+// checkMatrixArgs rejects -matrix being followed by a separate mode,
+// as in -matrix auto. Because -matrix is a boolean flag, the flag
+// package would otherwise read a build matrix from stdin and treat
+// the mode as a pattern.
+func checkMatrixArgs(m matrixFlag, args []string) error {
+	if m == matrixStdin && len(args) > 0 && args[0] == string(matrixAuto) {
+		return fmt.Errorf("-matrix doesn't take a separate argument, use -matrix=%s", args[0])
+	}
+	return nil
+}
+
+// memoryFlag is an amount of memory in bytes. It uses the same
+// syntax as the GOMEMLIMIT environment variable: an integer, with an
+// optional unit suffix of B, KiB, MiB, GiB or TiB.
+type memoryFlag uint64
+
+var memoryUnits = []struct {
+	suffix string
+	factor uint64
+}{
+	{"TiB", 1 << 40},
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"B", 1},
+}
+
+func (v *memoryFlag) String() string {
+	n := uint64(*v)
+	if n == 0 {
+		return "0"
+	}
+	for _, u := range memoryUnits {
+		if n%u.factor == 0 {
+			return fmt.Sprintf("%d%s", n/u.factor, u.suffix)
+		}
+	}
+	panic("unreachable")
+}
+
+func (v *memoryFlag) Set(s string) error {
+	factor := uint64(1)
+	num := s
+	for _, u := range memoryUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			factor = u.factor
+			num = strings.TrimSuffix(s, u.suffix)
+			break
+		}
+	}
+	n, err := strconv.ParseUint(num, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid memory limit %q", s)
+	}
+	if n > math.MaxUint64/factor {
+		return fmt.Errorf("memory limit %q is too large", s)
+	}
+	*v = memoryFlag(n * factor)
+	return nil
+}
+
 // ParseFlags parses command line flags.
 // It must be called before calling Run.
 // After calling ParseFlags, the values of flags can be accessed.
@@ -220,7 +359,7 @@ type diagnosticDescriptor struct {
 	Message  string
 }
 
-func (diag diagnostic) descriptor() diagnosticDescriptor {
+func (diag Diagnostic) descriptor() diagnosticDescriptor {
 	return diagnosticDescriptor{
 		Position: diag.Position,
 		End:      diag.End,
@@ -230,14 +369,16 @@ func (diag diagnostic) descriptor() diagnosticDescriptor {
 }
 
 type run struct {
+	name         string
 	checkedFiles map[string]struct{}
-	diagnostics  map[diagnosticDescriptor]diagnostic
+	diagnostics  map[diagnosticDescriptor]Diagnostic
 }
 
 func runFromLintResult(res LintResult) run {
 	out := run{
+		name:         res.BuildName,
 		checkedFiles: map[string]struct{}{},
-		diagnostics:  map[diagnosticDescriptor]diagnostic{},
+		diagnostics:  map[diagnosticDescriptor]Diagnostic{},
 	}
 
 	for _, cf := range res.CheckedFiles {
@@ -249,6 +390,109 @@ func runFromLintResult(res LintResult) run {
 	return out
 }
 
+// autoMatrix derives the build matrix for the packages matched by
+// patterns in dir, for -matrix=auto. Prefix identifies the module in
+// messages.
+func (cmd *Command) autoMatrix(dir string, env []string, patterns []string, prefix string) []BuildConfig {
+	bconfs, uncovered, err := discoverMatrix(dir, env, patterns, cmd.flags.tests)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, prefix+"couldn't derive build matrix:", err)
+		cmd.exit(1)
+	}
+	for _, path := range uncovered {
+		fmt.Fprintf(os.Stderr, "warning: no build configuration includes %s\n", shortPath(path))
+	}
+	if len(bconfs) == 0 {
+		fmt.Fprintln(os.Stderr, prefix+"couldn't derive build matrix: no build configuration includes any files")
+		cmd.exit(1)
+	}
+	// Print the matrix so that it can be saved and used with
+	// -matrix in the future.
+	if prefix != "" {
+		fmt.Fprintf(os.Stderr, "# build matrix chosen by -matrix=auto for %s\n", shortPath(dir))
+	} else {
+		fmt.Fprintln(os.Stderr, "# build matrix chosen by -matrix=auto")
+	}
+	writeBuildConfigs(os.Stderr, bconfs)
+	return bconfs
+}
+
+// readOverlay reads the files specified by -stdin-filename or
+// -modified from stdin. It returns the overlay and the patterns to
+// check.
+func (cmd *Command) readOverlay(patterns []string) (map[string][]byte, []string, error) {
+	if cmd.flags.modified {
+		archive, err := buildutil.ParseOverlayArchive(os.Stdin)
+		if err != nil {
+			return nil, nil, err
+		}
+		// go/packages requires absolute file names.
+		overlay := make(map[string][]byte, len(archive))
+		for name, b := range archive {
+			abs, err := filepath.Abs(name)
+			if err != nil {
+				return nil, nil, err
+			}
+			overlay[abs] = b
+		}
+		return overlay, patterns, nil
+	}
+
+	name, err := filepath.Abs(cmd.flags.stdinFilename)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.onlyFile = name
+	if len(patterns) == 0 {
+		// Check the package containing the file, and its test
+		// variants.
+		patterns = []string{"file=" + name}
+	}
+	return map[string][]byte{name: b}, patterns, nil
+}
+
+// lintResult converts r back to a LintResult.
+func (r run) lintResult() LintResult {
+	res := LintResult{
+		BuildName: r.name,
+	}
+	for f := range r.checkedFiles {
+		res.CheckedFiles = append(res.CheckedFiles, f)
+	}
+	sort.Strings(res.CheckedFiles)
+	for _, diag := range r.diagnostics {
+		res.Diagnostics = append(res.Diagnostics, diag)
+	}
+	sortDiagnostics(res.Diagnostics)
+	return res
+}
+
+// decodeRuns reads runs from r, which either contains the output of
+// '-f binary' or SARIF logs.
+func decodeRuns(r *bufio.Reader) ([]run, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			r.ReadByte()
+		case '{':
+			return decodeSarif(r)
+		default:
+			return decodeGob(r)
+		}
+	}
+}
+
 func decodeGob(br io.ByteReader) ([]run, error) {
 	var runs []run
 	for {
@@ -300,16 +544,19 @@ func (cmd *Command) Run() {
 		}
 		trace.Start(f)
 	}
+	if path := cmd.flags.debugTimeline; path != "" {
+		tl, err := newTimeline(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cmd.timeline = tl
+	}
 
-	defaultChecks := []string{"all"}
 	cs := make([]*lint.Analyzer, 0, len(cmd.analyzers))
 	for _, a := range cmd.analyzers {
 		cs = append(cs, a)
-		if a.Doc.NonDefault {
-			defaultChecks = append(defaultChecks, "-"+a.Analyzer.Name)
-		}
 	}
-	config.DefaultConfig.Checks = defaultChecks
+	config.DefaultConfig.Checks = defaultChecks(cs)
 
 	switch {
 	case cmd.flags.debugVersion:
@@ -330,6 +577,26 @@ func (cmd *Command) Run() {
 	case cmd.flags.printVersion:
 		version.Print(cmd.version, cmd.machineVersion)
 		cmd.exit(0)
+	case cmd.flags.debugSummarizeMeasurements:
+		var r io.Reader = os.Stdin
+		if args := cmd.flags.fs.Args(); len(args) > 0 {
+			readers := make([]io.Reader, 0, len(args))
+			for _, path := range args {
+				f, err := os.Open(path)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					cmd.exit(1)
+				}
+				defer f.Close()
+				readers = append(readers, f)
+			}
+			r = io.MultiReader(readers...)
+		}
+		if err := summarizeMeasurements(os.Stdout, r, cmd.flags.debugTop); err != nil {
+			fmt.Fprintln(os.Stderr, "couldn't summarize measurements:", err)
+			cmd.exit(1)
+		}
+		cmd.exit(0)
 	case cmd.flags.explain != "":
 		explain := cmd.flags.explain
 		check, ok := cmd.analyzers[explain]
@@ -348,7 +615,7 @@ func (cmd *Command) Run() {
 		var runs []run
 		if len(cmd.flags.fs.Args()) == 0 {
 			var err error
-			runs, err = decodeGob(bufio.NewReader(os.Stdin))
+			runs, err = decodeRuns(bufio.NewReader(os.Stdin))
 			if err != nil {
 				fmt.Fprintln(os.Stderr, fmt.Errorf("couldn't parse stdin: %s", err))
 				cmd.exit(1)
@@ -362,7 +629,7 @@ func (cmd *Command) Run() {
 					}
 					defer f.Close()
 					br := bufio.NewReader(f)
-					return decodeGob(br)
+					return decodeRuns(br)
 				}(path)
 				if err != nil {
 					fmt.Fprintln(os.Stderr, fmt.Errorf("couldn't parse file %s: %s", path, err))
@@ -372,23 +639,105 @@ func (cmd *Command) Run() {
 			}
 		}
 
+		if cmd.flags.formatter == "binary" {
+			// Write the runs unmerged, so that they can be merged
+			// with more runs in the future.
+			for _, r := range runs {
+				if err := gob.NewEncoder(os.Stdout).Encode(r.lintResult()); err != nil {
+					fmt.Fprintf(os.Stderr, "failed writing output: %s\n", err)
+					cmd.exit(2)
+				}
+			}
+			cmd.exit(0)
+		}
 		relevantDiagnostics := mergeRuns(runs)
-		cmd.printDiagnostics(cs, relevantDiagnostics)
+		cmd.printDiagnostics(cs, relevantDiagnostics, runs)
 	default:
 		switch cmd.flags.formatter {
-		case "text", "stylish", "json", "sarif", "binary", "null":
+		case "text", "stylish", "pretty", "json", "jsonl", "sarif", "binary", "null", "matrix-report", "summary", "summary-json":
 		default:
 			fmt.Fprintf(os.Stderr, "unsupported output format %q\n", cmd.flags.formatter)
 			cmd.exit(2)
 		}
+		stream := cmd.flags.stream || cmd.flags.formatter == "jsonl"
+		if stream {
+			switch cmd.flags.formatter {
+			case "text", "pretty", "json", "jsonl", "null":
+			default:
+				fmt.Fprintf(os.Stderr, "output format %q doesn't support streaming\n", cmd.flags.formatter)
+				cmd.exit(2)
+			}
+			if cmd.flags.matrix != matrixNone {
+				// Merging the results of multiple runs requires all
+				// runs to have finished.
+				fmt.Fprintln(os.Stderr, "cannot stream diagnostics when using -matrix")
+				cmd.exit(2)
+			}
+		}
+		switch cmd.flags.progress {
+		case "", "tty", "json":
+		default:
+			fmt.Fprintf(os.Stderr, "unsupported progress display %q\n", cmd.flags.progress)
+			cmd.exit(2)
+		}
 
-		var bconfs []BuildConfig
-		if cmd.flags.matrix {
-			if cmd.flags.tags != "" {
-				fmt.Fprintln(os.Stderr, "cannot use -matrix and -tags together")
+		if cmd.flags.matrix != matrixNone && cmd.flags.tags != "" {
+			fmt.Fprintln(os.Stderr, "cannot use -matrix and -tags together")
+			cmd.exit(2)
+		}
+		if err := checkMatrixArgs(cmd.flags.matrix, cmd.flags.fs.Args()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			cmd.exit(2)
+		}
+
+		patterns := cmd.flags.fs.Args()
+		var overlay map[string][]byte
+		if cmd.flags.stdinFilename != "" || cmd.flags.modified {
+			if cmd.flags.stdinFilename != "" && cmd.flags.modified {
+				fmt.Fprintln(os.Stderr, "cannot use -stdin-filename and -modified together")
 				cmd.exit(2)
 			}
+			if cmd.flags.matrix == matrixStdin {
+				fmt.Fprintln(os.Stderr, "cannot read both a build matrix and modified files from stdin")
+				cmd.exit(2)
+			}
+			var err error
+			overlay, patterns, err = cmd.readOverlay(patterns)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "couldn't read modified files:", err)
+				cmd.exit(1)
+			}
+		}
 
+		// The directories of the modules to check. The empty string
+		// stands for the current directory.
+		mods := []string{""}
+		// Additional environment variables for each module
+		var env []string
+		if cmd.flags.allModules {
+			var err error
+			mods, err = findModules(".")
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "couldn't find modules:", err)
+				cmd.exit(1)
+			}
+			if len(mods) == 0 {
+				fmt.Fprintln(os.Stderr, "no modules found")
+				cmd.exit(1)
+			}
+			if len(patterns) == 0 {
+				patterns = []string{"./..."}
+			}
+			// Check each module on its own, even if it is part of a
+			// workspace.
+			env = []string{"GOWORK=off"}
+		}
+
+		var bconfs []BuildConfig
+		switch cmd.flags.matrix {
+		case matrixAuto:
+			// Derived separately for each module
+		case matrixStdin:
 			var err error
 			bconfs, err = parseBuildConfigs(os.Stdin)
 			if err != nil {
@@ -399,7 +748,7 @@ func (cmd *Command) Run() {
 				}
 				os.Exit(2)
 			}
-		} else {
+		default:
 			bc := BuildConfig{}
 			if cmd.flags.tags != "" {
 				// Validate that the tags argument is well-formed. go/packages
@@ -416,69 +765,162 @@ func (cmd *Command) Run() {
 			bconfs = append(bconfs, bc)
 		}
 
+		var sp *streamPrinter
+		if stream {
+			sp = cmd.newStreamPrinter(cs)
+		}
+
+		progress := newProgressReporter(cmd.flags.progress, os.Stderr)
 		var runs []run
-		for _, bconf := range bconfs {
-			res, err := doLint(cs, cmd.flags.fs.Args(), &options{
-				BuildConfig: bconf,
-				LintTests:   cmd.flags.tests,
-				GoVersion:   string(cmd.flags.goVersion),
-				Config: config.Config{
-					Checks: cmd.flags.checks,
-				},
-				PrintAnalyzerMeasurement: measureAnalyzers,
-			})
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				cmd.exit(1)
+		// Modules are checked one after another, because they may
+		// target different Go versions, and the analyzers can only
+		// target one version at a time.
+		for _, dir := range mods {
+			// prefix identifies the module in messages
+			var prefix string
+			if dir != "" {
+				prefix = shortPath(dir) + ": "
 			}
 
-			for _, w := range res.Warnings {
-				fmt.Fprintln(os.Stderr, "warning:", w)
+			bconfs := bconfs
+			if cmd.flags.matrix == matrixAuto {
+				bconfs = cmd.autoMatrix(dir, env, patterns, prefix)
 			}
 
-			if cmd.flags.formatter == "binary" {
-				err := gob.NewEncoder(os.Stdout).Encode(res)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "failed writing output: %s\n", err)
-					cmd.exit(2)
+			// Build configurations are checked concurrently. They
+			// share a single worker and memory budget, so that
+			// checking many configurations doesn't oversubscribe the
+			// machine, and packages that are identical in several
+			// configurations are only analyzed once.
+			group := runner.NewGroup(0, uint64(cmd.flags.maxMemory))
+			results := make([]LintResult, len(bconfs))
+			errs := make([]error, len(bconfs))
+			var wg sync.WaitGroup
+			for i, bconf := range bconfs {
+				if len(env) > 0 {
+					bconf.Envs = append(bconf.Envs[:len(bconf.Envs):len(bconf.Envs)], env...)
+				}
+				opts := &options{
+					BuildConfig: bconf,
+					LintTests:   cmd.flags.tests,
+					GoVersion:   string(cmd.flags.goVersion),
+					Config: config.Config{
+						Checks: cmd.flags.checks,
+					},
+					PrintAnalyzerMeasurement: measureAnalyzers,
+					AnalyzerTimeout:          cmd.flags.analyzerTimeout,
+					Overlay:                  overlay,
+					Progress:                 progress,
+					Group:                    group,
+					Timeline:                 cmd.timeline,
+					Dir:                      dir,
+					ModuleConfigs:            cmd.flags.allModules,
+					HandleInfoSignals:        true,
+				}
+				if sp != nil {
+					opts.Stream = sp.Print
+				}
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i], errs[i] = doLint(context.Background(), cs, patterns, opts)
+				}(i)
+			}
+			wg.Wait()
+
+			for i, res := range results {
+				if err := errs[i]; err != nil {
+					fmt.Fprintln(os.Stderr, prefix+err.Error())
+					cmd.exit(1)
+				}
+
+				for _, w := range res.Warnings {
+					fmt.Fprintln(os.Stderr, "warning:", prefix+w)
+				}
+
+				if cmd.flags.formatter == "binary" {
+					err := gob.NewEncoder(os.Stdout).Encode(res)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "failed writing output: %s\n", err)
+						cmd.exit(2)
+					}
+				} else {
+					runs = append(runs, runFromLintResult(res))
 				}
-			} else {
-				runs = append(runs, runFromLintResult(res))
 			}
 		}
+		if progress != nil {
+			progress.Stop()
+		}
 
-		if cmd.flags.formatter != "binary" {
+		if sp != nil {
+			sp.Finish()
+		} else if cmd.flags.formatter != "binary" {
 			diags := mergeRuns(runs)
-			cmd.printDiagnostics(cs, diags)
+			cmd.printDiagnostics(cs, diags, runs)
 		}
 	}
 }
 
-func mergeRuns(runs []run) []diagnostic {
-	var relevantDiagnostics []diagnostic
+// mergeRuns merges the diagnostics of multiple runs. It returns one
+// diagnostic per descriptor, with Builds set to the names of all runs
+// that produced it.
+func mergeRuns(runs []run) []Diagnostic {
+	var relevantDiagnostics []Diagnostic
+	// maps descriptors to indices into relevantDiagnostics
+	merged := map[diagnosticDescriptor]int{}
 	for _, r := range runs {
-		for _, diag := range r.diagnostics {
+		for desc, diag := range r.diagnostics {
+			if idx, ok := merged[desc]; ok {
+				relevantDiagnostics[idx].Builds = append(relevantDiagnostics[idx].Builds, r.name)
+				continue
+			}
 			switch diag.MergeIf {
 			case lint.MergeIfAny:
-				relevantDiagnostics = append(relevantDiagnostics, diag)
 			case lint.MergeIfAll:
 				doPrint := true
 				for _, r := range runs {
 					if _, ok := r.checkedFiles[diag.Position.Filename]; ok {
-						if _, ok := r.diagnostics[diag.descriptor()]; !ok {
+						if _, ok := r.diagnostics[desc]; !ok {
 							doPrint = false
 						}
 					}
 				}
-				if doPrint {
-					relevantDiagnostics = append(relevantDiagnostics, diag)
+				if !doPrint {
+					continue
 				}
+			default:
+				continue
 			}
+			diag.Builds = []string{r.name}
+			merged[desc] = len(relevantDiagnostics)
+			relevantDiagnostics = append(relevantDiagnostics, diag)
 		}
 	}
+	for i := range relevantDiagnostics {
+		diag := &relevantDiagnostics[i]
+		diag.Builds = buildNames(diag.Builds)
+		diag.BuildName = strings.Join(diag.Builds, ",")
+	}
 	return relevantDiagnostics
 }
 
+// buildNames sorts names, removing duplicates and empty names.
+func buildNames(names []string) []string {
+	sort.Strings(names)
+	out := names[:0]
+	for i, name := range names {
+		if name == "" || (i > 0 && names[i-1] == name) {
+			continue
+		}
+		out = append(out, name)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
 func (cmd *Command) exit(code int) {
 	if cmd.flags.debugCpuprofile != "" {
 		pprof.StopCPUProfile()
@@ -494,76 +936,116 @@ func (cmd *Command) exit(code int) {
 	if cmd.flags.debugTrace != "" {
 		trace.Stop()
 	}
+	if cmd.timeline != nil {
+		if err := cmd.timeline.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "couldn't write timeline:", err)
+		}
+	}
 	os.Exit(code)
 }
 
-func (cmd *Command) printDiagnostics(cs []*lint.Analyzer, diagnostics []diagnostic) {
-	if len(diagnostics) > 1 {
-		sort.Slice(diagnostics, func(i, j int) bool {
-			di := diagnostics[i]
-			dj := diagnostics[j]
-			pi := di.Position
-			pj := dj.Position
+func sortDiagnostics(diagnostics []Diagnostic) {
+	sort.Slice(diagnostics, func(i, j int) bool {
+		di := diagnostics[i]
+		dj := diagnostics[j]
+		pi := di.Position
+		pj := dj.Position
 
-			if pi.Filename != pj.Filename {
-				return pi.Filename < pj.Filename
-			}
-			if pi.Line != pj.Line {
-				return pi.Line < pj.Line
-			}
-			if pi.Column != pj.Column {
-				return pi.Column < pj.Column
-			}
-			if di.Message != dj.Message {
-				return di.Message < dj.Message
-			}
-			if di.BuildName != dj.BuildName {
-				return di.BuildName < dj.BuildName
-			}
-			return di.Category < dj.Category
-		})
-
-		filtered := []diagnostic{
-			diagnostics[0],
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
 		}
-		builds := []map[string]struct{}{
-			{diagnostics[0].BuildName: {}},
+		if pi.Line != pj.Line {
+			return pi.Line < pj.Line
 		}
-		for _, diag := range diagnostics[1:] {
-			// We may encounter duplicate diagnostics because one file
-			// can be part of many packages, and because multiple
-			// build configurations may check the same files.
-			if !filtered[len(filtered)-1].equal(diag) {
-				if filtered[len(filtered)-1].descriptor() == diag.descriptor() {
-					// Diagnostics only differ in build name, track new name
-					builds[len(filtered)-1][diag.BuildName] = struct{}{}
-				} else {
-					filtered = append(filtered, diag)
-					builds = append(builds, map[string]struct{}{})
-					builds[len(filtered)-1][diag.BuildName] = struct{}{}
-				}
-			}
+		if pi.Column != pj.Column {
+			return pi.Column < pj.Column
+		}
+		if di.Message != dj.Message {
+			return di.Message < dj.Message
 		}
+		if di.BuildName != dj.BuildName {
+			return di.BuildName < dj.BuildName
+		}
+		return di.Category < dj.Category
+	})
+}
+
+// uniqueDiagnostics sorts diagnostics and removes duplicates. The
+// build names of diagnostics that only differ in their build names
+// are merged.
+func uniqueDiagnostics(diagnostics []Diagnostic) []Diagnostic {
+	if len(diagnostics) <= 1 {
+		return diagnostics
+	}
+	sortDiagnostics(diagnostics)
 
-		var names []string
-		for i := range filtered {
-			names = names[:0]
-			for k := range builds[i] {
-				names = append(names, k)
+	names := func(diag Diagnostic) []string {
+		if len(diag.Builds) > 0 {
+			return diag.Builds
+		}
+		return []string{diag.BuildName}
+	}
+	filtered := []Diagnostic{
+		diagnostics[0],
+	}
+	builds := [][]string{
+		append([]string(nil), names(diagnostics[0])...),
+	}
+	for _, diag := range diagnostics[1:] {
+		// We may encounter duplicate diagnostics because one file
+		// can be part of many packages, and because multiple
+		// build configurations may check the same files.
+		if !filtered[len(filtered)-1].equal(diag) {
+			if filtered[len(filtered)-1].descriptor() == diag.descriptor() {
+				// Diagnostics only differ in build name, track new names
+				builds[len(filtered)-1] = append(builds[len(filtered)-1], names(diag)...)
+			} else {
+				filtered = append(filtered, diag)
+				builds = append(builds, append([]string(nil), names(diag)...))
 			}
-			sort.Strings(names)
-			filtered[i].BuildName = strings.Join(names, ",")
 		}
-		diagnostics = filtered
 	}
 
+	for i := range filtered {
+		filtered[i].Builds = buildNames(builds[i])
+		filtered[i].BuildName = strings.Join(filtered[i].Builds, ",")
+	}
+	return filtered
+}
+
+func (cmd *Command) printDiagnostics(cs []*lint.Analyzer, diagnostics []Diagnostic, runs []run) {
+	diagnostics = uniqueDiagnostics(diagnostics)
+
+	f := cmd.newFormatter(runs)
+	var counts diagnosticCounts
+	notIgnored := cmd.tally(cmd.shouldExit(cs), diagnostics, &counts)
+	if sf, ok := f.(*sarifFormatter); ok {
+		sf.exitCode = exitStatus(f, counts)
+	}
+	f.Format(cs, notIgnored)
+	cmd.finish(f, counts)
+}
+
+// newFormatter returns the formatter selected by the -f flag. Runs are
+// the runs that produced the diagnostics, and are only needed by some
+// formatters.
+func (cmd *Command) newFormatter(runs []run) formatter {
 	var f formatter
 	switch cmd.flags.formatter {
 	case "text":
 		f = textFormatter{W: os.Stdout}
 	case "stylish":
 		f = &stylishFormatter{W: os.Stdout}
-	case "json":
+	case "pretty":
+		pf := &prettyFormatter{
+			W:     os.Stdout,
+			Color: isTerminal(os.Stdout),
+		}
+		if cmd.name == "staticcheck" {
+			pf.DocsURL = "https://staticcheck.io/docs/checks#"
+		}
+		f = pf
+	case "json", "jsonl":
 		f = jsonFormatter{W: os.Stdout}
 	case "sarif":
 		f = &sarifFormatter{
@@ -574,6 +1056,12 @@ func (cmd *Command) printDiagnostics(cs []*lint.Analyzer, diagnostics []diagnost
 			f.(*sarifFormatter).driverName = "Staticcheck"
 			f.(*sarifFormatter).driverWebsite = "https://staticcheck.io"
 		}
+	case "matrix-report":
+		f = newMatrixReportFormatter(os.Stdout, runs)
+	case "summary":
+		f = &summaryFormatter{W: os.Stdout}
+	case "summary-json":
+		f = &summaryFormatter{W: os.Stdout, JSON: true}
 	case "binary":
 		fmt.Fprintln(os.Stderr, "'-f binary' not supported in this context")
 		cmd.exit(2)
@@ -583,8 +1071,16 @@ func (cmd *Command) printDiagnostics(cs []*lint.Analyzer, diagnostics []diagnost
 		fmt.Fprintf(os.Stderr, "unsupported output format %q\n", cmd.flags.formatter)
 		cmd.exit(2)
 	}
+	return f
+}
+
+func (cmd *Command) shouldExit(cs []*lint.Analyzer) map[string]bool {
+	return failingCategories(cs, cmd.flags.fail)
+}
 
-	fail := cmd.flags.fail
+// failingCategories returns the set of categories whose diagnostics
+// count as errors, as opposed to warnings.
+func failingCategories(cs []*lint.Analyzer, fail []string) map[string]bool {
 	analyzerNames := make([]string, len(cs))
 	for i, a := range cs {
 		analyzerNames[i] = a.Analyzer.Name
@@ -592,44 +1088,179 @@ func (cmd *Command) printDiagnostics(cs []*lint.Analyzer, diagnostics []diagnost
 	shouldExit := filterAnalyzerNames(analyzerNames, fail)
 	shouldExit["staticcheck"] = true
 	shouldExit["compile"] = true
+	shouldExit["crash"] = true
+	shouldExit["timeout"] = true
+	return shouldExit
+}
+
+type diagnosticCounts struct {
+	total    int
+	errors   int
+	warnings int
+	ignored  int
+	// toolErrors is the number of errors that describe problems with
+	// running the tool, see isToolNotification.
+	toolErrors int
+
+	// Breakdowns of the errors, warnings and ignored diagnostics,
+	// keyed by check, by directory and by file.
+	byCheck map[string]*severityCounts
+	byDir   map[string]*severityCounts
+	byFile  map[string]*severityCounts
+}
+
+type severityCounts struct {
+	Errors   int `json:"errors"`
+	Warnings int `json:"warnings"`
+	Ignored  int `json:"ignored"`
+}
+
+func (c severityCounts) total() int {
+	return c.Errors + c.Warnings + c.Ignored
+}
+
+// add records a diagnostic with the given severity in the breakdowns.
+func (counts *diagnosticCounts) add(diag Diagnostic, sev Severity) {
+	if counts.byCheck == nil {
+		counts.byCheck = map[string]*severityCounts{}
+		counts.byDir = map[string]*severityCounts{}
+		counts.byFile = map[string]*severityCounts{}
+	}
+	file, dir := "-", "-"
+	if diag.Position.Filename != "" {
+		file = shortPath(diag.Position.Filename)
+		dir = shortPath(filepath.Dir(diag.Position.Filename))
+	}
+	for _, k := range []struct {
+		m   map[string]*severityCounts
+		key string
+	}{{counts.byCheck, diag.Category}, {counts.byDir, dir}, {counts.byFile, file}} {
+		c := k.m[k.key]
+		if c == nil {
+			c = &severityCounts{}
+			k.m[k.key] = c
+		}
+		switch sev {
+		case SeverityError:
+			c.Errors++
+		case SeverityWarning:
+			c.Warnings++
+		case SeverityIgnored:
+			c.Ignored++
+		}
+	}
+}
 
-	var (
-		numErrors   int
-		numWarnings int
-		numIgnored  int
-	)
-	notIgnored := make([]diagnostic, 0, len(diagnostics))
+// tally assigns final severities to diagnostics, updates counts and
+// returns the diagnostics that should be printed.
+func (cmd *Command) tally(shouldExit map[string]bool, diagnostics []Diagnostic, counts *diagnosticCounts) []Diagnostic {
+	notIgnored := make([]Diagnostic, 0, len(diagnostics))
 	for _, diag := range diagnostics {
+		if cmd.onlyFile != "" && diag.Position.Filename != cmd.onlyFile && !isToolNotification(diag.Category) {
+			// Problems that prevent the file from being checked are
+			// reported even if they're in other files.
+			continue
+		}
+		counts.total++
 		if diag.Category == "compile" && cmd.flags.debugNoCompileErrors {
 			continue
 		}
-		if diag.Severity == severityIgnored && !cmd.flags.showIgnored {
-			numIgnored++
+		if diag.Severity == SeverityIgnored && !cmd.flags.showIgnored {
+			counts.ignored++
+			counts.add(diag, SeverityIgnored)
 			continue
 		}
 		if shouldExit[diag.Category] {
-			numErrors++
+			counts.errors++
+			if isToolNotification(diag.Category) {
+				counts.toolErrors++
+			}
+			counts.add(diag, SeverityError)
 		} else {
-			diag.Severity = severityWarning
-			numWarnings++
+			diag.Severity = SeverityWarning
+			counts.warnings++
+			counts.add(diag, SeverityWarning)
 		}
 		notIgnored = append(notIgnored, diag)
 	}
+	return notIgnored
+}
 
-	f.Format(cs, notIgnored)
+// finish prints final statistics and exits with the appropriate exit
+// status.
+func (cmd *Command) finish(f formatter, counts diagnosticCounts) {
 	if f, ok := f.(statter); ok {
-		f.Stats(len(diagnostics), numErrors, numWarnings, numIgnored)
+		f.Stats(counts)
 	}
 
-	if numErrors > 0 {
-		if _, ok := f.(*sarifFormatter); ok {
-			// When emitting SARIF, finding errors is considered success.
-			cmd.exit(0)
-		} else {
-			cmd.exit(1)
+	cmd.exit(exitStatus(f, counts))
+}
+
+// exitStatus returns the exit status of a run that produced counts
+// and whose output was formatted by f.
+func exitStatus(f formatter, counts diagnosticCounts) int {
+	if counts.errors == 0 {
+		return 0
+	}
+	if _, ok := f.(*sarifFormatter); ok && counts.toolErrors == 0 {
+		// When emitting SARIF, finding errors is considered success.
+		// Failing to check some of the code isn't.
+		return 0
+	}
+	return 1
+}
+
+// A streamPrinter prints diagnostics as they are being produced,
+// instead of waiting for all packages to be processed.
+//
+// Diagnostics are only sorted within each batch, and duplicates are
+// suppressed across batches.
+type streamPrinter struct {
+	cmd        *Command
+	cs         []*lint.Analyzer
+	f          formatter
+	shouldExit map[string]bool
+
+	mu     sync.Mutex
+	seen   map[diagnosticDescriptor]struct{}
+	counts diagnosticCounts
+}
+
+func (cmd *Command) newStreamPrinter(cs []*lint.Analyzer) *streamPrinter {
+	return &streamPrinter{
+		cmd:        cmd,
+		cs:         cs,
+		f:          cmd.newFormatter(nil),
+		shouldExit: cmd.shouldExit(cs),
+		seen:       map[diagnosticDescriptor]struct{}{},
+	}
+}
+
+func (p *streamPrinter) Print(diagnostics []Diagnostic) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// We may encounter duplicate diagnostics because one file can be
+	// part of many packages, for example a package and its test
+	// variant.
+	unique := make([]Diagnostic, 0, len(diagnostics))
+	for _, diag := range diagnostics {
+		desc := diag.descriptor()
+		if _, ok := p.seen[desc]; ok {
+			continue
 		}
+		p.seen[desc] = struct{}{}
+		unique = append(unique, diag)
 	}
-	cmd.exit(0)
+	sortDiagnostics(unique)
+	p.f.Format(p.cs, p.cmd.tally(p.shouldExit, unique, &p.counts))
+}
+
+// Finish prints final statistics and exits.
+func (p *streamPrinter) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cmd.finish(p.f, p.counts)
 }
 
 func usage(name string, fs *flag.FlagSet) func() {
@@ -1,8 +1,15 @@
 package lintcmd
 
 import (
+	"bytes"
+	"flag"
 	"go/token"
+	"reflect"
+	"strings"
 	"testing"
+
+	"honnef.co/go/tools/analysis/lint"
+	"honnef.co/go/tools/lintcmd/runner"
 )
 
 func TestParsePos(t *testing.T) {
@@ -43,3 +50,139 @@ func TestParsePos(t *testing.T) {
 		}
 	}
 }
+
+func TestMemoryFlag(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out uint64
+		err bool
+	}{
+		{"0", 0, false},
+		{"1024", 1024, false},
+		{"512B", 512, false},
+		{"4KiB", 4 << 10, false},
+		{"512MiB", 512 << 20, false},
+		{"4GiB", 4 << 30, false},
+		{"1TiB", 1 << 40, false},
+		{"4GB", 0, true},
+		{"-1", 0, true},
+		{"GiB", 0, true},
+		{"99999999999TiB", 0, true},
+	}
+
+	for _, tt := range tests {
+		var v memoryFlag
+		err := v.Set(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("Set(%q): got error %v, want error: %t", tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && uint64(v) != tt.out {
+			t.Errorf("Set(%q) = %d, want %d", tt.in, uint64(v), tt.out)
+		}
+	}
+
+	v := memoryFlag(3 << 30)
+	if s := v.String(); s != "3GiB" {
+		t.Errorf("String() = %q, want %q", s, "3GiB")
+	}
+}
+
+func TestMatrixFlag(t *testing.T) {
+	var tests = []struct {
+		args []string
+		m    matrixFlag
+		err  bool
+	}{
+		{[]string{"./..."}, matrixNone, false},
+		{[]string{"-matrix", "./..."}, matrixStdin, false},
+		{[]string{"-matrix=auto", "./..."}, matrixAuto, false},
+		{[]string{"-matrix=false", "./..."}, matrixNone, false},
+		{[]string{"-matrix", "auto", "./..."}, matrixStdin, true},
+		{[]string{"-matrix", "auto"}, matrixStdin, true},
+	}
+
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("", flag.ContinueOnError)
+		var m matrixFlag
+		fs.Var(&m, "matrix", "")
+		if err := fs.Parse(tt.args); err != nil {
+			t.Errorf("%q: %s", tt.args, err)
+			continue
+		}
+		if m != tt.m {
+			t.Errorf("%q: got mode %q, want %q", tt.args, m, tt.m)
+		}
+		if err := checkMatrixArgs(m, fs.Args()); (err != nil) != tt.err {
+			t.Errorf("%q: got error %v, want error: %t", tt.args, err, tt.err)
+		}
+	}
+}
+
+func TestMergeRuns(t *testing.T) {
+	diag := func(file string, line int, msg string, mergeIf lint.MergeStrategy) Diagnostic {
+		return Diagnostic{
+			Diagnostic: runner.Diagnostic{
+				Position: token.Position{Filename: file, Line: line, Column: 1},
+				Category: "SA0000",
+				Message:  msg,
+			},
+			MergeIf: mergeIf,
+		}
+	}
+	res := func(name string, files []string, diags ...Diagnostic) LintResult {
+		for i := range diags {
+			diags[i].BuildName = name
+		}
+		return LintResult{BuildName: name, CheckedFiles: files, Diagnostics: diags}
+	}
+
+	runs := []run{
+		runFromLintResult(res("linux", []string{"/a.go", "/a_unix.go"},
+			diag("/a.go", 1, "everywhere", lint.MergeIfAny),
+			diag("/a.go", 2, "only linux", lint.MergeIfAny),
+			diag("/a.go", 3, "not on windows", lint.MergeIfAll),
+			diag("/a_unix.go", 1, "unix file", lint.MergeIfAny),
+		)),
+		runFromLintResult(res("darwin", []string{"/a.go", "/a_unix.go"},
+			diag("/a.go", 1, "everywhere", lint.MergeIfAny),
+			diag("/a.go", 3, "not on windows", lint.MergeIfAll),
+			diag("/a_unix.go", 1, "unix file", lint.MergeIfAny),
+		)),
+		runFromLintResult(res("windows", []string{"/a.go"},
+			diag("/a.go", 1, "everywhere", lint.MergeIfAny),
+		)),
+	}
+
+	diags := uniqueDiagnostics(mergeRuns(runs))
+	got := map[string][]string{}
+	for _, d := range diags {
+		got[d.Message] = d.Builds
+		if d.BuildName != strings.Join(d.Builds, ",") {
+			t.Errorf("%q: BuildName %q doesn't match builds %q", d.Message, d.BuildName, d.Builds)
+		}
+	}
+	want := map[string][]string{
+		"everywhere": {"darwin", "linux", "windows"},
+		"only linux": {"linux"},
+		// "not on windows" is dropped, because windows checked the
+		// file and didn't report it.
+		"unix file": {"darwin", "linux"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got builds %v, want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	newMatrixReportFormatter(&buf, runs).Format(nil, diags)
+	wantReport := `/a.go:2:1: only linux (SA0000)
+	reported by: linux
+	not reported by: darwin, windows
+/a_unix.go:1:1: unix file (SA0000)
+	reported by: darwin, linux
+	file not part of: windows
+`
+	if buf.String() != wantReport {
+		t.Errorf("got report\n%s\nwant\n%s", buf.String(), wantReport)
+	}
+}
@@ -30,7 +30,8 @@ func parseBuildConfigs(r io.Reader) ([]BuildConfig, error) {
 			}
 		}
 		line = strings.TrimSpace(line)
-		if line == "" {
+		if line == "" || strings.HasPrefix(line, "#") {
+			i++
 			continue
 		}
 		name, envs, flags, err := parseBuildConfig(line)
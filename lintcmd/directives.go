@@ -6,9 +6,9 @@ import (
 	"honnef.co/go/tools/lintcmd/runner"
 )
 
-func parseDirectives(dirs []runner.SerializedDirective) ([]ignore, []diagnostic) {
+func parseDirectives(dirs []runner.SerializedDirective) ([]ignore, []Diagnostic) {
 	var ignores []ignore
-	var diagnostics []diagnostic
+	var diagnostics []Diagnostic
 
 	for _, dir := range dirs {
 		cmd := dir.Command
@@ -16,13 +16,13 @@ func parseDirectives(dirs []runner.SerializedDirective) ([]ignore, []diagnostic)
 		switch cmd {
 		case "ignore", "file-ignore":
 			if len(args) < 2 {
-				p := diagnostic{
+				p := Diagnostic{
 					Diagnostic: runner.Diagnostic{
 						Position: dir.NodePosition,
 						Message:  "malformed linter directive; missing the required reason field?",
 						Category: "compile",
 					},
-					Severity: severityError,
+					Severity: SeverityError,
 				}
 				diagnostics = append(diagnostics, p)
 				continue
@@ -32,6 +32,7 @@ func parseDirectives(dirs []runner.SerializedDirective) ([]ignore, []diagnostic)
 			continue
 		}
 		checks := strings.Split(args[0], ",")
+		reason := strings.Join(args[1:], " ")
 		pos := dir.NodePosition
 		var ig ignore
 		switch cmd {
@@ -40,12 +41,14 @@ func parseDirectives(dirs []runner.SerializedDirective) ([]ignore, []diagnostic)
 				File:   pos.Filename,
 				Line:   pos.Line,
 				Checks: checks,
+				Reason: reason,
 				Pos:    dir.DirectivePosition,
 			}
 		case "file-ignore":
 			ig = &fileIgnore{
 				File:   pos.Filename,
 				Checks: checks,
+				Reason: reason,
 			}
 		}
 		ignores = append(ignores, ig)
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"go/token"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/tabwriter"
 
 	"honnef.co/go/tools/analysis/lint"
@@ -37,19 +39,44 @@ func relativePositionString(pos token.Position) string {
 	return s
 }
 
+// sourceCache reads and caches the lines of source files.
+type sourceCache struct {
+	// maps file names to their lines; nil if the file couldn't be
+	// read
+	files map[string][]string
+}
+
+// line returns the nth line of a file, without the line break.
+func (s *sourceCache) line(file string, n int) (string, bool) {
+	if s.files == nil {
+		s.files = map[string][]string{}
+	}
+	lines, ok := s.files[file]
+	if !ok {
+		if b, err := ioutil.ReadFile(file); err == nil {
+			lines = strings.Split(string(b), "\n")
+		}
+		s.files[file] = lines
+	}
+	if n < 1 || n > len(lines) {
+		return "", false
+	}
+	return lines[n-1], true
+}
+
 type statter interface {
-	Stats(total, errors, warnings, ignored int)
+	Stats(counts diagnosticCounts)
 }
 
 type formatter interface {
-	Format(checks []*lint.Analyzer, diagnostics []diagnostic)
+	Format(checks []*lint.Analyzer, diagnostics []Diagnostic)
 }
 
 type textFormatter struct {
 	W io.Writer
 }
 
-func (o textFormatter) Format(_ []*lint.Analyzer, ps []diagnostic) {
+func (o textFormatter) Format(_ []*lint.Analyzer, ps []Diagnostic) {
 	for _, p := range ps {
 		fmt.Fprintf(o.W, "%s: %s\n", relativePositionString(p.Position), p.String())
 		for _, r := range p.Related {
@@ -60,13 +87,13 @@ func (o textFormatter) Format(_ []*lint.Analyzer, ps []diagnostic) {
 
 type nullFormatter struct{}
 
-func (nullFormatter) Format([]*lint.Analyzer, []diagnostic) {}
+func (nullFormatter) Format([]*lint.Analyzer, []Diagnostic) {}
 
 type jsonFormatter struct {
 	W io.Writer
 }
 
-func (o jsonFormatter) Format(_ []*lint.Analyzer, ps []diagnostic) {
+func (o jsonFormatter) Format(_ []*lint.Analyzer, ps []Diagnostic) {
 	type location struct {
 		File   string `json:"file"`
 		Line   int    `json:"line"`
@@ -87,6 +114,7 @@ func (o jsonFormatter) Format(_ []*lint.Analyzer, ps []diagnostic) {
 			End      location  `json:"end"`
 			Message  string    `json:"message"`
 			Related  []related `json:"related,omitempty"`
+			Builds   []string  `json:"builds,omitempty"`
 		}{
 			Code:     p.Category,
 			Severity: p.Severity.String(),
@@ -101,6 +129,7 @@ func (o jsonFormatter) Format(_ []*lint.Analyzer, ps []diagnostic) {
 				Column: p.End.Column,
 			},
 			Message: p.Message,
+			Builds:  p.Builds,
 		}
 		for _, r := range p.Related {
 			jp.Related = append(jp.Related, related{
@@ -128,7 +157,7 @@ type stylishFormatter struct {
 	tw       *tabwriter.Writer
 }
 
-func (o *stylishFormatter) Format(_ []*lint.Analyzer, ps []diagnostic) {
+func (o *stylishFormatter) Format(_ []*lint.Analyzer, ps []Diagnostic) {
 	for _, p := range ps {
 		pos := p.Position
 		if pos.Filename == "" {
@@ -151,11 +180,55 @@ func (o *stylishFormatter) Format(_ []*lint.Analyzer, ps []diagnostic) {
 	}
 }
 
-func (o *stylishFormatter) Stats(total, errors, warnings, ignored int) {
+func (o *stylishFormatter) Stats(counts diagnosticCounts) {
 	if o.tw != nil {
 		o.tw.Flush()
 		fmt.Fprintln(o.W)
 	}
 	fmt.Fprintf(o.W, " ✖ %d problems (%d errors, %d warnings, %d ignored)\n",
-		total, errors, warnings, ignored)
+		counts.total, counts.errors, counts.warnings, counts.ignored)
+}
+
+// matrixReportFormatter lists diagnostics that were only produced by
+// some of the build configurations that were checked, and explains
+// why the others didn't produce them.
+type matrixReportFormatter struct {
+	W    io.Writer
+	runs []run
+}
+
+func newMatrixReportFormatter(w io.Writer, runs []run) *matrixReportFormatter {
+	return &matrixReportFormatter{W: w, runs: runs}
+}
+
+func (o *matrixReportFormatter) Format(_ []*lint.Analyzer, ps []Diagnostic) {
+	for _, p := range ps {
+		reported := map[string]bool{}
+		for _, name := range p.Builds {
+			reported[name] = true
+		}
+		var notReported, notChecked []string
+		for _, r := range o.runs {
+			if reported[r.name] {
+				continue
+			}
+			if _, ok := r.checkedFiles[p.Position.Filename]; ok {
+				notReported = append(notReported, r.name)
+			} else {
+				notChecked = append(notChecked, r.name)
+			}
+		}
+		if len(notReported) == 0 && len(notChecked) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(o.W, "%s: %s (%s)\n", relativePositionString(p.Position), p.Message, p.Category)
+		fmt.Fprintf(o.W, "\treported by: %s\n", strings.Join(p.Builds, ", "))
+		if len(notReported) > 0 {
+			fmt.Fprintf(o.W, "\tnot reported by: %s\n", strings.Join(buildNames(notReported), ", "))
+		}
+		if len(notChecked) > 0 {
+			fmt.Fprintf(o.W, "\tfile not part of: %s\n", strings.Join(buildNames(notChecked), ", "))
+		}
+	}
 }
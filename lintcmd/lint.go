@@ -1,6 +1,7 @@
 package lintcmd
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"go/build"
@@ -12,6 +13,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -31,6 +33,10 @@ import (
 type linter struct {
 	Analyzers map[string]*lint.Analyzer
 	Runner    *runner.Runner
+	// If set, Stream will be called with the diagnostics of each
+	// package as soon as the package has been processed, in addition
+	// to Lint returning all diagnostics. Calls are serialized.
+	Stream func([]Diagnostic)
 }
 
 func computeSalt() ([]byte, error) {
@@ -57,16 +63,38 @@ func computeSalt() ([]byte, error) {
 	}
 }
 
+var (
+	linterCacheOnce sync.Once
+	linterCache     *cache.Cache
+	linterCacheErr  error
+)
+
+// defaultLinterCache returns the default cache, salted with the
+// identity of the running executable. The salt is only computed once
+// per process.
+func defaultLinterCache() (*cache.Cache, error) {
+	linterCacheOnce.Do(func() {
+		c, err := cache.Default()
+		if err != nil {
+			linterCacheErr = err
+			return
+		}
+		salt, err := computeSalt()
+		if err != nil {
+			linterCacheErr = fmt.Errorf("could not compute salt for cache: %s", err)
+			return
+		}
+		c.SetSalt(salt)
+		linterCache = c
+	})
+	return linterCache, linterCacheErr
+}
+
 func newLinter(cfg config.Config) (*linter, error) {
-	c, err := cache.Default()
+	c, err := defaultLinterCache()
 	if err != nil {
 		return nil, err
 	}
-	salt, err := computeSalt()
-	if err != nil {
-		return nil, fmt.Errorf("could not compute salt for cache: %s", err)
-	}
-	c.SetSalt(salt)
 	r, err := runner.New(cfg, c)
 	if err != nil {
 		return nil, err
@@ -77,103 +105,170 @@ func newLinter(cfg config.Config) (*linter, error) {
 	}, nil
 }
 
+// LintResult is the result of linting packages.
 type LintResult struct {
+	// BuildName is the name of the build configuration that was
+	// checked.
+	BuildName string
+	// CheckedFiles lists all files that were analyzed.
 	CheckedFiles []string
-	Diagnostics  []diagnostic
-	Warnings     []string
+	Diagnostics  []Diagnostic
+	// Warnings contains problems that aren't tied to a position, such
+	// as patterns not matching any packages.
+	Warnings []string
 }
 
-func (l *linter) Lint(cfg *packages.Config, patterns []string) (LintResult, error) {
+func (l *linter) Lint(ctx context.Context, cfg *packages.Config, patterns []string) (LintResult, error) {
 	var out LintResult
 
 	as := make([]*analysis.Analyzer, 0, len(l.Analyzers))
 	for _, a := range l.Analyzers {
 		as = append(as, a.Analyzer)
 	}
-	results, err := l.Runner.Run(cfg, as, patterns)
-	if err != nil {
-		return out, err
-	}
-
-	if len(results) == 0 {
-		// TODO(dh): emulate Go's behavior more closely once we have
-		// access to go list's Match field.
-		for _, pattern := range patterns {
-			fmt.Fprintf(os.Stderr, "warning: %q matched no packages\n", pattern)
-		}
-	}
 
 	analyzerNames := make([]string, 0, len(l.Analyzers))
 	for name := range l.Analyzers {
 		analyzerNames = append(analyzerNames, name)
 	}
-	used := map[unusedKey]bool{}
-	var unuseds []unusedPair
-	for _, res := range results {
+
+	var (
+		// mu guards all of the following variables, as well as out,
+		// while packages are being streamed.
+		mu        sync.Mutex
+		processed = map[*loader.PackageSpec]bool{}
+		used      = map[unusedKey]bool{}
+		unuseds   []unusedPair
+		streamErr error
+	)
+	process := func(res runner.Result) ([]Diagnostic, error) {
 		if len(res.Errors) > 0 && !res.Failed {
 			panic("package has errors but isn't marked as failed")
 		}
+		processed[res.Package] = true
 		if res.Failed {
-			out.Diagnostics = append(out.Diagnostics, failed(res)...)
-		} else {
-			if res.Skipped {
-				out.Warnings = append(out.Warnings, fmt.Sprintf("skipped package %s because it is too large", res.Package))
-				continue
-			}
+			return failed(res), nil
+		}
+		if res.Skipped {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("skipped package %s because it is too large", res.Package))
+			return nil, nil
+		}
 
-			if !res.Initial {
-				continue
-			}
+		// Crashes are reported even for dependencies, as they
+		// may have prevented the computation of facts.
+		var diags []Diagnostic
+		for _, crash := range res.Crashes {
+			diags = append(diags, Diagnostic{
+				Diagnostic: crash,
+				Severity:   SeverityError,
+			})
+		}
 
-			out.CheckedFiles = append(out.CheckedFiles, res.Package.GoFiles...)
-			allowedAnalyzers := filterAnalyzerNames(analyzerNames, res.Config.Checks)
-			resd, err := res.Load()
-			if err != nil {
-				return out, err
-			}
-			ps := success(allowedAnalyzers, resd)
-			filtered, err := filterIgnored(ps, resd, allowedAnalyzers)
-			if err != nil {
-				return out, err
+		if !res.Initial {
+			return diags, nil
+		}
+
+		out.CheckedFiles = append(out.CheckedFiles, res.Package.GoFiles...)
+		allowedAnalyzers := filterAnalyzerNames(analyzerNames, res.Config.Checks)
+		resd, err := res.Load()
+		if err != nil {
+			return nil, err
+		}
+		ps := success(allowedAnalyzers, resd)
+		filtered, err := filterIgnored(ps, resd, allowedAnalyzers)
+		if err != nil {
+			return nil, err
+		}
+		// OPT move this code into the 'success' function.
+		for i, diag := range filtered {
+			a := l.Analyzers[diag.Category]
+			// Some diag.Category don't map to analyzers, such as "staticcheck"
+			if a != nil {
+				filtered[i].MergeIf = a.Doc.MergeIf
 			}
-			// OPT move this code into the 'success' function.
-			for i, diag := range filtered {
-				a := l.Analyzers[diag.Category]
-				// Some diag.Category don't map to analyzers, such as "staticcheck"
-				if a != nil {
-					filtered[i].MergeIf = a.Doc.MergeIf
-				}
+		}
+		diags = append(diags, filtered...)
+
+		for _, obj := range resd.Unused.Used {
+			// FIXME(dh): pick the object whose filename does not include $GOROOT
+			key := unusedKey{
+				pkgPath: res.Package.PkgPath,
+				base:    filepath.Base(obj.Position.Filename),
+				line:    obj.Position.Line,
+				name:    obj.Name,
 			}
-			out.Diagnostics = append(out.Diagnostics, filtered...)
+			used[key] = true
+		}
 
-			for _, obj := range resd.Unused.Used {
-				// FIXME(dh): pick the object whose filename does not include $GOROOT
+		if allowedAnalyzers["U1000"] {
+			for _, obj := range resd.Unused.Unused {
 				key := unusedKey{
 					pkgPath: res.Package.PkgPath,
 					base:    filepath.Base(obj.Position.Filename),
 					line:    obj.Position.Line,
 					name:    obj.Name,
 				}
-				used[key] = true
+				unuseds = append(unuseds, unusedPair{key, obj})
+				if _, ok := used[key]; !ok {
+					used[key] = false
+				}
 			}
+		}
+		return diags, nil
+	}
 
-			if allowedAnalyzers["U1000"] {
-				for _, obj := range resd.Unused.Unused {
-					key := unusedKey{
-						pkgPath: res.Package.PkgPath,
-						base:    filepath.Base(obj.Position.Filename),
-						line:    obj.Position.Line,
-						name:    obj.Name,
-					}
-					unuseds = append(unuseds, unusedPair{key, obj})
-					if _, ok := used[key]; !ok {
-						used[key] = false
-					}
-				}
+	if l.Stream != nil {
+		l.Runner.OnResult = func(res runner.Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			if streamErr != nil {
+				return
+			}
+			diags, err := process(res)
+			if err != nil {
+				streamErr = err
+				return
 			}
+			out.Diagnostics = append(out.Diagnostics, diags...)
+			if len(diags) > 0 {
+				l.Stream(diags)
+			}
+		}
+		defer func() { l.Runner.OnResult = nil }()
+	}
+
+	results, err := l.Runner.Run(ctx, cfg, as, patterns)
+	if err != nil {
+		return out, err
+	}
+	if streamErr != nil {
+		return out, streamErr
+	}
+
+	if len(results) == 0 {
+		// TODO(dh): emulate Go's behavior more closely once we have
+		// access to go list's Match field.
+		for _, pattern := range patterns {
+			out.Warnings = append(out.Warnings, fmt.Sprintf("%q matched no packages", pattern))
 		}
 	}
 
+	// When streaming, this only processes the packages the runner
+	// couldn't process at all.
+	var rest []Diagnostic
+	for _, res := range results {
+		if processed[res.Package] {
+			continue
+		}
+		diags, err := process(res)
+		if err != nil {
+			return out, err
+		}
+		rest = append(rest, diags...)
+	}
+
+	// Whether an object is unused can only be decided once all
+	// packages have been processed, which is why U1000's diagnostics
+	// are always emitted last.
 	for _, uo := range unuseds {
 		if uo.obj.Kind == "type param" {
 			// We don't currently flag unused type parameters on used objects, and flagging them on unused objects isn't
@@ -186,7 +281,7 @@ func (l *linter) Lint(cfg *packages.Config, patterns []string) (LintResult, erro
 		if uo.obj.InGenerated {
 			continue
 		}
-		out.Diagnostics = append(out.Diagnostics, diagnostic{
+		rest = append(rest, Diagnostic{
 			Diagnostic: runner.Diagnostic{
 				Position: uo.obj.DisplayPosition,
 				Message:  fmt.Sprintf("%s %s is unused", uo.obj.Kind, uo.obj.Name),
@@ -196,10 +291,14 @@ func (l *linter) Lint(cfg *packages.Config, patterns []string) (LintResult, erro
 		})
 	}
 
+	out.Diagnostics = append(out.Diagnostics, rest...)
+	if l.Stream != nil && len(rest) > 0 {
+		l.Stream(rest)
+	}
 	return out, nil
 }
 
-func filterIgnored(diagnostics []diagnostic, res runner.ResultData, allowedAnalyzers map[string]bool) ([]diagnostic, error) {
+func filterIgnored(diagnostics []Diagnostic, res runner.ResultData, allowedAnalyzers map[string]bool) ([]Diagnostic, error) {
 	couldHaveMatched := func(ig *lineIgnore) bool {
 		for _, c := range ig.Checks {
 			if c == "U1000" {
@@ -232,12 +331,13 @@ func filterIgnored(diagnostics []diagnostic, res runner.ResultData, allowedAnaly
 		for i := range diagnostics {
 			diag := &diagnostics[i]
 			if ig.Match(*diag) {
-				diag.Severity = severityIgnored
+				diag.Severity = SeverityIgnored
+				diag.IgnoreReason = ig.reason()
 			}
 		}
 
 		if ig, ok := ig.(*lineIgnore); ok && !ig.Matched && couldHaveMatched(ig) {
-			diag := diagnostic{
+			diag := Diagnostic{
 				Diagnostic: runner.Diagnostic{
 					Position: ig.Pos,
 					Message:  "this linter directive didn't match anything; should it be removed?",
@@ -252,18 +352,22 @@ func filterIgnored(diagnostics []diagnostic, res runner.ResultData, allowedAnaly
 }
 
 type ignore interface {
-	Match(diag diagnostic) bool
+	Match(diag Diagnostic) bool
+	reason() string
 }
 
 type lineIgnore struct {
 	File    string
 	Line    int
 	Checks  []string
+	Reason  string
 	Matched bool
 	Pos     token.Position
 }
 
-func (li *lineIgnore) Match(p diagnostic) bool {
+func (li *lineIgnore) reason() string { return li.Reason }
+
+func (li *lineIgnore) Match(p Diagnostic) bool {
 	pos := p.Position
 	if pos.Filename != li.File || pos.Line != li.Line {
 		return false
@@ -288,9 +392,12 @@ func (li *lineIgnore) String() string {
 type fileIgnore struct {
 	File   string
 	Checks []string
+	Reason string
 }
 
-func (fi *fileIgnore) Match(p diagnostic) bool {
+func (fi *fileIgnore) reason() string { return fi.Reason }
+
+func (fi *fileIgnore) Match(p Diagnostic) bool {
 	if p.Position.Filename != fi.File {
 		return false
 	}
@@ -302,36 +409,48 @@ func (fi *fileIgnore) Match(p diagnostic) bool {
 	return false
 }
 
-type severity uint8
+// Severity describes how a diagnostic should be treated. Diagnostics
+// that were suppressed by linter directives have SeverityIgnored.
+type Severity uint8
 
 const (
-	severityError severity = iota
-	severityWarning
-	severityIgnored
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityIgnored
 )
 
-func (s severity) String() string {
+func (s Severity) String() string {
 	switch s {
-	case severityError:
+	case SeverityError:
 		return "error"
-	case severityWarning:
+	case SeverityWarning:
 		return "warning"
-	case severityIgnored:
+	case SeverityIgnored:
 		return "ignored"
 	default:
 		return fmt.Sprintf("Severity(%d)", s)
 	}
 }
 
-// diagnostic represents a diagnostic in some source code.
-type diagnostic struct {
+// Diagnostic represents a diagnostic in some source code.
+type Diagnostic struct {
 	runner.Diagnostic
-	Severity  severity
-	MergeIf   lint.MergeStrategy
+	Severity Severity
+	MergeIf  lint.MergeStrategy
+	// BuildName is the name of the build configuration that produced
+	// the diagnostic. For merged diagnostics, it is a comma-separated
+	// list of all the names in Builds.
 	BuildName string
+	// Builds lists the names of the build configurations that
+	// produced the diagnostic, sorted. It is only populated after
+	// merging the results of multiple build configurations.
+	Builds []string
+	// IgnoreReason is the reason given by the linter directive that
+	// caused the diagnostic to be ignored.
+	IgnoreReason string
 }
 
-func (p diagnostic) equal(o diagnostic) bool {
+func (p Diagnostic) equal(o Diagnostic) bool {
 	return p.Position == o.Position &&
 		p.End == o.End &&
 		p.Message == o.Message &&
@@ -341,16 +460,18 @@ func (p diagnostic) equal(o diagnostic) bool {
 		p.BuildName == o.BuildName
 }
 
-func (p *diagnostic) String() string {
-	if p.BuildName != "" {
+func (p *Diagnostic) String() string {
+	if len(p.Builds) > 0 {
+		return fmt.Sprintf("%s [%s] (%s)", p.Message, strings.Join(p.Builds, ","), p.Category)
+	} else if p.BuildName != "" {
 		return fmt.Sprintf("%s [%s] (%s)", p.Message, p.BuildName, p.Category)
 	} else {
 		return fmt.Sprintf("%s (%s)", p.Message, p.Category)
 	}
 }
 
-func failed(res runner.Result) []diagnostic {
-	var diagnostics []diagnostic
+func failed(res runner.Result) []Diagnostic {
+	var diagnostics []Diagnostic
 
 	for _, e := range res.Errors {
 		switch e := e.(type) {
@@ -384,23 +505,23 @@ func failed(res runner.Result) []diagnostic {
 					panic(fmt.Sprintf("internal error: %s", e))
 				}
 			}
-			diag := diagnostic{
+			diag := Diagnostic{
 				Diagnostic: runner.Diagnostic{
 					Position: posn,
 					Message:  msg,
 					Category: "compile",
 				},
-				Severity: severityError,
+				Severity: SeverityError,
 			}
 			diagnostics = append(diagnostics, diag)
 		case error:
-			diag := diagnostic{
+			diag := Diagnostic{
 				Diagnostic: runner.Diagnostic{
 					Position: token.Position{},
 					Message:  e.Error(),
 					Category: "compile",
 				},
-				Severity: severityError,
+				Severity: SeverityError,
 			}
 			diagnostics = append(diagnostics, diag)
 		}
@@ -421,14 +542,14 @@ type unusedPair struct {
 	obj unused.SerializedObject
 }
 
-func success(allowedAnalyzers map[string]bool, res runner.ResultData) []diagnostic {
+func success(allowedAnalyzers map[string]bool, res runner.ResultData) []Diagnostic {
 	diags := res.Diagnostics
-	var diagnostics []diagnostic
+	var diagnostics []Diagnostic
 	for _, diag := range diags {
 		if !allowedAnalyzers[diag.Category] {
 			continue
 		}
-		diagnostics = append(diagnostics, diagnostic{Diagnostic: diag})
+		diagnostics = append(diagnostics, Diagnostic{Diagnostic: diag})
 	}
 	return diagnostics
 }
@@ -508,9 +629,30 @@ type options struct {
 	LintTests                bool
 	GoVersion                string
 	PrintAnalyzerMeasurement func(analysis *analysis.Analyzer, pkg *loader.PackageSpec, d time.Duration)
+	MaxMemory                uint64
+	AnalyzerTimeout          time.Duration
+	// If set, progress of the run is reported to Progress.
+	Progress progressReporter
+	// If set, the run shares workers, memory and work with other
+	// runs in the same group.
+	Group *runner.Group
+	// If set, diagnostics will be passed to Stream as soon as they
+	// are available. See linter.Stream.
+	Stream func([]Diagnostic)
+	// If set, spans will be recorded in the timeline.
+	Timeline *timeline
+	// Directory to run the build system in
+	Dir string
+	// If set, configuration files outside of modules don't apply to
+	// the modules' packages
+	ModuleConfigs bool
+	// If set, print statistics when receiving SIGINFO or SIGUSR1
+	HandleInfoSignals bool
+	// Contents of files that differ from the files on disk
+	Overlay map[string][]byte
 }
 
-func doLint(as []*lint.Analyzer, paths []string, opt *options) (LintResult, error) {
+func doLint(ctx context.Context, as []*lint.Analyzer, paths []string, opt *options) (LintResult, error) {
 	if opt == nil {
 		opt = &options{}
 	}
@@ -524,8 +666,22 @@ func doLint(as []*lint.Analyzer, paths []string, opt *options) (LintResult, erro
 		analyzers[a.Analyzer.Name] = a
 	}
 	l.Analyzers = analyzers
+	if opt.Stream != nil {
+		l.Stream = func(diags []Diagnostic) {
+			for i := range diags {
+				diags[i].BuildName = opt.BuildConfig.Name
+			}
+			opt.Stream(diags)
+		}
+	}
 	l.Runner.GoVersion = opt.GoVersion
 	l.Runner.Stats.PrintAnalyzerMeasurement = opt.PrintAnalyzerMeasurement
+	l.Runner.MaxMemory = opt.MaxMemory
+	l.Runner.AnalyzerTimeout = opt.AnalyzerTimeout
+	l.Runner.Group = opt.Group
+	if opt.Timeline != nil {
+		l.Runner.Stats.OnSpan = opt.Timeline.BeginBuild(opt.BuildConfig.Name)
+	}
 
 	cfg := &packages.Config{}
 	if opt.LintTests {
@@ -534,20 +690,32 @@ func doLint(as []*lint.Analyzer, paths []string, opt *options) (LintResult, erro
 
 	cfg.BuildFlags = opt.BuildConfig.Flags
 	cfg.Env = append(os.Environ(), opt.BuildConfig.Envs...)
-
+	cfg.Dir = opt.Dir
+	cfg.Overlay = opt.Overlay
+	// Errors are ignored; they will resurface when loading packages.
+	mods, _ := workspaceModules(cfg.Dir, cfg.Env)
+	paths = workspacePatterns(cfg.Dir, mods, paths)
+	l.Runner.ModuleConfigs = opt.ModuleConfigs
+
+	// When checking several build configurations concurrently, each
+	// of them prints its own statistics.
+	var prefix string
+	if opt.BuildConfig.Name != "" {
+		prefix = "[" + opt.BuildConfig.Name + "] "
+	}
 	printStats := func() {
 		// Individual stats are read atomically, but overall there
 		// is no synchronisation. For printing rough progress
 		// information, this doesn't matter.
 		switch l.Runner.Stats.State() {
 		case runner.StateInitializing:
-			fmt.Fprintln(os.Stderr, "Status: initializing")
+			fmt.Fprintln(os.Stderr, prefix+"Status: initializing")
 		case runner.StateLoadPackageGraph:
-			fmt.Fprintln(os.Stderr, "Status: loading package graph")
+			fmt.Fprintln(os.Stderr, prefix+"Status: loading package graph")
 		case runner.StateBuildActionGraph:
-			fmt.Fprintln(os.Stderr, "Status: building action graph")
+			fmt.Fprintln(os.Stderr, prefix+"Status: building action graph")
 		case runner.StateProcessing:
-			fmt.Fprintf(os.Stderr, "Packages: %d/%d initial, %d/%d total; Workers: %d/%d\n",
+			fmt.Fprintf(os.Stderr, prefix+"Packages: %d/%d initial, %d/%d total; Workers: %d/%d\n",
 				l.Runner.Stats.ProcessedInitialPackages(),
 				l.Runner.Stats.InitialPackages(),
 				l.Runner.Stats.ProcessedPackages(),
@@ -555,11 +723,23 @@ func doLint(as []*lint.Analyzer, paths []string, opt *options) (LintResult, erro
 				l.Runner.ActiveWorkers(),
 				l.Runner.TotalWorkers(),
 			)
+			if limit := l.Runner.Stats.MemoryLimit(); limit > 0 {
+				fmt.Fprintf(os.Stderr, prefix+"Memory: %d/%d MiB reserved, %d MiB peak heap; %d packages deferred, %d analyzers throttled\n",
+					l.Runner.Stats.ReservedMemory()>>20,
+					limit>>20,
+					l.Runner.Stats.PeakHeap()>>20,
+					l.Runner.Stats.DeferredPackages(),
+					l.Runner.Stats.ThrottledAnalyzers(),
+				)
+			}
+			if n := l.Runner.Stats.AbandonedAnalyzers(); n > 0 {
+				fmt.Fprintf(os.Stderr, prefix+"Abandoned analyzers still running: %d\n", n)
+			}
 		case runner.StateFinalizing:
-			fmt.Fprintln(os.Stderr, "Status: finalizing")
+			fmt.Fprintln(os.Stderr, prefix+"Status: finalizing")
 		}
 	}
-	if len(infoSignals) > 0 {
+	if opt.HandleInfoSignals && len(infoSignals) > 0 {
 		ch := make(chan os.Signal, 1)
 		signal.Notify(ch, infoSignals...)
 		defer signal.Stop(ch)
@@ -569,9 +749,122 @@ func doLint(as []*lint.Analyzer, paths []string, opt *options) (LintResult, erro
 			}
 		}()
 	}
-	res, err := l.Lint(cfg, paths)
+	if opt.Progress != nil {
+		opt.Progress.Add(opt.BuildConfig.Name, l.Runner)
+	}
+	res, err := l.Lint(ctx, cfg, paths)
+	res.BuildName = opt.BuildConfig.Name
 	for i := range res.Diagnostics {
 		res.Diagnostics[i].BuildName = opt.BuildConfig.Name
 	}
 	return res, err
 }
+
+// Options configure Lint.
+type Options struct {
+	// Config gets merged with the configuration of each package, the
+	// same way the -checks flag does. The zero value inherits the
+	// configuration of each package unchanged.
+	Config config.Config
+	// BuildConfig specifies the build environment and flags.
+	BuildConfig BuildConfig
+	// Tests specifies whether to include tests.
+	Tests bool
+	// GoVersion is the targeted Go version in the format "1.x", or
+	// "module" to use the module's Go version. The empty string is
+	// equivalent to "module".
+	GoVersion string
+	// Fail lists the checks whose diagnostics have SeverityError.
+	// Diagnostics of all other checks have SeverityWarning. It uses
+	// the same syntax as the -fail flag. A nil list is equivalent to
+	// "all".
+	Fail []string
+	// Dir is the directory in which to resolve patterns. The empty
+	// string means the current working directory.
+	Dir string
+	// MaxMemory is the approximate memory budget in bytes, like the
+	// -max-memory flag. Zero means no budget.
+	MaxMemory uint64
+	// AnalyzerTimeout is like the -analyzer-timeout flag. Zero means
+	// no timeout.
+	AnalyzerTimeout time.Duration
+	// Overlay maps absolute file names to contents that are used in
+	// place of the files on disk, for example to check unsaved
+	// changes in an editor. See packages.Config.Overlay.
+	Overlay map[string][]byte
+}
+
+// lintMu serializes calls to Lint. Analyzers, their flags and the
+// default configuration are global state that gets modified for each
+// run.
+var lintMu sync.Mutex
+
+// Lint runs analyzers on the packages matched by patterns and returns
+// their findings. It is the library equivalent of running a Command.
+//
+// The returned diagnostics are sorted and deduplicated. Diagnostics
+// that were suppressed by linter directives are included, with
+// SeverityIgnored. Diagnostics describing failures to load packages
+// have the category "compile".
+//
+// Lint can be called any number of times. Concurrent calls are
+// serialized. Canceling ctx aborts the run and returns the context's
+// error.
+func Lint(ctx context.Context, analyzers []*lint.Analyzer, patterns []string, opts Options) (LintResult, error) {
+	lintMu.Lock()
+	defer lintMu.Unlock()
+
+	oldChecks := config.DefaultConfig.Checks
+	config.DefaultConfig.Checks = defaultChecks(analyzers)
+	defer func() { config.DefaultConfig.Checks = oldChecks }()
+
+	goVersion := opts.GoVersion
+	if goVersion == "" {
+		goVersion = "module"
+	}
+	fail := opts.Fail
+	if fail == nil {
+		fail = []string{"all"}
+	}
+
+	res, err := doLint(ctx, analyzers, patterns, &options{
+		Config:          opts.Config,
+		BuildConfig:     opts.BuildConfig,
+		LintTests:       opts.Tests,
+		GoVersion:       goVersion,
+		Dir:             opts.Dir,
+		MaxMemory:       opts.MaxMemory,
+		AnalyzerTimeout: opts.AnalyzerTimeout,
+		Overlay:         opts.Overlay,
+	})
+	if err != nil {
+		return LintResult{}, err
+	}
+
+	res.Diagnostics = uniqueDiagnostics(res.Diagnostics)
+	errs := failingCategories(analyzers, fail)
+	for i := range res.Diagnostics {
+		diag := &res.Diagnostics[i]
+		if diag.Severity == SeverityIgnored {
+			continue
+		}
+		if errs[diag.Category] {
+			diag.Severity = SeverityError
+		} else {
+			diag.Severity = SeverityWarning
+		}
+	}
+	return res, nil
+}
+
+// defaultChecks returns the checks that are enabled by default, which
+// are all checks except for those marked as non-default.
+func defaultChecks(analyzers []*lint.Analyzer) []string {
+	checks := []string{"all"}
+	for _, a := range analyzers {
+		if a.Doc.NonDefault {
+			checks = append(checks, "-"+a.Analyzer.Name)
+		}
+	}
+	return checks
+}
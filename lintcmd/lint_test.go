@@ -0,0 +1,143 @@
+package lintcmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"honnef.co/go/tools/analysis/lint"
+	"honnef.co/go/tools/simple"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+func s1002() []*lint.Analyzer {
+	for _, a := range simple.Analyzers {
+		if a.Analyzer.Name == "S1002" {
+			return []*lint.Analyzer{a}
+		}
+	}
+	panic("couldn't find S1002")
+}
+
+func TestLint(t *testing.T) {
+	// Linting the same packages twice must return the same results.
+	for i := 0; i < 2; i++ {
+		res, err := Lint(context.Background(), s1002(), []string{"./testdata/src/lintapi"}, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var active, ignored int
+		for _, diag := range res.Diagnostics {
+			if diag.Category != "S1002" {
+				t.Errorf("unexpected diagnostic %s: %s", diag.Category, diag.Message)
+				continue
+			}
+			switch diag.Severity {
+			case SeverityError:
+				active++
+			case SeverityIgnored:
+				ignored++
+			default:
+				t.Errorf("diagnostic at %s has unexpected severity %s", diag.Position, diag.Severity)
+			}
+		}
+		if active != 1 || ignored != 1 {
+			t.Errorf("run %d: got %d active and %d ignored diagnostics, want 1 and 1", i, active, ignored)
+		}
+	}
+}
+
+func TestLintCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Lint(ctx, s1002(), []string{"./testdata/src/lintapi"}, Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestLintOverlay(t *testing.T) {
+	dir, err := filepath.Abs("testdata/src/lintapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay := map[string][]byte{
+		filepath.Join(dir, "lintapi.go"): []byte("package lintapi\n\nfunc fn(b bool) bool { return b }\n"),
+		// A file that only exists in the overlay
+		filepath.Join(dir, "new.go"): []byte("package lintapi\n\nfunc fn2(b bool) bool { return b != false }\n"),
+	}
+	res, err := Lint(context.Background(), s1002(), []string{"./testdata/src/lintapi"}, Options{Overlay: overlay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Diagnostics) != 1 {
+		t.Fatalf("got %d diagnostics, want 1: %v", len(res.Diagnostics), res.Diagnostics)
+	}
+	if diag := res.Diagnostics[0]; filepath.Base(diag.Position.Filename) != "new.go" || diag.Position.Line != 3 {
+		t.Errorf("got diagnostic at %s, want new.go:3", diag.Position)
+	}
+
+	// Results for the overlay mustn't be reused for the files on
+	// disk.
+	res, err = Lint(context.Background(), s1002(), []string{"./testdata/src/lintapi"}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Diagnostics) != 2 {
+		t.Errorf("got %d diagnostics without overlay, want 2", len(res.Diagnostics))
+	}
+}
+
+func TestLintCrashNotCached(t *testing.T) {
+	// Results of a run in which an analyzer crashed mustn't be reused
+	// by later runs.
+	crash := true
+	as := []*lint.Analyzer{{
+		Doc: &lint.Documentation{Title: "Crashes on demand"},
+		Analyzer: &analysis.Analyzer{
+			Name: "TEST1000",
+			Run: func(pass *analysis.Pass) (interface{}, error) {
+				if crash {
+					panic("crash")
+				}
+				for _, f := range pass.Files {
+					pass.Reportf(f.Package, "analyzed")
+				}
+				return nil, nil
+			},
+		},
+	}}
+
+	dir, err := filepath.Abs("testdata/src/lintapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Make sure that the package isn't in the cache yet.
+	overlay := map[string][]byte{
+		filepath.Join(dir, "lintapi.go"): []byte(fmt.Sprintf("package lintapi\n\n// %d\n", time.Now().UnixNano())),
+	}
+
+	categories := func() map[string]int {
+		res, err := Lint(context.Background(), as, []string{"./testdata/src/lintapi"}, Options{Overlay: overlay})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := map[string]int{}
+		for _, diag := range res.Diagnostics {
+			out[diag.Category]++
+		}
+		return out
+	}
+
+	if got := categories(); got["crash"] != 1 || got["TEST1000"] != 0 {
+		t.Fatalf("got diagnostics %v, want one crash", got)
+	}
+	crash = false
+	if got := categories(); got["crash"] != 0 || got["TEST1000"] != 1 {
+		t.Fatalf("got diagnostics %v after fixing the analyzer, want one TEST1000", got)
+	}
+}
@@ -0,0 +1,711 @@
+package lintcmd
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// The following lists mirror those in go/build's syslist.go. Files
+// can use these names in their file names and in build constraints,
+// even if the Go toolchain doesn't support them as build targets.
+var knownOS = map[string]bool{
+	"aix":       true,
+	"android":   true,
+	"darwin":    true,
+	"dragonfly": true,
+	"freebsd":   true,
+	"hurd":      true,
+	"illumos":   true,
+	"ios":       true,
+	"js":        true,
+	"linux":     true,
+	"nacl":      true,
+	"netbsd":    true,
+	"openbsd":   true,
+	"plan9":     true,
+	"solaris":   true,
+	"windows":   true,
+	"zos":       true,
+}
+
+var unixOS = map[string]bool{
+	"aix":       true,
+	"android":   true,
+	"darwin":    true,
+	"dragonfly": true,
+	"freebsd":   true,
+	"hurd":      true,
+	"illumos":   true,
+	"ios":       true,
+	"linux":     true,
+	"netbsd":    true,
+	"openbsd":   true,
+	"solaris":   true,
+}
+
+var knownArch = map[string]bool{
+	"386":         true,
+	"amd64":       true,
+	"amd64p32":    true,
+	"arm":         true,
+	"armbe":       true,
+	"arm64":       true,
+	"arm64be":     true,
+	"loong64":     true,
+	"mips":        true,
+	"mipsle":      true,
+	"mips64":      true,
+	"mips64le":    true,
+	"mips64p32":   true,
+	"mips64p32le": true,
+	"ppc":         true,
+	"ppc64":       true,
+	"ppc64le":     true,
+	"riscv":       true,
+	"riscv64":     true,
+	"s390":        true,
+	"s390x":       true,
+	"sparc":       true,
+	"sparc64":     true,
+	"wasm":        true,
+}
+
+// impliedOS maps operating systems to the operating systems they
+// imply. For example, a file ending in _linux.go is also built for
+// android.
+var impliedOS = map[string]string{
+	"android": "linux",
+	"illumos": "solaris",
+	"ios":     "darwin",
+}
+
+// firstClassPorts are the platforms that the Go project considers
+// first class. We prefer them over other platforms when they are
+// equally useful.
+var firstClassPorts = map[platform]bool{
+	{"linux", "386"}:     true,
+	{"linux", "amd64"}:   true,
+	{"linux", "arm"}:     true,
+	{"linux", "arm64"}:   true,
+	{"darwin", "amd64"}:  true,
+	{"darwin", "arm64"}:  true,
+	{"windows", "386"}:   true,
+	{"windows", "amd64"}: true,
+}
+
+// maxMatrixTags limits the number of custom build tags per file that
+// we try all combinations of.
+const maxMatrixTags = 8
+
+// A platform is a valid GOOS/GOARCH pair.
+type platform struct {
+	GOOS   string
+	GOARCH string
+}
+
+// A fileConstraint describes the conditions under which a file is
+// part of a build.
+type fileConstraint struct {
+	// GOOS and GOARCH from the file name, if any.
+	goos   string
+	goarch string
+	// The file's build constraint, or nil.
+	expr constraint.Expr
+	// Whether the file imports "C".
+	cgo bool
+}
+
+func (c fileConstraint) key() string {
+	expr := ""
+	if c.expr != nil {
+		expr = c.expr.String()
+	}
+	return fmt.Sprintf("%s/%s/%t/%s", c.goos, c.goarch, c.cgo, expr)
+}
+
+// tags returns the custom build tags mentioned by the constraint,
+// sorted.
+func (c fileConstraint) tags() []string {
+	if c.expr == nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	walkTags(c.expr, func(tag string) {
+		if isCustomTag(tag) {
+			seen[tag] = true
+		}
+	})
+	out := make([]string, 0, len(seen))
+	for tag := range seen {
+		out = append(out, tag)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// requiresIgnore reports whether the constraint can only be satisfied
+// with the "ignore" tag, such as "//go:build ignore". By convention,
+// such files are never part of a build; they're usually programs run
+// by go generate.
+func (c fileConstraint) requiresIgnore() bool {
+	if c.expr == nil {
+		return false
+	}
+	mentioned := false
+	var tags []string
+	seen := map[string]bool{}
+	walkTags(c.expr, func(tag string) {
+		if tag == "ignore" {
+			mentioned = true
+		} else if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	})
+	if !mentioned || len(tags) > maxMatrixTags {
+		return false
+	}
+	// Try all assignments of the other tags.
+	for mask := 0; mask < 1<<len(tags); mask++ {
+		ok := c.expr.Eval(func(tag string) bool {
+			for i, t := range tags {
+				if t == tag {
+					return mask&(1<<i) != 0
+				}
+			}
+			return false
+		})
+		if ok {
+			return false
+		}
+	}
+	return true
+}
+
+// mentionsCgo reports whether the constraint depends on cgo.
+func (c fileConstraint) mentionsCgo() bool {
+	if c.cgo {
+		return true
+	}
+	found := false
+	walkTags(c.expr, func(tag string) {
+		if tag == "cgo" {
+			found = true
+		}
+	})
+	return found
+}
+
+// walkTags calls fn for every tag in expr. Unlike
+// constraint.Expr.Eval, it doesn't short-circuit.
+func walkTags(expr constraint.Expr, fn func(tag string)) {
+	switch expr := expr.(type) {
+	case *constraint.TagExpr:
+		fn(expr.Tag)
+	case *constraint.NotExpr:
+		walkTags(expr.X, fn)
+	case *constraint.AndExpr:
+		walkTags(expr.X, fn)
+		walkTags(expr.Y, fn)
+	case *constraint.OrExpr:
+		walkTags(expr.X, fn)
+		walkTags(expr.Y, fn)
+	}
+}
+
+// isCustomTag reports whether tag is a build tag that has to be set
+// with -tags, as opposed to one that is implied by the platform or
+// the toolchain.
+func isCustomTag(tag string) bool {
+	if knownOS[tag] || knownArch[tag] {
+		return false
+	}
+	switch tag {
+	case "unix", "cgo", "gc", "gccgo":
+		return false
+	case "ignore":
+		// By convention, files tagged with "ignore" are never part of
+		// a build. They're usually programs run by go generate.
+		return false
+	}
+	return !isReleaseTag(tag)
+}
+
+func isReleaseTag(tag string) bool {
+	if !strings.HasPrefix(tag, "go1.") {
+		return false
+	}
+	_, err := strconv.Atoi(tag[len("go1."):])
+	return err == nil
+}
+
+// matchOS reports whether files constrained to name are built for goos.
+func matchOS(name, goos string) bool {
+	return name == goos || impliedOS[goos] == name
+}
+
+// A matrixEntry is a single build configuration chosen by
+// -matrix=auto.
+type matrixEntry struct {
+	platform
+	// Sorted list of custom tags.
+	tags []string
+	cgo  bool
+}
+
+func (e matrixEntry) hasTag(tag string) bool {
+	i := sort.SearchStrings(e.tags, tag)
+	return i < len(e.tags) && e.tags[i] == tag
+}
+
+// matchTag mimics go/build's (*Context).matchTag.
+func (e matrixEntry) matchTag(tag string) bool {
+	switch {
+	case tag == "ignore":
+		return false
+	case tag == "gc":
+		return true
+	case tag == "gccgo":
+		return false
+	case tag == "cgo":
+		return e.cgo
+	case tag == "unix":
+		return unixOS[e.GOOS]
+	case knownOS[tag]:
+		return matchOS(tag, e.GOOS)
+	case knownArch[tag]:
+		return tag == e.GOARCH
+	case isReleaseTag(tag):
+		for _, rt := range build.Default.ReleaseTags {
+			if rt == tag {
+				return true
+			}
+		}
+		return false
+	default:
+		return e.hasTag(tag)
+	}
+}
+
+func (e matrixEntry) matches(c fileConstraint) bool {
+	if c.goos != "" && !matchOS(c.goos, e.GOOS) {
+		return false
+	}
+	if c.goarch != "" && c.goarch != e.GOARCH {
+		return false
+	}
+	if c.cgo && !e.cgo {
+		return false
+	}
+	return c.expr == nil || c.expr.Eval(e.matchTag)
+}
+
+func (e matrixEntry) key() string {
+	return fmt.Sprintf("%s/%s/%t/%s", e.GOOS, e.GOARCH, e.cgo, strings.Join(e.tags, ","))
+}
+
+// name returns a build name suitable for parseBuildConfig.
+func (e matrixEntry) name() string {
+	parts := []string{e.GOOS, e.GOARCH}
+	if e.cgo {
+		parts = append(parts, "cgo")
+	}
+	parts = append(parts, e.tags...)
+	name := strings.Join(parts, "_")
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// parseFileConstraint parses the build constraints in the header of
+// the Go file at path.
+func parseFileConstraint(fset *token.FileSet, path string) (fileConstraint, error) {
+	var c fileConstraint
+	c.goos, c.goarch = fileNameConstraint(path)
+
+	f, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return c, err
+	}
+	for _, imp := range f.Imports {
+		if imp.Path.Value == `"C"` {
+			c.cgo = true
+		}
+	}
+
+	// Like go/build, prefer //go:build lines and fall back to
+	// // +build lines.
+	var goBuild constraint.Expr
+	var plusBuild []constraint.Expr
+	for _, cg := range f.Comments {
+		if cg.Pos() >= f.Package {
+			break
+		}
+		for _, cm := range cg.List {
+			switch {
+			case constraint.IsGoBuild(cm.Text):
+				if goBuild != nil {
+					continue
+				}
+				expr, err := constraint.Parse(cm.Text)
+				if err != nil {
+					return c, fmt.Errorf("%s: %s", fset.Position(cm.Pos()), err)
+				}
+				goBuild = expr
+			case constraint.IsPlusBuild(cm.Text):
+				expr, err := constraint.Parse(cm.Text)
+				if err != nil {
+					return c, fmt.Errorf("%s: %s", fset.Position(cm.Pos()), err)
+				}
+				plusBuild = append(plusBuild, expr)
+			}
+		}
+	}
+	if goBuild != nil {
+		c.expr = goBuild
+	} else {
+		for _, expr := range plusBuild {
+			if c.expr == nil {
+				c.expr = expr
+			} else {
+				c.expr = &constraint.AndExpr{X: c.expr, Y: expr}
+			}
+		}
+	}
+	return c, nil
+}
+
+// fileNameConstraint returns the GOOS and GOARCH implied by a file's
+// name, following the same rules as go/build.
+func fileNameConstraint(path string) (goos, goarch string) {
+	name := path[strings.LastIndexAny(path, `/\`)+1:]
+	if dot := strings.Index(name, "."); dot != -1 {
+		name = name[:dot]
+	}
+	// The first element of the name is never a constraint, so that
+	// files named linux.go aren't constrained.
+	i := strings.Index(name, "_")
+	if i < 0 {
+		return "", ""
+	}
+	name = name[i:]
+
+	l := strings.Split(name, "_")
+	if n := len(l); n > 0 && l[n-1] == "test" {
+		l = l[:n-1]
+	}
+	n := len(l)
+	switch {
+	case n >= 2 && knownOS[l[n-2]] && knownArch[l[n-1]]:
+		return l[n-2], l[n-1]
+	case n >= 1 && knownOS[l[n-1]]:
+		return l[n-1], ""
+	case n >= 1 && knownArch[l[n-1]]:
+		return "", l[n-1]
+	default:
+		return "", ""
+	}
+}
+
+type constraintGroup struct {
+	constraint fileConstraint
+	files      []string
+}
+
+// solveMatrix picks a small set of build configurations that together
+// include every file at least once. Finding the smallest such set is
+// an instance of the set cover problem; we use the greedy
+// approximation, which works well for the kinds of constraints found
+// in practice.
+//
+// The host platform and then first-class ports are preferred when
+// breaking ties, and cgo is only
+// enabled on the host platform, as it usually requires a C toolchain
+// for the target platform.
+//
+// solveMatrix returns the chosen configurations and the files that
+// aren't part of any of them. Files that require the "ignore" tag are
+// neither covered nor reported as uncovered.
+func solveMatrix(files map[string]fileConstraint, platforms []platform, host platform) (entries []matrixEntry, uncovered []string) {
+	groupsByKey := map[string]*constraintGroup{}
+	for path, c := range files {
+		if c.requiresIgnore() {
+			continue
+		}
+		k := c.key()
+		g, ok := groupsByKey[k]
+		if !ok {
+			g = &constraintGroup{constraint: c}
+			groupsByKey[k] = g
+		}
+		g.files = append(g.files, path)
+	}
+	groups := make([]*constraintGroup, 0, len(groupsByKey))
+	for _, g := range groupsByKey {
+		sort.Strings(g.files)
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].files[0] < groups[j].files[0]
+	})
+
+	// Candidates are all configurations that include at least one
+	// group, using no tags other than the ones the group mentions.
+	var candidates []matrixEntry
+	seen := map[string]bool{}
+	for _, g := range groups {
+		tags := g.constraint.tags()
+		if len(tags) > maxMatrixTags {
+			tags = tags[:maxMatrixTags]
+		}
+		for _, p := range platforms {
+			cgos := []bool{false}
+			if p == host && g.constraint.mentionsCgo() {
+				cgos = append(cgos, true)
+			}
+			for _, cgo := range cgos {
+				for mask := 0; mask < 1<<len(tags); mask++ {
+					e := matrixEntry{platform: p, cgo: cgo}
+					for i, tag := range tags {
+						if mask&(1<<i) != 0 {
+							e.tags = append(e.tags, tag)
+						}
+					}
+					if !e.matches(g.constraint) || seen[e.key()] {
+						continue
+					}
+					seen[e.key()] = true
+					candidates = append(candidates, e)
+				}
+			}
+		}
+	}
+
+	covered := make([]bool, len(groups))
+	score := func(e matrixEntry) int {
+		n := 0
+		for i, g := range groups {
+			if !covered[i] && e.matches(g.constraint) {
+				n += len(g.files)
+			}
+		}
+		return n
+	}
+	// better reports whether a is preferable to b, given their scores.
+	better := func(a matrixEntry, sa int, b matrixEntry, sb int) bool {
+		if sa != sb {
+			return sa > sb
+		}
+		if (a.platform == host) != (b.platform == host) {
+			return a.platform == host
+		}
+		if firstClassPorts[a.platform] != firstClassPorts[b.platform] {
+			return firstClassPorts[a.platform]
+		}
+		if (a.GOARCH == host.GOARCH) != (b.GOARCH == host.GOARCH) {
+			return a.GOARCH == host.GOARCH
+		}
+		if a.cgo != b.cgo {
+			return !a.cgo
+		}
+		if len(a.tags) != len(b.tags) {
+			return len(a.tags) < len(b.tags)
+		}
+		return a.key() < b.key()
+	}
+	union := func(a, b []string) []string {
+		m := map[string]bool{}
+		for _, tag := range a {
+			m[tag] = true
+		}
+		for _, tag := range b {
+			m[tag] = true
+		}
+		out := make([]string, 0, len(m))
+		for tag := range m {
+			out = append(out, tag)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	for {
+		var best matrixEntry
+		bestScore := 0
+		for _, e := range candidates {
+			if s := score(e); s > 0 && (bestScore == 0 || better(e, s, best, bestScore)) {
+				best, bestScore = e, s
+			}
+		}
+		if bestScore == 0 {
+			break
+		}
+
+		// Candidates only use the tags of a single group. Try
+		// combining several candidates, which lets a single
+		// configuration cover files that depend on different tags.
+		for _, e := range candidates {
+			if e.platform != best.platform || (len(e.tags) == 0 && e.cgo == best.cgo) {
+				continue
+			}
+			merged := best
+			merged.tags = union(best.tags, e.tags)
+			merged.cgo = best.cgo || e.cgo
+			if s := score(merged); s > bestScore {
+				best, bestScore = merged, s
+			}
+		}
+
+		entries = append(entries, best)
+		for i, g := range groups {
+			if !covered[i] && best.matches(g.constraint) {
+				covered[i] = true
+			}
+		}
+	}
+
+	for i, g := range groups {
+		if !covered[i] {
+			uncovered = append(uncovered, g.files...)
+		}
+	}
+	sort.Strings(uncovered)
+	return entries, uncovered
+}
+
+// matrixBuildConfigs turns matrix entries into build configurations.
+func matrixBuildConfigs(entries []matrixEntry, setCgo bool) []BuildConfig {
+	names := map[string]int{}
+	out := make([]BuildConfig, 0, len(entries))
+	for _, e := range entries {
+		name := e.name()
+		if n := names[name]; n > 0 {
+			name = fmt.Sprintf("%s_%d", name, n)
+		}
+		names[e.name()]++
+
+		bc := BuildConfig{
+			Name: name,
+			Envs: []string{"GOOS=" + e.GOOS, "GOARCH=" + e.GOARCH},
+		}
+		if setCgo {
+			if e.cgo {
+				bc.Envs = append(bc.Envs, "CGO_ENABLED=1")
+			} else {
+				bc.Envs = append(bc.Envs, "CGO_ENABLED=0")
+			}
+		}
+		if len(e.tags) > 0 {
+			bc.Flags = []string{"-tags", strings.Join(e.tags, ",")}
+		}
+		out = append(out, bc)
+	}
+	return out
+}
+
+// writeBuildConfigs writes build configurations in the format
+// understood by parseBuildConfigs.
+func writeBuildConfigs(w io.Writer, bconfs []BuildConfig) {
+	for _, bc := range bconfs {
+		fmt.Fprintf(w, "%s:", bc.Name)
+		for _, arg := range append(bc.Envs[:len(bc.Envs):len(bc.Envs)], bc.Flags...) {
+			if strings.ContainsRune(arg, ' ') {
+				arg = `"` + arg + `"`
+			}
+			fmt.Fprintf(w, " %s", arg)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// goPlatforms returns the platforms supported by the go command.
+func goPlatforms() ([]platform, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", "tool", "dist", "list")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("couldn't list supported platforms: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var out []platform
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		idx := strings.Index(line, "/")
+		if idx == -1 {
+			continue
+		}
+		out = append(out, platform{GOOS: line[:idx], GOARCH: strings.TrimSpace(line[idx+1:])})
+	}
+	return out, nil
+}
+
+// discoverMatrix derives a build matrix from the build constraints of
+// all files in the packages matched by patterns, which are resolved in
+// dir with the additional environment variables env. It returns the
+// build configurations and the files that can't be included by any
+// configuration.
+func discoverMatrix(dir string, env []string, patterns []string, tests bool) ([]BuildConfig, []string, error) {
+	cfg := &packages.Config{
+		Mode:  packages.NeedName | packages.NeedFiles,
+		Tests: tests,
+		Dir:   dir,
+	}
+	if len(env) > 0 {
+		cfg.Env = append(os.Environ(), env...)
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fset := token.NewFileSet()
+	files := map[string]fileConstraint{}
+	setCgo := false
+	for _, pkg := range pkgs {
+		if strings.HasSuffix(pkg.ID, ".test") {
+			// The synthesized main package of a test binary
+			continue
+		}
+		for _, path := range append(pkg.GoFiles, pkg.IgnoredFiles...) {
+			if _, ok := files[path]; ok {
+				continue
+			}
+			if !strings.HasSuffix(path, ".go") {
+				continue
+			}
+			if !tests && strings.HasSuffix(path, "_test.go") {
+				continue
+			}
+			c, err := parseFileConstraint(fset, path)
+			if err != nil {
+				return nil, nil, err
+			}
+			if c.mentionsCgo() {
+				setCgo = true
+			}
+			files[path] = c
+		}
+	}
+
+	platforms, err := goPlatforms()
+	if err != nil {
+		return nil, nil, err
+	}
+	host := platform{GOOS: build.Default.GOOS, GOARCH: build.Default.GOARCH}
+	entries, uncovered := solveMatrix(files, platforms, host)
+	return matrixBuildConfigs(entries, setCgo), uncovered, nil
+}
@@ -0,0 +1,117 @@
+package lintcmd
+
+import (
+	"bytes"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileNameConstraint(t *testing.T) {
+	tests := []struct {
+		name   string
+		goos   string
+		goarch string
+	}{
+		{"foo.go", "", ""},
+		{"linux.go", "", ""},
+		{"foo_linux.go", "linux", ""},
+		{"foo_amd64.go", "", "amd64"},
+		{"foo_linux_amd64.go", "linux", "amd64"},
+		{"foo_linux_amd64_test.go", "linux", "amd64"},
+		{"foo_windows_test.go", "windows", ""},
+		{"foo_bar.go", "", ""},
+		{"dir_linux/foo.go", "", ""},
+	}
+	for _, tt := range tests {
+		goos, goarch := fileNameConstraint(tt.name)
+		if goos != tt.goos || goarch != tt.goarch {
+			t.Errorf("%s: got %q/%q, want %q/%q", tt.name, goos, goarch, tt.goos, tt.goarch)
+		}
+	}
+}
+
+func TestSolveMatrix(t *testing.T) {
+	files := map[string]string{
+		"a.go":         "package pkg\n",
+		"a_linux.go":   "package pkg\n",
+		"a_windows.go": "package pkg\n",
+		"a_arm64.go":   "package pkg\n",
+		"unix.go":      "//go:build unix\n\npackage pkg\n",
+		"legacy.go":    "// +build darwin\n// +build !cgo\n\npackage pkg\n",
+		"cgo.go":       "package pkg\n\nimport \"C\"\n",
+		"foo.go":       "//go:build linux && foo\n\npackage pkg\n",
+		"bar.go":       "//go:build linux && bar\n\npackage pkg\n",
+		"notbar.go":    "//go:build !bar\n\npackage pkg\n",
+		"gen.go":       "//go:build ignore\n\npackage main\n",
+		"gen2.go":      "// +build ignore,linux\n\npackage main\n",
+		"plan9.go":     "//go:build plan9\n\npackage pkg\n",
+	}
+	dir := t.TempDir()
+	fset := token.NewFileSet()
+	constraints := map[string]fileConstraint{}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+		c, err := parseFileConstraint(fset, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		constraints[name] = c
+	}
+
+	platforms := []platform{
+		{"darwin", "amd64"},
+		{"darwin", "arm64"},
+		{"linux", "amd64"},
+		{"linux", "arm64"},
+		{"windows", "amd64"},
+	}
+	host := platform{"linux", "amd64"}
+	entries, uncovered := solveMatrix(constraints, platforms, host)
+
+	// plan9 isn't in our list of supported platforms. gen.go and
+	// gen2.go are ignored by convention and aren't reported.
+	if want := []string{"plan9.go"}; !reflect.DeepEqual(uncovered, want) {
+		t.Errorf("got uncovered files %q, want %q", uncovered, want)
+	}
+	for name, c := range constraints {
+		if name == "gen.go" || name == "gen2.go" || name == "plan9.go" {
+			continue
+		}
+		found := false
+		for _, e := range entries {
+			if e.matches(c) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("no build configuration includes %s", name)
+		}
+	}
+
+	// One configuration for linux with foo, one for linux with bar
+	// and cgo (notbar.go excludes bar, and cgo is only enabled on
+	// the host), one for darwin and one for windows.
+	if len(entries) != 4 {
+		t.Errorf("got %d configurations, want 4: %v", len(entries), entries)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# comment\n")
+	bconfs := matrixBuildConfigs(entries, true)
+	writeBuildConfigs(&buf, bconfs)
+	parsed, err := parseBuildConfigs(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("couldn't parse generated matrix %q: %s", buf.String(), err)
+	}
+	if !reflect.DeepEqual(parsed, bconfs) {
+		t.Errorf("generated matrix didn't round-trip: got %v, want %v", parsed, bconfs)
+	}
+}
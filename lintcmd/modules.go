@@ -0,0 +1,182 @@
+package lintcmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// findModules returns the absolute paths of the directories below
+// root, including root itself, that contain go.mod files. Like the
+// go command's ./... pattern, it skips vendor and testdata
+// directories, as well as directories whose names begin with a dot
+// or an underscore.
+func findModules(root string) ([]string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	var mods []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root {
+			name := d.Name()
+			if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+		}
+		if fi, err := os.Stat(filepath.Join(path, "go.mod")); err == nil && !fi.IsDir() {
+			mods = append(mods, path)
+		}
+		return nil
+	})
+	return mods, err
+}
+
+// findWorkFile returns the go.work file that is in effect in dir, or
+// the empty string if there is none. Like the go command, it honours
+// GOWORK in env and otherwise looks for go.work in dir and its
+// parents. It doesn't consider GOWORK set with 'go env -w'.
+func findWorkFile(dir string, env []string) (string, error) {
+	if env == nil {
+		env = os.Environ()
+	}
+	var gowork string
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "GOWORK=") {
+			// Later entries take precedence, as they do for
+			// exec.Cmd.
+			gowork = strings.TrimPrefix(kv, "GOWORK=")
+		}
+	}
+	switch gowork {
+	case "off":
+		return "", nil
+	case "", "auto":
+	default:
+		return gowork, nil
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, "go.work")
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// workspaceModules returns the absolute paths of the modules in the
+// go.work workspace that is in effect in dir, if any.
+func workspaceModules(dir string, env []string) ([]string, error) {
+	work, err := findWorkFile(dir, env)
+	if err != nil || work == "" {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", "work", "edit", "-json", work)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var wf struct {
+		Use []struct {
+			DiskPath string
+		}
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &wf); err != nil {
+		return nil, err
+	}
+	mods := make([]string, 0, len(wf.Use))
+	for _, use := range wf.Use {
+		path := filepath.FromSlash(use.DiskPath)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(work), path)
+		}
+		mods = append(mods, filepath.Clean(path))
+	}
+	return mods, nil
+}
+
+// within reports whether path is dir or below it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// expandWorkspacePatterns rewrites relative patterns of the form
+// dir/... to match the packages of all workspace modules below dir.
+// The go command doesn't necessarily match packages of workspace
+// modules for patterns rooted in directories that don't belong to a
+// module, such as the root of a workspace. Cwd is the directory that
+// patterns are relative to, mods are the workspace's modules.
+func expandWorkspacePatterns(cwd string, mods []string, patterns []string) []string {
+	out := make([]string, 0, len(patterns))
+	for _, pat := range patterns {
+		if !strings.HasSuffix(pat, "...") || !build.IsLocalImport(pat) {
+			out = append(out, pat)
+			continue
+		}
+		root := filepath.Join(cwd, filepath.FromSlash(strings.TrimSuffix(pat, "...")))
+		inModule := false
+		var expanded []string
+		for _, mod := range mods {
+			if within(root, mod) {
+				// The pattern already matches packages in this
+				// module.
+				inModule = true
+			} else if within(mod, root) {
+				rel, err := filepath.Rel(cwd, mod)
+				if err != nil {
+					continue
+				}
+				rel = filepath.ToSlash(rel)
+				if !strings.HasPrefix(rel, "../") {
+					rel = "./" + rel
+				}
+				expanded = append(expanded, rel+"/...")
+			}
+		}
+		if inModule || len(expanded) == 0 {
+			out = append(out, pat)
+		}
+		out = append(out, expanded...)
+	}
+	return out
+}
+
+// workspacePatterns applies expandWorkspacePatterns if dir is part of
+// a go.work workspace with the modules mods.
+func workspacePatterns(dir string, mods []string, patterns []string) []string {
+	if len(mods) == 0 {
+		return patterns
+	}
+	cwd, err := filepath.Abs(dir)
+	if err != nil {
+		return patterns
+	}
+	return expandWorkspacePatterns(cwd, mods, patterns)
+}
@@ -0,0 +1,105 @@
+package lintcmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindModules(t *testing.T) {
+	root := t.TempDir()
+	files := []string{
+		"go.mod",
+		"a/go.mod",
+		"a/b/go.mod",
+		"c/d/go.mod",
+		"c/e/foo.go",
+		"vendor/f/go.mod",
+		"a/testdata/go.mod",
+		".git/go.mod",
+		"_old/go.mod",
+	}
+	for _, f := range files {
+		path := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mods, err := findModules(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, dir := range []string{"", "a", "a/b", "c/d"} {
+		want = append(want, filepath.Join(root, filepath.FromSlash(dir)))
+	}
+	if !reflect.DeepEqual(mods, want) {
+		t.Errorf("got %q, want %q", mods, want)
+	}
+}
+
+func TestFindWorkFile(t *testing.T) {
+	root := t.TempDir()
+	work := filepath.Join(root, "go.work")
+	dir := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(work, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(root, "other.work")
+
+	tests := []struct {
+		env  []string
+		want string
+	}{
+		{[]string{}, work},
+		{[]string{"GOWORK=auto"}, work},
+		{[]string{"GOWORK=off"}, ""},
+		{[]string{"GOWORK=" + other}, other},
+		{[]string{"GOWORK=off", "GOWORK="}, work},
+	}
+	for _, tt := range tests {
+		got, err := findWorkFile(dir, tt.env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestExpandWorkspacePatterns(t *testing.T) {
+	root := filepath.FromSlash("/work")
+	mods := []string{
+		filepath.Join(root, "a"),
+		filepath.Join(root, "a", "nested"),
+		filepath.Join(root, "b"),
+		filepath.Join(root, "other", "c"),
+	}
+	tests := []struct {
+		cwd      string
+		patterns []string
+		want     []string
+	}{
+		{"", []string{"./..."}, []string{"./a/...", "./a/nested/...", "./b/...", "./other/c/..."}},
+		{"", []string{"./other/..."}, []string{"./other/c/..."}},
+		{"", []string{"./a/..."}, []string{"./a/...", "./a/nested/..."}},
+		{"a", []string{"./..."}, []string{"./...", "./nested/..."}},
+		{"a", []string{"../b/...", "example.com/foo/...", "."}, []string{"../b/...", "example.com/foo/...", "."}},
+		{"", []string{"./none/..."}, []string{"./none/..."}},
+	}
+	for _, tt := range tests {
+		got := expandWorkspacePatterns(filepath.Join(root, tt.cwd), mods, tt.patterns)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: %q: got %q, want %q", tt.cwd, tt.patterns, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package lintcmd
+
+import (
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"honnef.co/go/tools/analysis/lint"
+	"honnef.co/go/tools/lintcmd/runner"
+)
+
+const (
+	// Tabs in source code are expanded to this many columns.
+	prettyTabWidth = 4
+	// Longer spans are shortened by omitting lines in the middle.
+	prettyMaxLines = 6
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[1;31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[1;33m"
+	ansiBlue   = "\x1b[1;34m"
+	ansiCyan   = "\x1b[1;36m"
+)
+
+// isTerminal reports whether f is a terminal, and whether the user
+// hasn't opted out of colored output.
+func isTerminal(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTTY(f)
+}
+
+// isTTY reports whether f is a terminal.
+func isTTY(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// prettyFormatter prints diagnostics for human consumption, together
+// with excerpts of the source code they refer to and their suggested
+// fixes.
+type prettyFormatter struct {
+	W     io.Writer
+	Color bool
+	// If set, diagnostics of known checks link to DocsURL followed
+	// by the check's name.
+	DocsURL string
+
+	sources sourceCache
+}
+
+func (o *prettyFormatter) paint(code, s string) string {
+	if !o.Color || s == "" {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+func (o *prettyFormatter) Format(checks []*lint.Analyzer, ps []Diagnostic) {
+	known := make(map[string]bool, len(checks))
+	for _, c := range checks {
+		known[c.Analyzer.Name] = true
+	}
+	for _, p := range ps {
+		o.diagnostic(p, known[p.Category])
+	}
+}
+
+func (o *prettyFormatter) Stats(counts diagnosticCounts) {
+	fmt.Fprintf(o.W, "%s (%d errors, %d warnings, %d ignored)\n",
+		o.paint(ansiBold, fmt.Sprintf("%d problems", counts.total)), counts.errors, counts.warnings, counts.ignored)
+}
+
+func (o *prettyFormatter) diagnostic(p Diagnostic, known bool) {
+	var sev, color string
+	switch p.Severity {
+	case SeverityError:
+		sev, color = "error", ansiRed
+	case SeverityIgnored:
+		sev, color = "ignored", ansiDim
+	default:
+		sev, color = "warning", ansiYellow
+	}
+
+	// The width of the gutter, which has to fit all line numbers
+	maxLine := p.Position.Line
+	if p.End.Line > maxLine {
+		maxLine = p.End.Line
+	}
+	for _, r := range p.Related {
+		if r.End.Line > maxLine {
+			maxLine = r.End.Line
+		}
+	}
+	for _, fix := range p.SuggestedFixes {
+		for _, edit := range fix.TextEdits {
+			if edit.End.Line > maxLine {
+				maxLine = edit.End.Line
+			}
+		}
+	}
+	width := len(strconv.Itoa(maxLine))
+
+	fmt.Fprintf(o.W, "%s%s %s\n", o.paint(color, sev+"["+p.Category+"]"), o.paint(ansiBold, ":"), o.paint(ansiBold, p.Message))
+	o.excerpt(width, p.Position, p.End, "^", color)
+	for _, r := range p.Related {
+		o.note(width, "note", r.Message)
+		o.excerpt(width, r.Position, r.End, "-", ansiCyan)
+	}
+	for _, fix := range p.SuggestedFixes {
+		o.note(width, "fix", fix.Message)
+		o.fix(width, p.Position.Filename, fix)
+	}
+	if len(p.Builds) > 0 {
+		o.note(width, "builds", strings.Join(p.Builds, ", "))
+	}
+	if p.Severity == SeverityIgnored && p.IgnoreReason != "" {
+		o.note(width, "ignored", p.IgnoreReason)
+	}
+	if known && o.DocsURL != "" {
+		o.note(width, "help", o.DocsURL+p.Category)
+	}
+	fmt.Fprintln(o.W)
+}
+
+func (o *prettyFormatter) gutter(width int, s string) string {
+	return o.paint(ansiBlue, fmt.Sprintf("%*s |", width, s))
+}
+
+func (o *prettyFormatter) note(width int, kind, msg string) {
+	fmt.Fprintf(o.W, "%s %s %s\n", strings.Repeat(" ", width), o.paint(ansiBlue, "="), o.paint(ansiBold, kind+":")+" "+msg)
+}
+
+// expandTabs replaces tabs in line with spaces. It returns the
+// expanded line and the display column of every byte offset in line,
+// including the offset just past the end of the line.
+func expandTabs(line string) (string, []int) {
+	cols := make([]int, len(line)+1)
+	var out strings.Builder
+	col := 0
+	for i := 0; i < len(line); {
+		r, n := utf8.DecodeRuneInString(line[i:])
+		for j := 0; j < n; j++ {
+			cols[i+j] = col
+		}
+		i += n
+		if r == '\t' {
+			w := prettyTabWidth - col%prettyTabWidth
+			out.WriteString(strings.Repeat(" ", w))
+			col += w
+		} else {
+			out.WriteRune(r)
+			col++
+		}
+	}
+	cols[len(line)] = col
+	return out.String(), cols
+}
+
+// excerpt prints the source lines from start to end and underlines
+// the span between them using mark.
+func (o *prettyFormatter) excerpt(width int, start, end token.Position, mark, color string) {
+	fmt.Fprintf(o.W, "%s%s %s\n", strings.Repeat(" ", width), o.paint(ansiBlue, "-->"), relativePositionString(start))
+	if !start.IsValid() {
+		return
+	}
+	if _, ok := o.sources.line(start.Filename, start.Line); !ok {
+		return
+	}
+	if !end.IsValid() || end.Filename != start.Filename || end.Line < start.Line || (end.Line == start.Line && end.Column < start.Column) {
+		end = start
+	}
+
+	lines := make([]int, 0, end.Line-start.Line+1)
+	for n := start.Line; n <= end.Line; n++ {
+		lines = append(lines, n)
+	}
+	if len(lines) > prettyMaxLines {
+		// Keep the beginning and end of the span, marking the
+		// omission with a zero.
+		head := lines[:prettyMaxLines/2]
+		tail := lines[len(lines)-(prettyMaxLines/2-1):]
+		lines = append(append(head[:len(head):len(head)], 0), tail...)
+	}
+
+	fmt.Fprintln(o.W, o.gutter(width, ""))
+	for _, n := range lines {
+		if n == 0 {
+			fmt.Fprintln(o.W, o.paint(ansiBlue, fmt.Sprintf("%*s", width+2, "...")))
+			continue
+		}
+		text, ok := o.sources.line(start.Filename, n)
+		if !ok {
+			break
+		}
+		text = strings.TrimSuffix(text, "\r")
+		disp, cols := expandTabs(text)
+		fmt.Fprintf(o.W, "%s %s\n", o.gutter(width, strconv.Itoa(n)), disp)
+
+		if start.Column == 0 {
+			// We don't know which part of the line to mark
+			continue
+		}
+		from := 0
+		if n == start.Line {
+			from = start.Column - 1
+		} else {
+			// Don't underline indentation
+			from = len(text) - len(strings.TrimLeft(text, " \t"))
+		}
+		to := len(text)
+		if n == end.Line {
+			to = end.Column - 1
+		}
+		if from > len(text) {
+			from = len(text)
+		}
+		if to > len(text) {
+			to = len(text)
+		}
+		if n != start.Line && from == len(text) {
+			// Nothing to underline on empty lines
+			continue
+		}
+		c1, c2 := cols[from], cols[from]+1
+		if to > from {
+			c2 = cols[to]
+		}
+		fmt.Fprintf(o.W, "%s %s%s\n", o.gutter(width, ""), strings.Repeat(" ", c1), o.paint(color, strings.Repeat(mark, c2-c1)))
+	}
+}
+
+// fix prints a suggested fix as a diff of the lines it changes.
+func (o *prettyFormatter) fix(width int, file string, fix runner.SuggestedFix) {
+	// Group edits by file, maintaining the order of files.
+	var files []string
+	edits := map[string][]runner.TextEdit{}
+	for _, edit := range fix.TextEdits {
+		name := edit.Position.Filename
+		if _, ok := edits[name]; !ok {
+			files = append(files, name)
+		}
+		edits[name] = append(edits[name], edit)
+	}
+
+	for _, name := range files {
+		if name != file {
+			fmt.Fprintf(o.W, "%s%s %s\n", strings.Repeat(" ", width), o.paint(ansiBlue, "-->"), shortPath(name))
+		}
+		lines, first, ok := o.applyEdits(edits[name])
+		if !ok {
+			fmt.Fprintln(o.W, o.gutter(width, ""), "(source not available)")
+			continue
+		}
+		o.diff(width, lines, first)
+	}
+}
+
+type prettyEdit struct {
+	start, end int
+	text       string
+}
+
+// applyEdits applies edits to the lines they affect. It returns the
+// lines before and after applying them, and the number of the first
+// line.
+func (o *prettyFormatter) applyEdits(edits []runner.TextEdit) (lines [2][]string, first int, ok bool) {
+	first, last := -1, -1
+	for _, edit := range edits {
+		end := edit.End
+		if !end.IsValid() {
+			end = edit.Position
+		}
+		if first == -1 || edit.Position.Line < first {
+			first = edit.Position.Line
+		}
+		if end.Line > last {
+			last = end.Line
+		}
+	}
+	if first < 1 {
+		return lines, 0, false
+	}
+
+	file := edits[0].Position.Filename
+	var old []string
+	for n := first; n <= last; n++ {
+		text, ok := o.sources.line(file, n)
+		if !ok {
+			return lines, 0, false
+		}
+		old = append(old, text)
+	}
+	// offset converts a position to an offset into the joined lines.
+	offset := func(pos token.Position) int {
+		off := 0
+		for n := first; n < pos.Line; n++ {
+			off += len(old[n-first]) + 1
+		}
+		col := pos.Column - 1
+		if col < 0 {
+			col = 0
+		}
+		if col > len(old[pos.Line-first]) {
+			col = len(old[pos.Line-first])
+		}
+		return off + col
+	}
+
+	pedits := make([]prettyEdit, 0, len(edits))
+	for _, edit := range edits {
+		end := edit.End
+		if !end.IsValid() {
+			end = edit.Position
+		}
+		pedits = append(pedits, prettyEdit{offset(edit.Position), offset(end), string(edit.NewText)})
+	}
+	sort.SliceStable(pedits, func(i, j int) bool {
+		return pedits[i].start > pedits[j].start
+	})
+	text := strings.Join(old, "\n")
+	for _, edit := range pedits {
+		if edit.end < edit.start || edit.end > len(text) {
+			return lines, 0, false
+		}
+		text = text[:edit.start] + edit.text + text[edit.end:]
+	}
+	lines[0] = old
+	lines[1] = strings.Split(text, "\n")
+	return lines, first, true
+}
+
+// diff prints the removed and added lines, omitting unchanged lines at
+// the beginning and end.
+func (o *prettyFormatter) diff(width int, lines [2][]string, first int) {
+	before, after := lines[0], lines[1]
+	for len(before) > 0 && len(after) > 0 && before[0] == after[0] {
+		before, after = before[1:], after[1:]
+		first++
+	}
+	for len(before) > 0 && len(after) > 0 && before[len(before)-1] == after[len(after)-1] {
+		before, after = before[:len(before)-1], after[:len(after)-1]
+	}
+
+	fmt.Fprintln(o.W, o.gutter(width, ""))
+	for i, line := range before {
+		disp, _ := expandTabs(strings.TrimSuffix(line, "\r"))
+		fmt.Fprintf(o.W, "%s %s\n", o.paint(ansiBlue, fmt.Sprintf("%*d", width, first+i)), o.paint(ansiRed, "- "+disp))
+	}
+	for _, line := range after {
+		disp, _ := expandTabs(strings.TrimSuffix(line, "\r"))
+		fmt.Fprintf(o.W, "%s %s\n", strings.Repeat(" ", width), o.paint(ansiGreen, "+ "+disp))
+	}
+}
@@ -0,0 +1,89 @@
+package lintcmd
+
+import (
+	"bytes"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"honnef.co/go/tools/lintcmd/runner"
+)
+
+func TestExpandTabs(t *testing.T) {
+	got, cols := expandTabs("\ta\tbé")
+	if want := "    a   bé"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// "é" is two bytes but one column wide.
+	if want := []int{0, 4, 5, 8, 9, 9, 10}; !reflect.DeepEqual(cols, want) {
+		t.Errorf("got columns %v, want %v", cols, want)
+	}
+}
+
+func TestPrettyFormatter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.go")
+	src := "package a\n\nfunc fn(x bool) {\n\tif x == true {\n\t}\n}\n"
+	if err := os.WriteFile(path, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	pos := func(line, col int) token.Position {
+		return token.Position{Filename: path, Line: line, Column: col}
+	}
+
+	diag := Diagnostic{
+		Diagnostic: runner.Diagnostic{
+			Position: pos(4, 5),
+			End:      pos(4, 14),
+			Message:  "should omit comparison to bool constant",
+			Category: "S1002",
+			SuggestedFixes: []runner.SuggestedFix{{
+				Message: "simplify",
+				TextEdits: []runner.TextEdit{{
+					Position: pos(4, 5),
+					End:      pos(4, 14),
+					NewText:  []byte("x"),
+				}},
+			}},
+			Related: []runner.RelatedInformation{{
+				Position: pos(3, 9),
+				End:      pos(3, 15),
+				Message:  "x is declared here",
+			}},
+		},
+		Severity: SeverityError,
+	}
+
+	var buf bytes.Buffer
+	f := &prettyFormatter{W: &buf, DocsURL: "https://example.com/#"}
+	f.Format(nil, []Diagnostic{diag})
+	f.Stats(diagnosticCounts{total: 1, errors: 1})
+
+	// Paths are printed relative to the working directory, which we
+	// don't control.
+	got := strings.ReplaceAll(buf.String(), relativePositionString(pos(4, 5)), "a.go:4:5")
+	got = strings.ReplaceAll(got, relativePositionString(pos(3, 9)), "a.go:3:9")
+	want := `error[S1002]: should omit comparison to bool constant
+ --> a.go:4:5
+  |
+4 |     if x == true {
+  |        ^^^^^^^^^
+  = note: x is declared here
+ --> a.go:3:9
+  |
+3 | func fn(x bool) {
+  |         ------
+  = fix: simplify
+  |
+4 -     if x == true {
+  +     if x {
+
+1 problems (1 errors, 0 warnings, 0 ignored)
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
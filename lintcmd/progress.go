@@ -0,0 +1,324 @@
+package lintcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"honnef.co/go/tools/lintcmd/runner"
+)
+
+func stateName(state int) string {
+	switch state {
+	case runner.StateInitializing:
+		return "initializing"
+	case runner.StateLoadPackageGraph:
+		return "loading package graph"
+	case runner.StateBuildActionGraph:
+		return "building action graph"
+	case runner.StateProcessing:
+		return "processing"
+	case runner.StateFinalizing:
+		return "finalizing"
+	default:
+		return fmt.Sprintf("State(%d)", state)
+	}
+}
+
+// A progressReporter displays the progress of one or more concurrent
+// linter runs.
+type progressReporter interface {
+	// Add installs the reporter's hooks in r, which checks the build
+	// configuration named buildName. It must be called before r
+	// starts running.
+	Add(buildName string, r *runner.Runner)
+	// Stop finalizes the output.
+	Stop()
+}
+
+func newProgressReporter(kind string, f *os.File) progressReporter {
+	switch kind {
+	case "tty":
+		p := &ttyProgress{
+			w:        f,
+			stop:     make(chan struct{}),
+			done:     make(chan struct{}),
+			interval: ttyRefreshInterval,
+		}
+		if isTTY(f) {
+			p.columns = func() int { return terminalWidth(f) }
+		} else {
+			// Redrawing a line only works on terminals. Print
+			// complete lines, less frequently, instead.
+			p.plain = true
+			p.interval = plainRefreshInterval
+		}
+		go p.run()
+		return p
+	case "json":
+		return &jsonProgress{enc: json.NewEncoder(f)}
+	default:
+		return nil
+	}
+}
+
+type progressBuild struct {
+	name string
+	r    *runner.Runner
+}
+
+// ttyProgress displays a single, continuously updated line of
+// progress information, meant for interactive terminals. In plain
+// mode, used when the output isn't a terminal, it instead prints a
+// new line whenever the progress has changed.
+type ttyProgress struct {
+	w        io.Writer
+	stop     chan struct{}
+	done     chan struct{}
+	interval time.Duration
+	plain    bool
+	// columns returns the width of the terminal, or 0 if it is
+	// unknown.
+	columns func() int
+	// width is the width of the current line. In plain mode, last is
+	// the previously printed line.
+	width int
+	last  string
+
+	mu     sync.Mutex
+	builds []progressBuild
+}
+
+// ttyRefreshInterval is how often the progress line gets redrawn.
+const ttyRefreshInterval = 200 * time.Millisecond
+
+// plainRefreshInterval is how often progress gets printed in plain
+// mode.
+const plainRefreshInterval = 5 * time.Second
+
+// defaultColumns is the assumed width of terminals whose width we
+// can't determine.
+const defaultColumns = 80
+
+// ttySlowestPackages is the number of in-progress packages to show.
+const ttySlowestPackages = 3
+
+func (p *ttyProgress) Add(buildName string, r *runner.Runner) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.builds = append(p.builds, progressBuild{buildName, r})
+}
+
+func (p *ttyProgress) run() {
+	defer close(p.done)
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p.draw()
+		case <-p.stop:
+			p.clear()
+			return
+		}
+	}
+}
+
+func (p *ttyProgress) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+func (p *ttyProgress) line() string {
+	p.mu.Lock()
+	builds := append([]progressBuild(nil), p.builds...)
+	p.mu.Unlock()
+	if len(builds) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	if len(builds) == 1 {
+		if builds[0].name != "" {
+			fmt.Fprintf(&b, "[%s] ", builds[0].name)
+		}
+	} else {
+		fmt.Fprintf(&b, "[%d builds] ", len(builds))
+	}
+
+	type activePackage struct {
+		runner.ActivePackage
+		build string
+	}
+	var processed, total, processedInitial, initial int
+	var active []activePackage
+	processing := false
+	for _, build := range builds {
+		stats := &build.r.Stats
+		if stats.State() < runner.StateProcessing {
+			continue
+		}
+		processing = true
+		processed += stats.ProcessedPackages()
+		total += stats.TotalPackages()
+		processedInitial += stats.ProcessedInitialPackages()
+		initial += stats.InitialPackages()
+		for _, pkg := range stats.ActivePackages() {
+			active = append(active, activePackage{pkg, build.name})
+		}
+	}
+	if !processing {
+		b.WriteString(stateName(builds[0].r.Stats.State()))
+		return b.String()
+	}
+	// All runners share the same workers, see Command.Run.
+	fmt.Fprintf(&b, "packages %d/%d (%d/%d initial), workers %d/%d",
+		processed,
+		total,
+		processedInitial,
+		initial,
+		builds[0].r.ActiveWorkers(),
+		builds[0].r.TotalWorkers(),
+	)
+	sort.SliceStable(active, func(i, j int) bool {
+		return active[i].Start.Before(active[j].Start)
+	})
+	if len(active) > ttySlowestPackages {
+		active = active[:ttySlowestPackages]
+	}
+	now := time.Now()
+	for i, pkg := range active {
+		if i == 0 {
+			b.WriteString("; slowest: ")
+		} else {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s", pkg.Package)
+		if len(builds) > 1 && pkg.build != "" {
+			fmt.Fprintf(&b, " [%s]", pkg.build)
+		}
+		fmt.Fprintf(&b, " (%s)", now.Sub(pkg.Start).Truncate(100*time.Millisecond))
+	}
+	return b.String()
+}
+
+func (p *ttyProgress) draw() {
+	s := p.line()
+	if p.plain {
+		if s != "" && s != p.last {
+			fmt.Fprintln(p.w, s)
+			p.last = s
+		}
+		return
+	}
+
+	cols := p.columns()
+	if cols <= 0 {
+		cols = defaultColumns
+	}
+	// Leave the last column empty, as some terminals wrap the line
+	// once it is filled.
+	s = truncateLine(s, cols-1)
+	n := utf8.RuneCountInString(s)
+	pad := ""
+	if p.width > n {
+		// Overwrite leftovers of a previous, longer line.
+		pad = strings.Repeat(" ", p.width-n)
+	}
+	p.width = n
+	fmt.Fprintf(p.w, "\r%s%s", s, pad)
+}
+
+// truncateLine shortens s to at most n runes, marking the truncation
+// with an ellipsis.
+func truncateLine(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+func (p *ttyProgress) clear() {
+	if p.plain {
+		return
+	}
+	if p.width > 0 {
+		fmt.Fprintf(p.w, "\r%s\r", strings.Repeat(" ", p.width))
+		p.width = 0
+	}
+}
+
+// jsonProgress emits progress events as newline-delimited JSON.
+type jsonProgress struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type jsonProgressEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+	Build string    `json:"build,omitempty"`
+	State string    `json:"state,omitempty"`
+
+	Package  string `json:"package,omitempty"`
+	Initial  bool   `json:"initial,omitempty"`
+	Cached   bool   `json:"cached,omitempty"`
+	Failed   bool   `json:"failed,omitempty"`
+	Duration int64  `json:"duration_ns,omitempty"`
+
+	Processed        int `json:"processed"`
+	Total            int `json:"total"`
+	ProcessedInitial int `json:"processed_initial"`
+	TotalInitial     int `json:"total_initial"`
+}
+
+func (p *jsonProgress) Add(buildName string, r *runner.Runner) {
+	r.Stats.OnStateChange = func(state int) {
+		p.emit(buildName, r, jsonProgressEvent{
+			Event: "state",
+			State: stateName(state),
+		})
+	}
+	r.Stats.OnPackageFinished = func(ev runner.PackageEvent) {
+		p.emit(buildName, r, jsonProgressEvent{
+			Event:    "package",
+			Package:  ev.Package.ID,
+			Initial:  ev.Initial,
+			Cached:   ev.Cached,
+			Failed:   ev.Failed,
+			Duration: ev.Duration.Nanoseconds(),
+		})
+	}
+}
+
+func (p *jsonProgress) Stop() {
+	p.emit("", nil, jsonProgressEvent{Event: "done"})
+}
+
+func (p *jsonProgress) emit(buildName string, r *runner.Runner, ev jsonProgressEvent) {
+	ev.Time = time.Now()
+	ev.Build = buildName
+	if r != nil {
+		stats := &r.Stats
+		ev.Processed = stats.ProcessedPackages()
+		ev.Total = stats.TotalPackages()
+		ev.ProcessedInitial = stats.ProcessedInitialPackages()
+		ev.TotalInitial = stats.InitialPackages()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// There is nothing useful we can do if writing progress
+	// information fails.
+	_ = p.enc.Encode(ev)
+}
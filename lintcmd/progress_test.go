@@ -0,0 +1,65 @@
+package lintcmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestProgressTotalPackages(t *testing.T) {
+	// The synthetic root of the action graph isn't a package and
+	// mustn't be counted, so that the total matches the number of
+	// packages that get processed.
+	var buf bytes.Buffer
+	p := &jsonProgress{enc: json.NewEncoder(&buf)}
+	_, err := doLint(context.Background(), s1002(), []string{"./testdata/src/lintapi"}, &options{
+		GoVersion: "module",
+		Progress:  p,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var packages, processed, total int
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var ev jsonProgressEvent
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Event != "package" {
+			continue
+		}
+		packages++
+		if ev.Processed > processed {
+			processed = ev.Processed
+		}
+		total = ev.Total
+	}
+	if packages == 0 {
+		t.Fatal("got no package events")
+	}
+	if processed != packages || total != packages {
+		t.Errorf("got %d processed and %d total packages, want %d", processed, total, packages)
+	}
+}
+
+func TestTruncateLine(t *testing.T) {
+	tests := []struct {
+		in   string
+		n    int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello", 4, "hel…"},
+		{"héllo", 3, "hé…"},
+		{"hello", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := truncateLine(tt.in, tt.n); got != tt.want {
+			t.Errorf("truncateLine(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	tsync "honnef.co/go/tools/internal/sync"
+	"honnef.co/go/tools/lintcmd/cache"
+)
+
+// A Group coordinates Runners that run concurrently, for example to
+// check several build configurations at once. Runners in a group
+// share a single worker budget and memory budget, and when several
+// of them need to analyze a package with identical inputs, the
+// package is analyzed only once and the others reuse the cached
+// result.
+//
+// All runners in a group must use the same cache and target the same
+// Go version.
+type Group struct {
+	semaphore tsync.Semaphore
+	memory    *memoryBudget
+
+	mu       sync.Mutex
+	inflight map[cache.ActionID]chan struct{}
+	// the Go version the analyzers' flags have been set to
+	goVersion string
+}
+
+// NewGroup returns a new group. Workers is the total number of
+// workers shared by all runners in the group; if it is zero or
+// negative, GOMAXPROCS is used. If maxMemory is non-zero, it is a
+// memory budget shared by all runners, and the MaxMemory fields of
+// the runners are ignored.
+func NewGroup(workers int, maxMemory uint64) *Group {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	g := &Group{
+		semaphore: tsync.NewSemaphore(workers),
+		inflight:  map[cache.ActionID]chan struct{}{},
+	}
+	if maxMemory > 0 {
+		g.memory = newMemoryBudget(maxMemory)
+	}
+	return g
+}
+
+// claim marks the action with the given ID as being in progress. If
+// another runner is already working on it, claim waits for it to
+// finish, after which the action's results will usually be cached.
+// The caller must call the returned function when it is done with the
+// action.
+//
+// claim may be called on a nil group, in which case it never waits.
+func (g *Group) claim(id cache.ActionID) (done func()) {
+	if g == nil {
+		return func() {}
+	}
+	g.mu.Lock()
+	for {
+		ch, ok := g.inflight[id]
+		if !ok {
+			break
+		}
+		g.mu.Unlock()
+		<-ch
+		g.mu.Lock()
+	}
+	ch := make(chan struct{})
+	g.inflight[id] = ch
+	g.mu.Unlock()
+
+	return func() {
+		g.mu.Lock()
+		delete(g.inflight, id)
+		g.mu.Unlock()
+		close(ch)
+	}
+}
+
+// setGoVersion records the Go version targeted by a runner in the
+// group. Only the first runner calls set, which configures the
+// analyzers' flags; the analyzers are shared by all runners and must
+// not be modified while others are using them.
+func (g *Group) setGoVersion(v string, set func() error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.goVersion == "" {
+		if err := set(); err != nil {
+			return err
+		}
+		g.goVersion = v
+		return nil
+	}
+	if g.goVersion != v {
+		return fmt.Errorf("runners in the same group target different Go versions, %s and %s", g.goVersion, v)
+	}
+	return nil
+}
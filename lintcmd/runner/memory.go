@@ -0,0 +1,176 @@
+package runner
+
+import (
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+
+	"honnef.co/go/tools/go/loader"
+)
+
+// These factors translate the on-disk size of a package's inputs into
+// a rough estimate of the memory needed to analyze it. Source code
+// grows considerably once it has been parsed, type-checked and
+// converted to IR, while export data is comparatively compact in
+// memory. The numbers are deliberately pessimistic; underestimating
+// leads to OOM kills, overestimating merely to less parallelism.
+const (
+	sourceCostFactor = 48
+	exportCostFactor = 6
+	// fixed overhead per package and per imported package, covering
+	// things like the FileSet, maps of facts and analyzer bookkeeping.
+	basePackageCost = 4 << 20
+	baseImportCost  = 64 << 10
+)
+
+// estimateMemory estimates the number of bytes of memory that
+// analyzing spec will require. The estimate is based on the sizes of
+// the package's source files and the export data of its direct
+// dependencies.
+func estimateMemory(spec *loader.PackageSpec) uint64 {
+	if spec == nil {
+		return 0
+	}
+	size := func(path string) uint64 {
+		if path == "" {
+			return 0
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return 0
+		}
+		return uint64(fi.Size())
+	}
+
+	cost := uint64(basePackageCost)
+	for _, f := range spec.CompiledGoFiles {
+		if b, ok := spec.Overlay[f]; ok {
+			cost += uint64(len(b)) * sourceCostFactor
+		} else {
+			cost += size(f) * sourceCostFactor
+		}
+	}
+	for _, imp := range spec.Imports {
+		cost += baseImportCost + size(imp.ExportFile)*exportCostFactor
+	}
+	return cost
+}
+
+// heapSample is the runtime/metrics sample describing the amount of
+// memory occupied by live and not-yet-swept heap objects.
+const heapSample = "/memory/classes/heap/objects:bytes"
+
+func readHeap() uint64 {
+	sample := []metrics.Sample{{Name: heapSample}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// memoryBudget limits the number of packages that are being processed
+// concurrently, based on their estimated memory usage and the actual
+// size of the heap.
+//
+// A budget never prevents progress: if no packages are being
+// processed, the next package will be admitted regardless of its
+// cost. In the worst case, processing degrades to a single worker.
+//
+// Budgets report their decisions to the Stats of the runner that is
+// asking, which allows a single budget to be shared by several
+// runners.
+type memoryBudget struct {
+	limit uint64
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	reserved uint64
+	active   int
+	waiting  int
+}
+
+func newMemoryBudget(limit uint64) *memoryBudget {
+	b := &memoryBudget{
+		limit: limit,
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// fits reports whether an additional cost bytes fit in the budget.
+// The caller must hold b.mu.
+func (b *memoryBudget) fits(cost uint64, stats *Stats) bool {
+	if b.active == 0 {
+		return true
+	}
+	if b.reserved+cost > b.limit {
+		return false
+	}
+	heap := readHeap()
+	stats.observeHeap(heap)
+	return heap+cost <= b.limit
+}
+
+// acquire blocks until cost bytes can be reserved. A nil budget
+// admits everything.
+func (b *memoryBudget) acquire(cost uint64, stats *Stats) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	deferred := false
+	for !b.fits(cost, stats) {
+		if !deferred {
+			deferred = true
+			stats.deferPackage()
+		}
+		b.waiting++
+		b.cond.Wait()
+		b.waiting--
+	}
+	b.active++
+	b.reserved += cost
+	stats.setReservedMemory(b.reserved)
+}
+
+// release returns a reservation made by acquire.
+func (b *memoryBudget) release(cost uint64, stats *Stats) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.active--
+	b.reserved -= cost
+	stats.setReservedMemory(b.reserved)
+	waiting := b.waiting > 0
+	b.mu.Unlock()
+	if waiting {
+		// The heap may consist largely of garbage left behind by
+		// packages that have finished processing. Collect it before
+		// the waiters check whether they fit.
+		runtime.GC()
+	}
+	b.cond.Broadcast()
+}
+
+// allowsConcurrency reports whether there is enough headroom in the
+// budget to run additional analyzers in parallel. Unlike acquire, it
+// never blocks; when there is no headroom, analyzers will run
+// sequentially under their package's token.
+func (b *memoryBudget) allowsConcurrency(stats *Stats) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	heap := readHeap()
+	stats.observeHeap(heap)
+	if heap < b.limit && b.reserved < b.limit {
+		return true
+	}
+	stats.throttleAnalyzer()
+	return false
+}
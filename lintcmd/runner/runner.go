@@ -56,6 +56,21 @@
 // the dependency graph. A lot of inter-connected packages will see
 // less parallelism than a lot of independent packages.
 //
+// Parallelism can additionally be bounded by a memory budget. Before
+// a package gets processed, its memory usage is estimated from the
+// sizes of its source files and the export data of its dependencies.
+// The package is only admitted if the sum of all estimates, as well
+// as the actual size of the heap, stays within the budget. Analyzers
+// of a package only run in parallel if there is headroom left. When
+// memory is tight, this degrades to fewer workers, down to a single
+// one, but it never prevents progress.
+//
+// Several runners can be combined into a Group, which makes them share
+// a single semaphore and memory budget. When runners in a group need
+// to analyze packages with identical cache keys at the same time, only
+// one of them does the work, and the others wait for it and load the
+// results from the cache.
+//
 // Caching
 //
 // The runner caches facts, directives and diagnostics in a
@@ -113,6 +128,8 @@ package runner
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/gob"
 	"fmt"
 	"go/token"
@@ -122,15 +139,19 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"runtime/debug"
 	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"honnef.co/go/tools/analysis/lint"
 	"honnef.co/go/tools/analysis/report"
 	"honnef.co/go/tools/config"
+	"honnef.co/go/tools/go/ir"
 	"honnef.co/go/tools/go/loader"
+	"honnef.co/go/tools/internal/passes/buildir"
 	tsync "honnef.co/go/tools/internal/sync"
 	"honnef.co/go/tools/lintcmd/cache"
 	"honnef.co/go/tools/unused"
@@ -183,10 +204,44 @@ type Result struct {
 
 	Failed bool
 	Errors []error
-	// Action results, path to file
-	results string
-	// Results relevant to testing, only set when test mode is enabled, path to file
-	testData string
+	// Crashes contains diagnostics describing analyzers that panicked
+	// or timed out while analyzing the package. Unlike Errors, crashes
+	// do not mark the result as failed; the diagnostics of all other
+	// analyzers are still available. Crashes are reported for
+	// dependencies, too.
+	Crashes []Diagnostic
+	// Action results
+	results storedData
+	// Results relevant to testing, only set when test mode is enabled
+	testData storedData
+	// Encoded IR, only set when IR caching is enabled
+	ir storedData
+}
+
+// storedData refers to serialized data produced by a package action.
+// Usually the data lives in the cache and path is the path of the
+// cached file. Data that mustn't be cached is held in memory instead.
+type storedData struct {
+	path string
+	data []byte
+}
+
+func (d storedData) isZero() bool {
+	return d.path == "" && d.data == nil
+}
+
+func (d storedData) open() (io.ReadCloser, error) {
+	if d.data != nil {
+		return ioutil.NopCloser(bytes.NewReader(d.data)), nil
+	}
+	return os.Open(d.path)
+}
+
+func (d storedData) hash() ([cache.HashSize]byte, error) {
+	if d.data != nil {
+		return sha256.Sum256(d.data), nil
+	}
+	return cache.FileHash(d.path)
 }
 
 type SerializedDirective struct {
@@ -217,11 +272,11 @@ func (r Result) Load() (ResultData, error) {
 	if r.Failed {
 		panic("Load called on failed Result")
 	}
-	if r.results == "" {
+	if r.results.isZero() {
 		// this package was only a dependency
 		return ResultData{}, nil
 	}
-	f, err := os.Open(r.results)
+	f, err := r.results.open()
 	if err != nil {
 		return ResultData{}, fmt.Errorf("failed loading result: %w", err)
 	}
@@ -253,11 +308,11 @@ func (r Result) LoadTest() (TestData, error) {
 	if r.Failed {
 		panic("Load called on failed Result")
 	}
-	if r.results == "" {
+	if r.results.isZero() {
 		// this package was only a dependency
 		return TestData{}, nil
 	}
-	f, err := os.Open(r.testData)
+	f, err := r.testData.open()
 	if err != nil {
 		return TestData{}, fmt.Errorf("failed loading test data: %w", err)
 	}
@@ -267,6 +322,31 @@ func (r Result) LoadTest() (TestData, error) {
 	return out, err
 }
 
+// LoadIR decodes the package's cached IR into prog. pkg must be the
+// type information of the package. It should only be called if
+// Runner.CacheIR was set to true.
+func (r Result) LoadIR(prog *ir.Program, pkg *types.Package) (*ir.Package, error) {
+	if r.Failed {
+		panic("LoadIR called on failed Result")
+	}
+	if r.ir.isZero() {
+		return nil, fmt.Errorf("no IR cached for package %s", r.Package.PkgPath)
+	}
+	f, err := r.ir.open()
+	if err != nil {
+		return nil, fmt.Errorf("failed loading IR: %w", err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading IR: %w", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no IR cached for package %s", r.Package.PkgPath)
+	}
+	return prog.DecodePackage(pkg, bytes.NewReader(data))
+}
+
 type action interface {
 	Deps() []action
 	Triggers() []action
@@ -315,16 +395,40 @@ type packageAction struct {
 
 	// Action results
 	cfg      config.Config
-	vetx     string
-	results  string
-	testData string
+	vetx     storedData
+	results  storedData
+	testData storedData
+	ir       storedData
 	skipped  bool
+	crashes  []Diagnostic
+	// uncacheable is set if an analyzer crashed while analyzing the
+	// package or any of its dependencies. Crashes, and particularly
+	// timeouts, may not be reproducible, so results derived from them
+	// are kept in memory instead of being cached.
+	uncacheable bool
+	// the lane of the worker processing the package
+	lane int
 }
 
 func (act *packageAction) String() string {
 	return fmt.Sprintf("packageAction(%s)", act.Package)
 }
 
+func (act *packageAction) result() Result {
+	return Result{
+		Package:  act.Package,
+		Config:   act.cfg,
+		Initial:  !act.factsOnly,
+		Skipped:  act.skipped,
+		Failed:   act.failed,
+		Errors:   act.errors,
+		Crashes:  act.crashes,
+		results:  act.results,
+		testData: act.testData,
+		ir:       act.ir,
+	}
+}
+
 type objectFact struct {
 	fact analysis.Fact
 	// TODO(dh): why do we store the objectpath when producing the
@@ -376,6 +480,39 @@ type analyzerAction struct {
 	ObjectFacts  map[objectFactKey]objectFact
 	PackageFacts map[packageFactKey]analysis.Fact
 	Pass         *analysis.Pass
+
+	// mu guards the action's results against an analyzer that keeps
+	// running after we've abandoned it because of a timeout.
+	mu        sync.Mutex
+	abandoned bool
+}
+
+// analyzerCrash describes an analyzer that panicked or timed out.
+type analyzerCrash struct {
+	Analyzer string
+	Package  string
+	// Panic is the value the analyzer panicked with, and Stack the
+	// stack trace at the time of the panic. Both are unset if the
+	// analyzer timed out.
+	Panic interface{}
+	Stack []byte
+	// Timeout is set if the analyzer was abandoned because it ran for
+	// too long.
+	Timeout time.Duration
+}
+
+func (err *analyzerCrash) Error() string {
+	if err.Timeout != 0 {
+		return fmt.Sprintf("analyzer %s timed out after %s while analyzing package %s", err.Analyzer, err.Timeout, err.Package)
+	}
+	return fmt.Sprintf("analyzer %s panicked while analyzing package %s: %v\n\n%s", err.Analyzer, err.Package, err.Panic, err.Stack)
+}
+
+func (err *analyzerCrash) category() string {
+	if err.Timeout != 0 {
+		return "timeout"
+	}
+	return "crash"
 }
 
 func (act *analyzerAction) String() string {
@@ -391,6 +528,36 @@ type Runner struct {
 	FallbackGoVersion string
 	// If set to true, Runner will populate results with data relevant to testing analyzers
 	TestMode bool
+	// If set to true, Runner will cache the IR of all packages that
+	// buildir.Analyzer ran on, including dependencies. It can be
+	// loaded with Result.LoadIR.
+	CacheIR bool
+	// If set to true, configuration files outside of a package's
+	// module don't apply to the package
+	ModuleConfigs bool
+	// If non-zero, the approximate maximum number of bytes of memory
+	// to use. Parallelism will be reduced to stay within this budget.
+	MaxMemory uint64
+	// If set, OnResult will be called with the result of each package
+	// as soon as the package has been processed. It may be called
+	// concurrently from multiple goroutines. Packages that could not
+	// be processed at all, for example because they or their
+	// dependencies failed to load, are only included in the results
+	// returned by Run.
+	OnResult func(Result)
+	// If non-zero, the maximum amount of time a single analyzer may
+	// spend on a single package. Analyzers that exceed it are
+	// abandoned and reported as having timed out. Note that abandoned
+	// analyzers cannot be stopped. Their goroutines keep running in
+	// the background, using CPU time and holding on to the package
+	// they were analyzing, until the analyzer returns on its own. This
+	// memory isn't accounted for by MaxMemory. Use
+	// Stats.AbandonedAnalyzers to find out how many are still running.
+	AnalyzerTimeout time.Duration
+	// If set, the runner shares its workers, its memory budget and
+	// in-progress work with the other runners in the group. It must
+	// be set before calling Run.
+	Group *Group
 
 	// GoVersion might be "module"; actualGoVersion contains the resolved version
 	actualGoVersion string
@@ -399,10 +566,39 @@ type Runner struct {
 	cfg       config.Config
 	cache     *cache.Cache
 	semaphore tsync.Semaphore
+	memory    *memoryBudget
+	lanes     laneAllocator
+}
+
+// A laneAllocator assigns small integers to concurrently running
+// workers, for the purpose of displaying timelines.
+type laneAllocator struct {
+	mu   sync.Mutex
+	used []bool
+}
+
+func (l *laneAllocator) acquire() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, used := range l.used {
+		if !used {
+			l.used[i] = true
+			return i
+		}
+	}
+	l.used = append(l.used, true)
+	return len(l.used) - 1
+}
+
+func (l *laneAllocator) release(lane int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.used[lane] = false
 }
 
 type subrunner struct {
 	*Runner
+	ctx           context.Context
 	analyzers     []*analysis.Analyzer
 	factAnalyzers []*analysis.Analyzer
 	analyzerNames string
@@ -418,7 +614,7 @@ func New(cfg config.Config, c *cache.Cache) (*Runner, error) {
 	}, nil
 }
 
-func newSubrunner(r *Runner, analyzers []*analysis.Analyzer) *subrunner {
+func newSubrunner(ctx context.Context, r *Runner, analyzers []*analysis.Analyzer) *subrunner {
 	analyzerNames := make([]string, len(analyzers))
 	for i, a := range analyzers {
 		analyzerNames[i] = a.Name
@@ -433,6 +629,7 @@ func newSubrunner(r *Runner, analyzers []*analysis.Analyzer) *subrunner {
 	}
 	return &subrunner{
 		Runner:        r,
+		ctx:           ctx,
 		analyzers:     analyzers,
 		factAnalyzers: factAnalyzers,
 		analyzerNames: strings.Join(analyzerNames, ","),
@@ -510,24 +707,42 @@ func newAnalyzerAction(an *analysis.Analyzer, cache map[*analysis.Analyzer]*anal
 	return a
 }
 
-func getCachedFiles(cache *cache.Cache, ids []cache.ActionID, out []*string) error {
+func getCachedFiles(cache *cache.Cache, ids []cache.ActionID, out []*storedData) error {
 	for i, id := range ids {
-		var err error
-		*out[i], _, err = cache.GetFile(id)
+		path, _, err := cache.GetFile(id)
 		if err != nil {
 			return err
 		}
+		*out[i] = storedData{path: path}
 	}
 	return nil
 }
 
-func (r *subrunner) do(act action) error {
+func (r *subrunner) do(act action) (err error) {
 	a := act.(*packageAction)
+	start := time.Now()
+	cached := true
+	a.lane = r.lanes.acquire()
+	r.Stats.startPackage(a.Package, start)
 	defer func() {
-		r.Stats.finishPackage()
-		if !a.factsOnly {
-			r.Stats.finishInitialPackage()
-		}
+		r.lanes.release(a.lane)
+		r.Stats.emitSpan(Span{
+			Kind:     SpanPackage,
+			Package:  a.Package,
+			Lane:     a.lane,
+			Start:    start,
+			Duration: time.Since(start),
+			Initial:  !a.factsOnly,
+			Cached:   cached,
+		})
+		r.Stats.finishPackage(PackageEvent{
+			Package:  a.Package,
+			Initial:  !a.factsOnly,
+			Cached:   cached,
+			Failed:   a.failed || err != nil,
+			Start:    start,
+			Duration: time.Since(start),
+		})
 	}()
 
 	// compute hash of action
@@ -563,24 +778,43 @@ func (r *subrunner) do(act action) error {
 	// vetx?
 	for _, dep := range a.deps {
 		dep := dep.(*packageAction)
-		vetxHash, err := cache.FileHash(dep.vetx)
+		vetxHash, err := dep.vetx.hash()
 		if err != nil {
 			return fmt.Errorf("failed computing hash: %w", err)
 		}
 		fmt.Fprintf(h, "vetout %q %x\n", dep.Package.PkgPath, vetxHash)
+		if dep.uncacheable {
+			a.uncacheable = true
+		}
 	}
 	a.hash = cache.ActionID(h.Sum())
 
+	// If another runner in our group is already analyzing a package
+	// with the same inputs, wait for it and reuse its results.
+	done := r.Group.claim(a.hash)
+	defer done()
+
 	// try to fetch hashed data
-	ids := make([]cache.ActionID, 0, 2)
+	ids := make([]cache.ActionID, 0, 4)
+	outs := make([]*storedData, 0, 4)
 	ids = append(ids, cache.Subkey(a.hash, "vetx"))
+	outs = append(outs, &a.vetx)
 	if !a.factsOnly {
 		ids = append(ids, cache.Subkey(a.hash, "results"))
+		outs = append(outs, &a.results)
 		if r.TestMode {
 			ids = append(ids, cache.Subkey(a.hash, "testdata"))
+			outs = append(outs, &a.testData)
 		}
 	}
-	if err := getCachedFiles(r.cache, ids, []*string{&a.vetx, &a.results, &a.testData}); err != nil {
+	if r.CacheIR {
+		ids = append(ids, cache.Subkey(a.hash, "ir"))
+		outs = append(outs, &a.ir)
+	}
+	// Results derived from crashes are never cached, so don't bother
+	// looking for them.
+	if a.uncacheable || getCachedFiles(r.cache, ids, outs) != nil {
+		cached = false
 		result, err := r.doUncached(a)
 		if err != nil {
 			return err
@@ -590,6 +824,10 @@ func (r *subrunner) do(act action) error {
 		}
 
 		a.skipped = result.skipped
+		a.crashes = result.crashes
+		if len(a.crashes) > 0 {
+			a.uncacheable = true
+		}
 
 		// OPT(dh) instead of collecting all object facts and encoding
 		// them after analysis finishes, we could encode them as we
@@ -615,6 +853,15 @@ func (r *subrunner) do(act action) error {
 			return err
 		}
 
+		if r.CacheIR {
+			// We cache the IR even if it is empty, so that packages
+			// without IR don't cause cache misses.
+			a.ir, err = r.writeCacheReader(a, "ir", bytes.NewReader(result.ir))
+			if err != nil {
+				return err
+			}
+		}
+
 		if a.factsOnly {
 			return nil
 		}
@@ -646,37 +893,53 @@ func (r *subrunner) do(act action) error {
 	return nil
 }
 
+// workers returns the semaphore bounding the runner's parallelism.
+func (r *Runner) workers() *tsync.Semaphore {
+	if r.Group != nil {
+		return &r.Group.semaphore
+	}
+	return &r.semaphore
+}
+
 // ActiveWorkers returns the number of currently running workers.
+// For runners in a group, this includes the workers of all runners.
 func (r *Runner) ActiveWorkers() int {
-	return r.semaphore.Len()
+	return r.workers().Len()
 }
 
 // TotalWorkers returns the maximum number of possible workers.
 func (r *Runner) TotalWorkers() int {
-	return r.semaphore.Cap()
+	return r.workers().Cap()
 }
 
-func (r *Runner) writeCacheReader(a *packageAction, kind string, rs io.ReadSeeker) (string, error) {
+func (r *Runner) writeCacheReader(a *packageAction, kind string, rs io.ReadSeeker) (storedData, error) {
+	if a.uncacheable {
+		data, err := ioutil.ReadAll(rs)
+		if err != nil {
+			return storedData{}, err
+		}
+		return storedData{data: data}, nil
+	}
 	h := cache.Subkey(a.hash, kind)
 	out, _, err := r.cache.Put(h, rs)
 	if err != nil {
-		return "", fmt.Errorf("failed caching data: %w", err)
+		return storedData{}, fmt.Errorf("failed caching data: %w", err)
 	}
-	return r.cache.OutputFile(out), nil
+	return storedData{path: r.cache.OutputFile(out)}, nil
 }
 
-func (r *Runner) writeCacheGob(a *packageAction, kind string, data interface{}) (string, error) {
+func (r *Runner) writeCacheGob(a *packageAction, kind string, data interface{}) (storedData, error) {
 	f, err := ioutil.TempFile("", "staticcheck")
 	if err != nil {
-		return "", err
+		return storedData{}, err
 	}
 	defer f.Close()
 	os.Remove(f.Name())
 	if err := gob.NewEncoder(f).Encode(data); err != nil {
-		return "", fmt.Errorf("failed gob encoding data: %w", err)
+		return storedData{}, fmt.Errorf("failed gob encoding data: %w", err)
 	}
 	if _, err := f.Seek(0, io.SeekStart); err != nil {
-		return "", err
+		return storedData{}, err
 	}
 	return r.writeCacheReader(a, kind, f)
 }
@@ -684,10 +947,12 @@ func (r *Runner) writeCacheGob(a *packageAction, kind string, data interface{})
 type packageActionResult struct {
 	facts   []gobFact
 	diags   []Diagnostic
+	crashes []Diagnostic
 	unused  unused.SerializedResult
 	dirs    []lint.Directive
 	lpkg    *loader.Package
 	skipped bool
+	ir      []byte
 
 	// Only set when using test mode
 	testFacts []TestFact
@@ -699,7 +964,15 @@ func (r *subrunner) doUncached(a *packageAction) (packageActionResult, error) {
 	// processed concurrently, we shouldn't load b's export data
 	// twice.
 
+	t := time.Now()
 	pkg, _, err := loader.Load(a.Package)
+	r.Stats.emitSpan(Span{
+		Kind:     SpanLoad,
+		Package:  a.Package,
+		Lane:     a.lane,
+		Start:    t,
+		Duration: time.Since(t),
+	})
 	if err != nil {
 		return packageActionResult{}, err
 	}
@@ -763,9 +1036,11 @@ func (r *subrunner) doUncached(a *packageAction) (packageActionResult, error) {
 		testFacts: res.testFacts,
 		wants:     wants,
 		diags:     res.diagnostics,
+		crashes:   res.crashes,
 		unused:    res.unused,
 		dirs:      dirs,
 		lpkg:      pkg,
+		ir:        res.ir,
 	}, err
 }
 
@@ -787,7 +1062,7 @@ func pkgPaths(root *types.Package) map[string]*types.Package {
 
 func (r *Runner) loadFacts(root *types.Package, dep *packageAction, objFacts map[objectFactKey]objectFact, pkgFacts map[packageFactKey]analysis.Fact) error {
 	// Load facts of all imported packages
-	vetx, err := os.Open(dep.vetx)
+	vetx, err := dep.vetx.open()
 	if err != nil {
 		return fmt.Errorf("failed loading cached facts: %w", err)
 	}
@@ -828,11 +1103,14 @@ func (r *Runner) loadFacts(root *types.Package, dep *packageAction, objFacts map
 	return nil
 }
 
-func genericHandle(a action, root action, queue chan action, sem *tsync.Semaphore, exec func(a action) error) {
+// genericHandle executes a and schedules the actions it triggers. If
+// release isn't nil, it is called after executing a, but before
+// scheduling its triggers.
+func genericHandle(a action, root action, queue chan action, release func(), exec func(a action) error) {
 	if a == root {
 		close(queue)
-		if sem != nil {
-			sem.Release()
+		if release != nil {
+			release()
 		}
 		return
 	}
@@ -859,8 +1137,8 @@ func genericHandle(a action, root action, queue chan action, sem *tsync.Semaphor
 			a.AddError(err)
 		}
 	}
-	if sem != nil {
-		sem.Release()
+	if release != nil {
+		release()
 	}
 
 	for _, t := range a.Triggers() {
@@ -879,11 +1157,16 @@ type analyzerRunner struct {
 	// analyzers other than the current one
 	depPkgFacts map[packageFactKey]analysis.Fact
 	factsOnly   bool
+	timeout     time.Duration
+	ctx         context.Context
 
 	stats *Stats
 }
 
-func (ar *analyzerRunner) do(act action) error {
+func (ar *analyzerRunner) do(act action, lane int) error {
+	if err := ar.ctx.Err(); err != nil {
+		return err
+	}
 	a := act.(*analyzerAction)
 	results := map[*analysis.Analyzer]interface{}{}
 	// TODO(dh): does this have to be recursive?
@@ -913,7 +1196,9 @@ func (ar *analyzerRunner) do(act action) error {
 		TypesInfo:  ar.pkg.TypesInfo,
 		TypesSizes: ar.pkg.TypesSizes,
 		Report: func(diag analysis.Diagnostic) {
-			if !ar.factsOnly {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			if !ar.factsOnly && !a.abandoned {
 				if diag.Category == "" {
 					diag.Category = a.Analyzer.Name
 				}
@@ -955,7 +1240,10 @@ func (ar *analyzerRunner) do(act action) error {
 			if f, ok := ar.depObjFacts[key]; ok {
 				reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(f.fact).Elem())
 				return true
-			} else if f, ok := a.ObjectFacts[key]; ok {
+			}
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			if f, ok := a.ObjectFacts[key]; ok {
 				reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(f.fact).Elem())
 				return true
 			}
@@ -969,7 +1257,10 @@ func (ar *analyzerRunner) do(act action) error {
 			if f, ok := ar.depPkgFacts[key]; ok {
 				reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(f).Elem())
 				return true
-			} else if f, ok := a.PackageFacts[key]; ok {
+			}
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			if f, ok := a.PackageFacts[key]; ok {
 				reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(f).Elem())
 				return true
 			}
@@ -981,16 +1272,26 @@ func (ar *analyzerRunner) do(act action) error {
 				Type: reflect.TypeOf(fact),
 			}
 			path, _ := objectpath.For(obj)
-			a.ObjectFacts[key] = objectFact{fact, path}
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			if !a.abandoned {
+				a.ObjectFacts[key] = objectFact{fact, path}
+			}
 		},
 		ExportPackageFact: func(fact analysis.Fact) {
 			key := packageFactKey{
 				Pkg:  ar.pkg.Types,
 				Type: reflect.TypeOf(fact),
 			}
-			a.PackageFacts[key] = fact
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			if !a.abandoned {
+				a.PackageFacts[key] = fact
+			}
 		},
 		AllPackageFacts: func() []analysis.PackageFact {
+			a.mu.Lock()
+			defer a.mu.Unlock()
 			out := make([]analysis.PackageFact, 0, len(ar.depPkgFacts)+len(a.PackageFacts))
 			for key, fact := range ar.depPkgFacts {
 				out = append(out, analysis.PackageFact{
@@ -1007,6 +1308,8 @@ func (ar *analyzerRunner) do(act action) error {
 			return out
 		},
 		AllObjectFacts: func() []analysis.ObjectFact {
+			a.mu.Lock()
+			defer a.mu.Unlock()
 			out := make([]analysis.ObjectFact, 0, len(ar.depObjFacts)+len(a.ObjectFacts))
 			for key, fact := range ar.depObjFacts {
 				if filterFactType(key.Type) {
@@ -1029,8 +1332,17 @@ func (ar *analyzerRunner) do(act action) error {
 	}
 
 	t := time.Now()
-	res, err := a.Analyzer.Run(a.Pass)
-	ar.stats.measureAnalyzer(a.Analyzer, ar.pkg.PackageSpec, time.Since(t))
+	res, err := ar.run(a)
+	d := time.Since(t)
+	ar.stats.measureAnalyzer(a.Analyzer, ar.pkg.PackageSpec, d)
+	ar.stats.emitSpan(Span{
+		Kind:     SpanAnalyzer,
+		Package:  ar.pkg.PackageSpec,
+		Analyzer: a.Analyzer,
+		Lane:     lane,
+		Start:    t,
+		Duration: d,
+	})
 	if err != nil {
 		return err
 	}
@@ -1038,24 +1350,111 @@ func (ar *analyzerRunner) do(act action) error {
 	return nil
 }
 
+// run runs the action's analyzer, converting panics into errors of
+// type *analyzerCrash. If a timeout is set and the analyzer doesn't
+// finish in time, or if the context gets canceled, it gets abandoned.
+// There is no way to stop an abandoned analyzer; its goroutine exits
+// only once the analyzer returns, and it is counted by
+// Stats.AbandonedAnalyzers until then.
+func (ar *analyzerRunner) run(a *analyzerAction) (interface{}, error) {
+	run := func() (res interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &analyzerCrash{
+					Analyzer: a.Analyzer.Name,
+					Package:  ar.pkg.ID,
+					Panic:    r,
+					Stack:    debug.Stack(),
+				}
+			}
+		}()
+		return a.Analyzer.Run(a.Pass)
+	}
+
+	if ar.timeout == 0 && ar.ctx.Done() == nil {
+		return run()
+	}
+
+	type result struct {
+		res interface{}
+		err error
+	}
+	// The channel is buffered so that an abandoned analyzer doesn't
+	// leak its goroutine forever once it eventually finishes.
+	ch := make(chan result, 1)
+	// finished is guarded by a.mu.
+	var finished bool
+	go func() {
+		res, err := run()
+		a.mu.Lock()
+		finished = true
+		if a.abandoned {
+			ar.stats.finishAbandonedAnalyzer()
+		}
+		a.mu.Unlock()
+		ch <- result{res, err}
+	}()
+	var timeout <-chan time.Time
+	if ar.timeout != 0 {
+		timer := time.NewTimer(ar.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	abandon := func() {
+		a.mu.Lock()
+		a.abandoned = true
+		if !finished {
+			ar.stats.abandonAnalyzer()
+		}
+		a.mu.Unlock()
+	}
+	select {
+	case r := <-ch:
+		return r.res, r.err
+	case <-ar.ctx.Done():
+		abandon()
+		return nil, ar.ctx.Err()
+	case <-timeout:
+		abandon()
+		return nil, &analyzerCrash{
+			Analyzer: a.Analyzer.Name,
+			Package:  ar.pkg.ID,
+			Timeout:  ar.timeout,
+		}
+	}
+}
+
 type analysisResult struct {
 	facts       []gobFact
 	diagnostics []Diagnostic
+	crashes     []Diagnostic
 	unused      unused.SerializedResult
+	ir          []byte
 
 	// Only set when using test mode
 	testFacts []TestFact
 }
 
 func (r *subrunner) runAnalyzers(pkgAct *packageAction, pkg *loader.Package) (analysisResult, error) {
+	if err := r.ctx.Err(); err != nil {
+		return analysisResult{}, err
+	}
 	depObjFacts := map[objectFactKey]objectFact{}
 	depPkgFacts := map[packageFactKey]analysis.Fact{}
 
+	t := time.Now()
 	for _, dep := range pkgAct.deps {
 		if err := r.loadFacts(pkg.Types, dep.(*packageAction), depObjFacts, depPkgFacts); err != nil {
 			return analysisResult{}, err
 		}
 	}
+	r.Stats.emitSpan(Span{
+		Kind:     SpanFacts,
+		Package:  pkgAct.Package,
+		Lane:     pkgAct.lane,
+		Start:    t,
+		Duration: time.Since(t),
+	})
 
 	root := &analyzerAction{}
 	var analyzers []*analysis.Analyzer
@@ -1078,6 +1477,8 @@ func (r *subrunner) runAnalyzers(pkgAct *packageAction, pkg *loader.Package) (an
 	ar := &analyzerRunner{
 		pkg:         pkg,
 		factsOnly:   pkgAct.factsOnly,
+		timeout:     r.AnalyzerTimeout,
+		ctx:         r.ctx,
 		depObjFacts: depObjFacts,
 		depPkgFacts: depPkgFacts,
 		stats:       &r.Stats,
@@ -1096,13 +1497,19 @@ func (r *subrunner) runAnalyzers(pkgAct *packageAction, pkg *loader.Package) (an
 		close(queue)
 	}
 	for item := range queue {
-		b := r.semaphore.AcquireMaybe()
+		b := r.memory.allowsConcurrency(&r.Stats) && r.workers().AcquireMaybe()
 		if b {
-			go genericHandle(item, root, queue, &r.semaphore, ar.do)
+			go genericHandle(item, root, queue, r.workers().Release, func(act action) error {
+				lane := r.lanes.acquire()
+				defer r.lanes.release(lane)
+				return ar.do(act, lane)
+			})
 		} else {
 			// the semaphore is exhausted; run the analysis under the
 			// token we've acquired for analyzing the package.
-			genericHandle(item, root, queue, nil, ar.do)
+			genericHandle(item, root, queue, nil, func(act action) error {
+				return ar.do(act, pkgAct.lane)
+			})
 		}
 	}
 
@@ -1175,6 +1582,16 @@ func (r *subrunner) runAnalyzers(pkgAct *packageAction, pkg *loader.Package) (an
 		}
 	}
 
+	var irData []byte
+	if a, ok := all[buildir.Analyzer]; ok && r.CacheIR && !a.failed {
+		var buf bytes.Buffer
+		// Failing to encode the IR isn't fatal; the package will
+		// merely lack cached IR.
+		if err := ir.EncodePackage(&buf, a.Result.(*buildir.IR).Pkg); err == nil {
+			irData = buf.Bytes()
+		}
+	}
+
 	var diags []Diagnostic
 	for _, a := range root.deps {
 		a := a.(*analyzerAction)
@@ -1184,10 +1601,74 @@ func (r *subrunner) runAnalyzers(pkgAct *packageAction, pkg *loader.Package) (an
 		facts:       gobFacts,
 		testFacts:   testFacts,
 		diagnostics: diags,
+		crashes:     crashDiagnostics(all, pkg),
 		unused:      unusedResult,
+		ir:          irData,
 	}, nil
 }
 
+// crashDiagnostics returns a diagnostic for every analyzer that
+// crashed or timed out. Each diagnostic lists the analyzers that were
+// skipped because they depended on the crashed one.
+func crashDiagnostics(all map[*analysis.Analyzer]*analyzerAction, pkg *loader.Package) []Diagnostic {
+	var pos token.Position
+	if len(pkg.Syntax) > 0 {
+		pos = report.DisplayPosition(pkg.Fset, pkg.Syntax[0].Name.Pos())
+	}
+
+	var out []Diagnostic
+	for _, a := range all {
+		for _, err := range a.errors {
+			crash, ok := err.(*analyzerCrash)
+			if !ok {
+				continue
+			}
+
+			// Dependents were marked as failed by genericHandle, without
+			// recording any errors of their own.
+			skipped := map[string]struct{}{}
+			var dfs func(act action)
+			dfs = func(act action) {
+				for _, t := range act.Triggers() {
+					t := t.(*analyzerAction)
+					if t.Analyzer == nil {
+						// the synthetic root
+						continue
+					}
+					if _, ok := skipped[t.Analyzer.Name]; ok {
+						continue
+					}
+					if t.failed && len(t.errors) == 0 {
+						skipped[t.Analyzer.Name] = struct{}{}
+						dfs(t)
+					}
+				}
+			}
+			dfs(a)
+
+			msg := crash.Error()
+			if len(skipped) > 0 {
+				names := make([]string, 0, len(skipped))
+				for name := range skipped {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				msg = fmt.Sprintf("%s\n\nskipped dependent analyzers: %s", msg, strings.Join(names, ", "))
+			}
+			out = append(out, Diagnostic{
+				Position: pos,
+				End:      pos,
+				Category: crash.category(),
+				Message:  msg,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Message < out[j].Message
+	})
+	return out
+}
+
 func registerGobTypes(analyzers []*analysis.Analyzer) {
 	for _, a := range analyzers {
 		for _, typ := range a.FactTypes {
@@ -1226,13 +1707,31 @@ func allAnalyzers(analyzers []*analysis.Analyzer) []*analysis.Analyzer {
 // respective results.
 //
 // If cfg is nil, a default config will be used. Otherwise, cfg will
-// be used, with the exception of the Mode field.
-func (r *Runner) Run(cfg *packages.Config, analyzers []*analysis.Analyzer, patterns []string) ([]Result, error) {
+// be used, with the exception of the Mode field. If cfg doesn't have
+// a Context, ctx will be used for loading packages.
+//
+// Canceling ctx stops the processing of packages that haven't started
+// yet and abandons running analyzers, after which Run returns the
+// context's error.
+func (r *Runner) Run(ctx context.Context, cfg *packages.Config, analyzers []*analysis.Analyzer, patterns []string) ([]Result, error) {
 	analyzers = allAnalyzers(analyzers)
 	registerGobTypes(analyzers)
 
+	var lcfg packages.Config
+	if cfg != nil {
+		lcfg = *cfg
+	}
+	if lcfg.Context == nil {
+		lcfg.Context = ctx
+	}
+
 	r.Stats.setState(StateLoadPackageGraph)
-	lpkgs, err := loader.Graph(r.cache, cfg, patterns...)
+	lpkgs, err := loader.GraphWithOptions(r.cache, &lcfg, &loader.GraphOptions{ModuleConfigs: r.ModuleConfigs}, patterns...)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		// go/packages doesn't wrap the context's error, report it
+		// ourselves.
+		return nil, ctxErr
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -1244,19 +1743,32 @@ func (r *Runner) Run(cfg *packages.Config, analyzers []*analysis.Analyzer, patte
 
 	var goVersion string
 	if r.GoVersion == "module" {
+		// When using a go.work workspace, packages may belong to
+		// several modules that target different Go versions. The
+		// analyzers can only target a single version, so we pick the
+		// oldest one, to avoid suggesting changes that would break
+		// some of the modules.
+		var oldest lint.VersionFlag
+		multiple := false
 		for _, lpkg := range lpkgs {
-			if m := lpkg.Module; m != nil {
-				if goVersion == "" {
-					goVersion = m.GoVersion
-				} else if goVersion != m.GoVersion {
-					// Theoretically, we should only ever see a single Go
-					// module. At least that's currently (as of Go 1.15)
-					// true when using 'go list'.
-					fmt.Fprintln(os.Stderr, "warning: encountered multiple modules and could not deduce targeted Go version")
-					goVersion = ""
-					break
-				}
+			m := lpkg.Module
+			if m == nil || m.GoVersion == "" {
+				continue
 			}
+			var v lint.VersionFlag
+			if err := v.Set(m.GoVersion); err != nil {
+				continue
+			}
+			if goVersion != "" && v != oldest {
+				multiple = true
+			}
+			if goVersion == "" || v < oldest {
+				goVersion = m.GoVersion
+				oldest = v
+			}
+		}
+		if multiple {
+			fmt.Fprintf(os.Stderr, "warning: encountered multiple modules targeting different Go versions, targeting the oldest one, Go %s\n", goVersion)
 		}
 	} else {
 		goVersion = r.GoVersion
@@ -1269,14 +1781,25 @@ func (r *Runner) Run(cfg *packages.Config, analyzers []*analysis.Analyzer, patte
 		goVersion = r.FallbackGoVersion
 	}
 	r.actualGoVersion = goVersion
-	for _, a := range analyzers {
-		flag := a.Flags.Lookup("go")
-		if flag == nil {
-			continue
-		}
-		if err := flag.Value.Set(goVersion); err != nil {
-			return nil, err
+	setFlags := func() error {
+		for _, a := range analyzers {
+			flag := a.Flags.Lookup("go")
+			if flag == nil {
+				continue
+			}
+			if err := flag.Value.Set(goVersion); err != nil {
+				return err
+			}
 		}
+		return nil
+	}
+	if r.Group != nil {
+		err = r.Group.setGoVersion(goVersion, setFlags)
+	} else {
+		err = setFlags()
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	r.Stats.setState(StateBuildActionGraph)
@@ -1290,7 +1813,18 @@ func (r *Runner) Run(cfg *packages.Config, analyzers []*analysis.Analyzer, patte
 	root.pending = uint32(len(root.deps))
 
 	queue := make(chan action)
-	r.Stats.setTotalPackages(len(all) - 1)
+	// The synthetic root isn't in all, so every entry is a package
+	// that will be processed.
+	r.Stats.setTotalPackages(len(all))
+
+	if r.Group != nil {
+		r.memory = r.Group.memory
+	} else if r.MaxMemory > 0 {
+		r.memory = newMemoryBudget(r.MaxMemory)
+	}
+	if r.memory != nil {
+		r.Stats.setMemoryLimit(r.memory.limit)
+	}
 
 	r.Stats.setState(StateProcessing)
 	go func() {
@@ -1301,30 +1835,59 @@ func (r *Runner) Run(cfg *packages.Config, analyzers []*analysis.Analyzer, patte
 		}
 	}()
 
-	sr := newSubrunner(r, analyzers)
+	sr := newSubrunner(ctx, r, analyzers)
 	for item := range queue {
-		r.semaphore.Acquire()
-		go genericHandle(item, root, queue, &r.semaphore, func(act action) error {
-			return sr.do(act)
+		var cost uint64
+		reserved := r.memory != nil && item != root
+		if reserved {
+			// Reserve memory before taking a worker, so that packages
+			// that are waiting for memory don't hold on to workers.
+			cost = estimateMemory(item.(*packageAction).Package)
+			r.memory.acquire(cost, &r.Stats)
+		}
+		r.workers().Acquire()
+		release := func() {
+			r.workers().Release()
+			if reserved {
+				// The reservation has to be released before
+				// genericHandle schedules our dependents, or we
+				// might wait for memory while they wait for us to
+				// receive them.
+				r.memory.release(cost, &r.Stats)
+			}
+		}
+		go genericHandle(item, root, queue, release, func(act action) error {
+			if err := ctx.Err(); err != nil {
+				// Don't start any new work. Marking the package as
+				// failed causes all its dependents to be skipped.
+				return err
+			}
+			err := sr.do(act)
+			if r.OnResult != nil {
+				// Record the error the same way genericHandle would,
+				// so that the result we pass on is complete.
+				if err != nil {
+					act.MarkFailed()
+					act.AddError(err)
+					err = nil
+				}
+				r.OnResult(act.(*packageAction).result())
+			}
+			return err
 		})
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	r.Stats.setState(StateFinalizing)
 	out := make([]Result, 0, len(all))
 	for _, item := range all {
 		if item.Package == nil {
 			continue
 		}
-		out = append(out, Result{
-			Package:  item.Package,
-			Config:   item.cfg,
-			Initial:  !item.factsOnly,
-			Skipped:  item.skipped,
-			Failed:   item.failed,
-			Errors:   item.errors,
-			results:  item.results,
-			testData: item.testData,
-		})
+		out = append(out, item.result())
 	}
 	return out, nil
 }
@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"go/token"
+	"strings"
+	"testing"
+
+	"honnef.co/go/tools/config"
+	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/ir/irutil"
+	"honnef.co/go/tools/internal/passes/buildir"
+	"honnef.co/go/tools/lintcmd/cache"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+)
+
+func TestCacheIR(t *testing.T) {
+	c, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(config.Config{}, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.GoVersion = "1.17"
+	r.CacheIR = true
+	analyzer := &analysis.Analyzer{
+		Name:     "irtest",
+		Doc:      "require IR",
+		Requires: []*analysis.Analyzer{buildir.Analyzer},
+		Run:      func(*analysis.Pass) (interface{}, error) { return nil, nil },
+	}
+	results, err := r.Run(context.Background(), nil, []*analysis.Analyzer{analyzer}, []string{"./testdata/src/irdep/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dep *Result
+	for i, res := range results {
+		if strings.HasSuffix(res.Package.PkgPath, "/irdep/b") {
+			dep = &results[i]
+		}
+	}
+	if dep == nil {
+		t.Fatal("no result for the dependency")
+	}
+	if dep.Initial {
+		t.Fatal("dependency is an initial package")
+	}
+
+	// Build the dependency's IR from source, the way buildir does,
+	// and compare it with what we get from the cache.
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.LoadAllSyntax}, dep.Package.PkgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, irpkgs := irutil.Packages(pkgs, ir.GlobalDebug, nil)
+	want := irpkgs[0]
+	want.Build()
+
+	prog := ir.NewProgram(token.NewFileSet(), ir.SanityCheckFunctions)
+	got, err := dep.LoadIR(prog, pkgs[0].Types)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	disassemble := func(fns []*ir.Function) map[string]string {
+		out := map[string]string{}
+		for _, fn := range fns {
+			var buf bytes.Buffer
+			ir.WriteFunction(&buf, fn)
+			out[fn.String()] = buf.String()
+		}
+		return out
+	}
+	wantFns, gotFns := disassemble(want.Functions), disassemble(got.Functions)
+	if len(wantFns) == 0 {
+		t.Fatal("dependency has no functions")
+	}
+	if len(gotFns) != len(wantFns) {
+		t.Errorf("got %d functions, want %d", len(gotFns), len(wantFns))
+	}
+	for name, w := range wantFns {
+		if g := gotFns[name]; g != w {
+			t.Errorf("cached IR of %s differs\nwant:\n%s\ngot:\n%s", name, w, g)
+		}
+	}
+}
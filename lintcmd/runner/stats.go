@@ -1,6 +1,8 @@
 package runner
 
 import (
+	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -18,30 +20,187 @@ const (
 )
 
 type Stats struct {
+	// 64-bit fields come first to guarantee their alignment on
+	// 32-bit platforms.
+	memoryLimit    uint64
+	reservedMemory uint64
+	peakHeap       uint64
+
 	state                    uint32
 	initialPackages          uint32
 	totalPackages            uint32
 	processedPackages        uint32
 	processedInitialPackages uint32
 
+	deferredPackages   uint32
+	throttledAnalyzers uint32
+	abandonedAnalyzers uint32
+
+	activeMu sync.Mutex
+	active   map[*loader.PackageSpec]time.Time
+
 	// optional function to call every time an analyzer has finished analyzing a package.
 	PrintAnalyzerMeasurement func(*analysis.Analyzer, *loader.PackageSpec, time.Duration)
+	// optional function to call every time the runner transitions to a new state.
+	OnStateChange func(state int)
+	// optional function to call every time a package has been processed.
+	// It may be called concurrently from multiple goroutines.
+	OnPackageFinished func(PackageEvent)
+	// optional function to call every time a unit of work has finished.
+	// It may be called concurrently from multiple goroutines.
+	OnSpan func(Span)
+}
+
+// Span kinds
+const (
+	// Processing a package, from start to finish.
+	SpanPackage = "package"
+	// Loading a package from source and its dependencies from export data.
+	SpanLoad = "load"
+	// Loading the facts of a package's dependencies.
+	SpanFacts = "facts"
+	// Running a single analyzer on a package.
+	SpanAnalyzer = "analyzer"
+)
+
+// A Span describes a unit of work done by the runner. Spans can be
+// used to construct timelines of a run.
+type Span struct {
+	Kind    string
+	Package *loader.PackageSpec
+	// Only set for spans of kind SpanAnalyzer.
+	Analyzer *analysis.Analyzer
+	// Lane identifies the worker that did the work. At any point in
+	// time, spans on the same lane are either disjoint or nested.
+	Lane     int
+	Start    time.Time
+	Duration time.Duration
+	// Only meaningful for spans of kind SpanPackage.
+	Initial bool
+	Cached  bool
+}
+
+func (s *Stats) emitSpan(span Span) {
+	if s.OnSpan != nil {
+		s.OnSpan(span)
+	}
+}
+
+// PackageEvent describes a package that has finished processing.
+type PackageEvent struct {
+	Package *loader.PackageSpec
+	// Initial is true if the package was matched by the user's
+	// patterns and false if it is a dependency.
+	Initial bool
+	// Cached is true if the package's results were loaded from the
+	// cache.
+	Cached bool
+	Failed bool
+
+	Start    time.Time
+	Duration time.Duration
+}
+
+// ActivePackage describes a package that is currently being processed.
+type ActivePackage struct {
+	Package *loader.PackageSpec
+	Start   time.Time
 }
 
-func (s *Stats) setState(state uint32)    { atomic.StoreUint32(&s.state, state) }
+func (s *Stats) setState(state uint32) {
+	atomic.StoreUint32(&s.state, state)
+	if s.OnStateChange != nil {
+		s.OnStateChange(int(state))
+	}
+}
 func (s *Stats) State() int               { return int(atomic.LoadUint32(&s.state)) }
 func (s *Stats) setInitialPackages(n int) { atomic.StoreUint32(&s.initialPackages, uint32(n)) }
 func (s *Stats) InitialPackages() int     { return int(atomic.LoadUint32(&s.initialPackages)) }
 func (s *Stats) setTotalPackages(n int)   { atomic.StoreUint32(&s.totalPackages, uint32(n)) }
 func (s *Stats) TotalPackages() int       { return int(atomic.LoadUint32(&s.totalPackages)) }
 
-func (s *Stats) finishPackage()         { atomic.AddUint32(&s.processedPackages, 1) }
-func (s *Stats) finishInitialPackage()  { atomic.AddUint32(&s.processedInitialPackages, 1) }
+func (s *Stats) startPackage(pkg *loader.PackageSpec, t time.Time) {
+	s.activeMu.Lock()
+	defer s.activeMu.Unlock()
+	if s.active == nil {
+		s.active = map[*loader.PackageSpec]time.Time{}
+	}
+	s.active[pkg] = t
+}
+
+func (s *Stats) finishPackage(ev PackageEvent) {
+	s.activeMu.Lock()
+	delete(s.active, ev.Package)
+	s.activeMu.Unlock()
+
+	atomic.AddUint32(&s.processedPackages, 1)
+	if ev.Initial {
+		atomic.AddUint32(&s.processedInitialPackages, 1)
+	}
+	if s.OnPackageFinished != nil {
+		s.OnPackageFinished(ev)
+	}
+}
+
+// ActivePackages returns the packages that are currently being
+// processed, sorted by how long they have been processing, longest
+// first.
+func (s *Stats) ActivePackages() []ActivePackage {
+	s.activeMu.Lock()
+	out := make([]ActivePackage, 0, len(s.active))
+	for pkg, t := range s.active {
+		out = append(out, ActivePackage{Package: pkg, Start: t})
+	}
+	s.activeMu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Start.Equal(out[j].Start) {
+			return out[i].Start.Before(out[j].Start)
+		}
+		return out[i].Package.ID < out[j].Package.ID
+	})
+	return out
+}
+
 func (s *Stats) ProcessedPackages() int { return int(atomic.LoadUint32(&s.processedPackages)) }
 func (s *Stats) ProcessedInitialPackages() int {
 	return int(atomic.LoadUint32(&s.processedInitialPackages))
 }
 
+// MemoryLimit returns the memory budget in bytes, or zero if no budget is in effect.
+func (s *Stats) MemoryLimit() uint64        { return atomic.LoadUint64(&s.memoryLimit) }
+func (s *Stats) setMemoryLimit(n uint64)    { atomic.StoreUint64(&s.memoryLimit, n) }
+func (s *Stats) setReservedMemory(n uint64) { atomic.StoreUint64(&s.reservedMemory, n) }
+
+// ReservedMemory returns the estimated memory usage of all packages currently being processed.
+func (s *Stats) ReservedMemory() uint64 { return atomic.LoadUint64(&s.reservedMemory) }
+
+// PeakHeap returns the largest heap size observed while making scheduling decisions.
+func (s *Stats) PeakHeap() uint64 { return atomic.LoadUint64(&s.peakHeap) }
+
+func (s *Stats) observeHeap(n uint64) {
+	for {
+		old := atomic.LoadUint64(&s.peakHeap)
+		if n <= old || atomic.CompareAndSwapUint64(&s.peakHeap, old, n) {
+			return
+		}
+	}
+}
+
+func (s *Stats) deferPackage()     { atomic.AddUint32(&s.deferredPackages, 1) }
+func (s *Stats) throttleAnalyzer() { atomic.AddUint32(&s.throttledAnalyzers, 1) }
+
+// DeferredPackages returns the number of packages whose processing had to wait for memory to become available.
+func (s *Stats) DeferredPackages() int { return int(atomic.LoadUint32(&s.deferredPackages)) }
+
+// ThrottledAnalyzers returns the number of times analyzers ran sequentially instead of in parallel to stay within the memory budget.
+func (s *Stats) ThrottledAnalyzers() int { return int(atomic.LoadUint32(&s.throttledAnalyzers)) }
+
+func (s *Stats) abandonAnalyzer()         { atomic.AddUint32(&s.abandonedAnalyzers, 1) }
+func (s *Stats) finishAbandonedAnalyzer() { atomic.AddUint32(&s.abandonedAnalyzers, ^uint32(0)) }
+
+// AbandonedAnalyzers returns the number of analyzers that were abandoned because of a timeout or cancellation but are still running in the background.
+func (s *Stats) AbandonedAnalyzers() int { return int(atomic.LoadUint32(&s.abandonedAnalyzers)) }
+
 func (s *Stats) measureAnalyzer(analysis *analysis.Analyzer, pkg *loader.PackageSpec, d time.Duration) {
 	if s.PrintAnalyzerMeasurement != nil {
 		s.PrintAnalyzerMeasurement(analysis, pkg, d)
@@ -0,0 +1,5 @@
+package a
+
+import "honnef.co/go/tools/lintcmd/runner/testdata/src/irdep/b"
+
+func fn() int { return b.Double(2) }
@@ -0,0 +1,12 @@
+package b
+
+type T struct{ n int }
+
+func (t *T) Inc() { t.n++ }
+
+func Double(x int) int {
+	if x < 0 {
+		return -2 * x
+	}
+	return x * 2
+}
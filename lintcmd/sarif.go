@@ -65,24 +65,30 @@ package lintcmd
 // identical, as SARIF requires that either the ID and name are
 // different, or that the name is omitted.
 
-// FIXME(dh): we're currently reporting column information using UTF-8
-// byte offsets, not using Unicode code points or UTF-16, which are
-// the only two ways allowed by SARIF.
-
-// TODO(dh) set properties.tags – we can use different tags for the
-// staticcheck, simple, stylecheck and unused checks, so users can
-// filter their results
+// Column information in token.Position uses UTF-8 byte offsets, but
+// SARIF only allows Unicode code points or UTF-16 code units. We
+// convert columns to UTF-16 code units, SARIF's default, by looking
+// at the source lines.
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"honnef.co/go/tools/analysis/lint"
+	"honnef.co/go/tools/lintcmd/runner"
 	"honnef.co/go/tools/sarif"
 )
 
@@ -90,6 +96,9 @@ type sarifFormatter struct {
 	driverName    string
 	driverVersion string
 	driverWebsite string
+	// exitCode is the exit status of the command, which gets recorded
+	// in the invocation.
+	exitCode int
 }
 
 func sarifLevel(severity lint.Severity) string {
@@ -230,10 +239,120 @@ func convertCodeBlocks(text string) string {
 	return buf.String()
 }
 
-func (o *sarifFormatter) Format(checks []*lint.Analyzer, diagnostics []diagnostic) {
-	// TODO(dh): some diagnostics shouldn't be reported as results. For example, when the user specifies a package on the command line that doesn't exist.
+// sarifSources provides access to source lines, for converting
+// columns and computing fingerprints.
+type sarifSources struct {
+	sourceCache
+}
+
+// column converts the column of pos from UTF-8 bytes to UTF-16 code
+// units. If the source line isn't available, the column is returned
+// unchanged.
+func (s *sarifSources) column(pos token.Position) int {
+	if pos.Column < 1 {
+		return pos.Column
+	}
+	line, ok := s.line(pos.Filename, pos.Line)
+	if !ok {
+		return pos.Column
+	}
+	n := pos.Column - 1
+	past := 0
+	if n > len(line) {
+		// Columns may point just past the end of the line.
+		past = n - len(line)
+		n = len(line)
+	}
+	units := 0
+	for _, r := range line[:n] {
+		if r >= 0x10000 {
+			// surrogate pair
+			units += 2
+		} else {
+			units++
+		}
+	}
+	return units + past + 1
+}
+
+func (s *sarifSources) region(start, end token.Position) sarif.Region {
+	r := sarif.Region{
+		StartLine:   start.Line,
+		StartColumn: s.column(start),
+	}
+	if end.IsValid() {
+		r.EndLine = end.Line
+		r.EndColumn = s.column(end)
+	}
+	return r
+}
+
+// sarifFingerprintKind identifies our fingerprint algorithm. It has to
+// change whenever the algorithm changes.
+const sarifFingerprintKind = "staticcheck/v1"
+
+// fingerprint computes a partial fingerprint for a diagnostic. It
+// depends on the check, the file, the message and the contents of
+// the line, but not on the line number, so that it remains stable
+// when unrelated lines are added or removed. Seen is used to tell
+// apart identical diagnostics on identical lines in the same file.
+func (s *sarifSources) fingerprint(p Diagnostic, seen map[string]int) string {
+	line, _ := s.line(p.Position.Filename, p.Position.Line)
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s", p.Category, shortPath(p.Position.Filename), p.Message, strings.TrimSpace(line))
+	sum := hex.EncodeToString(h.Sum(nil))[:32]
+	n := seen[sum]
+	seen[sum]++
+	return sum + ":" + strconv.Itoa(n)
+}
+
+// sarifTags returns the tags of a check, which identify the family of
+// checks it belongs to.
+func sarifTags(check string) []string {
+	idx := strings.IndexFunc(check, unicode.IsDigit)
+	if idx == -1 {
+		return nil
+	}
+	switch check[:idx] {
+	case "SA":
+		return []string{"staticcheck"}
+	case "S":
+		return []string{"simple"}
+	case "ST":
+		return []string{"stylecheck"}
+	case "U":
+		return []string{"unused"}
+	case "QF":
+		return []string{"quickfix"}
+	default:
+		return nil
+	}
+}
+
+// isToolNotification reports whether diagnostics of a category
+// describe problems with running the tool, as opposed to problems in
+// the code.
+func isToolNotification(category string) bool {
+	switch category {
+	case "compile", "crash", "timeout":
+		return true
+	default:
+		return false
+	}
+}
+
+func (o *sarifFormatter) Format(checks []*lint.Analyzer, diagnostics []Diagnostic) {
+	var sources sarifSources
 
 	cwd, _ := os.Getwd()
+	invocation := sarif.Invocation{
+		Arguments: os.Args[1:],
+		WorkingDirectory: sarif.ArtifactLocation{
+			URI: sarifURI(cwd),
+		},
+		ExecutionSuccessful: true,
+		ExitCode:            o.exitCode,
+	}
 	run := sarif.Run{
 		Tool: sarif.Tool{
 			Driver: sarif.ToolComponent{
@@ -242,41 +361,62 @@ func (o *sarifFormatter) Format(checks []*lint.Analyzer, diagnostics []diagnosti
 				InformationURI: o.driverWebsite,
 			},
 		},
-		Invocations: []sarif.Invocation{{
-			Arguments: os.Args[1:],
-			WorkingDirectory: sarif.ArtifactLocation{
-				URI: sarifURI(cwd),
-			},
-			ExecutionSuccessful: true,
-		}},
+		ColumnKind: sarif.UTF16CodeUnits,
 	}
 	for _, c := range checks {
-		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules,
-			sarif.ReportingDescriptor{
-				// We don't set Name, as Name and ID mustn't be identical.
-				ID: c.Analyzer.Name,
-				ShortDescription: sarif.Message{
-					Text:     c.Doc.Title,
-					Markdown: c.Doc.TitleMarkdown,
-				},
-				HelpURI: "https://staticcheck.io/docs/checks#" + c.Analyzer.Name,
-				// We use our markdown as the plain text version, too. We
-				// use very little markdown, primarily quotations,
-				// indented code blocks and backticks. All of these are
-				// fine as plain text, too.
-				Help: sarif.Message{
-					Text:     sarifFormatText(c.Doc.Format(false)),
-					Markdown: sarifFormatText(c.Doc.FormatMarkdown(false)),
-				},
-				DefaultConfiguration: sarif.ReportingConfiguration{
-					// TODO(dh): we could figure out which checks were disabled globally
-					Enabled: true,
-					Level:   sarifLevel(c.Doc.Severity),
-				},
-			})
+		rule := sarif.ReportingDescriptor{
+			// We don't set Name, as Name and ID mustn't be identical.
+			ID: c.Analyzer.Name,
+			ShortDescription: sarif.Message{
+				Text:     c.Doc.Title,
+				Markdown: c.Doc.TitleMarkdown,
+			},
+			HelpURI: "https://staticcheck.io/docs/checks#" + c.Analyzer.Name,
+			// We use our markdown as the plain text version, too. We
+			// use very little markdown, primarily quotations,
+			// indented code blocks and backticks. All of these are
+			// fine as plain text, too.
+			Help: sarif.Message{
+				Text:     sarifFormatText(c.Doc.Format(false)),
+				Markdown: sarifFormatText(c.Doc.FormatMarkdown(false)),
+			},
+			DefaultConfiguration: sarif.ReportingConfiguration{
+				// TODO(dh): we could figure out which checks were disabled globally
+				Enabled: true,
+				Level:   sarifLevel(c.Doc.Severity),
+			},
+		}
+		if tags := sarifTags(c.Analyzer.Name); tags != nil {
+			rule.Properties = sarif.PropertyBag{"tags": tags}
+		}
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, rule)
 	}
 
+	seen := map[string]int{}
 	for _, p := range diagnostics {
+		if isToolNotification(p.Category) {
+			// Packages that failed to load or analyzers that failed
+			// to run aren't results, they mean that the analysis is
+			// incomplete.
+			n := sarif.Notification{
+				Level: sarif.Error,
+				Message: sarif.Message{
+					Text: p.Message,
+				},
+			}
+			if p.Position.IsValid() {
+				n.Locations = []sarif.Location{{
+					PhysicalLocation: sarif.PhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation(p.Position.Filename),
+						Region:           sources.region(p.Position, p.End),
+					},
+				}}
+			}
+			invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, n)
+			invocation.ExecutionSuccessful = false
+			continue
+		}
+
 		r := sarif.Result{
 			RuleID: p.Category,
 			Kind:   sarif.Fail,
@@ -287,14 +427,12 @@ func (o *sarifFormatter) Format(checks []*lint.Analyzer, diagnostics []diagnosti
 		r.Locations = []sarif.Location{{
 			PhysicalLocation: sarif.PhysicalLocation{
 				ArtifactLocation: sarifArtifactLocation(p.Position.Filename),
-				Region: sarif.Region{
-					StartLine:   p.Position.Line,
-					StartColumn: p.Position.Column,
-					EndLine:     p.End.Line,
-					EndColumn:   p.End.Column,
-				},
+				Region:           sources.region(p.Position, p.End),
 			},
 		}}
+		r.PartialFingerprints = map[string]string{
+			sarifFingerprintKind: sources.fingerprint(p, seen),
+		}
 		for _, fix := range p.SuggestedFixes {
 			sfix := sarif.Fix{
 				Description: sarif.Message{
@@ -305,12 +443,7 @@ func (o *sarifFormatter) Format(checks []*lint.Analyzer, diagnostics []diagnosti
 			changes := map[string][]sarif.Replacement{}
 			for _, edit := range fix.TextEdits {
 				changes[edit.Position.Filename] = append(changes[edit.Position.Filename], sarif.Replacement{
-					DeletedRegion: sarif.Region{
-						StartLine:   edit.Position.Line,
-						StartColumn: edit.Position.Column,
-						EndLine:     edit.End.Line,
-						EndColumn:   edit.End.Column,
-					},
+					DeletedRegion: sources.region(edit.Position, edit.End),
 					InsertedContent: sarif.ArtifactContent{
 						Text: string(edit.NewText),
 					},
@@ -335,22 +468,17 @@ func (o *sarifFormatter) Format(checks []*lint.Analyzer, diagnostics []diagnosti
 					},
 					PhysicalLocation: sarif.PhysicalLocation{
 						ArtifactLocation: sarifArtifactLocation(related.Position.Filename),
-						Region: sarif.Region{
-							StartLine:   related.Position.Line,
-							StartColumn: related.Position.Column,
-							EndLine:     related.End.Line,
-							EndColumn:   related.End.Column,
-						},
+						Region:           sources.region(related.Position, related.End),
 					},
 				})
 		}
 
-		if p.Severity == severityIgnored {
+		if p.Severity == SeverityIgnored {
 			// Note that GitHub does not support suppressions, which is why Staticcheck still requires the -show-ignored flag to be set for us to emit ignored diagnostics.
 
 			r.Suppressions = []sarif.Suppression{{
-				Kind: "inSource",
-				// TODO(dh): populate the Justification field
+				Kind:          "inSource",
+				Justification: p.IgnoreReason,
 			}}
 		} else {
 			// We want an empty slice, not nil. SARIF differentiates
@@ -359,8 +487,20 @@ func (o *sarifFormatter) Format(checks []*lint.Analyzer, diagnostics []diagnosti
 			// information available.
 			r.Suppressions = []sarif.Suppression{}
 		}
+		if tags := sarifTags(p.Category); tags != nil {
+			r.Properties = sarif.PropertyBag{"tags": tags}
+		}
+		if len(p.Builds) > 0 {
+			// The names of the build configurations that produced
+			// the result, when checking multiple configurations.
+			if r.Properties == nil {
+				r.Properties = sarif.PropertyBag{}
+			}
+			r.Properties["builds"] = p.Builds
+		}
 		run.Results = append(run.Results, r)
 	}
+	run.Invocations = []sarif.Invocation{invocation}
 
 	json.NewEncoder(os.Stdout).Encode(sarif.Log{
 		Version: sarif.Version,
@@ -368,3 +508,256 @@ func (o *sarifFormatter) Format(checks []*lint.Analyzer, diagnostics []diagnosti
 		Runs:    []sarif.Run{run},
 	})
 }
+
+// byteColumn is the inverse of column. It converts a column measured
+// in units of kind, which is either UTF-16 code units or Unicode code
+// points, to UTF-8 bytes.
+func (s *sarifSources) byteColumn(file string, line, col int, kind string) int {
+	if col < 1 {
+		return col
+	}
+	text, ok := s.line(file, line)
+	if !ok {
+		return col
+	}
+	units := col - 1
+	for i, r := range text {
+		if units <= 0 {
+			return i + 1
+		}
+		if r >= 0x10000 && kind != sarif.CodePoints {
+			units -= 2
+		} else {
+			units--
+		}
+	}
+	// Columns may point past the end of the line.
+	return len(text) + units + 1
+}
+
+// decodeSarif converts SARIF logs produced by arbitrary tools into
+// runs, one per SARIF run. The category of each diagnostic is the
+// name of the tool, followed by a slash and the ID of the rule, for
+// example "gosec/G104". Results that were suppressed by the tool, or
+// by linter directives in Go source files, are marked as ignored.
+//
+// Relative paths are resolved relative to the current directory,
+// unless the log specifies the locations of URI base IDs.
+func decodeSarif(r io.Reader) ([]run, error) {
+	var sources sarifSources
+	dirs := &sarifDirectives{
+		fset:    token.NewFileSet(),
+		ignores: map[string][]ignore{},
+	}
+	var runs []run
+	dec := json.NewDecoder(r)
+	for {
+		var log sarif.Log
+		if err := dec.Decode(&log); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if !strings.HasPrefix(log.Version, "2.1") {
+			return nil, fmt.Errorf("unsupported SARIF version %q", log.Version)
+		}
+		for _, srun := range log.Runs {
+			runs = append(runs, runFromSarif(srun, &sources, dirs))
+		}
+	}
+	return runs, nil
+}
+
+func runFromSarif(srun sarif.Run, sources *sarifSources, dirs *sarifDirectives) run {
+	tool := srun.Tool.Driver.Name
+	if tool == "" {
+		tool = "sarif"
+	}
+	out := run{
+		checkedFiles: map[string]struct{}{},
+		diagnostics:  map[diagnosticDescriptor]Diagnostic{},
+	}
+
+	// resolve turns an artifact location into a file name.
+	var resolve func(loc sarif.ArtifactLocation, depth int) string
+	resolve = func(loc sarif.ArtifactLocation, depth int) string {
+		if depth > 8 {
+			// Base IDs referring to each other in a cycle
+			return ""
+		}
+		if loc.URI == "" {
+			if loc.Index >= 0 && loc.Index < len(srun.Artifacts) && srun.Artifacts[loc.Index].Location.URI != "" {
+				return resolve(srun.Artifacts[loc.Index].Location, depth+1)
+			}
+			return ""
+		}
+		u, err := url.Parse(loc.URI)
+		if err != nil {
+			return ""
+		}
+		if u.Scheme == "file" {
+			return filepath.Clean(filepath.FromSlash(u.Path))
+		} else if u.Scheme != "" {
+			// Not a file, e.g. an https:// URI
+			return ""
+		}
+		name := filepath.FromSlash(u.Path)
+		if filepath.IsAbs(name) {
+			return filepath.Clean(name)
+		}
+		base := "."
+		if b, ok := srun.OriginalURIBaseIDs[loc.URIBaseID]; ok {
+			if dir := resolve(b, depth+1); dir != "" {
+				base = dir
+			}
+		}
+		if abs, err := filepath.Abs(filepath.Join(base, name)); err == nil {
+			return abs
+		}
+		return name
+	}
+	position := func(loc sarif.PhysicalLocation) (start, end token.Position) {
+		file := resolve(loc.ArtifactLocation, 0)
+		if file == "" || loc.Region.StartLine < 1 {
+			return token.Position{Filename: file}, token.Position{}
+		}
+		start = token.Position{
+			Filename: file,
+			Line:     loc.Region.StartLine,
+			Column:   sources.byteColumn(file, loc.Region.StartLine, loc.Region.StartColumn, srun.ColumnKind),
+		}
+		if loc.Region.EndLine > 0 || loc.Region.EndColumn > 0 {
+			endLine := loc.Region.EndLine
+			if endLine == 0 {
+				// The region is on a single line
+				endLine = start.Line
+			}
+			end = token.Position{
+				Filename: file,
+				Line:     endLine,
+				Column:   sources.byteColumn(file, endLine, loc.Region.EndColumn, srun.ColumnKind),
+			}
+		}
+		return start, end
+	}
+
+	for _, art := range srun.Artifacts {
+		if file := resolve(art.Location, 0); file != "" {
+			out.checkedFiles[file] = struct{}{}
+		}
+	}
+
+	var diags []Diagnostic
+	for _, res := range srun.Results {
+		switch res.Kind {
+		case "", sarif.Fail, "review", "open":
+		default:
+			// "pass", "notApplicable" and "informational" results
+			// aren't problems.
+			continue
+		}
+		category := tool
+		if res.RuleID != "" {
+			category += "/" + res.RuleID
+		}
+		msg := res.Message.Text
+		if msg == "" {
+			msg = res.Message.Markdown
+		}
+		diag := Diagnostic{
+			Diagnostic: runner.Diagnostic{
+				Category: category,
+				Message:  msg,
+			},
+			MergeIf: lint.MergeIfAny,
+		}
+		if len(res.Locations) > 0 {
+			diag.Position, diag.End = position(res.Locations[0].PhysicalLocation)
+		}
+		for _, rel := range res.RelatedLocations {
+			related := runner.RelatedInformation{}
+			related.Position, related.End = position(rel.PhysicalLocation)
+			if rel.Message != nil {
+				related.Message = rel.Message.Text
+			}
+			diag.Related = append(diag.Related, related)
+		}
+		for _, fix := range res.Fixes {
+			sfix := runner.SuggestedFix{
+				Message: fix.Description.Text,
+			}
+			for _, change := range fix.ArtifactChanges {
+				loc := sarif.PhysicalLocation{ArtifactLocation: change.ArtifactLocation}
+				for _, repl := range change.Replacements {
+					loc.Region = repl.DeletedRegion
+					edit := runner.TextEdit{
+						NewText: []byte(repl.InsertedContent.Text),
+					}
+					edit.Position, edit.End = position(loc)
+					sfix.TextEdits = append(sfix.TextEdits, edit)
+				}
+			}
+			diag.SuggestedFixes = append(diag.SuggestedFixes, sfix)
+		}
+		for _, sup := range res.Suppressions {
+			switch sup.Status {
+			case "", "accepted":
+				diag.Severity = SeverityIgnored
+				diag.IgnoreReason = sup.Justification
+			}
+		}
+		diags = append(diags, diag)
+	}
+
+	dirs.apply(diags)
+	for _, diag := range diags {
+		out.diagnostics[diag.descriptor()] = diag
+	}
+	return out
+}
+
+// sarifDirectives applies the linter directives of Go files to
+// diagnostics that didn't originate from our own analysis.
+type sarifDirectives struct {
+	fset *token.FileSet
+	// maps file names to their directives; nil if the file couldn't
+	// be parsed
+	ignores map[string][]ignore
+}
+
+func (s *sarifDirectives) apply(diags []Diagnostic) {
+	for i := range diags {
+		diag := &diags[i]
+		name := diag.Position.Filename
+		if filepath.Ext(name) != ".go" {
+			continue
+		}
+		igs, ok := s.ignores[name]
+		if !ok {
+			// Parse errors are fine as long as we got the comments.
+			f, _ := parser.ParseFile(s.fset, name, nil, parser.ParseComments)
+			if f != nil {
+				var dirs []runner.SerializedDirective
+				for _, dir := range lint.ParseDirectives([]*ast.File{f}, s.fset) {
+					dirs = append(dirs, runner.SerializedDirective{
+						Command:           dir.Command,
+						Arguments:         dir.Arguments,
+						DirectivePosition: s.fset.PositionFor(dir.Directive.Pos(), false),
+						NodePosition:      s.fset.PositionFor(dir.Node.Pos(), false),
+					})
+				}
+				// Malformed directives have already been flagged
+				// by our own analysis.
+				igs, _ = parseDirectives(dirs)
+			}
+			s.ignores[name] = igs
+		}
+		for _, ig := range igs {
+			if ig.Match(*diag) {
+				diag.Severity = SeverityIgnored
+				diag.IgnoreReason = ig.reason()
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package lintcmd
+
+import (
+	"bufio"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"honnef.co/go/tools/lintcmd/runner"
+)
+
+func TestSarifColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.go")
+	// "ä" is two bytes in UTF-8 and one code unit in UTF-16, "𝄞" is
+	// four bytes in UTF-8 and two code units in UTF-16.
+	src := "package a\n\nvar s = \"ä𝄞\" + x\n"
+	if err := os.WriteFile(path, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var sources sarifSources
+	tests := []struct {
+		col  int
+		want int
+	}{
+		{1, 1},
+		{9, 9},
+		{12, 11},
+		{16, 13},
+		{19, 16},
+		// one past the end of the line
+		{23, 20},
+	}
+	for _, tt := range tests {
+		got := sources.column(token.Position{Filename: path, Line: 3, Column: tt.col})
+		if got != tt.want {
+			t.Errorf("column %d: got %d, want %d", tt.col, got, tt.want)
+		}
+	}
+
+	// Files we can't read keep their byte columns.
+	if got := sources.column(token.Position{Filename: filepath.Join(t.TempDir(), "missing.go"), Line: 1, Column: 5}); got != 5 {
+		t.Errorf("got column %d for missing file, want 5", got)
+	}
+}
+
+func TestSarifFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.go")
+	fingerprints := func(src string, lines ...int) []string {
+		if err := os.WriteFile(path, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+		var sources sarifSources
+		seen := map[string]int{}
+		var out []string
+		for _, l := range lines {
+			diag := Diagnostic{
+				Diagnostic: runner.Diagnostic{
+					Position: token.Position{Filename: path, Line: l, Column: 2},
+					Message:  "empty branch",
+					Category: "SA9003",
+				},
+			}
+			out = append(out, sources.fingerprint(diag, seen))
+		}
+		return out
+	}
+
+	before := fingerprints("package a\n\nfunc fn() {\n\tif x {}\n\tif x {}\n}\n", 4, 5)
+	after := fingerprints("package a\n\nimport \"fmt\"\n\nfunc fn() {\n\tif x {}\n\tif x {}\n}\n", 6, 7)
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("fingerprints changed after shifting lines: %q and %q", before, after)
+	}
+	if before[0] == before[1] {
+		t.Errorf("identical diagnostics on identical lines have the same fingerprint %q", before[0])
+	}
+}
+
+func TestSarifTags(t *testing.T) {
+	tests := map[string][]string{
+		"SA1000":  {"staticcheck"},
+		"S1000":   {"simple"},
+		"ST1000":  {"stylecheck"},
+		"U1000":   {"unused"},
+		"QF1001":  {"quickfix"},
+		"compile": nil,
+		"XY1000":  nil,
+	}
+	for check, want := range tests {
+		if got := sarifTags(check); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", check, got, want)
+		}
+	}
+}
+
+func TestDecodeSarif(t *testing.T) {
+	dir := t.TempDir()
+	src := "package a\n\nfunc fn() {\n\t//lint:ignore gosec/G104 closing can't fail\n\tf.Close()\n\ts := \"𝄞\"; f.Close()\n}\n"
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	log := `{
+  "version": "2.1.0",
+  "runs": [{
+    "tool": {"driver": {"name": "gosec"}},
+    "originalUriBaseIds": {"SRC": {"uri": "` + sarifURI(dir) + `/"}},
+    "results": [
+      {"ruleId": "G104", "message": {"text": "unhandled error"},
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "a.go", "uriBaseId": "SRC"}, "region": {"startLine": 5, "startColumn": 2}}}]},
+      {"ruleId": "G104", "message": {"text": "unhandled error"},
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "a.go", "uriBaseId": "SRC"}, "region": {"startLine": 6, "startColumn": 11, "endColumn": 20}}}]},
+      {"ruleId": "G101", "message": {"text": "hardcoded credentials"},
+       "suppressions": [{"kind": "external", "justification": "test data"}],
+       "locations": [{"physicalLocation": {"artifactLocation": {"uri": "a.go", "uriBaseId": "SRC"}, "region": {"startLine": 3}}}]},
+      {"ruleId": "G000", "kind": "pass", "message": {"text": "fine"}}
+    ]
+  }]
+}`
+	runs, err := decodeRuns(bufio.NewReader(strings.NewReader("\n" + log)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(runs))
+	}
+
+	type result struct {
+		category string
+		line     int
+		column   int
+		end      int
+		severity Severity
+		reason   string
+	}
+	var got []result
+	diags := mergeRuns(runs)
+	sortDiagnostics(diags)
+	for _, diag := range diags {
+		if diag.Position.Filename != filepath.Join(dir, "a.go") {
+			t.Errorf("got file %q, want %q", diag.Position.Filename, filepath.Join(dir, "a.go"))
+		}
+		got = append(got, result{diag.Category, diag.Position.Line, diag.Position.Column, diag.End.Column, diag.Severity, diag.IgnoreReason})
+	}
+	want := []result{
+		{"gosec/G101", 3, 0, 0, SeverityIgnored, "test data"},
+		{"gosec/G104", 5, 2, 0, SeverityIgnored, "closing can't fail"},
+		// "𝄞" is two UTF-16 code units but four bytes
+		{"gosec/G104", 6, 13, 22, SeverityError, ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := decodeRuns(bufio.NewReader(strings.NewReader(`{"version": "2.0.0", "runs": []}`))); err == nil {
+		t.Error("expected error for unsupported SARIF version")
+	}
+}
+
+func TestSarifExitStatus(t *testing.T) {
+	status := func(f formatter, categories ...string) int {
+		var diags []Diagnostic
+		for _, c := range categories {
+			diags = append(diags, Diagnostic{Diagnostic: runner.Diagnostic{Category: c}})
+		}
+		var counts diagnosticCounts
+		cmd := &Command{}
+		cmd.tally(map[string]bool{"SA4006": true, "compile": true, "crash": true}, diags, &counts)
+		return exitStatus(f, counts)
+	}
+
+	tests := []struct {
+		f          formatter
+		categories []string
+		want       int
+	}{
+		{&sarifFormatter{}, nil, 0},
+		// Finding problems is a successful run
+		{&sarifFormatter{}, []string{"SA4006"}, 0},
+		{&sarifFormatter{}, []string{"SA4006", "crash"}, 1},
+		{&sarifFormatter{}, []string{"compile"}, 1},
+		{nullFormatter{}, []string{"SA4006"}, 1},
+		{nullFormatter{}, []string{"ST1000"}, 0},
+	}
+	for _, tt := range tests {
+		if got := status(tt.f, tt.categories...); got != tt.want {
+			t.Errorf("%T with %v: got exit status %d, want %d", tt.f, tt.categories, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package lintcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"honnef.co/go/tools/analysis/lint"
+)
+
+// The number of files listed by the summary formatter.
+const summaryTopFiles = 10
+
+// summaryFormatter doesn't print individual diagnostics, but
+// statistics about them: how many were found by each check, in each
+// directory and with each severity, and which files have the most.
+type summaryFormatter struct {
+	W    io.Writer
+	JSON bool
+
+	titles map[string]string
+}
+
+func (o *summaryFormatter) Format(checks []*lint.Analyzer, _ []Diagnostic) {
+	o.titles = make(map[string]string, len(checks))
+	for _, c := range checks {
+		if c.Doc != nil {
+			o.titles[c.Analyzer.Name] = c.Doc.Title
+		}
+	}
+}
+
+type summaryEntry struct {
+	Name  string `json:"name"`
+	Title string `json:"title,omitempty"`
+	severityCounts
+	Total int `json:"total"`
+}
+
+type summary struct {
+	Total       int            `json:"total"`
+	Errors      int            `json:"errors"`
+	Warnings    int            `json:"warnings"`
+	Ignored     int            `json:"ignored"`
+	Checks      []summaryEntry `json:"checks"`
+	Directories []summaryEntry `json:"directories"`
+	TopFiles    []summaryEntry `json:"top_files"`
+}
+
+// summaryEntries sorts counts by their totals, from most to fewest
+// diagnostics.
+func summaryEntries(counts map[string]*severityCounts) []summaryEntry {
+	out := make([]summaryEntry, 0, len(counts))
+	for name, c := range counts {
+		out = append(out, summaryEntry{Name: name, severityCounts: *c, Total: c.total()})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total != out[j].Total {
+			return out[i].Total > out[j].Total
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func (o *summaryFormatter) summary(counts diagnosticCounts) summary {
+	s := summary{
+		Total:       counts.total,
+		Errors:      counts.errors,
+		Warnings:    counts.warnings,
+		Ignored:     counts.ignored,
+		Checks:      summaryEntries(counts.byCheck),
+		Directories: summaryEntries(counts.byDir),
+		TopFiles:    summaryEntries(counts.byFile),
+	}
+	for i := range s.Checks {
+		s.Checks[i].Title = o.titles[s.Checks[i].Name]
+	}
+	if len(s.TopFiles) > summaryTopFiles {
+		s.TopFiles = s.TopFiles[:summaryTopFiles]
+	}
+	return s
+}
+
+func (o *summaryFormatter) Stats(counts diagnosticCounts) {
+	s := o.summary(counts)
+	if o.JSON {
+		enc := json.NewEncoder(o.W)
+		enc.SetIndent("", "\t")
+		_ = enc.Encode(s)
+		return
+	}
+
+	tw := tabwriter.NewWriter(o.W, 0, 4, 2, ' ', 0)
+	table := func(heading string, entries []summaryEntry, titles bool) {
+		if len(entries) == 0 {
+			return
+		}
+		fmt.Fprintf(tw, "%s\terrors\twarnings\tignored\ttotal", heading)
+		if titles {
+			fmt.Fprint(tw, "\ttitle")
+		}
+		fmt.Fprintln(tw)
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d", e.Name, e.Errors, e.Warnings, e.Ignored, e.Total)
+			if titles {
+				fmt.Fprintf(tw, "\t%s", e.Title)
+			}
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintln(tw)
+	}
+	table("check", s.Checks, true)
+	table("directory", s.Directories, false)
+	table("file", s.TopFiles, false)
+	tw.Flush()
+
+	fmt.Fprintf(o.W, "%d problems (%d errors, %d warnings, %d ignored)\n", s.Total, s.Errors, s.Warnings, s.Ignored)
+}
@@ -0,0 +1,60 @@
+package lintcmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"honnef.co/go/tools/lintcmd/runner"
+)
+
+func TestSummary(t *testing.T) {
+	dir := t.TempDir()
+	var counts diagnosticCounts
+	add := func(file, check string, sev Severity, n int) {
+		for i := 0; i < n; i++ {
+			diag := Diagnostic{Diagnostic: runner.Diagnostic{Category: check}}
+			diag.Position.Filename = filepath.Join(dir, file)
+			counts.add(diag, sev)
+		}
+	}
+	add("a/a.go", "SA4006", SeverityError, 3)
+	add("a/a.go", "ST1000", SeverityWarning, 1)
+	add("b/b.go", "ST1000", SeverityIgnored, 2)
+	add("b/c.go", "SA4006", SeverityError, 1)
+	for i := 0; i < summaryTopFiles; i++ {
+		add(fmt.Sprintf("c/%d.go", i), "S1000", SeverityWarning, 1)
+	}
+
+	f := &summaryFormatter{titles: map[string]string{"SA4006": "A value is never read"}}
+	s := f.summary(counts)
+
+	wantChecks := []summaryEntry{
+		{Name: "S1000", severityCounts: severityCounts{Warnings: 10}, Total: 10},
+		{Name: "SA4006", Title: "A value is never read", severityCounts: severityCounts{Errors: 4}, Total: 4},
+		{Name: "ST1000", severityCounts: severityCounts{Warnings: 1, Ignored: 2}, Total: 3},
+	}
+	if !reflect.DeepEqual(s.Checks, wantChecks) {
+		t.Errorf("got checks %v, want %v", s.Checks, wantChecks)
+	}
+
+	var dirs []string
+	for _, e := range s.Directories {
+		dirs = append(dirs, filepath.Base(e.Name))
+	}
+	if want := []string{"c", "a", "b"}; !reflect.DeepEqual(dirs, want) {
+		t.Errorf("got directories %v, want %v", dirs, want)
+	}
+
+	if len(s.TopFiles) != summaryTopFiles {
+		t.Fatalf("got %d files, want %d", len(s.TopFiles), summaryTopFiles)
+	}
+	var files []string
+	for _, e := range s.TopFiles[:3] {
+		files = append(files, filepath.Base(e.Name))
+	}
+	if want := []string{"a.go", "b.go", "c.go"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("got top files %v, want %v", files, want)
+	}
+}
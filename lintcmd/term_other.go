@@ -0,0 +1,12 @@
+//go:build !aix && !android && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!android,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package lintcmd
+
+import "os"
+
+// terminalWidth returns the number of columns of the terminal f, or 0
+// if it can't be determined.
+func terminalWidth(f *os.File) int {
+	return 0
+}
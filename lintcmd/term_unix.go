@@ -0,0 +1,20 @@
+//go:build aix || android || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix android darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package lintcmd
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalWidth returns the number of columns of the terminal f, or 0
+// if it can't be determined.
+func terminalWidth(f *os.File) int {
+	ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	if err != nil {
+		return 0
+	}
+	return int(ws.Col)
+}
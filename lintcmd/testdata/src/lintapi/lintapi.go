@@ -0,0 +1,12 @@
+package lintapi
+
+func fn(b bool) bool {
+	if b == true {
+		return true
+	}
+	//lint:ignore S1002 testing ignored diagnostics
+	if b == true {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+package lintcmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"honnef.co/go/tools/lintcmd/runner"
+)
+
+// A timeline writes spans in the Chrome trace event format, which can
+// be viewed in chrome://tracing, Perfetto and many other tools.
+//
+// See https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type timeline struct {
+	mu    sync.Mutex
+	w     *bufio.Writer
+	f     *os.File
+	start time.Time
+	// lanes we've already emitted metadata for, per process
+	lanes map[[2]int]struct{}
+	// the number of build configurations; each configuration is
+	// displayed as its own process
+	pids  int
+	first bool
+	err   error
+}
+
+type traceEvent struct {
+	Name      string                 `json:"name"`
+	Category  string                 `json:"cat,omitempty"`
+	Phase     string                 `json:"ph"`
+	Timestamp int64                  `json:"ts"`
+	Duration  int64                  `json:"dur,omitempty"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+func newTimeline(path string) (*timeline, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	tl := &timeline{
+		w:     bufio.NewWriter(f),
+		f:     f,
+		start: time.Now(),
+		lanes: map[[2]int]struct{}{},
+		first: true,
+	}
+	_, tl.err = tl.w.WriteString(`{"displayTimeUnit":"ms","traceEvents":[`)
+	return tl, nil
+}
+
+// BeginBuild starts a new process in the timeline, named after the
+// build configuration. It returns a function that records spans of
+// that build, which may be called concurrently.
+func (tl *timeline) BeginBuild(name string) func(runner.Span) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.pids++
+	pid := tl.pids
+	if name == "" {
+		name = "staticcheck"
+	}
+	tl.emit(traceEvent{
+		Name:  "process_name",
+		Phase: "M",
+		PID:   pid,
+		Args:  map[string]interface{}{"name": name},
+	})
+	return func(span runner.Span) { tl.span(pid, span) }
+}
+
+func (tl *timeline) span(pid int, span runner.Span) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	if _, ok := tl.lanes[[2]int{pid, span.Lane}]; !ok {
+		tl.lanes[[2]int{pid, span.Lane}] = struct{}{}
+		tl.emit(traceEvent{
+			Name:  "thread_name",
+			Phase: "M",
+			PID:   pid,
+			TID:   span.Lane,
+			Args:  map[string]interface{}{"name": fmt.Sprintf("worker %d", span.Lane)},
+		})
+	}
+
+	ev := traceEvent{
+		Category:  span.Kind,
+		Phase:     "X",
+		Timestamp: span.Start.Sub(tl.start).Microseconds(),
+		Duration:  span.Duration.Microseconds(),
+		PID:       pid,
+		TID:       span.Lane,
+		Args: map[string]interface{}{
+			"package": span.Package.ID,
+		},
+	}
+	switch span.Kind {
+	case runner.SpanPackage:
+		ev.Name = span.Package.ID
+		ev.Args["initial"] = span.Initial
+		ev.Args["cached"] = span.Cached
+	case runner.SpanAnalyzer:
+		ev.Name = span.Analyzer.Name
+		ev.Args["analyzer"] = span.Analyzer.Name
+	default:
+		ev.Name = span.Kind
+	}
+	tl.emit(ev)
+}
+
+// emit writes a single event. The caller must hold tl.mu.
+func (tl *timeline) emit(ev traceEvent) {
+	if tl.err != nil {
+		return
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		tl.err = err
+		return
+	}
+	if !tl.first {
+		tl.w.WriteString(",\n")
+	}
+	tl.first = false
+	_, tl.err = tl.w.Write(b)
+}
+
+// Close finishes writing the timeline.
+func (tl *timeline) Close() error {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	if tl.err == nil {
+		_, tl.err = tl.w.WriteString("]}\n")
+	}
+	if tl.err == nil {
+		tl.err = tl.w.Flush()
+	}
+	if err := tl.f.Close(); tl.err == nil {
+		tl.err = err
+	}
+	return tl.err
+}
+
+type measurement struct {
+	name  string
+	total time.Duration
+	count int
+}
+
+// summarizeMeasurements reads the output of -debug.measure-analyzers
+// and prints the n analyzers and packages that took the most time.
+func summarizeMeasurements(w io.Writer, r io.Reader, n int) error {
+	analyzers := map[string]*measurement{}
+	pkgs := map[string]*measurement{}
+	add := func(m map[string]*measurement, name string, d time.Duration) {
+		e, ok := m[name]
+		if !ok {
+			e = &measurement{name: name}
+			m[name] = e
+		}
+		e.total += d
+		e.count++
+	}
+
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		if sc.Text() == "" {
+			continue
+		}
+		fields := strings.Split(sc.Text(), "\t")
+		if len(fields) != 3 {
+			return fmt.Errorf("line %d: expected 3 fields, found %d", line, len(fields))
+		}
+		ns, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+		add(analyzers, fields[0], time.Duration(ns))
+		add(pkgs, fields[1], time.Duration(ns))
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	top := func(m map[string]*measurement) []*measurement {
+		out := make([]*measurement, 0, len(m))
+		for _, e := range m {
+			out = append(out, e)
+		}
+		sort.Slice(out, func(i, j int) bool {
+			if out[i].total != out[j].total {
+				return out[i].total > out[j].total
+			}
+			return out[i].name < out[j].name
+		})
+		if n > 0 && len(out) > n {
+			out = out[:n]
+		}
+		return out
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Analyzer\tTotal\tPackages\tAverage")
+	for _, e := range top(analyzers) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", e.name, e.total, e.count, e.total/time.Duration(e.count))
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "Package\tTotal\tAnalyzers\tAverage")
+	for _, e := range top(pkgs) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", e.name, e.total, e.count, e.total/time.Duration(e.count))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,35 @@
+package lintcmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeMeasurements(t *testing.T) {
+	in := "SA1000\tfoo\t300\n" +
+		"SA1000\tbar\t100\n" +
+		"S1000\tfoo\t50\n" +
+		"\n" +
+		"ST1000\tbar\t200\n"
+
+	var buf bytes.Buffer
+	if err := summarizeMeasurements(&buf, strings.NewReader(in), 2); err != nil {
+		t.Fatal(err)
+	}
+	want := `Analyzer  Total  Packages  Average
+SA1000    400ns  2         200ns
+ST1000    200ns  1         200ns
+
+Package  Total  Analyzers  Average
+foo      350ns  2          175ns
+bar      300ns  2          150ns
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	if err := summarizeMeasurements(&buf, strings.NewReader("SA1000\tfoo\n"), 2); err == nil {
+		t.Error("expected error for malformed line")
+	}
+}
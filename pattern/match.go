@@ -499,6 +499,14 @@ func (fn Function) Match(m *Matcher, node interface{}) (interface{}, bool) {
 	case *typeparams.IndexListExpr:
 		fun = idx.X
 	}
+	// Like the rest of the matcher, look through parentheses.
+	for {
+		paren, ok := fun.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		fun = paren.X
+	}
 
 	switch fun := fun.(type) {
 	case *ast.Ident:
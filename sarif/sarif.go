@@ -14,6 +14,10 @@ type Run struct {
 	Results     []Result     `json:"results,omitempty"`
 	Invocations []Invocation `json:"invocations,omitempty"`
 	Artifacts   []Artifact   `json:"artifacts,omitempty"`
+	ColumnKind  string       `json:"columnKind,omitempty"`
+	// Maps URI base IDs, such as %SRCROOT%, to the locations they
+	// stand for.
+	OriginalURIBaseIDs map[string]ArtifactLocation `json:"originalUriBaseIds,omitempty"`
 }
 
 type Artifact struct {
@@ -27,6 +31,8 @@ type Artifact struct {
 const (
 	AnalysisTarget = "analysisTarget"
 	UTF8           = "UTF-8"
+	UTF16CodeUnits = "utf16CodeUnits"
+	CodePoints     = "unicodeCodePoints"
 	Fail           = "fail"
 	Warning        = "warning"
 	Error          = "error"
@@ -47,6 +53,15 @@ type Invocation struct {
 	Arguments           []string         `json:"arguments,omitempty"`
 	WorkingDirectory    ArtifactLocation `json:"workingDirectory,omitempty"`
 	ExecutionSuccessful bool             `json:"executionSuccessful"`
+	ExitCode            int              `json:"exitCode"`
+
+	ToolExecutionNotifications []Notification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type Notification struct {
+	Level     string     `json:"level,omitempty"`
+	Message   Message    `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
 }
 
 type ToolComponent struct {
@@ -64,6 +79,7 @@ type ReportingDescriptor struct {
 	Help                 Message                `json:"help"`
 	HelpURI              string                 `json:"helpUri,omitempty"`
 	DefaultConfiguration ReportingConfiguration `json:"defaultConfiguration"`
+	Properties           PropertyBag            `json:"properties,omitempty"`
 }
 
 type ReportingConfiguration struct {
@@ -82,10 +98,19 @@ type Result struct {
 	RelatedLocations []Location    `json:"relatedLocations,omitempty"`
 	Fixes            []Fix         `json:"fixes,omitempty"`
 	Suppressions     []Suppression `json:"suppressions"`
+	// Maps from fingerprint kinds to partial fingerprints, which
+	// identify a result across runs even if it moved.
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+	Properties          PropertyBag       `json:"properties,omitempty"`
 }
 
+// A PropertyBag holds additional properties of an object that aren't
+// described by the SARIF format.
+type PropertyBag map[string]interface{}
+
 type Suppression struct {
 	Kind          string `json:"kind"`
+	Status        string `json:"status,omitempty"`
 	Justification string `json:"justification"`
 }
 
@@ -132,7 +157,7 @@ type ArtifactLocation struct {
 
 type Region struct {
 	StartLine   int `json:"startLine"`
-	StartColumn int `json:"startColumn"`
+	StartColumn int `json:"startColumn,omitempty"`
 	EndLine     int `json:"endLine,omitempty"`
 	EndColumn   int `json:"endColumn,omitempty"`
 }
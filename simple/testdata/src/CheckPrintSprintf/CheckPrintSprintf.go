@@ -16,6 +16,9 @@ func fn() {
 
 	arg := "%d"
 	fmt.Println(fmt.Sprintf(arg, 1))
+
+	var fns []func(string)
+	(fns)[0](fmt.Sprintf("%d", 1))
 }
 
 func Sprintf(string) string { return "" }
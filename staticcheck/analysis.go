@@ -3,16 +3,19 @@ package staticcheck
 import (
 	"honnef.co/go/tools/analysis/facts"
 	"honnef.co/go/tools/analysis/facts/nilness"
+	"honnef.co/go/tools/analysis/facts/taint"
 	"honnef.co/go/tools/analysis/facts/typedness"
 	"honnef.co/go/tools/analysis/lint"
 	"honnef.co/go/tools/internal/passes/buildir"
+	"honnef.co/go/tools/internal/passes/sccp"
+	"honnef.co/go/tools/internal/passes/vrp"
 
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/passes/inspect"
 )
 
 func makeCallCheckerAnalyzer(rules map[string]CallCheck, extraReqs ...*analysis.Analyzer) *analysis.Analyzer {
-	reqs := []*analysis.Analyzer{buildir.Analyzer, facts.TokenFile}
+	reqs := []*analysis.Analyzer{buildir.Analyzer, facts.TokenFile, facts.Purity, sccp.Analyzer}
 	reqs = append(reqs, extraReqs...)
 	return &analysis.Analyzer{
 		Run:      callChecker(rules),
@@ -20,6 +23,13 @@ func makeCallCheckerAnalyzer(rules map[string]CallCheck, extraReqs ...*analysis.
 	}
 }
 
+// makeTypedCallCheckerAnalyzer is like makeCallCheckerAnalyzer, but
+// also checks the calls in instantiations of generic functions. It
+// should be used for rules that depend on the types of arguments.
+func makeTypedCallCheckerAnalyzer(rules map[string]CallCheck, extraReqs ...*analysis.Analyzer) *analysis.Analyzer {
+	return makeCallCheckerAnalyzer(rules, append([]*analysis.Analyzer{buildir.InstancesAnalyzer}, extraReqs...)...)
+}
+
 var Analyzers = lint.InitializeAnalyzers(Docs, map[string]*analysis.Analyzer{
 	"SA1000": makeCallCheckerAnalyzer(checkRegexpRules),
 	"SA1001": {
@@ -27,7 +37,7 @@ var Analyzers = lint.InitializeAnalyzers(Docs, map[string]*analysis.Analyzer{
 		Requires: []*analysis.Analyzer{inspect.Analyzer},
 	},
 	"SA1002": makeCallCheckerAnalyzer(checkTimeParseRules),
-	"SA1003": makeCallCheckerAnalyzer(checkEncodingBinaryRules),
+	"SA1003": makeTypedCallCheckerAnalyzer(checkEncodingBinaryRules),
 	"SA1004": {
 		Run:      CheckTimeSleepConstant,
 		Requires: []*analysis.Analyzer{inspect.Analyzer},
@@ -55,7 +65,7 @@ var Analyzers = lint.InitializeAnalyzers(Docs, map[string]*analysis.Analyzer{
 		Run:      CheckSeeker,
 		Requires: []*analysis.Analyzer{inspect.Analyzer},
 	},
-	"SA1014": makeCallCheckerAnalyzer(checkUnmarshalPointerRules),
+	"SA1014": makeTypedCallCheckerAnalyzer(checkUnmarshalPointerRules),
 	"SA1015": {
 		Run:      CheckLeakyTimeTick,
 		Requires: []*analysis.Analyzer{buildir.Analyzer},
@@ -81,11 +91,15 @@ var Analyzers = lint.InitializeAnalyzers(Docs, map[string]*analysis.Analyzer{
 		Run:      CheckTimerResetReturnValue,
 		Requires: []*analysis.Analyzer{buildir.Analyzer},
 	},
-	"SA1026": makeCallCheckerAnalyzer(checkUnsupportedMarshal),
-	"SA1027": makeCallCheckerAnalyzer(checkAtomicAlignment),
-	"SA1028": makeCallCheckerAnalyzer(checkSortSliceRules),
-	"SA1029": makeCallCheckerAnalyzer(checkWithValueKeyRules),
+	"SA1026": makeTypedCallCheckerAnalyzer(checkUnsupportedMarshal),
+	"SA1027": makeTypedCallCheckerAnalyzer(checkAtomicAlignment),
+	"SA1028": makeTypedCallCheckerAnalyzer(checkSortSliceRules),
+	"SA1029": makeTypedCallCheckerAnalyzer(checkWithValueKeyRules),
 	"SA1030": makeCallCheckerAnalyzer(checkStrconvRules),
+	"SA1031": {
+		Run:      CheckTaintedSink,
+		Requires: []*analysis.Analyzer{taint.Analysis},
+	},
 
 	"SA2000": {
 		Run:      CheckWaitgroupAdd,
@@ -230,6 +244,10 @@ var Analyzers = lint.InitializeAnalyzers(Docs, map[string]*analysis.Analyzer{
 		Run:      CheckAllocationNilCheck,
 		Requires: []*analysis.Analyzer{buildir.Analyzer, inspect.Analyzer, facts.TokenFile},
 	},
+	"SA4032": {
+		Run:      CheckImpossibleComparison,
+		Requires: []*analysis.Analyzer{buildir.Analyzer, vrp.Analyzer, facts.Generated},
+	},
 
 	"SA5000": {
 		Run:      CheckNilMaps,
@@ -277,13 +295,21 @@ var Analyzers = lint.InitializeAnalyzers(Docs, map[string]*analysis.Analyzer{
 		FactTypes: []analysis.Fact{new(evenElements)},
 		Requires:  []*analysis.Analyzer{buildir.Analyzer},
 	},
+	"SA5013": {
+		Run:      CheckIndexOutOfRange,
+		Requires: []*analysis.Analyzer{buildir.Analyzer, vrp.Analyzer},
+	},
+	"SA5014": {
+		Run:      CheckDivisionByZero,
+		Requires: []*analysis.Analyzer{buildir.Analyzer, vrp.Analyzer},
+	},
 
 	"SA6000": makeCallCheckerAnalyzer(checkRegexpMatchLoopRules),
 	"SA6001": {
 		Run:      CheckMapBytesKey,
 		Requires: []*analysis.Analyzer{buildir.Analyzer},
 	},
-	"SA6002": makeCallCheckerAnalyzer(checkSyncPoolValueRules),
+	"SA6002": makeTypedCallCheckerAnalyzer(checkSyncPoolValueRules),
 	"SA6003": {
 		Run:      CheckRangeStringRunes,
 		Requires: []*analysis.Analyzer{buildir.Analyzer},
@@ -310,7 +336,7 @@ var Analyzers = lint.InitializeAnalyzers(Docs, map[string]*analysis.Analyzer{
 		Requires: []*analysis.Analyzer{inspect.Analyzer},
 	},
 	// Filtering generated code because it may include empty structs generated from data models.
-	"SA9005": makeCallCheckerAnalyzer(checkNoopMarshal, facts.Generated),
+	"SA9005": makeTypedCallCheckerAnalyzer(checkNoopMarshal, facts.Generated),
 	"SA9006": {
 		Run:      CheckStaticBitShift,
 		Requires: []*analysis.Analyzer{inspect.Analyzer},
@@ -332,6 +332,27 @@ the various parsing and formatting functions in \'strconv\'.`,
 		MergeIf:  lint.MergeIfAny,
 	},
 
+	"SA1031": {
+		Title: `Untrusted data flows into a sensitive function`,
+		Text: `Data from untrusted sources, such as the parameters of an HTTP
+request, must not be used in SQL queries, file paths or command lines
+without being validated or escaped first. Doing so allows attackers to
+inject SQL, read arbitrary files or run arbitrary commands. In the
+following example, the user controls the query:
+
+    name := r.FormValue("name")
+    db.Query("SELECT * FROM users WHERE name = '" + name + "'")
+
+This check follows untrusted data through assignments, string
+operations and function calls. The sources, sinks and sanitizers it
+knows about can be configured with the \'taint\' table of the
+configuration file.`,
+		Since:      "Unreleased",
+		NonDefault: true,
+		Severity:   lint.SeverityWarning,
+		MergeIf:    lint.MergeIfAny,
+	},
+
 	"SA2000": {
 		Title:    `\'sync.WaitGroup.Add\' called inside the goroutine, leading to a race condition`,
 		Since:    "2017.1",
@@ -787,6 +808,27 @@ or \'1\', it always generates \'0\'.`,
 		MergeIf:  lint.MergeIfAny,
 	},
 
+	"SA4032": {
+		Title: `Comparison that is never true given the possible values of its operands`,
+		Text: `Staticcheck tracks the ranges of values that integers can take on,
+based on constants, arithmetic, and the conditions that have been
+checked on the way to a comparison. When these ranges show that a
+comparison can never be true, the code that depends on it can never
+run. In the following example, the second condition is never true:
+
+    if x >= 0 && x < 10 {
+        if x > 20 {
+            // ...
+        }
+    }
+
+Comparisons that are decided by the types of their operands alone,
+such as \'x < 0\' for unsigned x, are flagged by SA4003 instead.`,
+		Since:    "Unreleased",
+		Severity: lint.SeverityWarning,
+		MergeIf:  lint.MergeIfAll,
+	},
+
 	"SA5000": {
 		Title:    `Assignment to nil map`,
 		Since:    "2017.1",
@@ -981,6 +1023,32 @@ and calling it with an odd number of elements would be an error.`,
 		MergeIf:  lint.MergeIfAny,
 	},
 
+	"SA5013": {
+		Title: `Indexing with an index that is always out of range`,
+		Text: `The index is out of range for every possible value of the index
+and every possible length of the indexed slice, array or string, and
+the index operation will panic at runtime. For example:
+
+    s := make([]int, 3)
+    for i := 0; i <= 3; i++ {
+        if i > 2 {
+            s[i] = 0
+        }
+    }`,
+		Since:    "Unreleased",
+		Severity: lint.SeverityError,
+		MergeIf:  lint.MergeIfAll,
+	},
+
+	"SA5014": {
+		Title: `Integer division by a value that is always zero`,
+		Text: `The compiler rejects division by the constant zero, but not division
+by variables that always hold zero. Such divisions panic at runtime.`,
+		Since:    "Unreleased",
+		Severity: lint.SeverityError,
+		MergeIf:  lint.MergeIfAll,
+	},
+
 	"SA6000": {
 		Title:    `Using \'regexp.Match\' or related in a loop, should use \'regexp.Compile\'`,
 		Since:    "2017.1",
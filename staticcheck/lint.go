@@ -22,14 +22,18 @@ import (
 	"honnef.co/go/tools/analysis/edit"
 	"honnef.co/go/tools/analysis/facts"
 	"honnef.co/go/tools/analysis/facts/nilness"
+	"honnef.co/go/tools/analysis/facts/taint"
 	"honnef.co/go/tools/analysis/facts/typedness"
 	"honnef.co/go/tools/analysis/lint"
 	"honnef.co/go/tools/analysis/report"
 	"honnef.co/go/tools/go/ast/astutil"
 	"honnef.co/go/tools/go/ir"
+	"honnef.co/go/tools/go/ir/interp"
 	"honnef.co/go/tools/go/ir/irutil"
 	"honnef.co/go/tools/go/types/typeutil"
 	"honnef.co/go/tools/internal/passes/buildir"
+	"honnef.co/go/tools/internal/passes/sccp"
+	"honnef.co/go/tools/internal/passes/vrp"
 	"honnef.co/go/tools/internal/sharedcheck"
 	"honnef.co/go/tools/knowledge"
 	"honnef.co/go/tools/pattern"
@@ -341,8 +345,8 @@ var (
 )
 
 func validateIntBase(arg *Argument) {
-	if c := extractConstExpectKind(arg.Value.Value, constant.Int); c != nil {
-		val, _ := constant.Int64Val(c.Value)
+	if c := constExpectKind(arg.Value, constant.Int); c != nil {
+		val, _ := constant.Int64Val(c)
 		if val < 2 {
 			arg.Invalid("'base' must not be smaller than 2")
 		}
@@ -353,8 +357,8 @@ func validateIntBase(arg *Argument) {
 }
 
 func validateIntBaseAllowZero(arg *Argument) {
-	if c := extractConstExpectKind(arg.Value.Value, constant.Int); c != nil {
-		val, _ := constant.Int64Val(c.Value)
+	if c := constExpectKind(arg.Value, constant.Int); c != nil {
+		val, _ := constant.Int64Val(c)
 		if val < 2 && val != 0 {
 			arg.Invalid("'base' must not be smaller than 2, unless it is 0")
 		}
@@ -369,8 +373,8 @@ func validateComplexFormat(arg *Argument) {
 }
 
 func validateFloatFormat(arg *Argument) {
-	if c := extractConstExpectKind(arg.Value.Value, constant.Int); c != nil {
-		val, _ := constant.Int64Val(c.Value)
+	if c := constExpectKind(arg.Value, constant.Int); c != nil {
+		val, _ := constant.Int64Val(c)
 		switch val {
 		case 'b', 'e', 'E', 'f', 'g', 'G', 'x', 'X':
 		default:
@@ -383,8 +387,8 @@ func validateComplexBitSize(arg *Argument) { validateDiscreetBitSize(arg, 64, 12
 func validateFloatBitSize(arg *Argument)   { validateDiscreetBitSize(arg, 32, 64) }
 
 func validateDiscreetBitSize(arg *Argument, size1 int, size2 int) {
-	if c := extractConstExpectKind(arg.Value.Value, constant.Int); c != nil {
-		val, _ := constant.Int64Val(c.Value)
+	if c := constExpectKind(arg.Value, constant.Int); c != nil {
+		val, _ := constant.Int64Val(c)
 		if val != int64(size1) && val != int64(size2) {
 			arg.Invalid(fmt.Sprintf("'bitSize' argument is invalid, must be either %d or %d", size1, size2))
 		}
@@ -392,8 +396,8 @@ func validateDiscreetBitSize(arg *Argument, size1 int, size2 int) {
 }
 
 func validateContinuousBitSize(arg *Argument, min int, max int) {
-	if c := extractConstExpectKind(arg.Value.Value, constant.Int); c != nil {
-		val, _ := constant.Int64Val(c.Value)
+	if c := constExpectKind(arg.Value, constant.Int); c != nil {
+		val, _ := constant.Int64Val(c)
 		if val < int64(min) || val > int64(max) {
 			arg.Invalid(fmt.Sprintf("'bitSize' argument is invalid, must be within %d and %d", min, max))
 		}
@@ -417,7 +421,7 @@ func checkPrintfCall(call *Call, fIdx, vIdx int) {
 		// We don't know what the actual arguments to the function are
 		return
 	}
-	checkPrintfCallImpl(f, f.Value.Value, args)
+	checkPrintfCallImpl(call.Parent, f, f.Value.Value, args)
 }
 
 type verbFlag int
@@ -460,10 +464,10 @@ var verbs = [...]verbFlag{
 	'x': isPseudoPointer | isInt | isFP | isString,
 }
 
-func checkPrintfCallImpl(carg *Argument, f ir.Value, args []ir.Value) {
+func checkPrintfCallImpl(fn *ir.Function, carg *Argument, f ir.Value, args []ir.Value) {
 	var msCache *typeutil.MethodSetCache
-	if f.Parent() != nil {
-		msCache = &f.Parent().Prog.MethodSets
+	if fn != nil {
+		msCache = &fn.Prog.MethodSets
 	}
 
 	elem := func(T types.Type, verb rune) ([]types.Type, bool) {
@@ -3261,7 +3265,61 @@ func callChecker(rules map[string]CallCheck) func(pass *analysis.Pass) (interfac
 	}
 }
 
+// constValue returns the value of v if it is constant, either because
+// it is computed from constants or because it is the result of
+// calling a pure function with constant arguments.
+func constValue(known *sccp.Result, pure facts.PurityResult, v ir.Value) (constant.Value, bool) {
+	if k, ok := v.(*ir.Const); ok {
+		return k.Value, k.Value != nil
+	}
+	if val, ok := known.Const(v); ok {
+		return val, true
+	}
+	call, ok := v.(*ir.Call)
+	if !ok {
+		return nil, false
+	}
+	callee := call.Call.StaticCallee()
+	if callee == nil {
+		return nil, false
+	}
+	if obj, ok := callee.Object().(*types.Func); !ok || pure[obj] == nil {
+		return nil, false
+	}
+	args := make([]constant.Value, len(call.Call.Args))
+	for i, arg := range call.Call.Args {
+		val, ok := constValue(known, pure, arg)
+		if !ok {
+			return nil, false
+		}
+		args[i] = val
+	}
+	return interp.Eval(callee, args)
+}
+
 func checkCalls(pass *analysis.Pass, rules map[string]CallCheck) (interface{}, error) {
+	known := pass.ResultOf[sccp.Analyzer].(*sccp.Result)
+	pure := pass.ResultOf[facts.Purity].(facts.PurityResult)
+
+	// Instantiations of generic functions share their syntax with
+	// the generic function. Only report problems that the generic
+	// function doesn't already have, and say which type arguments
+	// caused them.
+	type reportKey struct {
+		pos token.Pos
+		msg string
+	}
+	seen := map[reportKey]struct{}{}
+	var suffix string
+	reportf := func(node report.Positioner, msg string) {
+		key := reportKey{node.Pos(), msg}
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		report.Report(pass, node, msg+suffix)
+	}
+
 	cb := func(caller *ir.Function, site ir.CallInstruction, callee *ir.Function) {
 		obj, ok := callee.Object().(*types.Func)
 		if !ok {
@@ -3281,7 +3339,15 @@ func checkCalls(pass *analysis.Pass, rules map[string]CallCheck) (interface{}, e
 			if iarg, ok := arg.(*ir.MakeInterface); ok {
 				arg = iarg.X
 			}
-			args = append(args, &Argument{Value: Value{arg}})
+			v := Value{Value: arg}
+			if _, ok := arg.Type().Underlying().(*types.Basic); ok {
+				// Validate values that are computed from constants
+				// at runtime as if they were constants.
+				if val, ok := constValue(known, pure, arg); ok {
+					v.Const = val
+				}
+			}
+			args = append(args, &Argument{Value: v})
 		}
 		call := &Call{
 			Pass:   pass,
@@ -3311,30 +3377,59 @@ func checkCalls(pass *analysis.Pass, rules map[string]CallCheck) (interface{}, e
 			for _, e := range arg.invalids {
 				if astcall != nil {
 					if idx < len(astcall.Args) {
-						report.Report(pass, astcall.Args[idx], e)
+						reportf(astcall.Args[idx], e)
 					} else {
 						// this is an instance of fn1(fn2()) where fn2
 						// returns multiple values. Report the error
 						// at the next-best position that we have, the
 						// first argument. An example of a check that
 						// triggers this is checkEncodingBinaryRules.
-						report.Report(pass, astcall.Args[0], e)
+						reportf(astcall.Args[0], e)
 					}
 				} else {
-					report.Report(pass, site, e)
+					reportf(site, e)
 				}
 			}
 		}
 		for _, e := range call.invalids {
-			report.Report(pass, call.Instr, e)
+			reportf(call.Instr, e)
 		}
 	}
 	for _, fn := range pass.ResultOf[buildir.Analyzer].(*buildir.IR).SrcFuncs {
 		eachCall(fn, cb)
 	}
+	if res, ok := pass.ResultOf[buildir.InstancesAnalyzer].(*buildir.IR); ok {
+		for _, fn := range res.Instances {
+			suffix = fmt.Sprintf(" (instantiated with %s)", describeInstantiation(pass, fn))
+			eachCall(fn, cb)
+		}
+	}
 	return nil, nil
 }
 
+// describeInstantiation describes the type arguments of fn, an
+// instantiation of a generic function or a function literal therein,
+// as in "T = int, U = string".
+func describeInstantiation(pass *analysis.Pass, fn *ir.Function) string {
+	for fn.Origin() == nil && fn.Parent() != nil {
+		fn = fn.Parent()
+	}
+	origin := fn.Origin()
+	if origin == nil {
+		return ""
+	}
+	tparams := typeparams.ForSignature(origin.Signature)
+	if origin.Signature.Recv() != nil {
+		tparams = typeparams.RecvTypeParams(origin.Signature)
+	}
+	qf := types.RelativeTo(pass.Pkg)
+	var parts []string
+	for i, targ := range fn.TypeArgs() {
+		parts = append(parts, fmt.Sprintf("%s = %s", tparams.At(i).Obj().Name(), types.TypeString(targ, qf)))
+	}
+	return strings.Join(parts, ", ")
+}
+
 func shortCallName(call *ir.CallCommon) string {
 	if call.IsInvoke() {
 		return ""
@@ -4719,7 +4814,9 @@ fnLoop:
 			continue
 		}
 
-		reads := map[int][]ir.Instruction{}
+		numFields := recv.Type().Underlying().(*types.Struct).NumFields()
+		// reads maps instructions to the fields they read
+		reads := map[ir.Instruction][]int{}
 		writes := map[int][]ir.Instruction{}
 		for _, ref := range *alloc.Referrers() {
 			switch ref := ref.(type) {
@@ -4729,7 +4826,7 @@ fnLoop:
 					case *ir.Store:
 						writes[ref.Field] = append(writes[ref.Field], refref)
 					case *ir.Load:
-						reads[ref.Field] = append(reads[ref.Field], refref)
+						reads[refref] = append(reads[refref], ref.Field)
 					case *ir.DebugRef:
 						continue
 					default:
@@ -4751,8 +4848,8 @@ fnLoop:
 				}
 			case *ir.Load:
 				// a load of the entire struct loads every field
-				for i := 0; i < recv.Type().Underlying().(*types.Struct).NumFields(); i++ {
-					reads[i] = append(reads[i], ref)
+				for i := 0; i < numFields; i++ {
+					reads[ref] = append(reads[ref], i)
 				}
 			case *ir.DebugRef:
 				continue
@@ -4760,30 +4857,31 @@ fnLoop:
 				continue fnLoop
 			}
 		}
+		if len(writes) == 0 {
+			continue
+		}
 
-		offset := func(instr ir.Instruction) int {
-			for i, other := range instr.Block().Instrs {
-				if instr == other {
-					return i
+		// Compute the set of fields that may be read after each
+		// instruction. Writes don't kill reads, as we don't want to
+		// flag 'a.x = 1; a.x = 2; _ = a.x'.
+		res := irutil.SolveDataflow(fn, &irutil.DataflowProblem{
+			Direction: irutil.Backward,
+			Lattice:   fieldSetLattice{},
+			Boundary:  fieldSet(nil),
+			Transfer: func(instr ir.Instruction, state interface{}) interface{} {
+				fields, ok := reads[instr]
+				if !ok {
+					return state
 				}
-			}
-			panic("couldn't find instruction in its block")
-		}
+				return state.(fieldSet).with(fields...)
+			},
+		})
 
 		for field, ws := range writes {
-			rs := reads[field]
-		wLoop:
 			for _, w := range ws {
-				for _, r := range rs {
-					if w.Block() == r.Block() {
-						if offset(r) > offset(w) {
-							// found a reachable read of our write
-							continue wLoop
-						}
-					} else if irutil.Reachable(w.Block(), r.Block()) {
-						// found a reachable read of our write
-						continue wLoop
-					}
+				if res.After(w).(fieldSet).has(field) {
+					// found a reachable read of our write
+					continue
 				}
 				fieldName := recv.Type().Underlying().(*types.Struct).Field(field).Name()
 				report.Report(pass, w, fmt.Sprintf("ineffective assignment to field %s.%s", recv.Type().(*types.Named).Obj().Name(), fieldName))
@@ -4793,6 +4891,67 @@ fnLoop:
 	return nil, nil
 }
 
+// fieldSet is an immutable set of struct field indices.
+type fieldSet []bool
+
+func (s fieldSet) has(field int) bool {
+	return field < len(s) && s[field]
+}
+
+// with returns the union of s and fields.
+func (s fieldSet) with(fields ...int) fieldSet {
+	var out fieldSet
+	for _, f := range fields {
+		if s.has(f) {
+			continue
+		}
+		if out == nil {
+			n := len(s)
+			for _, f := range fields {
+				if f >= n {
+					n = f + 1
+				}
+			}
+			out = make(fieldSet, n)
+			copy(out, s)
+		}
+		out[f] = true
+	}
+	if out == nil {
+		return s
+	}
+	return out
+}
+
+// fieldSetLattice is the lattice of fieldSets, ordered by inclusion.
+type fieldSetLattice struct{}
+
+func (fieldSetLattice) Bottom() interface{} { return fieldSet(nil) }
+
+func (fieldSetLattice) Join(a, b interface{}) interface{} {
+	x, y := a.(fieldSet), b.(fieldSet)
+	var fields []int
+	for f, ok := range y {
+		if ok {
+			fields = append(fields, f)
+		}
+	}
+	return x.with(fields...)
+}
+
+func (fieldSetLattice) Equal(a, b interface{}) bool {
+	x, y := a.(fieldSet), b.(fieldSet)
+	if len(x) < len(y) {
+		x, y = y, x
+	}
+	for f, ok := range x {
+		if ok != y.has(f) {
+			return false
+		}
+	}
+	return true
+}
+
 var negativeZeroFloatQ = pattern.MustParse(`
 	(Or
 		(UnaryExpr
@@ -5214,3 +5373,134 @@ func CheckAllocationNilCheck(pass *analysis.Pass) (interface{}, error) {
 	code.Preorder(pass, fn, (*ast.IfStmt)(nil))
 	return nil, nil
 }
+
+func CheckImpossibleComparison(pass *analysis.Pass) (interface{}, error) {
+	ranges := pass.ResultOf[vrp.Analyzer].(*vrp.Ranges)
+	// narrowed reports whether we know more about v than its type
+	// does. Comparisons that are decided by types alone are flagged
+	// by SA4003.
+	narrowed := func(v ir.Value) bool {
+		if _, ok := v.(*ir.Const); ok {
+			return false
+		}
+		i, _ := ranges.Get(v)
+		typ, _ := vrp.TypeInterval(v.Type())
+		return !i.Equal(typ)
+	}
+	for _, fn := range pass.ResultOf[buildir.Analyzer].(*buildir.IR).SrcFuncs {
+		for _, b := range fn.Blocks {
+			if ranges.Dead(b) {
+				continue
+			}
+			for _, instr := range b.Instrs {
+				binop, ok := instr.(*ir.BinOp)
+				if !ok || binop.Pos() == token.NoPos {
+					continue
+				}
+				if !narrowed(binop.X) && !narrowed(binop.Y) {
+					continue
+				}
+				x, _ := ranges.Get(binop.X)
+				y, _ := ranges.Get(binop.Y)
+				_, ok1 := x.Const()
+				_, ok2 := y.Const()
+				if ok1 && ok2 {
+					// Comparisons of values that are known exactly
+					// usually involve constants that differ between
+					// build configurations.
+					continue
+				}
+				// Comparisons that are always true are frequently
+				// written on purpose, for clarity or as assertions.
+				if outcome, ok := ranges.Decide(binop); ok && !outcome {
+					report.Report(pass, binop,
+						fmt.Sprintf("comparison is never true, because the operands are in the ranges %s and %s", x, y),
+						report.FilterGenerated())
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+func CheckIndexOutOfRange(pass *analysis.Pass) (interface{}, error) {
+	ranges := pass.ResultOf[vrp.Analyzer].(*vrp.Ranges)
+	for _, fn := range pass.ResultOf[buildir.Analyzer].(*buildir.IR).SrcFuncs {
+		for _, b := range fn.Blocks {
+			if ranges.Dead(b) {
+				continue
+			}
+			for _, instr := range b.Instrs {
+				var x, index ir.Value
+				switch instr := instr.(type) {
+				case *ir.IndexAddr:
+					x, index = instr.X, instr.Index
+				case *ir.Index:
+					x, index = instr.X, instr.Index
+				case *ir.StringLookup:
+					x, index = instr.X, instr.Index
+				default:
+					continue
+				}
+				if instr.Pos() == token.NoPos {
+					continue
+				}
+				idx, ok := ranges.Get(index)
+				if !ok || idx.Empty() {
+					continue
+				}
+				n := ranges.Len(x)
+				if n.Empty() {
+					continue
+				}
+				if idx.Upper.Sign() < 0 {
+					report.Report(pass, instr, fmt.Sprintf("index is always negative, it is in the range %s", idx))
+				} else if idx.Lower.Cmp(n.Upper) >= 0 {
+					report.Report(pass, instr, fmt.Sprintf("index out of range: index is in the range %s, but the length is in the range %s", idx, n))
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+func CheckDivisionByZero(pass *analysis.Pass) (interface{}, error) {
+	ranges := pass.ResultOf[vrp.Analyzer].(*vrp.Ranges)
+	for _, fn := range pass.ResultOf[buildir.Analyzer].(*buildir.IR).SrcFuncs {
+		for _, b := range fn.Blocks {
+			if ranges.Dead(b) {
+				continue
+			}
+			for _, instr := range b.Instrs {
+				binop, ok := instr.(*ir.BinOp)
+				if !ok || (binop.Op != token.QUO && binop.Op != token.REM) || binop.Pos() == token.NoPos {
+					continue
+				}
+				y, ok := ranges.Get(binop.Y)
+				if !ok {
+					// Not an integer division
+					continue
+				}
+				if c, ok := y.Const(); ok && c.Sign() == 0 {
+					report.Report(pass, binop, "integer division by zero")
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+func CheckTaintedSink(pass *analysis.Pass) (interface{}, error) {
+	for _, flow := range pass.ResultOf[taint.Analysis].(*taint.Result).Flows {
+		var node report.Positioner = flow.Call
+		if call, ok := flow.Call.Source().(*ast.CallExpr); ok && flow.Arg >= 0 && flow.Arg < len(call.Args) {
+			node = call.Args[flow.Arg]
+		}
+		var related []report.Option
+		for _, step := range flow.Path {
+			related = append(related, report.Related(step.Instr, step.Message))
+		}
+		report.Report(pass, node, fmt.Sprintf("data from %s flows into %s", flow.Source, flow.Sink), related...)
+	}
+	return nil, nil
+}
@@ -45,6 +45,7 @@ func TestAll(t *testing.T) {
 			{Dir: "CheckStrconv"},
 			{Dir: "CheckStrconv_go115", Version: "1.15"},
 		},
+		"SA1031": {{Dir: "CheckTaintedSink"}},
 		"SA2000": {{Dir: "CheckWaitgroupAdd"}},
 		"SA2001": {{Dir: "CheckEmptyCriticalSection"}},
 		"SA2002": {{Dir: "CheckConcurrentTesting"}},
@@ -97,6 +98,7 @@ func TestAll(t *testing.T) {
 		"SA4029": {{Dir: "CheckIneffectiveSort"}},
 		"SA4030": {{Dir: "CheckIneffectiveRandInt"}},
 		"SA4031": {{Dir: "CheckAllocationNilCheck"}},
+		"SA4032": {{Dir: "CheckImpossibleComparison"}},
 		"SA5000": {{Dir: "CheckNilMaps"}},
 		"SA5001": {{Dir: "CheckEarlyDefer"}},
 		"SA5002": {{Dir: "CheckInfiniteEmptyLoop"}},
@@ -109,6 +111,8 @@ func TestAll(t *testing.T) {
 		"SA5010": {{Dir: "CheckImpossibleTypeAssertion"}},
 		"SA5011": {{Dir: "CheckMaybeNil"}},
 		"SA5012": {{Dir: "CheckEvenSliceLength"}},
+		"SA5013": {{Dir: "CheckIndexOutOfRange"}},
+		"SA5014": {{Dir: "CheckDivisionByZero"}},
 		"SA6000": {{Dir: "CheckRegexpMatchLoop"}},
 		"SA6001": {{Dir: "CheckMapBytesKey"}},
 		"SA6002": {{Dir: "CheckSyncPoolValue"}},
@@ -48,6 +48,10 @@ type Argument struct {
 
 type Value struct {
 	Value ir.Value
+	// Const is the value of Value if it is known to be constant,
+	// either because it is a constant or because it is computed from
+	// constants at runtime. It is nil otherwise.
+	Const constant.Value
 }
 
 func (arg *Argument) Invalid(msg string) {
@@ -64,6 +68,22 @@ func extractConstExpectKind(v ir.Value, kind constant.Kind) *ir.Const {
 	return k
 }
 
+// constExpectKind returns the constant value of v if it is of the
+// given kind, including values that are computed from constants at
+// runtime.
+func constExpectKind(v Value, kind constant.Kind) constant.Value {
+	if v.Const != nil {
+		if v.Const.Kind() != kind {
+			return nil
+		}
+		return v.Const
+	}
+	if k := extractConstExpectKind(v.Value, kind); k != nil {
+		return k.Value
+	}
+	return nil
+}
+
 func extractConst(v ir.Value) *ir.Const {
 	v = irutil.Flatten(v)
 	switch v := v.(type) {
@@ -77,8 +97,8 @@ func extractConst(v ir.Value) *ir.Const {
 }
 
 func ValidateRegexp(v Value) error {
-	if c := extractConstExpectKind(v.Value, constant.String); c != nil {
-		s := constant.StringVal(c.Value)
+	if c := constExpectKind(v, constant.String); c != nil {
+		s := constant.StringVal(c)
 		if _, err := regexp.Compile(s); err != nil {
 			return err
 		}
@@ -87,8 +107,8 @@ func ValidateRegexp(v Value) error {
 }
 
 func ValidateTimeLayout(v Value) error {
-	if c := extractConstExpectKind(v.Value, constant.String); c != nil {
-		s := constant.StringVal(c.Value)
+	if c := constExpectKind(v, constant.String); c != nil {
+		s := constant.StringVal(c)
 		s = strings.Replace(s, "_", " ", -1)
 		s = strings.Replace(s, "Z", "-", -1)
 		_, err := time.Parse(s, s)
@@ -100,8 +120,8 @@ func ValidateTimeLayout(v Value) error {
 }
 
 func ValidateURL(v Value) error {
-	if c := extractConstExpectKind(v.Value, constant.String); c != nil {
-		s := constant.StringVal(c.Value)
+	if c := constExpectKind(v, constant.String); c != nil {
+		s := constant.StringVal(c)
 		_, err := url.Parse(s)
 		if err != nil {
 			return fmt.Errorf("%q is not a valid URL: %s", s, err)
@@ -111,8 +131,8 @@ func ValidateURL(v Value) error {
 }
 
 func InvalidUTF8(v Value) bool {
-	if c := extractConstExpectKind(v.Value, constant.String); c != nil {
-		s := constant.StringVal(c.Value)
+	if c := constExpectKind(v, constant.String); c != nil {
+		s := constant.StringVal(c)
 		if !utf8.ValidString(s) {
 			return true
 		}
@@ -212,8 +232,8 @@ func CanBinaryMarshal(pass *analysis.Pass, v Value) bool {
 func RepeatZeroTimes(name string, arg int) CallCheck {
 	return func(call *Call) {
 		arg := call.Args[arg]
-		if k, ok := arg.Value.Value.(*ir.Const); ok && k.Value.Kind() == constant.Int {
-			if v, ok := constant.Int64Val(k.Value); ok && v == 0 {
+		if k := constExpectKind(arg.Value, constant.Int); k != nil {
+			if v, ok := constant.Int64Val(k); ok && v == 0 {
 				arg.Invalid(fmt.Sprintf("calling %s with n == 0 will return no results, did you mean -1?", name))
 			}
 		}
@@ -253,8 +273,8 @@ func validatePort(s string) bool {
 }
 
 func ValidHostPort(v Value) bool {
-	if k := extractConstExpectKind(v.Value, constant.String); k != nil {
-		s := constant.StringVal(k.Value)
+	if k := constExpectKind(v, constant.String); k != nil {
+		s := constant.StringVal(k)
 		if s == "" {
 			return true
 		}
@@ -277,8 +297,8 @@ func ConvertedFrom(v Value, typ string) bool {
 }
 
 func UniqueStringCutset(v Value) bool {
-	if c := extractConstExpectKind(v.Value, constant.String); c != nil {
-		s := constant.StringVal(c.Value)
+	if c := constExpectKind(v, constant.String); c != nil {
+		s := constant.StringVal(c)
 		rs := runeSlice(s)
 		if len(rs) < 2 {
 			return true
@@ -0,0 +1,28 @@
+package pkg
+
+func fn1(x int, b bool) {
+	d := 0
+	_ = x / d // want `integer division by zero`
+	_ = x % d // want `integer division by zero`
+
+	if b {
+		d = 1
+	}
+	_ = x / d
+}
+
+func fn2(x, y int) {
+	if y == 0 {
+		_ = x / y // want `integer division by zero`
+		return
+	}
+	_ = x / y
+}
+
+func fn3(x uint, y float64) {
+	if x < 1 {
+		_ = 10 / x // want `integer division by zero`
+	}
+	z := 0.0
+	_ = y / z
+}
@@ -0,0 +1,96 @@
+package pkg
+
+func fn1(x int) {
+	if x >= 0 && x < 10 {
+		if x > 9 { // want `comparison is never true`
+		}
+		if x < 0 { // want `comparison is never true`
+		}
+		if x < 100 {
+			// Conditions that are always true are often written on purpose
+		}
+		if x < 9 {
+		}
+	}
+}
+
+func fn2(b byte) {
+	if int(b) > 300 { // want `comparison is never true, because the operands are in the ranges \[0, 255\] and \[300, 300\]`
+	}
+	if int(b) >= 255 {
+	}
+}
+
+func fn3() {
+	for i := 0; i < 10; i++ {
+		if i == 10 { // want `comparison is never true`
+		}
+		if i == 9 {
+		}
+	}
+}
+
+func fn4(x uint) {
+	// Flagged by SA4003, not us
+	if x < 0 {
+	}
+
+	const debug = 0
+	if debug > 1 {
+	}
+
+	level := 0
+	if level > 1 {
+		// Values that are known exactly often depend on the build configuration
+	}
+}
+
+func fn5(x uint8) {
+	if x > 5 {
+		return
+	}
+	y := int(x) * 2
+	if y > 10 { // want `comparison is never true`
+	}
+}
+
+func fn6(x int) {
+	if x > 5 {
+		return
+	}
+	y := x * 2
+	// y may have overflowed
+	if y > 10 {
+	}
+}
+
+func fn7(x, y int) {
+	if x < y && y < 5 {
+		if x >= 5 {
+			// We don't track relations between variables
+		}
+	}
+}
+
+func fn8(x int) {
+	if x < 0 {
+		if x > 0 { // want `comparison is never true`
+			// Code in branches that can't execute isn't flagged
+			if x == 5 {
+			}
+		}
+	}
+}
+
+func fn9(x int64, y uint32) {
+	if x < 0 {
+		return
+	}
+	// The size of int depends on the platform
+	if int(x) < 0 {
+	}
+	if int(y) < 0 {
+	}
+	if int64(y) < 0 { // want `comparison is never true`
+	}
+}
@@ -0,0 +1,51 @@
+package pkg
+
+func fn1() {
+	s := make([]int, 3)
+	for i := 0; i <= 3; i++ {
+		if i > 2 {
+			s[i] = 0 // want `index out of range: index is in the range \[3, 3\], but the length is in the range \[3, 3\]`
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		s[i] = 0
+	}
+	for i := range s {
+		s[i] = 0
+	}
+}
+
+func fn2(arr [4]int, b bool) int {
+	i := 4
+	if b {
+		i = 5
+	}
+	return arr[i] // want `index out of range: index is in the range \[4, 5\]`
+}
+
+func fn3(s []int, b bool) {
+	t := s[:2]
+	idx := 2
+	if b {
+		idx = 1
+	}
+	_ = t[idx]
+	_ = t[2] // want `index out of range`
+	u := t[1:]
+	_ = u[1] // want `index out of range`
+}
+
+func fn4(x uint8) {
+	str := "hello"
+	_ = str[x]
+	n := -int(x) - 1
+	_ = str[n] // want `index is always negative, it is in the range \[-256, -1\]`
+}
+
+func fn5(b []byte) {
+	if len(b) > 3 {
+		// We don't learn from the lengths of slices being checked
+		_ = b[3]
+	}
+}
@@ -106,3 +106,18 @@ func (v T3) fn1() {
 	// embedding)
 	v.x = 1
 }
+
+func (v T1) fn16() {
+	for i := 0; i < 10; i++ {
+		println(v.x)
+		// read by the next iteration
+		v.x = i
+	}
+}
+
+func (v T1) fn17() {
+	for i := 0; i < 10; i++ {
+		println(v.y)
+		v.x = i // want `ineffective assignment to field T1.x`
+	}
+}
@@ -44,3 +44,38 @@ var _ = regexp.MustCompile("(") // want `error parsing regexp`
 func fn2() {
 	regexp.MustCompile("foo(").FindAll(nil, 0) // want `error parsing regexp`
 }
+
+func fn3(b bool) {
+	sep := ","
+	pattern := "[" + sep
+	regexp.MustCompile(pattern) // want `error parsing regexp`
+
+	verbose := false
+	pattern2 := "a"
+	if verbose {
+		pattern2 = "(" + pattern2 + ")"
+	}
+	regexp.MustCompile(pattern2 + "(") // want `error parsing regexp`
+
+	pattern3 := "a"
+	if b {
+		// The pattern isn't constant anymore
+		pattern3 = "("
+	}
+	regexp.MustCompile(pattern3)
+}
+
+func group(s string) string { return "(" + s }
+
+func quantified(s string, n int) string {
+	for i := 0; i < n; i++ {
+		s += "a"
+	}
+	return s + "**"
+}
+
+func fn4() {
+	regexp.MustCompile(group("a"))         // want `error parsing regexp`
+	regexp.MustCompile(quantified("x", 3)) // want `error parsing regexp`
+	regexp.MustCompile(group("a") + ")")
+}
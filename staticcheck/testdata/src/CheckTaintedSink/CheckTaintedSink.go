@@ -0,0 +1,62 @@
+package pkg
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+func lookup(db *sql.DB, name string) {
+	db.Query("SELECT * FROM users WHERE name = '" + name + "'")
+}
+
+func query(name string) string {
+	return fmt.Sprintf("SELECT * FROM users WHERE name = '%s'", name)
+}
+
+func fn1(db *sql.DB, r *http.Request) {
+	name := r.FormValue("name")
+	db.Query("SELECT * FROM users WHERE name = '" + name + "'") // want `data from \(\*net/http.Request\).FormValue flows into \(\*database/sql.DB\).Query.query`
+	db.Query(query(name))                                       // want `data from \(\*net/http.Request\).FormValue flows into \(\*database/sql.DB\).Query.query`
+	lookup(db, name)                                            // want `data from \(\*net/http.Request\).FormValue flows into \(\*database/sql.DB\).Query.query`
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	db.Query(fmt.Sprintf("SELECT * FROM users WHERE id = %d", id))
+	db.Query("SELECT * FROM users WHERE name = ?", name)
+}
+
+func fn2(r *http.Request) {
+	exec.Command(r.URL.Query().Get("cmd"))          // want `data from \(net/url.Values\).Get flows into os/exec.Command.name`
+	exec.Command("ls", "-l", r.Header.Get("X-Dir")) // want `data from \(net/http.Header\).Get flows into os/exec.Command.arg`
+	exec.Command("ls")
+}
+
+func file(r *http.Request) string {
+	return "/var/www/" + r.FormValue("file")
+}
+
+func fn3(r *http.Request) {
+	os.Open(file(r)) // want `data from \(\*net/http.Request\).FormValue flows into os.Open.name`
+	os.Open(filepath.Join("/var/www", filepath.Base(file(r))))
+	var paths []string
+	paths = append(paths, r.FormValue("file"))
+	os.Open(paths[0]) // want `data from \(\*net/http.Request\).FormValue flows into os.Open.name`
+}
+
+func fn4(r *http.Request) {
+	name := r.FormValue("file")
+	go func() { // want `data from \(\*net/http.Request\).FormValue flows into os.Remove.name`
+		os.Remove(name)
+	}()
+	defer func() { // want `data from \(\*net/http.Request\).FormValue flows into os.Remove.name`
+		os.Remove(name)
+	}()
+	fn := func() {
+		os.Remove("/tmp/file")
+	}
+	fn()
+}
@@ -12,3 +12,15 @@ func fn() {
 	time.Parse(time.RFC3339Nano, "")
 	time.Parse(time.Kitchen, "")
 }
+
+func layout(date bool) string {
+	if date {
+		return "2006-01-02"
+	}
+	return "12345"
+}
+
+func fn2() {
+	time.Parse(layout(true), "")
+	time.Parse(layout(false), "") // want `parsing time`
+}
@@ -0,0 +1,31 @@
+//go:build go1.18
+
+package pkg
+
+import "encoding/json"
+
+func marshal[T any](x T) {
+	json.Marshal(x) // want `unsupported type chan int, via x\.Ch \(instantiated with T = T3\)` `unsupported type func\(\) \(instantiated with T = func\(\)\)`
+}
+
+type box[T any] struct{ v T }
+
+func (b box[T]) marshal() {
+	json.Marshal(b.v) // want `unsupported type chan bool \(instantiated with T = chan bool\)`
+}
+
+func marshalClosure[T any](x T) func() {
+	return func() {
+		json.Marshal(x) // want `unsupported type chan string \(instantiated with T = chan string\)`
+	}
+}
+
+func fn11() {
+	marshal(1)
+	marshal("")
+	marshal(T3{})
+	marshal(func() {})
+	box[int]{}.marshal()
+	box[chan bool]{}.marshal()
+	marshalClosure(make(chan string))
+}
@@ -1331,6 +1331,11 @@ func (g *graph) function(fn *ir.Function) {
 
 	// (4.1) functions use all their arguments, return parameters and receivers
 	g.signature(fn.Signature, owningObject(fn))
+	for _, targ := range fn.TypeArgs() {
+		// Instantiations of generic functions use their type
+		// arguments, the same way calls of generic functions do.
+		g.seeAndUse(targ, owningObject(fn), edgeTypeArg)
+	}
 	g.instructions(fn)
 	for _, anon := range fn.AnonFuncs {
 		// (4.2) functions use anonymous functions defined beneath them